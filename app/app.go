@@ -2,17 +2,24 @@ package app
 
 import (
 	"embed"
+	"time"
+
+	"fail2ban-web/config"
 
 	"go.uber.org/fx"
 )
 
+// stopTimeout 停止应用的总超时：先等待 HTTP 请求完成（最长 server.shutdown_timeout），
+// 再等待后台服务退出和关闭数据库
+const stopTimeout = config.MaxShutdownTimeout + 30*time.Second
+
 // NewStaticFiles 提供静态文件
 func NewStaticFiles(files embed.FS) embed.FS {
 	return files
 }
 
-// NewApp 创建 fx 应用
-func NewApp(staticFiles embed.FS) *fx.App {
+// NewApp 创建 fx 应用，configPath为空时只使用环境变量配置
+func NewApp(staticFiles embed.FS, configPath string) *fx.App {
 	return fx.New(
 		// 提供静态文件
 		fx.Provide(
@@ -22,6 +29,14 @@ func NewApp(staticFiles embed.FS) *fx.App {
 			),
 		),
 
+		// 配置文件路径
+		fx.Provide(
+			fx.Annotate(
+				func() string { return configPath },
+				fx.ResultTags(`name:"configPath"`),
+			),
+		),
+
 		// 核心模块
 		ConfigModule,
 		LoggerModule,
@@ -34,5 +49,7 @@ func NewApp(staticFiles embed.FS) *fx.App {
 
 		// 启动 HTTP 服务器
 		fx.Invoke(RegisterServer),
+
+		fx.StopTimeout(stopTimeout),
 	)
 }
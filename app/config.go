@@ -4,14 +4,37 @@ import (
 	"fail2ban-web/config"
 
 	"go.uber.org/fx"
+	"go.uber.org/zap"
 )
 
-// NewConfig 创建配置
-func NewConfig() *config.Config {
-	return config.LoadConfig()
+// ConfigParams 配置依赖参数
+type ConfigParams struct {
+	fx.In
+	Path string `name:"configPath"`
+}
+
+// NewConfig 创建配置：默认值 < 配置文件 < 环境变量
+func NewConfig(params ConfigParams) (*config.Config, error) {
+	return config.Load(params.Path)
+}
+
+// LogConfig 启动时打印生效的配置，密码和密钥已隐藏
+func LogConfig(cfg *config.Config, logger *zap.Logger) error {
+	values, err := cfg.Redacted().ToMap()
+	if err != nil {
+		return err
+	}
+
+	file := cfg.File
+	if file == "" {
+		file = "(environment only)"
+	}
+	logger.Info("Effective configuration", zap.String("file", file), zap.Any("config", values))
+	return nil
 }
 
 // ConfigModule 配置模块
 var ConfigModule = fx.Module("config",
 	fx.Provide(NewConfig),
+	fx.Invoke(LogConfig),
 )
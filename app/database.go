@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"fail2ban-web/config"
 	"fail2ban-web/internal/model"
 
 	"go.uber.org/fx"
@@ -14,6 +15,7 @@ import (
 // DatabaseParams 数据库依赖参数
 type DatabaseParams struct {
 	fx.In
+	Config *config.Config
 	Logger *zap.Logger
 }
 
@@ -23,14 +25,14 @@ func NewDatabase(lc fx.Lifecycle, params DatabaseParams) (*gorm.DB, error) {
 	gormLogger := logger.Default.LogMode(logger.Info)
 
 	// 打开数据库连接
-	db, err := gorm.Open(sqlite.Open("fail2ban_web.db"), &gorm.Config{
+	db, err := gorm.Open(sqlite.Open(params.Config.Database.Path), &gorm.Config{
 		Logger: gormLogger,
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	params.Logger.Info("Database connection established")
+	params.Logger.Info("Database connection established", zap.String("path", params.Config.Database.Path))
 
 	// 添加生命周期钩子
 	lc.Append(fx.Hook{
@@ -40,6 +42,18 @@ func NewDatabase(lc fx.Lifecycle, params DatabaseParams) (*gorm.DB, error) {
 			if err := db.AutoMigrate(
 				&model.BannedIP{},
 				&model.Fail2banJail{},
+				&model.ScanDecision{},
+				&model.BacktestRun{},
+				&model.AnalysisJob{},
+				&model.BanEvent{},
+				&model.LogIngestState{},
+				&model.GeoPolicy{},
+				&model.WhitelistEntry{},
+				&model.WhitelistIgnoreIP{},
+				&model.IPList{},
+				&model.WebhookEndpoint{},
+				&model.WebhookDelivery{},
+				&model.EmailReport{},
 			); err != nil {
 				return err
 			}
@@ -20,6 +20,23 @@ type HandlerParams struct {
 	DefaultNginxService          *service.DefaultNginxService
 	DefaultNginxAdvancedService  *service.DefaultNginxAdvancedService
 	IntelligentService           *service.IntelligentScanService
+	BacktestService              *service.BacktestService
+	JobService                   *service.JobService
+	LogSourceService             *service.LogSourceService
+	BanEventService              *service.BanEventService
+	IPDossierService             *service.IPDossierService
+	GeoService                   *service.GeoService
+	GeoPolicyService             *service.GeoPolicyService
+	WhitelistService             *service.WhitelistService
+	IPListService                *service.IPListService
+	BanLifecycleService          *service.BanLifecycleService
+	BulkBanService               *service.BulkBanService
+	EventBus                     *service.EventBus
+	Metrics                      *service.Metrics
+	HealthService                *service.HealthService
+	WebhookService               *service.WebhookService
+	EmailReportService           *service.EmailReportService
+	ConfigReloadService          *service.ConfigReloadService
 }
 
 // HandlerResult Handler 输出
@@ -32,18 +49,52 @@ type HandlerResult struct {
 	SSHHandler           *handler.SSHHandler
 	NginxHandler         *handler.NginxHandler
 	IntelligentHandler   *handler.IntelligentHandler
+	BacktestHandler      *handler.BacktestHandler
+	JobHandler           *handler.JobHandler
+	LogHandler           *handler.LogHandler
+	BanEventHandler      *handler.BanEventHandler
+	IPHandler            *handler.IPHandler
+	GeoHandler           *handler.GeoHandler
+	GeoPolicyHandler     *handler.GeoPolicyHandler
+	WhitelistHandler     *handler.WhitelistHandler
+	IPListHandler        *handler.IPListHandler
+	BanLifecycleHandler  *handler.BanLifecycleHandler
+	BulkBanHandler       *handler.BulkBanHandler
+	EventHandler         *handler.EventHandler
+	WebhookHandler       *handler.WebhookHandler
+	EmailReportHandler   *handler.EmailReportHandler
+	MetricsHandler       *handler.MetricsHandler
+	HealthHandler        *handler.HealthHandler
+	AppConfigHandler     *handler.AppConfigHandler
 }
 
 // NewHandlers 创建所有 handlers
 func NewHandlers(params HandlerParams) HandlerResult {
 	return HandlerResult{
 		AuthHandler:          handler.NewAuthHandler(params.Config),
-		Fail2banHandler:      handler.NewFail2BanHandler(params.Fail2banService),
+		Fail2banHandler:      handler.NewFail2BanHandler(params.Fail2banService, params.WhitelistService, params.BanLifecycleService),
 		JailHandler:          handler.NewJailHandler(params.JailService),
 		DefaultConfigHandler: handler.NewDefaultConfigHandler(),
-		SSHHandler:           handler.NewSSHHandler(params.SSHService, params.DefaultSSHService),
-		NginxHandler:         handler.NewNginxHandler(params.NginxService, params.DefaultNginxService, params.DefaultNginxAdvancedService),
-		IntelligentHandler:   handler.NewIntelligentHandler(params.IntelligentService),
+		SSHHandler:           handler.NewSSHHandler(params.SSHService, params.DefaultSSHService, params.WhitelistService),
+		NginxHandler:         handler.NewNginxHandler(params.NginxService, params.DefaultNginxService, params.DefaultNginxAdvancedService, params.WhitelistService),
+		IntelligentHandler:   handler.NewIntelligentHandler(params.IntelligentService, params.LogSourceService),
+		BacktestHandler:      handler.NewBacktestHandler(params.BacktestService),
+		JobHandler:           handler.NewJobHandler(params.JobService),
+		LogHandler:           handler.NewLogHandler(params.LogSourceService),
+		BanEventHandler:      handler.NewBanEventHandler(params.BanEventService),
+		IPHandler:            handler.NewIPHandler(params.IPDossierService),
+		GeoHandler:           handler.NewGeoHandler(params.GeoService),
+		GeoPolicyHandler:     handler.NewGeoPolicyHandler(params.GeoPolicyService, params.IntelligentService),
+		WhitelistHandler:     handler.NewWhitelistHandler(params.WhitelistService),
+		IPListHandler:        handler.NewIPListHandler(params.IPListService),
+		BanLifecycleHandler:  handler.NewBanLifecycleHandler(params.BanLifecycleService),
+		BulkBanHandler:       handler.NewBulkBanHandler(params.BulkBanService),
+		EventHandler:         handler.NewEventHandler(params.EventBus),
+		WebhookHandler:       handler.NewWebhookHandler(params.WebhookService),
+		EmailReportHandler:   handler.NewEmailReportHandler(params.EmailReportService),
+		MetricsHandler:       handler.NewMetricsHandler(params.Metrics),
+		HealthHandler:        handler.NewHealthHandler(params.HealthService),
+		AppConfigHandler:     handler.NewAppConfigHandler(params.ConfigReloadService),
 	}
 }
 
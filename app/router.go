@@ -2,8 +2,10 @@ package app
 
 import (
 	"embed"
+	"fail2ban-web/config"
 	"fail2ban-web/internal/handler"
 	"fail2ban-web/internal/middleware"
+	"fail2ban-web/internal/service"
 	"html/template"
 	"io/fs"
 	"net/http"
@@ -24,19 +26,42 @@ type RouterParams struct {
 	SSHHandler           *handler.SSHHandler
 	NginxHandler         *handler.NginxHandler
 	IntelligentHandler   *handler.IntelligentHandler
+	BacktestHandler      *handler.BacktestHandler
+	JobHandler           *handler.JobHandler
+	LogHandler           *handler.LogHandler
+	BanEventHandler      *handler.BanEventHandler
+	IPHandler            *handler.IPHandler
+	GeoHandler           *handler.GeoHandler
+	GeoPolicyHandler     *handler.GeoPolicyHandler
+	WhitelistHandler     *handler.WhitelistHandler
+	IPListHandler        *handler.IPListHandler
+	BanLifecycleHandler  *handler.BanLifecycleHandler
+	BulkBanHandler       *handler.BulkBanHandler
+	EventHandler         *handler.EventHandler
+	WebhookHandler       *handler.WebhookHandler
+	EmailReportHandler   *handler.EmailReportHandler
+	MetricsHandler       *handler.MetricsHandler
+	HealthHandler        *handler.HealthHandler
+	AppConfigHandler     *handler.AppConfigHandler
+	Metrics              *service.Metrics
+	Config               *config.Config
 	StaticFiles          embed.FS `name:"staticFiles"`
 }
 
 // NewRouter 创建 Gin 路由器
 func NewRouter(params RouterParams) *gin.Engine {
-	// 设置为发布模式
-	gin.SetMode(gin.ReleaseMode)
+	// 运行模式：debug / release / test
+	gin.SetMode(params.Config.Server.Mode)
 
 	// 创建 Gin 路由器
 	r := gin.Default()
 
 	// 添加中间件
+	r.Use(middleware.MetricsMiddleware(params.Metrics))
 	r.Use(middleware.CORSMiddleware())
+	if tlsConfig := params.Config.Server.TLS; tlsConfig.Enabled() && tlsConfig.HSTSMaxAge > 0 {
+		r.Use(middleware.HSTSMiddleware(tlsConfig.HSTSMaxAge, tlsConfig.HSTSIncludeSubdomains))
+	}
 
 	// 设置静态文件
 	setupStaticFiles(r, params.StaticFiles)
@@ -55,6 +80,13 @@ func NewRouter(params RouterParams) *gin.Engine {
 		})
 	})
 
+	// Prometheus指标
+	r.GET("/metrics", params.MetricsHandler.GetMetrics)
+
+	// 存活和就绪检查（容器探针，不需要认证）
+	r.GET("/healthz", params.HealthHandler.Healthz)
+	r.GET("/readyz", params.HealthHandler.Readyz)
+
 	// API 路由组
 	api := r.Group("/api/v1")
 
@@ -66,9 +98,21 @@ func NewRouter(params RouterParams) *gin.Engine {
 		auth.GET("/profile", params.AuthHandler.GetProfile)
 	}
 
-	// 需要认证的API路由
+	// 客户端证书只有CN或SAN在client_cert_admins中时才能代替JWT认证
+	certAuth := middleware.NewClientCertAuth(params.Config.Server.TLS.ClientCertAdmins)
+
+	// 实时事件流，EventSource和WebSocket无法设置请求头，支持token查询参数认证
+	events := api.Group("/events")
+	events.Use(middleware.StreamAuthMiddleware(certAuth))
+	{
+		events.GET("", params.EventHandler.StreamEvents)
+		events.GET("/ws", params.EventHandler.StreamEventsWebSocket)
+	}
+
+	// 需要认证的API路由，接受JWT或client_cert_admins中的客户端证书
+	authMiddleware := middleware.NewJWTMiddleware(params.Config.JWT.Secret, certAuth)
 	authenticated := api.Group("")
-	// authenticated.Use(authMiddleware.JWTAuth()) // 暂时禁用认证
+	authenticated.Use(authMiddleware.JWTAuth())
 	{
 		// 健康检查
 		authenticated.GET("/health", params.Fail2banHandler.HealthCheck)
@@ -88,7 +132,90 @@ func NewRouter(params RouterParams) *gin.Engine {
 		authenticated.POST("/ban", params.Fail2banHandler.BanIP)
 
 		// 日志查看
-		authenticated.GET("/logs", params.Fail2banHandler.GetLogs)
+		authenticated.GET("/logs", params.LogHandler.GetLogs)
+		authenticated.GET("/logs/search", params.LogHandler.SearchLogs)
+		authenticated.GET("/log-sources", params.LogHandler.GetLogSources)
+
+		// 白名单管理
+		whitelist := authenticated.Group("/whitelist")
+		{
+			whitelist.GET("", params.WhitelistHandler.GetEntries)
+			whitelist.POST("", params.WhitelistHandler.CreateEntry)
+			whitelist.GET("/check/:ip", params.WhitelistHandler.CheckIP)
+			whitelist.GET("/:id", params.WhitelistHandler.GetEntry)
+			whitelist.PUT("/:id", params.WhitelistHandler.UpdateEntry)
+			whitelist.DELETE("/:id", params.WhitelistHandler.DeleteEntry)
+		}
+
+		// IP列表管理（云厂商、CDN网段等）
+		ipLists := authenticated.Group("/ip-lists")
+		{
+			ipLists.GET("", params.IPListHandler.GetLists)
+			ipLists.POST("/import", params.IPListHandler.ImportList)
+			ipLists.GET("/check/:ip", params.IPListHandler.CheckIP)
+			ipLists.GET("/:id", params.IPListHandler.GetList)
+			ipLists.DELETE("/:id", params.IPListHandler.DeleteList)
+		}
+
+		// fail2ban封禁事件历史
+		banEvents := authenticated.Group("/ban-events")
+		{
+			banEvents.GET("", params.BanEventHandler.GetBanEvents)
+			banEvents.GET("/ips/:ip", params.BanEventHandler.GetIPHistory)
+			banEvents.GET("/jails/:jail", params.BanEventHandler.GetJailHistory)
+		}
+
+		// 封禁记录生命周期
+		bans := authenticated.Group("/bans")
+		{
+			bans.GET("/upcoming", params.BanLifecycleHandler.GetUpcomingExpiries)
+			bans.POST("/bulk-ban", params.BulkBanHandler.BulkBan)
+			bans.POST("/bulk-unban", params.BulkBanHandler.BulkUnban)
+			bans.POST("/unban-everywhere", params.BulkBanHandler.UnbanEverywhere)
+			bans.POST("/:id/extend", params.BanLifecycleHandler.ExtendBan)
+		}
+
+		// Webhook通知
+		webhooks := authenticated.Group("/webhooks")
+		{
+			webhooks.GET("", params.WebhookHandler.GetWebhooks)
+			webhooks.POST("", params.WebhookHandler.CreateWebhook)
+			webhooks.GET("/:id", params.WebhookHandler.GetWebhook)
+			webhooks.PUT("/:id", params.WebhookHandler.UpdateWebhook)
+			webhooks.DELETE("/:id", params.WebhookHandler.DeleteWebhook)
+			webhooks.GET("/:id/deliveries", params.WebhookHandler.GetDeliveries)
+			webhooks.POST("/:id/test", params.WebhookHandler.TestWebhook)
+		}
+
+		// 邮件摘要报告
+		emailReports := authenticated.Group("/email-reports")
+		{
+			emailReports.GET("", params.EmailReportHandler.GetReports)
+			emailReports.POST("", params.EmailReportHandler.CreateReport)
+			emailReports.GET("/:id", params.EmailReportHandler.GetReport)
+			emailReports.PUT("/:id", params.EmailReportHandler.UpdateReport)
+			emailReports.DELETE("/:id", params.EmailReportHandler.DeleteReport)
+			emailReports.POST("/:id/send", params.EmailReportHandler.SendReport)
+			emailReports.GET("/:id/preview", params.EmailReportHandler.PreviewReport)
+		}
+
+		// 应用配置：查看生效的配置、重新加载配置文件
+		appConfig := authenticated.Group("/app-config")
+		{
+			appConfig.GET("", params.AppConfigHandler.GetConfig)
+			appConfig.POST("/reload", params.AppConfigHandler.ReloadConfig)
+		}
+
+		// IP调查
+		authenticated.GET("/ips/:ip", params.IPHandler.GetIPDossier)
+
+		// 离线GeoIP
+		geoip := authenticated.Group("/geoip")
+		{
+			geoip.GET("/status", params.GeoHandler.GetStatus)
+			geoip.POST("/reload", params.GeoHandler.Reload)
+			geoip.GET("/lookup/:ip", params.GeoHandler.Lookup)
+		}
 
 		// Jail 配置管理
 		jails := authenticated.Group("/jails")
@@ -142,11 +269,28 @@ func NewRouter(params RouterParams) *gin.Engine {
 		intelligent := authenticated.Group("/intelligent")
 		{
 			intelligent.GET("/threats", params.IntelligentHandler.GetCurrentThreats)
+			intelligent.GET("/subnets", params.IntelligentHandler.GetSubnetThreats)
 			intelligent.GET("/scan-result", params.IntelligentHandler.GetScanResult)
 			intelligent.GET("/stats", params.IntelligentHandler.GetThreatStats)
 			intelligent.POST("/ban", params.IntelligentHandler.ManualBanIP)
 			intelligent.POST("/analyze-log", params.IntelligentHandler.AnalyzeLogFile)
 			intelligent.POST("/analyze-access-log", params.IntelligentHandler.AnalyzeAccessLog)
+			intelligent.GET("/observe", params.IntelligentHandler.GetObserveConfig)
+			intelligent.PUT("/observe", params.IntelligentHandler.UpdateObserveConfig)
+			intelligent.GET("/observe/report", params.IntelligentHandler.GetObserveReport)
+			intelligent.GET("/backtests", params.BacktestHandler.GetBacktests)
+			intelligent.POST("/backtests", params.BacktestHandler.StartBacktest)
+			intelligent.GET("/backtests/:id", params.BacktestHandler.GetBacktest)
+			intelligent.GET("/jobs", params.JobHandler.GetJobs)
+			intelligent.GET("/jobs/:id", params.JobHandler.GetJob)
+			intelligent.POST("/jobs/:id/cancel", params.JobHandler.CancelJob)
+			intelligent.GET("/geo-policies", params.GeoPolicyHandler.GetPolicies)
+			intelligent.POST("/geo-policies", params.GeoPolicyHandler.CreatePolicy)
+			intelligent.GET("/geo-policies/matches", params.GeoPolicyHandler.GetPolicyMatches)
+			intelligent.GET("/geo-policies/:id", params.GeoPolicyHandler.GetPolicy)
+			intelligent.PUT("/geo-policies/:id", params.GeoPolicyHandler.UpdatePolicy)
+			intelligent.DELETE("/geo-policies/:id", params.GeoPolicyHandler.DeletePolicy)
+			intelligent.POST("/geo-policies/:id/ipset", params.GeoPolicyHandler.GenerateIPSet)
 		}
 	}
 
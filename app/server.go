@@ -2,6 +2,14 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fail2ban-web/config"
+	"fail2ban-web/internal/handler"
+	"fail2ban-web/internal/service"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/fx"
@@ -11,29 +19,139 @@ import (
 // ServerParams 服务器依赖参数
 type ServerParams struct {
 	fx.In
-	Lifecycle fx.Lifecycle
-	Logger    *zap.Logger
-	Router    *gin.Engine
+	Lifecycle    fx.Lifecycle
+	Shutdowner   fx.Shutdowner
+	Logger       *zap.Logger
+	Config       *config.Config
+	Router       *gin.Engine
+	TLSService   *service.TLSService
+	EventHandler *handler.EventHandler
 }
 
-// RegisterServer 注册并启动 HTTP 服务器
+// RegisterServer 注册 HTTP 服务器，配置证书时使用 HTTPS。
+// 端口在启动阶段绑定，绑定失败时启动失败；停止时等待进行中的请求完成后再停止后台服务和关闭数据库
 func RegisterServer(params ServerParams) {
+	serverConfig := params.Config.Server
+	server := newHTTPServer(serverConfig, serverConfig.Port, params.Router)
+	// Shutdown 不会等待事件流这类长连接结束，需要主动通知它们退出
+	server.RegisterOnShutdown(params.EventHandler.Shutdown)
+
+	var redirectServer *http.Server
+	if params.TLSService.Enabled() {
+		server.TLSConfig = params.TLSService.ServerTLSConfig()
+		if serverConfig.TLS.RedirectPort != "" {
+			redirectServer = newHTTPServer(serverConfig, serverConfig.TLS.RedirectPort, newHTTPSRedirectHandler(params.Router, serverConfig.Port))
+		}
+	}
+
 	params.Lifecycle.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			params.Logger.Info("Starting HTTP server on :8092...")
-			params.Logger.Info("Access the management panel at http://localhost:8092")
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				return fmt.Errorf("failed to listen on %s: %w", server.Addr, err)
+			}
+			
+			var redirectListener net.Listener
+			if redirectServer != nil {
+				if redirectListener, err = net.Listen("tcp", redirectServer.Addr); err != nil {
+					listener.Close()
+					return fmt.Errorf("failed to listen on %s: %w", redirectServer.Addr, err)
+				}
+			}
+			
+			scheme := "http"
+			if server.TLSConfig != nil {
+				scheme = "https"
+				params.TLSService.Start()
+			}
+			params.Logger.Info("Starting " + strings.ToUpper(scheme) + " server on " + server.Addr + "...")
+			params.Logger.Info("Access the management panel at " + scheme + "://localhost:" + serverConfig.Port)
 			
 			go func() {
-				if err := params.Router.Run(":8092"); err != nil {
-					params.Logger.Fatal("Failed to start HTTP server", zap.Error(err))
+				var err error
+				if server.TLSConfig != nil {
+					err = server.ServeTLS(listener, "", "")
+				} else {
+					err = server.Serve(listener)
 				}
+				params.handleServeError("HTTP server", err)
 			}()
 			
+			if redirectServer != nil {
+				params.Logger.Info("Redirecting HTTP on " + redirectServer.Addr + " to HTTPS")
+				go func() {
+					params.handleServeError("HTTP redirect server", redirectServer.Serve(redirectListener))
+				}()
+			}
+			
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
+			params.Logger.Info("Shutting down HTTP server, waiting for in-flight requests...")
+			ctx, cancel := context.WithTimeout(ctx, serverConfig.ShutdownTimeout)
+			defer cancel()
+			
+			shutdownServer(ctx, params.Logger, server)
+			if redirectServer != nil {
+				shutdownServer(ctx, params.Logger, redirectServer)
+			}
+			params.TLSService.Stop()
 			params.Logger.Info("HTTP server stopped")
 			return nil
 		},
 	})
 }
+
+// newHTTPServer 创建使用配置中超时设置的 http.Server
+func newHTTPServer(serverConfig config.ServerConfig, port string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              net.JoinHostPort(serverConfig.Host, port),
+		Handler:           handler,
+		ReadHeaderTimeout: serverConfig.ReadTimeout,
+		ReadTimeout:       serverConfig.ReadTimeout,
+		WriteTimeout:      serverConfig.WriteTimeout,
+		IdleTimeout:       serverConfig.IdleTimeout,
+	}
+}
+
+// handleServeError 服务器运行中意外退出时停止整个应用，使各模块的停止钩子正常执行
+func (params ServerParams) handleServeError(name string, err error) {
+	if err == nil || errors.Is(err, http.ErrServerClosed) {
+		return
+	}
+	params.Logger.Error(name+" stopped unexpectedly", zap.Error(err))
+	if err := params.Shutdowner.Shutdown(fx.ExitCode(1)); err != nil {
+		params.Logger.Error("Failed to shut down application", zap.Error(err))
+	}
+}
+
+// shutdownServer 优雅关闭服务器，超时后强制关闭剩余连接
+func shutdownServer(ctx context.Context, logger *zap.Logger, server *http.Server) {
+	if err := server.Shutdown(ctx); err != nil {
+		logger.Warn("Graceful shutdown timed out, closing remaining connections", zap.String("addr", server.Addr), zap.Error(err))
+		server.Close()
+	}
+}
+
+// newHTTPSRedirectHandler HTTP 重定向监听：存活和就绪检查直接响应，便于只支持 HTTP 的探针使用，
+// 其余请求以 308 重定向到 HTTPS 端口
+func newHTTPSRedirectHandler(router http.Handler, httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			router.ServeHTTP(w, r)
+			return
+		}
+		
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.Trim(host, "[]")
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,54 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok " + r.URL.Path))
+	})
+
+	tests := []struct {
+		name      string
+		httpsPort string
+		host      string
+		target    string
+		location  string
+	}{
+		{"带端口", "8443", "example.com:8080", "/api/jails?page=2", "https://example.com:8443/api/jails?page=2"},
+		{"不带端口", "8443", "example.com", "/", "https://example.com:8443/"},
+		{"默认HTTPS端口", "443", "example.com:80", "/login", "https://example.com/login"},
+		{"IPv6", "8443", "[2001:db8::1]:8080", "/", "https://[2001:db8::1]:8443/"},
+		{"IPv6默认HTTPS端口", "443", "[2001:db8::1]:80", "/a%20b", "https://[2001:db8::1]/a%20b"},
+		{"IPv6不带端口", "443", "[2001:db8::1]", "/", "https://[2001:db8::1]/"},
+		{"IPv4地址", "443", "192.0.2.1:80", "/", "https://192.0.2.1/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://"+tt.host+tt.target, nil)
+			req.Host = tt.host
+			rec := httptest.NewRecorder()
+			newHTTPSRedirectHandler(router, tt.httpsPort).ServeHTTP(rec, req)
+
+			// 308保留请求方法和请求体
+			if rec.Code != http.StatusPermanentRedirect {
+				t.Fatalf("状态码 = %d, want %d", rec.Code, http.StatusPermanentRedirect)
+			}
+			if got := rec.Header().Get("Location"); got != tt.location {
+				t.Errorf("Location = %q, want %q", got, tt.location)
+			}
+		})
+	}
+
+	// 健康检查不重定向
+	for _, path := range []string{"/healthz", "/readyz"} {
+		rec := httptest.NewRecorder()
+		newHTTPSRedirectHandler(router, "8443").ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok "+path {
+			t.Errorf("%s: 状态码 = %d, body = %q", path, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fail2ban-web/config"
 	"fail2ban-web/internal/service"
+	"fmt"
 
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -13,9 +14,10 @@ import (
 // ServiceParams 服务层依赖参数
 type ServiceParams struct {
 	fx.In
-	Config *config.Config
-	DB     *gorm.DB
-	Logger *zap.Logger
+	Config     *config.Config
+	DB         *gorm.DB
+	Logger     *zap.Logger
+	TLSService *service.TLSService
 }
 
 // ServiceResult 服务层输出
@@ -30,6 +32,23 @@ type ServiceResult struct {
 	DefaultNginxAdvancedService  *service.DefaultNginxAdvancedService
 	IntelligentService           *service.IntelligentScanService
 	DefaultJailService           *service.DefaultJailService
+	JobService                   *service.JobService
+	BacktestService              *service.BacktestService
+	LogSourceService             *service.LogSourceService
+	BanEventService              *service.BanEventService
+	IPDossierService             *service.IPDossierService
+	GeoService                   *service.GeoService
+	GeoPolicyService             *service.GeoPolicyService
+	WhitelistService             *service.WhitelistService
+	IPListService                *service.IPListService
+	BanLifecycleService          *service.BanLifecycleService
+	BulkBanService               *service.BulkBanService
+	EventBus                     *service.EventBus
+	Metrics                      *service.Metrics
+	WebhookService               *service.WebhookService
+	EmailReportService           *service.EmailReportService
+	HealthService                *service.HealthService
+	ConfigReloadService          *service.ConfigReloadService
 }
 
 // NewServices 创建所有服务
@@ -38,11 +57,21 @@ func NewServices(lc fx.Lifecycle, params ServiceParams) ServiceResult {
 	// 注意：这里暂时使用 zap 的 SugaredLogger 来模拟 logrus
 	// 更好的做法是重构 service 层使用 zap.Logger
 	
+	// 初始化事件总线和Prometheus指标
+	eventBus := service.NewEventBus()
+	metrics := service.NewMetrics()
+	
+	// 初始化Webhook通知服务
+	webhookService := service.NewWebhookService(params.DB, eventBus)
+	
+	// 初始化离线GeoIP服务
+	geoService := service.NewGeoService(params.Config)
+	
 	// 初始化服务
-	jailService := service.NewJailService(params.DB)
-	sshService := service.NewSSHService(params.Config, params.DB)
-	nginxService := service.NewNginxService(params.Config, params.DB)
-	defaultSSHService := service.NewDefaultSSHService(jailService)
+	jailService := service.NewJailService(params.DB, eventBus)
+	sshService := service.NewSSHService(params.Config, params.DB, geoService, metrics)
+	nginxService := service.NewNginxService(params.Config, params.DB, metrics)
+	defaultSSHService := service.NewDefaultSSHService(params.Config, jailService)
 	defaultNginxService := service.NewDefaultNginxServiceWithJail(jailService)
 	defaultNginxAdvancedService := service.NewDefaultNginxAdvancedService(jailService)
 	defaultJailService := service.NewDefaultJailService(jailService)
@@ -50,7 +79,29 @@ func NewServices(lc fx.Lifecycle, params ServiceParams) ServiceResult {
 	// Fail2BanService 需要 logrus.Logger，这里需要适配
 	// 临时创建一个 logrus logger
 	logrusLogger := service.NewLogrusLogger()
-	fail2banService := service.NewFail2BanService(logrusLogger)
+	fail2banService := service.NewFail2BanService(logrusLogger, metrics)
+	
+	// 初始化日志源服务
+	logSourceService := service.NewLogSourceService(params.Config)
+	
+	// 初始化fail2ban事件服务
+	banEventService := service.NewBanEventService(params.DB, logSourceService, fail2banService, eventBus, metrics)
+	
+	// 递增、永久和延长的封禁转移到长期封禁jail
+	extendedBanJail := service.NewExtendedBanJail(params.Config, fail2banService)
+	
+	// 初始化封禁生命周期服务
+	banLifecycleService := service.NewBanLifecycleService(params.DB, fail2banService, extendedBanJail)
+	
+	// 初始化IP列表和白名单服务
+	ipListService := service.NewIPListService(params.DB)
+	whitelistService := service.NewWhitelistService(params.DB, fail2banService, ipListService)
+	
+	// 初始化GeoIP策略服务
+	geoPolicyService := service.NewGeoPolicyService(params.Config, params.DB, geoService, fail2banService)
+	
+	// 初始化异步任务服务
+	jobService := service.NewJobService(params.Config, params.DB, eventBus)
 	
 	// 初始化智能扫描服务
 	intelligentService := service.NewIntelligentScanService(
@@ -60,19 +111,95 @@ func NewServices(lc fx.Lifecycle, params ServiceParams) ServiceResult {
 		nginxService,
 		jailService,
 		fail2banService,
+		whitelistService,
+		jobService,
+		geoService,
+		geoPolicyService,
+		ipListService,
+		extendedBanJail,
+		eventBus,
+		metrics,
 	)
+	metrics.RegisterStateCollector(fail2banService, jailService, intelligentService)
+	healthService := service.NewHealthService(params.Config, params.DB, fail2banService, logSourceService, geoService, intelligentService, params.TLSService)
+	
+	backtestService := service.NewBacktestService(params.DB, intelligentService, jobService, logSourceService)
+	ipDossierService := service.NewIPDossierService(params.DB, fail2banService, intelligentService, banEventService, logSourceService, geoService)
+	bulkBanService := service.NewBulkBanService(params.DB, fail2banService, whitelistService, intelligentService, banLifecycleService)
+	
+	// 初始化邮件告警和摘要报告服务
+	mailer := service.NewMailer(params.Config)
+	emailAlertService := service.NewEmailAlertService(params.Config, mailer, eventBus)
+	emailReportService := service.NewEmailReportService(params.DB, mailer, intelligentService)
+	
+	// 配置热加载：扫描、封禁和SMTP配置在SIGHUP或配置文件变化时更新
+	configReloadService := service.NewConfigReloadService(params.Config, intelligentService, mailer, emailAlertService, defaultSSHService)
 	
 	// 添加生命周期钩子
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
+			if err := jobService.Start(); err != nil {
+				return err
+			}
+			geoService.Start()
+			if err := geoPolicyService.Start(); err != nil {
+				return err
+			}
+			if err := ipListService.Start(); err != nil {
+				return err
+			}
+			if err := whitelistService.Start(); err != nil {
+				return err
+			}
+			params.Logger.Info("Starting webhook notifications...")
+			if err := webhookService.Start(); err != nil {
+				return err
+			}
+			params.Logger.Info("Starting email alerts and reports...")
+			if err := emailAlertService.Start(); err != nil {
+				return err
+			}
+			emailReportService.Start()
+			params.Logger.Info("Starting fail2ban event ingestion...")
+			banEventService.Start()
+			params.Logger.Info("Starting ban lifecycle manager...")
+			banLifecycleService.Start()
 			params.Logger.Info("Starting intelligent scan service...")
 			intelligentService.Start()
+			configReloadService.Start()
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
-			params.Logger.Info("Stopping intelligent scan service...")
-			intelligentService.Stop()
-			return nil
+			// HTTP 服务器已先停止，这里等待扫描循环、分析任务和其他后台协程退出后再关闭数据库；
+			// 超时后返回错误，fx 不再执行后续的停止钩子，避免在仍有写入时关闭数据库
+			drained := make(chan struct{})
+			go func() {
+				defer close(drained)
+				configReloadService.Stop()
+				params.Logger.Info("Stopping intelligent scan service...")
+				intelligentService.Stop()
+				params.Logger.Info("Stopping analysis jobs...")
+				jobService.Stop()
+				params.Logger.Info("Stopping fail2ban event ingestion...")
+				banEventService.Stop()
+				params.Logger.Info("Stopping ban lifecycle manager...")
+				banLifecycleService.Stop()
+				params.Logger.Info("Stopping webhook notifications...")
+				webhookService.Stop()
+				params.Logger.Info("Stopping email alerts and reports...")
+				emailAlertService.Stop()
+				emailReportService.Stop()
+				geoService.Stop()
+				whitelistService.Stop()
+			}()
+			
+			select {
+			case <-drained:
+				params.Logger.Info("Background services stopped")
+				return nil
+			case <-ctx.Done():
+				return fmt.Errorf("timed out waiting for background services to stop: %w", ctx.Err())
+			}
 		},
 	})
 
@@ -86,10 +213,27 @@ func NewServices(lc fx.Lifecycle, params ServiceParams) ServiceResult {
 		DefaultNginxAdvancedService: defaultNginxAdvancedService,
 		IntelligentService:          intelligentService,
 		DefaultJailService:          defaultJailService,
+		BacktestService:             backtestService,
+		JobService:                  jobService,
+		LogSourceService:            logSourceService,
+		BanEventService:             banEventService,
+		IPDossierService:            ipDossierService,
+		GeoService:                  geoService,
+		GeoPolicyService:            geoPolicyService,
+		WhitelistService:            whitelistService,
+		IPListService:               ipListService,
+		BanLifecycleService:         banLifecycleService,
+		BulkBanService:              bulkBanService,
+		EventBus:                    eventBus,
+		Metrics:                     metrics,
+		WebhookService:              webhookService,
+		EmailReportService:          emailReportService,
+		HealthService:               healthService,
+		ConfigReloadService:         configReloadService,
 	}
 }
 
 // ServiceModule 服务模块
 var ServiceModule = fx.Module("services",
-	fx.Provide(NewServices),
+	fx.Provide(NewServices, service.NewTLSService),
 )
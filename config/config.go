@@ -3,83 +3,301 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// Config 应用配置，依次使用默认值、配置文件和环境变量，环境变量优先级最高
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	JWT      JWTConfig
-	Fail2Ban Fail2BanConfig
-	Admin    AdminConfig
+	Server   ServerConfig   `yaml:"server"`
+	Database DatabaseConfig `yaml:"database"`
+	JWT      JWTConfig      `yaml:"jwt"`
+	Fail2Ban Fail2BanConfig `yaml:"fail2ban"`
+	Admin    AdminConfig    `yaml:"admin"`
+	Scanner  ScannerConfig  `yaml:"scanner"`
+	GeoIP    GeoIPConfig    `yaml:"geoip"`
+	Ban      BanConfig      `yaml:"ban"`
+	SMTP     SMTPConfig     `yaml:"smtp"`
+
+	File string `yaml:"-"` // 加载的配置文件路径，为空表示只使用环境变量
 }
 
 type ServerConfig struct {
-	Port string
-	Host string
-	Mode string
+	Port            string        `yaml:"port"`
+	Host            string        `yaml:"host"`
+	Mode            string        `yaml:"mode"`
+	ReadTimeout     time.Duration `yaml:"read_timeout"`     // 读取整个请求（含请求体）的超时，0表示不限制
+	WriteTimeout    time.Duration `yaml:"write_timeout"`    // 写入响应的超时，事件流接口不受此限制，0表示不限制
+	IdleTimeout     time.Duration `yaml:"idle_timeout"`     // keep-alive连接的空闲超时，0表示使用read_timeout
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"` // 停止时等待进行中请求完成的最长时间
+	TLS             TLSConfig     `yaml:"tls"`
+}
+
+// TLS客户端证书认证方式
+const (
+	ClientAuthNone     = "none"     // 不请求客户端证书
+	ClientAuthOptional = "optional" // 客户端提供证书时校验，校验通过且在client_cert_admins中的证书视为已认证
+	ClientAuthRequire  = "require"  // 所有连接都必须提供由client_ca_file签发的证书
+)
+
+// TLSConfig HTTPS配置，cert_file和key_file都配置时启用，证书文件变化时自动重新加载
+type TLSConfig struct {
+	CertFile              string        `yaml:"cert_file"`
+	KeyFile               string        `yaml:"key_file"`
+	RedirectPort          string        `yaml:"redirect_port"`           // 非空时在该端口监听HTTP并重定向到HTTPS
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age"`            // Strict-Transport-Security的max-age，0表示不发送
+	HSTSIncludeSubdomains bool          `yaml:"hsts_include_subdomains"` // HSTS是否包含子域名
+	ClientCAFile          string        `yaml:"client_ca_file"`          // 校验客户端证书的CA
+	ClientAuth            string        `yaml:"client_auth"`             // none / optional / require
+	ClientCertAdmins      []string      `yaml:"client_cert_admins"`      // 视为管理员的客户端证书CN或SAN，为空时证书不能代替JWT认证
+}
+
+// Enabled 是否启用HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
 }
 
 type DatabaseConfig struct {
-	Path string
+	Path string `yaml:"path"`
 }
 
 type JWTConfig struct {
-	Secret     string
-	ExpireTime int // 小时
+	Secret     string `yaml:"secret"`
+	ExpireTime int    `yaml:"expire_time"` // 小时
 }
 
 type Fail2BanConfig struct {
-	LogPath        string
-	ConfigPath     string
-	SocketPath     string
-	NginxAccessLog string
-	NginxErrorLog  string
-	SSHLogPath     string
-	ForceSudo      bool   // 强制使用sudo
-	SudoUser       string // sudo用户
-	DevMode        bool   // 开发模式
+	LogPath        string   `yaml:"log_path"`
+	ConfigPath     string   `yaml:"config_path"`
+	SocketPath     string   `yaml:"socket_path"`
+	NginxAccessLog string   `yaml:"nginx_access_log"`
+	NginxErrorLog  string   `yaml:"nginx_error_log"`
+	SSHLogPath     string   `yaml:"ssh_log_path"`
+	LogSources     []string `yaml:"log_sources"` // 额外的命名日志源，格式 name[:type]=path
+	ForceSudo      bool     `yaml:"force_sudo"`  // 强制使用sudo
+	SudoUser       string   `yaml:"sudo_user"`   // sudo用户
+	DevMode        bool     `yaml:"dev_mode"`    // 开发模式
 }
 
 type AdminConfig struct {
-	Username string
-	Password string
-	Email    string
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Email    string `yaml:"email"`
+}
+
+// ScannerConfig 智能扫描配置
+type ScannerConfig struct {
+	ObserveMode       bool     `yaml:"observe_mode"`        // 全局观察模式：只记录封禁决策，不调用fail2ban
+	ObservePolicies   []string `yaml:"observe_policies"`    // 单独处于观察模式的封禁策略
+	MaxConcurrentJobs int      `yaml:"max_concurrent_jobs"` // 同时执行的日志分析任务数
+	IPv6PrefixLen     int      `yaml:"ipv6_prefix"`         // IPv6威胁按该前缀长度聚合并封禁，128表示按单个地址处理
+	SubnetV4PrefixLen int      `yaml:"subnet_v4_prefix"`    // IPv4网段级威胁聚合的前缀长度
+	SubnetV6PrefixLen int      `yaml:"subnet_v6_prefix"`    // IPv6网段级威胁聚合的前缀长度
+	SubnetMinHosts    int      `yaml:"subnet_min_hosts"`    // 网段内不同攻击来源达到该数量时升级为网段封禁，0表示不按来源数量升级
+	SubnetMinScore    int      `yaml:"subnet_min_score"`    // 网段内威胁评分之和达到该值时升级为网段封禁，0表示不按评分升级
+
+	ScanInterval        time.Duration `yaml:"scan_interval"`         // 扫描SSH和Nginx日志的周期
+	AnalysisInterval    time.Duration `yaml:"analysis_interval"`     // 汇总分析威胁的周期
+	AutoProcessInterval time.Duration `yaml:"auto_process_interval"` // 检查并自动封禁威胁的周期
+	LogAnalysisInterval time.Duration `yaml:"log_analysis_interval"` // 自动分析access.log的周期
+
+	HighScoreThreshold    int      `yaml:"high_score_threshold"`    // 威胁评分达到该值时按high_score策略封禁
+	SSHBruteForceAttempts int      `yaml:"ssh_bruteforce_attempts"` // SSH失败次数达到该值时按ssh_bruteforce策略封禁
+	MultiAttackTypes      int      `yaml:"multi_attack_types"`      // 攻击类型数量达到该值且评分达到multi_attack_score时封禁
+	MultiAttackScore      int      `yaml:"multi_attack_score"`
+	SSHJails              []string `yaml:"ssh_jails"`   // SSH攻击优先使用的jail，按顺序尝试
+	NginxJails            []string `yaml:"nginx_jails"` // Nginx攻击优先使用的jail，都不存在时使用名称包含nginx的jail
+}
+
+// GeoIPConfig 离线GeoIP数据库配置
+type GeoIPConfig struct {
+	CityDB    string `yaml:"city_db"`    // GeoLite2-City.mmdb 路径
+	ASNDB     string `yaml:"asn_db"`     // GeoLite2-ASN.mmdb 路径
+	CacheSize int    `yaml:"cache_size"` // 查询结果LRU缓存条数
 }
 
-// LoadConfig 加载配置
+// BanConfig 封禁时长配置，重复封禁时按倍数递增
+type BanConfig struct {
+	Duration        time.Duration `yaml:"duration"`         // 首次封禁时长
+	IncrementFactor float64       `yaml:"increment_factor"` // 每次重复封禁的时长倍数，1表示不递增
+	MaxDuration     time.Duration `yaml:"max_duration"`     // 递增后的最大封禁时长，0表示不限制
+	Lookback        time.Duration `yaml:"lookback"`         // 统计历史封禁次数的时间窗口
+	PermanentAfter  int           `yaml:"permanent_after"`  // 历史封禁次数达到该值时永久封禁，0表示从不永久封禁
+}
+
+// SMTPConfig 邮件告警和摘要报告的SMTP配置，Host为空时不发送邮件
+type SMTPConfig struct {
+	Host            string        `yaml:"host"`
+	Port            int           `yaml:"port"`
+	Username        string        `yaml:"username"`
+	Password        string        `yaml:"password"`
+	From            string        `yaml:"from"`
+	TLSMode         string        `yaml:"tls"`              // starttls / tls / none
+	AlertRecipients []string      `yaml:"alert_recipients"` // 严重威胁即时告警的收件人
+	AlertMinScore   int           `yaml:"alert_min_score"`  // 威胁评分达到该值时发送告警
+	AlertCooldown   time.Duration `yaml:"alert_cooldown"`   // 同一IP两次告警的最小间隔
+}
+
+// LoadConfig 只使用默认值和环境变量加载配置
 func LoadConfig() *Config {
+	cfg := Defaults()
+	applyEnv(cfg)
+	return cfg
+}
+
+// Defaults 默认配置
+func Defaults() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8092"),
-			Host: getEnv("HOST", "0.0.0.0"),
-			Mode: getEnv("GIN_MODE", "release"),
+			Port:            "8092",
+			Host:            "0.0.0.0",
+			Mode:            "release",
+			ReadTimeout:     30 * time.Second,
+			WriteTimeout:    60 * time.Second,
+			IdleTimeout:     120 * time.Second,
+			ShutdownTimeout: 20 * time.Second,
+			TLS: TLSConfig{
+				HSTSMaxAge: 180 * 24 * time.Hour,
+				ClientAuth: ClientAuthNone,
+			},
 		},
 		Database: DatabaseConfig{
-			Path: getEnv("DB_PATH", "./fail2ban_web.db"),
+			Path: "./fail2ban_web.db",
 		},
 		JWT: JWTConfig{
-			Secret:     getEnv("JWT_SECRET", "your-secret-key-change-this-in-production"),
-			ExpireTime: getEnvAsInt("JWT_EXPIRE_TIME", 24),
+			Secret:     "your-secret-key-change-this-in-production",
+			ExpireTime: 24,
 		},
 		Fail2Ban: Fail2BanConfig{
-			LogPath:        getEnv("FAIL2BAN_LOG_PATH", "/var/log/fail2ban.log"),
-			ConfigPath:     getEnv("FAIL2BAN_CONFIG_PATH", "/etc/fail2ban"),
-			SocketPath:     getEnv("FAIL2BAN_SOCKET_PATH", "/var/run/fail2ban/fail2ban.sock"),
-			NginxAccessLog: getEnv("NGINX_ACCESS_LOG", "/var/log/nginx/access.log"),
-			NginxErrorLog:  getEnv("NGINX_ERROR_LOG", "/var/log/nginx/error.log"),
-			SSHLogPath:     getEnv("SSH_LOG_PATH", "/var/log/auth.log"),
-			ForceSudo:      getEnvAsBool("FAIL2BAN_FORCE_SUDO", false),
-			SudoUser:       getEnv("SUDO_USER", ""),
-			DevMode:        getEnvAsBool("DEV_MODE", false),
+			LogPath:        "/var/log/fail2ban.log",
+			ConfigPath:     "/etc/fail2ban",
+			SocketPath:     "/var/run/fail2ban/fail2ban.sock",
+			NginxAccessLog: "/var/log/nginx/access.log",
+			NginxErrorLog:  "/var/log/nginx/error.log",
+			SSHLogPath:     "/var/log/auth.log",
 		},
 		Admin: AdminConfig{
-			Username: getEnv("ADMIN_USERNAME", "admin"),
-			Password: getEnv("ADMIN_PASSWORD", "admin123"),
-			Email:    getEnv("ADMIN_EMAIL", "admin@fail2ban.local"),
+			Username: "admin",
+			Password: "admin123",
+			Email:    "admin@fail2ban.local",
+		},
+		Scanner: ScannerConfig{
+			MaxConcurrentJobs:     1,
+			IPv6PrefixLen:         64,
+			SubnetV4PrefixLen:     24,
+			SubnetV6PrefixLen:     48,
+			SubnetMinHosts:        5,
+			SubnetMinScore:        300,
+			ScanInterval:          5 * time.Minute,
+			AnalysisInterval:      time.Minute,
+			AutoProcessInterval:   30 * time.Second,
+			LogAnalysisInterval:   30 * time.Minute,
+			HighScoreThreshold:    80,
+			SSHBruteForceAttempts: 10,
+			MultiAttackTypes:      3,
+			MultiAttackScore:      60,
+			SSHJails:              []string{"sshd", "sshd-ddos"},
+			NginxJails:            []string{"nginx-http-auth"},
+		},
+		GeoIP: GeoIPConfig{
+			CityDB:    "config/GeoLite2-City.mmdb",
+			ASNDB:     "config/GeoLite2-ASN.mmdb",
+			CacheSize: 10000,
+		},
+		Ban: BanConfig{
+			Duration:        24 * time.Hour,
+			IncrementFactor: 2,
+			MaxDuration:     30 * 24 * time.Hour,
+			Lookback:        30 * 24 * time.Hour,
+		},
+		SMTP: SMTPConfig{
+			Port:          587,
+			From:          "fail2ban-web@localhost",
+			TLSMode:       "starttls",
+			AlertMinScore: 80,
+			AlertCooldown: time.Hour,
 		},
 	}
 }
 
+// applyEnv 使用环境变量覆盖配置，未设置的环境变量保留原值
+func applyEnv(cfg *Config) {
+	cfg.Server.Port = getEnv("PORT", cfg.Server.Port)
+	cfg.Server.Host = getEnv("HOST", cfg.Server.Host)
+	cfg.Server.Mode = getEnv("GIN_MODE", cfg.Server.Mode)
+	cfg.Server.ReadTimeout = getEnvAsDuration("SERVER_READ_TIMEOUT", cfg.Server.ReadTimeout)
+	cfg.Server.WriteTimeout = getEnvAsDuration("SERVER_WRITE_TIMEOUT", cfg.Server.WriteTimeout)
+	cfg.Server.IdleTimeout = getEnvAsDuration("SERVER_IDLE_TIMEOUT", cfg.Server.IdleTimeout)
+	cfg.Server.ShutdownTimeout = getEnvAsDuration("SERVER_SHUTDOWN_TIMEOUT", cfg.Server.ShutdownTimeout)
+	cfg.Server.TLS.CertFile = getEnv("TLS_CERT_FILE", cfg.Server.TLS.CertFile)
+	cfg.Server.TLS.KeyFile = getEnv("TLS_KEY_FILE", cfg.Server.TLS.KeyFile)
+	cfg.Server.TLS.RedirectPort = getEnv("TLS_REDIRECT_PORT", cfg.Server.TLS.RedirectPort)
+	cfg.Server.TLS.HSTSMaxAge = getEnvAsDuration("TLS_HSTS_MAX_AGE", cfg.Server.TLS.HSTSMaxAge)
+	cfg.Server.TLS.HSTSIncludeSubdomains = getEnvAsBool("TLS_HSTS_INCLUDE_SUBDOMAINS", cfg.Server.TLS.HSTSIncludeSubdomains)
+	cfg.Server.TLS.ClientCAFile = getEnv("TLS_CLIENT_CA_FILE", cfg.Server.TLS.ClientCAFile)
+	cfg.Server.TLS.ClientAuth = getEnv("TLS_CLIENT_AUTH", cfg.Server.TLS.ClientAuth)
+	cfg.Server.TLS.ClientCertAdmins = getEnvAsSlice("TLS_CLIENT_CERT_ADMINS", cfg.Server.TLS.ClientCertAdmins)
+
+	cfg.Database.Path = getEnv("DB_PATH", cfg.Database.Path)
+
+	cfg.JWT.Secret = getEnv("JWT_SECRET", cfg.JWT.Secret)
+	cfg.JWT.ExpireTime = getEnvAsInt("JWT_EXPIRE_TIME", cfg.JWT.ExpireTime)
+
+	cfg.Fail2Ban.LogPath = getEnv("FAIL2BAN_LOG_PATH", cfg.Fail2Ban.LogPath)
+	cfg.Fail2Ban.ConfigPath = getEnv("FAIL2BAN_CONFIG_PATH", cfg.Fail2Ban.ConfigPath)
+	cfg.Fail2Ban.SocketPath = getEnv("FAIL2BAN_SOCKET_PATH", cfg.Fail2Ban.SocketPath)
+	cfg.Fail2Ban.NginxAccessLog = getEnv("NGINX_ACCESS_LOG", cfg.Fail2Ban.NginxAccessLog)
+	cfg.Fail2Ban.NginxErrorLog = getEnv("NGINX_ERROR_LOG", cfg.Fail2Ban.NginxErrorLog)
+	cfg.Fail2Ban.SSHLogPath = getEnv("SSH_LOG_PATH", cfg.Fail2Ban.SSHLogPath)
+	cfg.Fail2Ban.LogSources = getEnvAsSlice("LOG_SOURCES", cfg.Fail2Ban.LogSources)
+	cfg.Fail2Ban.ForceSudo = getEnvAsBool("FAIL2BAN_FORCE_SUDO", cfg.Fail2Ban.ForceSudo)
+	cfg.Fail2Ban.SudoUser = getEnv("SUDO_USER", cfg.Fail2Ban.SudoUser)
+	cfg.Fail2Ban.DevMode = getEnvAsBool("DEV_MODE", cfg.Fail2Ban.DevMode)
+
+	cfg.Admin.Username = getEnv("ADMIN_USERNAME", cfg.Admin.Username)
+	cfg.Admin.Password = getEnv("ADMIN_PASSWORD", cfg.Admin.Password)
+	cfg.Admin.Email = getEnv("ADMIN_EMAIL", cfg.Admin.Email)
+
+	cfg.Scanner.ObserveMode = getEnvAsBool("SCANNER_OBSERVE_MODE", cfg.Scanner.ObserveMode)
+	cfg.Scanner.ObservePolicies = getEnvAsSlice("SCANNER_OBSERVE_POLICIES", cfg.Scanner.ObservePolicies)
+	cfg.Scanner.MaxConcurrentJobs = getEnvAsInt("ANALYSIS_MAX_CONCURRENT_JOBS", cfg.Scanner.MaxConcurrentJobs)
+	cfg.Scanner.IPv6PrefixLen = getEnvAsInt("SCANNER_IPV6_PREFIX", cfg.Scanner.IPv6PrefixLen)
+	cfg.Scanner.SubnetV4PrefixLen = getEnvAsInt("SCANNER_SUBNET_V4_PREFIX", cfg.Scanner.SubnetV4PrefixLen)
+	cfg.Scanner.SubnetV6PrefixLen = getEnvAsInt("SCANNER_SUBNET_V6_PREFIX", cfg.Scanner.SubnetV6PrefixLen)
+	cfg.Scanner.SubnetMinHosts = getEnvAsInt("SCANNER_SUBNET_MIN_HOSTS", cfg.Scanner.SubnetMinHosts)
+	cfg.Scanner.SubnetMinScore = getEnvAsInt("SCANNER_SUBNET_MIN_SCORE", cfg.Scanner.SubnetMinScore)
+	cfg.Scanner.ScanInterval = getEnvAsDuration("SCANNER_SCAN_INTERVAL", cfg.Scanner.ScanInterval)
+	cfg.Scanner.AnalysisInterval = getEnvAsDuration("SCANNER_ANALYSIS_INTERVAL", cfg.Scanner.AnalysisInterval)
+	cfg.Scanner.AutoProcessInterval = getEnvAsDuration("SCANNER_AUTO_PROCESS_INTERVAL", cfg.Scanner.AutoProcessInterval)
+	cfg.Scanner.LogAnalysisInterval = getEnvAsDuration("SCANNER_LOG_ANALYSIS_INTERVAL", cfg.Scanner.LogAnalysisInterval)
+	cfg.Scanner.HighScoreThreshold = getEnvAsInt("SCANNER_HIGH_SCORE_THRESHOLD", cfg.Scanner.HighScoreThreshold)
+	cfg.Scanner.SSHBruteForceAttempts = getEnvAsInt("SCANNER_SSH_BRUTEFORCE_ATTEMPTS", cfg.Scanner.SSHBruteForceAttempts)
+	cfg.Scanner.MultiAttackTypes = getEnvAsInt("SCANNER_MULTI_ATTACK_TYPES", cfg.Scanner.MultiAttackTypes)
+	cfg.Scanner.MultiAttackScore = getEnvAsInt("SCANNER_MULTI_ATTACK_SCORE", cfg.Scanner.MultiAttackScore)
+	cfg.Scanner.SSHJails = getEnvAsSlice("SCANNER_SSH_JAILS", cfg.Scanner.SSHJails)
+	cfg.Scanner.NginxJails = getEnvAsSlice("SCANNER_NGINX_JAILS", cfg.Scanner.NginxJails)
+
+	cfg.GeoIP.CityDB = getEnv("GEOIP_CITY_DB", cfg.GeoIP.CityDB)
+	cfg.GeoIP.ASNDB = getEnv("GEOIP_ASN_DB", cfg.GeoIP.ASNDB)
+	cfg.GeoIP.CacheSize = getEnvAsInt("GEOIP_CACHE_SIZE", cfg.GeoIP.CacheSize)
+
+	cfg.Ban.Duration = getEnvAsDuration("BAN_DURATION", cfg.Ban.Duration)
+	cfg.Ban.IncrementFactor = getEnvAsFloat("BAN_INCREMENT_FACTOR", cfg.Ban.IncrementFactor)
+	cfg.Ban.MaxDuration = getEnvAsDuration("BAN_MAX_DURATION", cfg.Ban.MaxDuration)
+	cfg.Ban.Lookback = getEnvAsDuration("BAN_INCREMENT_LOOKBACK", cfg.Ban.Lookback)
+	cfg.Ban.PermanentAfter = getEnvAsInt("BAN_PERMANENT_AFTER", cfg.Ban.PermanentAfter)
+
+	cfg.SMTP.Host = getEnv("SMTP_HOST", cfg.SMTP.Host)
+	cfg.SMTP.Port = getEnvAsInt("SMTP_PORT", cfg.SMTP.Port)
+	cfg.SMTP.Username = getEnv("SMTP_USERNAME", cfg.SMTP.Username)
+	cfg.SMTP.Password = getEnv("SMTP_PASSWORD", cfg.SMTP.Password)
+	cfg.SMTP.From = getEnv("SMTP_FROM", cfg.SMTP.From)
+	cfg.SMTP.TLSMode = getEnv("SMTP_TLS", cfg.SMTP.TLSMode)
+	cfg.SMTP.AlertRecipients = getEnvAsSlice("SMTP_ALERT_RECIPIENTS", cfg.SMTP.AlertRecipients)
+	cfg.SMTP.AlertMinScore = getEnvAsInt("SMTP_ALERT_MIN_SCORE", cfg.SMTP.AlertMinScore)
+	cfg.SMTP.AlertCooldown = getEnvAsDuration("SMTP_ALERT_COOLDOWN", cfg.SMTP.AlertCooldown)
+}
+
 // getEnv 获取环境变量，如果不存在则使用默认值
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
@@ -98,6 +316,26 @@ func getEnvAsInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvAsFloat 获取环境变量作为浮点数，如果不存在或转换失败则使用默认值
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsDuration 获取环境变量作为时长（如 24h、90m），如果不存在或转换失败则使用默认值
+func getEnvAsDuration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return defaultValue
+}
+
 // getEnvAsBool 获取环境变量作为布尔值，如果不存在或转换失败则使用默认值
 func getEnvAsBool(key string, defaultValue bool) bool {
 	if value := os.Getenv(key); value != "" {
@@ -106,4 +344,20 @@ func getEnvAsBool(key string, defaultValue bool) bool {
 		}
 	}
 	return defaultValue
-}
\ No newline at end of file
+}
+
+// getEnvAsSlice 获取逗号分隔的环境变量作为字符串切片，如果不存在则使用默认值
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
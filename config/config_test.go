@@ -0,0 +1,255 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// problemFields 校验错误中的字段名
+func problemFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("error = %v, want *ValidationError", err)
+	}
+	fields := make([]string, 0, len(validationErr.Problems))
+	for _, problem := range validationErr.Problems {
+		fields = append(fields, strings.SplitN(problem, " ", 2)[0])
+	}
+	return fields
+}
+
+func TestValidate(t *testing.T) {
+	if err := Defaults().Validate(); err != nil {
+		t.Fatalf("默认配置校验失败: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+		fields []string
+	}{
+		{"端口不是数字", func(c *Config) { c.Server.Port = "http" }, []string{"server.port"}},
+		{"端口超出范围", func(c *Config) { c.Server.Port = "70000" }, []string{"server.port"}},
+		{"未知的运行模式", func(c *Config) { c.Server.Mode = "production" }, []string{"server.mode"}},
+		{"负的超时", func(c *Config) { c.Server.ReadTimeout = -time.Second }, []string{"server.read_timeout"}},
+		{"关闭超时过短", func(c *Config) { c.Server.ShutdownTimeout = 0 }, []string{"server.shutdown_timeout"}},
+		{"关闭超时过长", func(c *Config) { c.Server.ShutdownTimeout = 2 * MaxShutdownTimeout }, []string{"server.shutdown_timeout"}},
+		{"数据库路径为空", func(c *Config) { c.Database.Path = "" }, []string{"database.path"}},
+		{"JWT密钥为空", func(c *Config) { c.JWT.Secret = "" }, []string{"jwt.secret"}},
+		{"JWT有效期为0", func(c *Config) { c.JWT.ExpireTime = 0 }, []string{"jwt.expire_time"}},
+		{"日志源格式错误", func(c *Config) { c.Fail2Ban.LogSources = []string{"app=/var/log/app.log", "/var/log/other.log"} }, []string{"fail2ban.log_sources"}},
+		{"IPv6前缀过短", func(c *Config) { c.Scanner.IPv6PrefixLen = 8 }, []string{"scanner.ipv6_prefix"}},
+		{"IPv4网段前缀超出范围", func(c *Config) { c.Scanner.SubnetV4PrefixLen = 33 }, []string{"scanner.subnet_v4_prefix"}},
+		{"扫描周期过短", func(c *Config) {
+			c.Scanner.ScanInterval = 500 * time.Millisecond
+			c.Scanner.AutoProcessInterval = 0
+		}, []string{"scanner.scan_interval", "scanner.auto_process_interval"}},
+		{"评分阈值超出范围", func(c *Config) { c.Scanner.HighScoreThreshold = 101 }, []string{"scanner.high_score_threshold"}},
+		{"封禁时长为0", func(c *Config) { c.Ban.Duration = 0 }, []string{"ban.duration"}},
+		{"递增倍数小于1", func(c *Config) { c.Ban.IncrementFactor = 0.5 }, []string{"ban.increment_factor"}},
+		{"永久封禁次数为负", func(c *Config) { c.Ban.PermanentAfter = -1 }, []string{"ban.permanent_after"}},
+		{"未知的SMTP加密方式", func(c *Config) { c.SMTP.TLSMode = "ssl" }, []string{"smtp.tls"}},
+		{"配置了SMTP但没有发件人", func(c *Config) {
+			c.SMTP.Host = "smtp.example.com"
+			c.SMTP.From = ""
+		}, []string{"smtp.from"}},
+		{"发件人格式错误", func(c *Config) { c.SMTP.From = "not an address" }, []string{"smtp.from"}},
+		// 所有问题一次返回
+		{"多个问题", func(c *Config) {
+			c.Server.Port = ""
+			c.JWT.Secret = ""
+			c.Ban.Duration = -time.Hour
+		}, []string{"server.port", "jwt.secret", "ban.duration"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Defaults()
+			tt.modify(cfg)
+			if got := problemFields(t, cfg.Validate()); !reflect.DeepEqual(got, tt.fields) {
+				t.Errorf("问题字段 = %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  port: "9000"
+  mode: debug
+jwt:
+  secret: from-file
+scanner:
+  ssh_jails: [sshd]
+  scan_interval: 10m
+ban:
+  duration: 1h
+  increment_factor: 3
+`)
+	// 环境变量优先于配置文件
+	t.Setenv("PORT", "9100")
+	t.Setenv("BAN_INCREMENT_FACTOR", "1.5")
+	t.Setenv("SCANNER_NGINX_JAILS", "nginx-http-auth, nginx-botsearch ,")
+	t.Setenv("SMTP_ALERT_COOLDOWN", "15m")
+	// 无法解析的环境变量保留原值
+	t.Setenv("JWT_EXPIRE_TIME", "forever")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.File != path {
+		t.Errorf("File = %q, want %q", cfg.File, path)
+	}
+	checks := []struct {
+		field     string
+		got, want interface{}
+	}{
+		{"server.port", cfg.Server.Port, "9100"},
+		{"server.mode", cfg.Server.Mode, "debug"},
+		{"server.host", cfg.Server.Host, "0.0.0.0"},
+		{"jwt.secret", cfg.JWT.Secret, "from-file"},
+		{"jwt.expire_time", cfg.JWT.ExpireTime, 24},
+		{"scanner.ssh_jails", cfg.Scanner.SSHJails, []string{"sshd"}},
+		{"scanner.nginx_jails", cfg.Scanner.NginxJails, []string{"nginx-http-auth", "nginx-botsearch"}},
+		{"scanner.scan_interval", cfg.Scanner.ScanInterval, 10 * time.Minute},
+		{"scanner.analysis_interval", cfg.Scanner.AnalysisInterval, time.Minute},
+		{"ban.duration", cfg.Ban.Duration, time.Hour},
+		{"ban.increment_factor", cfg.Ban.IncrementFactor, 1.5},
+		{"ban.max_duration", cfg.Ban.MaxDuration, 30 * 24 * time.Hour},
+		{"smtp.alert_cooldown", cfg.SMTP.AlertCooldown, 15 * time.Minute},
+	}
+	for _, check := range checks {
+		if !reflect.DeepEqual(check.got, check.want) {
+			t.Errorf("%s = %v, want %v", check.field, check.got, check.want)
+		}
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"未知字段", "server:\n  prot: \"9000\"\n"},
+		{"未知配置段", "logging:\n  level: debug\n"},
+		{"类型错误", "ban:\n  duration: forever\n"},
+		{"YAML格式错误", "server: [\n"},
+		{"校验失败", "scanner:\n  ipv6_prefix: 8\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfigFile(t, tt.content)); err == nil {
+				t.Error("Load() 没有返回错误")
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("配置文件不存在时 Load() 没有返回错误")
+	}
+
+	// 环境变量覆盖后同样校验
+	t.Setenv("SMTP_TLS", "ssl")
+	if fields := problemFields(t, func() error { _, err := Load(""); return err }()); !reflect.DeepEqual(fields, []string{"smtp.tls"}) {
+		t.Errorf("问题字段 = %v, want [smtp.tls]", fields)
+	}
+}
+
+func TestLoadEmptyFile(t *testing.T) {
+	cfg, err := Load(writeConfigFile(t, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Defaults()
+	want.File = cfg.File
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("空配置文件 Load() = %+v, want 默认配置", cfg)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Defaults()
+	cfg.SMTP.Password = "smtp-secret"
+	redacted := cfg.Redacted()
+
+	if redacted.JWT.Secret != redactedValue || redacted.Admin.Password != redactedValue || redacted.SMTP.Password != redactedValue {
+		t.Errorf("Redacted() = jwt %q, admin %q, smtp %q", redacted.JWT.Secret, redacted.Admin.Password, redacted.SMTP.Password)
+	}
+	if cfg.JWT.Secret == redactedValue || cfg.SMTP.Password != "smtp-secret" {
+		t.Error("Redacted() 修改了原配置")
+	}
+	// 未设置的密码保持为空
+	cfg.SMTP.Password = ""
+	if got := cfg.Redacted().SMTP.Password; got != "" {
+		t.Errorf("空密码 Redacted() = %q", got)
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "server.crt")
+	keyFile := filepath.Join(dir, "server.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	for _, path := range []string{certFile, keyFile, caFile} {
+		if err := os.WriteFile(path, []byte("placeholder"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := filepath.Join(dir, "missing.pem")
+
+	tests := []struct {
+		name   string
+		tls    TLSConfig
+		fields []string
+	}{
+		{"未启用", TLSConfig{ClientAuth: ClientAuthNone}, nil},
+		{"启用", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthNone, RedirectPort: "8080"}, nil},
+		{"只配置了证书", TLSConfig{CertFile: certFile, ClientAuth: ClientAuthNone}, []string{"server.tls"}},
+		{"只配置了私钥", TLSConfig{KeyFile: keyFile, ClientAuth: ClientAuthNone}, []string{"server.tls"}},
+		{"证书文件不存在", TLSConfig{CertFile: missing, KeyFile: keyFile, ClientAuth: ClientAuthNone}, []string{"server.tls.cert_file"}},
+		{"证书路径是目录", TLSConfig{CertFile: certFile, KeyFile: dir, ClientAuth: ClientAuthNone}, []string{"server.tls.key_file"}},
+		{"负的HSTS时长", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthNone, HSTSMaxAge: -time.Hour}, []string{"server.tls.hsts_max_age"}},
+		// HTTP重定向
+		{"未启用时配置重定向", TLSConfig{ClientAuth: ClientAuthNone, RedirectPort: "8080"}, []string{"server.tls.redirect_port"}},
+		{"重定向端口无效", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthNone, RedirectPort: "http"}, []string{"server.tls.redirect_port"}},
+		{"重定向端口与HTTPS端口相同", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthNone, RedirectPort: "8092"}, []string{"server.tls.redirect_port"}},
+		// 客户端证书
+		{"未知的客户端认证方式", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: "verify", ClientCAFile: caFile}, []string{"server.tls.client_auth"}},
+		{"可选客户端证书", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthOptional, ClientCAFile: caFile, ClientCertAdmins: []string{"ops"}}, nil},
+		{"强制客户端证书", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire, ClientCAFile: caFile}, nil},
+		{"缺少客户端CA", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthRequire}, []string{"server.tls.client_ca_file"}},
+		{"客户端CA不存在", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthOptional, ClientCAFile: missing}, []string{"server.tls.client_ca_file"}},
+		{"不校验客户端证书时配置CA", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthNone, ClientCAFile: caFile}, []string{"server.tls.client_ca_file"}},
+		{"不校验客户端证书时配置管理员", TLSConfig{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthNone, ClientCertAdmins: []string{"ops"}}, []string{"server.tls.client_cert_admins"}},
+		{"未启用时配置客户端证书", TLSConfig{ClientAuth: ClientAuthOptional, ClientCertAdmins: []string{"ops"}}, []string{"server.tls.client_auth", "server.tls.client_cert_admins"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Defaults()
+			cfg.Server.TLS = tt.tls
+			if got := problemFields(t, cfg.Validate()); !reflect.DeepEqual(got, tt.fields) {
+				t.Errorf("问题字段 = %v, want %v", got, tt.fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redactedValue 打印配置时替换敏感字段的值
+const redactedValue = "******"
+
+// Load 加载配置：默认值 < 配置文件 < 环境变量，path为空时不读取配置文件。
+// 配置文件中的未知字段和校验失败都会返回错误
+func Load(path string) (*Config, error) {
+	cfg := Defaults()
+	if path != "" {
+		if err := loadFile(cfg, path); err != nil {
+			return nil, err
+		}
+		cfg.File = path
+	}
+	applyEnv(cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// loadFile 将YAML配置文件合并到cfg，文件中未出现的字段保留原值
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("读取配置文件失败: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("解析配置文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+// Redacted 返回隐藏了密码和密钥的配置副本，用于打印和API输出
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.JWT.Secret = redact(c.JWT.Secret)
+	redacted.Admin.Password = redact(c.Admin.Password)
+	redacted.SMTP.Password = redact(c.SMTP.Password)
+	return &redacted
+}
+
+// YAML 将配置编码为YAML，时长以 24h0m0s 形式输出
+func (c *Config) YAML() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(c); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ToMap 将配置转换为以YAML字段名为键的map，用于以JSON输出与配置文件一致的结构
+func (c *Config) ToMap() (map[string]interface{}, error) {
+	data, err := c.YAML()
+	if err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	if err := yaml.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// redact 非空值替换为redactedValue
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
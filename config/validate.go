@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// minLoopInterval 扫描后台循环的最小周期
+const minLoopInterval = time.Second
+
+// MaxShutdownTimeout server.shutdown_timeout的上限，停止应用的总超时需要大于该值
+const MaxShutdownTimeout = time.Minute
+
+// ValidationError 配置校验错误，包含所有不合法的字段
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "配置不合法: " + strings.Join(e.Problems, "; ")
+}
+
+// validator 收集校验问题
+type validator struct {
+	problems []string
+}
+
+func (v *validator) check(ok bool, field, format string, args ...interface{}) {
+	if !ok {
+		v.problems = append(v.problems, field+" "+fmt.Sprintf(format, args...))
+	}
+}
+
+func (v *validator) intRange(field string, value, min, max int) {
+	v.check(value >= min && value <= max, field, "必须在 %d 到 %d 之间，当前为 %d", min, max, value)
+}
+
+func (v *validator) fileExists(field, path string) {
+	info, err := os.Stat(path)
+	if err != nil {
+		v.check(false, field, "无法访问: %v", err)
+		return
+	}
+	v.check(!info.IsDir(), field, "%s 是目录", path)
+}
+
+func (v *validator) oneOf(field, value string, allowed ...string) {
+	for _, item := range allowed {
+		if value == item {
+			return
+		}
+	}
+	v.check(false, field, "必须是 %s 之一，当前为 %q", strings.Join(allowed, "/"), value)
+}
+
+// Validate 校验配置，返回 *ValidationError
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	v.check(err == nil && port >= 1 && port <= 65535, "server.port", "必须是 1 到 65535 之间的端口，当前为 %q", c.Server.Port)
+	v.oneOf("server.mode", c.Server.Mode, "debug", "release", "test")
+	v.check(c.Server.ReadTimeout >= 0, "server.read_timeout", "不能为负数")
+	v.check(c.Server.WriteTimeout >= 0, "server.write_timeout", "不能为负数")
+	v.check(c.Server.IdleTimeout >= 0, "server.idle_timeout", "不能为负数")
+	v.check(c.Server.ShutdownTimeout >= time.Second && c.Server.ShutdownTimeout <= MaxShutdownTimeout,
+		"server.shutdown_timeout", "必须在 %s 到 %s 之间，当前为 %s", time.Second, MaxShutdownTimeout, c.Server.ShutdownTimeout)
+	c.validateTLS(v)
+
+	v.check(c.Database.Path != "", "database.path", "不能为空")
+
+	v.check(c.JWT.Secret != "", "jwt.secret", "不能为空")
+	v.check(c.JWT.ExpireTime > 0, "jwt.expire_time", "必须大于0")
+
+	v.check(c.Admin.Username != "", "admin.username", "不能为空")
+
+	v.check(c.Fail2Ban.ConfigPath != "", "fail2ban.config_path", "不能为空")
+	for _, spec := range c.Fail2Ban.LogSources {
+		v.check(strings.Contains(spec, "="), "fail2ban.log_sources", "格式应为 name[:type]=path，当前为 %q", spec)
+	}
+
+	scanner := c.Scanner
+	v.check(scanner.MaxConcurrentJobs >= 1, "scanner.max_concurrent_jobs", "必须大于等于1")
+	v.intRange("scanner.ipv6_prefix", scanner.IPv6PrefixLen, 16, 128)
+	v.intRange("scanner.subnet_v4_prefix", scanner.SubnetV4PrefixLen, 8, 32)
+	v.intRange("scanner.subnet_v6_prefix", scanner.SubnetV6PrefixLen, 16, 128)
+	v.check(scanner.SubnetMinHosts >= 0, "scanner.subnet_min_hosts", "不能为负数")
+	v.check(scanner.SubnetMinScore >= 0, "scanner.subnet_min_score", "不能为负数")
+	for _, loop := range []struct {
+		field    string
+		interval time.Duration
+	}{
+		{"scanner.scan_interval", scanner.ScanInterval},
+		{"scanner.analysis_interval", scanner.AnalysisInterval},
+		{"scanner.auto_process_interval", scanner.AutoProcessInterval},
+		{"scanner.log_analysis_interval", scanner.LogAnalysisInterval},
+	} {
+		v.check(loop.interval >= minLoopInterval, loop.field, "不能小于 %s，当前为 %s", minLoopInterval, loop.interval)
+	}
+	v.intRange("scanner.high_score_threshold", scanner.HighScoreThreshold, 1, 100)
+	v.check(scanner.SSHBruteForceAttempts >= 1, "scanner.ssh_bruteforce_attempts", "必须大于等于1")
+	v.check(scanner.MultiAttackTypes >= 1, "scanner.multi_attack_types", "必须大于等于1")
+	v.intRange("scanner.multi_attack_score", scanner.MultiAttackScore, 0, 100)
+
+	v.check(c.GeoIP.CacheSize >= 0, "geoip.cache_size", "不能为负数")
+
+	v.check(c.Ban.Duration > 0, "ban.duration", "必须大于0")
+	v.check(c.Ban.IncrementFactor >= 1, "ban.increment_factor", "必须大于等于1")
+	v.check(c.Ban.MaxDuration >= 0, "ban.max_duration", "不能为负数")
+	v.check(c.Ban.Lookback >= 0, "ban.lookback", "不能为负数")
+	v.check(c.Ban.PermanentAfter >= 0, "ban.permanent_after", "不能为负数")
+
+	v.intRange("smtp.port", c.SMTP.Port, 1, 65535)
+	v.oneOf("smtp.tls", c.SMTP.TLSMode, "starttls", "tls", "none")
+	v.check(c.SMTP.Host == "" || c.SMTP.From != "", "smtp.from", "配置了smtp.host时不能为空")
+	if c.SMTP.From != "" {
+		_, err := mail.ParseAddress(c.SMTP.From)
+		v.check(err == nil, "smtp.from", "不是有效的邮件地址")
+	}
+	v.intRange("smtp.alert_min_score", c.SMTP.AlertMinScore, 0, 100)
+	v.check(c.SMTP.AlertCooldown >= 0, "smtp.alert_cooldown", "不能为负数")
+
+	if len(v.problems) > 0 {
+		return &ValidationError{Problems: v.problems}
+	}
+	return nil
+}
+
+// validateTLS 校验HTTPS配置，证书文件需要存在，内容在加载时校验
+func (c *Config) validateTLS(v *validator) {
+	tlsConfig := c.Server.TLS
+	v.check((tlsConfig.CertFile == "") == (tlsConfig.KeyFile == ""), "server.tls", "cert_file和key_file必须同时配置")
+	v.check(tlsConfig.HSTSMaxAge >= 0, "server.tls.hsts_max_age", "不能为负数")
+	v.oneOf("server.tls.client_auth", tlsConfig.ClientAuth, ClientAuthNone, ClientAuthOptional, ClientAuthRequire)
+
+	if !tlsConfig.Enabled() {
+		v.check(tlsConfig.RedirectPort == "", "server.tls.redirect_port", "需要同时配置cert_file和key_file")
+		v.check(tlsConfig.ClientAuth == ClientAuthNone, "server.tls.client_auth", "需要同时配置cert_file和key_file")
+		v.check(len(tlsConfig.ClientCertAdmins) == 0, "server.tls.client_cert_admins", "需要同时配置cert_file和key_file")
+		return
+	}
+
+	v.fileExists("server.tls.cert_file", tlsConfig.CertFile)
+	v.fileExists("server.tls.key_file", tlsConfig.KeyFile)
+
+	if tlsConfig.RedirectPort != "" {
+		port, err := strconv.Atoi(tlsConfig.RedirectPort)
+		v.check(err == nil && port >= 1 && port <= 65535, "server.tls.redirect_port", "必须是 1 到 65535 之间的端口，当前为 %q", tlsConfig.RedirectPort)
+		v.check(tlsConfig.RedirectPort != c.Server.Port, "server.tls.redirect_port", "不能与server.port相同")
+	}
+
+	if tlsConfig.ClientAuth == ClientAuthNone {
+		v.check(tlsConfig.ClientCAFile == "", "server.tls.client_ca_file", "client_auth为none时不会校验客户端证书，请将client_auth设为optional或require")
+		v.check(len(tlsConfig.ClientCertAdmins) == 0, "server.tls.client_cert_admins", "client_auth为none时不会校验客户端证书，请将client_auth设为optional或require")
+	} else {
+		v.check(tlsConfig.ClientCAFile != "", "server.tls.client_ca_file", "client_auth为%s时不能为空", tlsConfig.ClientAuth)
+		if tlsConfig.ClientCAFile != "" {
+			v.fileExists("server.tls.client_ca_file", tlsConfig.ClientCAFile)
+		}
+	}
+}
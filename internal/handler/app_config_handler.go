@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AppConfigHandler struct {
+	configReloadService *service.ConfigReloadService
+}
+
+func NewAppConfigHandler(configReloadService *service.ConfigReloadService) *AppConfigHandler {
+	return &AppConfigHandler{
+		configReloadService: configReloadService,
+	}
+}
+
+// GetConfig 获取当前生效的配置（已隐藏密码和密钥）和最近一次重新加载的结果
+func (h *AppConfigHandler) GetConfig(c *gin.Context) {
+	effective := h.configReloadService.Effective()
+	values, err := effective.ToMap()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_config",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"file":        effective.File,
+		"config":      values,
+		"last_reload": h.configReloadService.LastReload(),
+	})
+}
+
+// ReloadConfig 立即重新加载配置文件
+func (h *AppConfigHandler) ReloadConfig(c *gin.Context) {
+	result, err := h.configReloadService.Reload(service.ConfigReloadAPI)
+	if errors.Is(err, service.ErrNoConfigFile) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "no_config_file",
+			"message": "No config file is loaded, start with -config or CONFIG_FILE to enable reloading",
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":   "config_reload_failed",
+			"message": err.Error(),
+			"result":  result,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Config reloaded successfully",
+		"result":  result,
+	})
+}
@@ -0,0 +1,101 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type BacktestHandler struct {
+	backtestService *service.BacktestService
+}
+
+func NewBacktestHandler(backtestService *service.BacktestService) *BacktestHandler {
+	return &BacktestHandler{
+		backtestService: backtestService,
+	}
+}
+
+// StartBacktest 启动回测任务
+func (h *BacktestHandler) StartBacktest(c *gin.Context) {
+	var req service.BacktestRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	run, err := h.backtestService.StartBacktest(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "failed_to_start_backtest",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":  "回测任务已开始",
+		"backtest": run,
+	})
+}
+
+// GetBacktests 获取回测任务列表
+func (h *BacktestHandler) GetBacktests(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 {
+		limit = 20
+	}
+
+	runs, err := h.backtestService.ListBacktests(limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_backtests",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"backtests": runs,
+		"total":     len(runs),
+	})
+}
+
+// GetBacktest 获取回测任务详情和结果
+func (h *BacktestHandler) GetBacktest(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_backtest_id",
+			"message": "Backtest ID must be a number",
+		})
+		return
+	}
+
+	run, err := h.backtestService.GetBacktest(uint(id))
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "backtest_not_found",
+				"message": "Backtest not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_backtest",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"backtest": run,
+	})
+}
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BanEventHandler struct {
+	banEventService *service.BanEventService
+}
+
+func NewBanEventHandler(banEventService *service.BanEventService) *BanEventHandler {
+	return &BanEventHandler{
+		banEventService: banEventService,
+	}
+}
+
+// GetBanEvents 获取fail2ban事件列表，通过before_id参数翻页
+func (h *BanEventHandler) GetBanEvents(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	beforeID, _ := strconv.ParseUint(c.Query("before_id"), 10, 64)
+
+	filter := service.BanEventFilter{
+		IP:       c.Query("ip"),
+		Jail:     c.Query("jail"),
+		Event:    c.Query("event"),
+		BeforeID: uint(beforeID),
+		Limit:    limit,
+	}
+
+	var err error
+	if filter.Since, err = parseTimeQuery(c, "since"); err != nil {
+		return
+	}
+	if filter.Until, err = parseTimeQuery(c, "until"); err != nil {
+		return
+	}
+
+	events, err := h.banEventService.ListEvents(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_ban_events",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	response := gin.H{
+		"events": events,
+		"total":  len(events),
+	}
+	if len(events) > 0 {
+		response["next_before_id"] = events[len(events)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetIPHistory 获取IP的封禁历史
+func (h *BanEventHandler) GetIPHistory(c *gin.Context) {
+	ip := c.Param("ip")
+	if net.ParseIP(ip) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_ip",
+			"message": "Invalid IP address format",
+		})
+		return
+	}
+
+	history, err := h.banEventService.GetIPHistory(ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_ip_history",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+	})
+}
+
+// GetJailHistory 获取jail的封禁历史
+func (h *BanEventHandler) GetJailHistory(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "7"))
+	if err != nil || days <= 0 {
+		days = 7
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	history, err := h.banEventService.GetJailHistory(c.Param("jail"), since, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_jail_history",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"history": history,
+	})
+}
@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BanLifecycleHandler struct {
+	banLifecycleService *service.BanLifecycleService
+}
+
+func NewBanLifecycleHandler(banLifecycleService *service.BanLifecycleService) *BanLifecycleHandler {
+	return &BanLifecycleHandler{
+		banLifecycleService: banLifecycleService,
+	}
+}
+
+// GetUpcomingExpiries 获取即将到期的封禁，within为时间范围（默认24h），limit为最大条数
+func (h *BanLifecycleHandler) GetUpcomingExpiries(c *gin.Context) {
+	within, err := time.ParseDuration(c.DefaultQuery("within", "24h"))
+	if err != nil || within <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_within",
+			"message": "within must be a positive duration such as 24h",
+		})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	bans, err := h.banLifecycleService.UpcomingExpiries(within, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_upcoming_expiries",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bans":   bans,
+		"total":  len(bans),
+		"within": within.String(),
+	})
+}
+
+// ExtendBan 延长封禁，duration（如 24h）、unban_time、permanent 三者指定一个
+func (h *BanLifecycleHandler) ExtendBan(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_ban_id",
+			"message": "Ban ID must be a number",
+		})
+		return
+	}
+
+	var req struct {
+		Duration  string     `json:"duration"`
+		UnbanTime *time.Time `json:"unban_time"`
+		Permanent bool       `json:"permanent"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	ext := service.BanExtension{
+		UnbanTime: req.UnbanTime,
+		Permanent: req.Permanent,
+	}
+	if req.Duration != "" {
+		if ext.Duration, err = time.ParseDuration(req.Duration); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_duration",
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	ban, err := h.banLifecycleService.ExtendBan(uint(id), ext)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrBanRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "ban_not_found",
+				"message": "Ban record not found",
+			})
+		case errors.Is(err, service.ErrBanNotActive):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "ban_not_active",
+				"message": "Ban has already expired or been lifted",
+			})
+		case errors.Is(err, service.ErrInvalidBanExtension):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_ban_extension",
+				"message": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "failed_to_extend_ban",
+				"message": err.Error(),
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Ban extended successfully",
+		"ban":     ban,
+	})
+}
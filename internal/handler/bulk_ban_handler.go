@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BulkBanHandler struct {
+	bulkBanService *service.BulkBanService
+}
+
+func NewBulkBanHandler(bulkBanService *service.BulkBanService) *BulkBanHandler {
+	return &BulkBanHandler{
+		bulkBanService: bulkBanService,
+	}
+}
+
+// BulkBan 批量封禁IP或网段，jail为all时在所有jail中封禁
+func (h *BulkBanHandler) BulkBan(c *gin.Context) {
+	var req service.BulkBanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	result, err := h.bulkBanService.BulkBan(req)
+	if err != nil {
+		respondBulkError(c, "bulk_ban_failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// BulkUnban 批量解封，可指定IP/网段，或按policy和since（如 1h）筛选封禁记录
+func (h *BulkBanHandler) BulkUnban(c *gin.Context) {
+	var req struct {
+		Targets []string `json:"targets"`
+		Jail    string   `json:"jail"`
+		Policy  string   `json:"policy"`
+		Since   string   `json:"since"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	unban := service.BulkUnbanRequest{
+		Targets: req.Targets,
+		Jail:    req.Jail,
+		Policy:  req.Policy,
+	}
+	if req.Since != "" {
+		since, err := time.ParseDuration(req.Since)
+		if err != nil || since <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_since",
+				"message": "since must be a positive duration such as 1h",
+			})
+			return
+		}
+		unban.Since = since
+	}
+
+	result, err := h.bulkBanService.BulkUnban(unban)
+	if err != nil {
+		respondBulkError(c, "bulk_unban_failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// UnbanEverywhere 从所有jail中解封IP，whitelist_for（如 1h）指定解封后的临时白名单时长
+func (h *BulkBanHandler) UnbanEverywhere(c *gin.Context) {
+	var req struct {
+		IP           string `json:"ip" binding:"required"`
+		WhitelistFor string `json:"whitelist_for"`
+		CreatedBy    string `json:"created_by"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	var whitelistFor time.Duration
+	if req.WhitelistFor != "" {
+		var err error
+		if whitelistFor, err = time.ParseDuration(req.WhitelistFor); err != nil || whitelistFor <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_whitelist_for",
+				"message": "whitelist_for must be a positive duration such as 1h",
+			})
+			return
+		}
+	}
+
+	result, err := h.bulkBanService.UnbanEverywhere(req.IP, whitelistFor, req.CreatedBy)
+	if err != nil {
+		respondBulkError(c, "unban_failed", err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func respondBulkError(c *gin.Context, code string, err error) {
+	if errors.Is(err, service.ErrInvalidBulkRequest) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_bulk_request",
+			"message": err.Error(),
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{
+		"error":   code,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,239 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"fail2ban-web/internal/model"
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type EmailReportHandler struct {
+	emailReportService *service.EmailReportService
+}
+
+func NewEmailReportHandler(emailReportService *service.EmailReportService) *EmailReportHandler {
+	return &EmailReportHandler{
+		emailReportService: emailReportService,
+	}
+}
+
+// emailReportRequest 创建/更新摘要报告的请求
+type emailReportRequest struct {
+	Name       string   `json:"name"`
+	Recipients []string `json:"recipients"`
+	Frequency  string   `json:"frequency"`
+	Hour       int      `json:"hour"`
+	Weekday    int      `json:"weekday"`
+	Enabled    *bool    `json:"enabled"`
+}
+
+// report 转换为摘要报告模型，enabled默认为true
+func (r *emailReportRequest) report() *model.EmailReport {
+	report := &model.EmailReport{
+		Name:       r.Name,
+		Recipients: r.Recipients,
+		Frequency:  r.Frequency,
+		Hour:       r.Hour,
+		Weekday:    r.Weekday,
+		Enabled:    true,
+	}
+	if r.Enabled != nil {
+		report.Enabled = *r.Enabled
+	}
+	return report
+}
+
+// GetReports 获取摘要报告列表
+func (h *EmailReportHandler) GetReports(c *gin.Context) {
+	reports, err := h.emailReportService.ListReports()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_email_reports",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": reports,
+		"total":   len(reports),
+	})
+}
+
+// GetReport 获取单个摘要报告
+func (h *EmailReportHandler) GetReport(c *gin.Context) {
+	id, ok := parseEmailReportID(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.emailReportService.GetReport(id)
+	if err != nil {
+		respondEmailReportError(c, err, "failed_to_get_email_report")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report": report,
+	})
+}
+
+// CreateReport 创建摘要报告
+func (h *EmailReportHandler) CreateReport(c *gin.Context) {
+	var req emailReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	report := req.report()
+	if err := h.emailReportService.CreateReport(report); err != nil {
+		respondEmailReportError(c, err, "failed_to_create_email_report")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Email report created successfully",
+		"report":  report,
+	})
+}
+
+// UpdateReport 更新摘要报告
+func (h *EmailReportHandler) UpdateReport(c *gin.Context) {
+	id, ok := parseEmailReportID(c)
+	if !ok {
+		return
+	}
+
+	var req emailReportRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	updated, err := h.emailReportService.UpdateReport(id, req.report())
+	if err != nil {
+		respondEmailReportError(c, err, "failed_to_update_email_report")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email report updated successfully",
+		"report":  updated,
+	})
+}
+
+// DeleteReport 删除摘要报告
+func (h *EmailReportHandler) DeleteReport(c *gin.Context) {
+	id, ok := parseEmailReportID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.emailReportService.DeleteReport(id); err != nil {
+		respondEmailReportError(c, err, "failed_to_delete_email_report")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Email report deleted successfully",
+	})
+}
+
+// SendReport 立即发送摘要报告
+func (h *EmailReportHandler) SendReport(c *gin.Context) {
+	id, ok := parseEmailReportID(c)
+	if !ok {
+		return
+	}
+
+	report, err := h.emailReportService.SendNow(id)
+	if err != nil {
+		respondEmailReportError(c, err, "failed_to_send_email_report")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "Email report sent successfully",
+		"recipients": report.Recipients,
+	})
+}
+
+// PreviewReport 预览摘要报告，format为html（默认）、text或json
+func (h *EmailReportHandler) PreviewReport(c *gin.Context) {
+	id, ok := parseEmailReportID(c)
+	if !ok {
+		return
+	}
+
+	digest, text, html, err := h.emailReportService.Preview(id)
+	if err != nil {
+		respondEmailReportError(c, err, "failed_to_preview_email_report")
+		return
+	}
+
+	switch c.DefaultQuery("format", "html") {
+	case "html":
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(html))
+	case "text":
+		c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(text))
+	case "json":
+		c.JSON(http.StatusOK, gin.H{
+			"digest": digest,
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_format",
+			"message": "format must be html, text or json",
+		})
+	}
+}
+
+// parseEmailReportID 解析路径中的摘要报告ID，失败时直接返回错误响应
+func parseEmailReportID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_email_report_id",
+			"message": "Email report ID must be a number",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondEmailReportError 将摘要报告服务的错误转换为对应的HTTP响应
+func respondEmailReportError(c *gin.Context, err error, code string) {
+	switch {
+	case errors.Is(err, service.ErrEmailReportNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "email_report_not_found",
+			"message": "Email report not found",
+		})
+	case errors.Is(err, service.ErrInvalidEmailReport):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_email_report",
+			"message": err.Error(),
+		})
+	case errors.Is(err, service.ErrSMTPNotConfigured):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "smtp_not_configured",
+			"message": "SMTP server is not configured",
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   code,
+			"message": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// eventHeartbeatInterval 事件流心跳间隔，避免代理因空闲断开连接
+	eventHeartbeatInterval = 15 * time.Second
+	// eventWriteTimeout WebSocket单次写入超时
+	eventWriteTimeout = 10 * time.Second
+)
+
+type EventHandler struct {
+	eventBus     *service.EventBus
+	upgrader     websocket.Upgrader
+	shutdown     chan struct{} // 关闭后所有事件流连接退出
+	shutdownOnce sync.Once
+}
+
+func NewEventHandler(eventBus *service.EventBus) *EventHandler {
+	return &EventHandler{
+		eventBus: eventBus,
+		upgrader: websocket.Upgrader{
+			CheckOrigin: checkWebSocketOrigin,
+		},
+		shutdown: make(chan struct{}),
+	}
+}
+
+// checkWebSocketOrigin 只接受同源页面发起的WebSocket连接，防止其他站点借用浏览器中的客户端证书；
+// 没有Origin头的请求来自非浏览器客户端，不受限制
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// Shutdown 结束所有事件流连接，HTTP服务器停止时调用，否则长连接会一直占用到停止超时
+func (h *EventHandler) Shutdown() {
+	h.shutdownOnce.Do(func() {
+		close(h.shutdown)
+	})
+}
+
+// subscribe 解析topics和Last-Event-ID并订阅事件总线
+func (h *EventHandler) subscribe(c *gin.Context) (*service.EventSubscription, bool, bool) {
+	var topics []string
+	if raw := c.Query("topics"); raw != "" {
+		for _, topic := range strings.Split(raw, ",") {
+			topic = strings.TrimSpace(topic)
+			if !service.IsEventTopic(topic) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "invalid_topic",
+					"message": fmt.Sprintf("Unknown topic %q, available topics: %s", topic, strings.Join(service.EventTopics, ", ")),
+				})
+				return nil, false, false
+			}
+			topics = append(topics, topic)
+		}
+	}
+
+	// EventSource断线重连时自动带上Last-Event-ID头，WebSocket使用查询参数
+	rawLastID := c.GetHeader("Last-Event-ID")
+	if rawLastID == "" {
+		rawLastID = c.Query("last_event_id")
+	}
+	var lastID uint64
+	if rawLastID != "" {
+		var err error
+		if lastID, err = strconv.ParseUint(rawLastID, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "invalid_last_event_id",
+				"message": "Last event ID must be a number",
+			})
+			return nil, false, false
+		}
+	}
+
+	sub, complete := h.eventBus.Subscribe(topics, lastID)
+	return sub, complete, true
+}
+
+// streamNotice 事件流自身的控制消息
+func streamNotice(noticeType string) service.Event {
+	return service.Event{
+		Topic: service.EventTopicStream,
+		Type:  noticeType,
+		Time:  time.Now(),
+	}
+}
+
+// StreamEvents 通过Server-Sent Events推送事件，topics按逗号分隔过滤主题
+func (h *EventHandler) StreamEvents(c *gin.Context) {
+	sub, complete, ok := h.subscribe(c)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// 事件流是长连接，不受服务器写超时限制
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{})
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		// 部分事件已不在缓冲区中，客户端应重新拉取完整状态
+		writeSSE(w, streamNotice("reset"))
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-h.shutdown:
+			// 客户端会按retry间隔自动重连
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			w.Flush()
+		case event, open := <-sub.Events:
+			if !open {
+				if sub.Lagged {
+					writeSSE(w, streamNotice("lagged"))
+					w.Flush()
+				}
+				return
+			}
+			writeSSE(w, event)
+			w.Flush()
+		}
+	}
+}
+
+// writeSSE 写入一条SSE消息，事件名为主题，控制消息不带ID以免影响续传位置
+func writeSSE(w gin.ResponseWriter, event service.Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	if event.ID > 0 {
+		fmt.Fprintf(w, "id: %d\n", event.ID)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Topic, data)
+}
+
+// StreamEventsWebSocket 通过WebSocket推送事件，每条消息为一个JSON事件
+func (h *EventHandler) StreamEventsWebSocket(c *gin.Context) {
+	sub, complete, ok := h.subscribe(c)
+	if !ok {
+		return
+	}
+	defer sub.Close()
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// Upgrade已经向客户端返回了错误
+		return
+	}
+	defer conn.Close()
+
+	// 读取并丢弃客户端消息，以便处理ping/pong和关闭帧
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(event service.Event) error {
+		conn.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+		return conn.WriteJSON(event)
+	}
+
+	if !complete {
+		if err := write(streamNotice("reset")); err != nil {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-h.shutdown:
+			conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down"),
+				time.Now().Add(eventWriteTimeout))
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(eventWriteTimeout)); err != nil {
+				return
+			}
+		case event, open := <-sub.Events:
+			if !open {
+				if sub.Lagged {
+					write(streamNotice("lagged"))
+				}
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber lagged"),
+					time.Now().Add(eventWriteTimeout))
+				return
+			}
+			if err := write(event); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -11,12 +11,16 @@ import (
 )
 
 type Fail2BanHandler struct {
-	fail2banService *service.Fail2BanService
+	fail2banService     *service.Fail2BanService
+	whitelistService    *service.WhitelistService
+	banLifecycleService *service.BanLifecycleService
 }
 
-func NewFail2BanHandler(fail2banService *service.Fail2BanService) *Fail2BanHandler {
+func NewFail2BanHandler(fail2banService *service.Fail2BanService, whitelistService *service.WhitelistService, banLifecycleService *service.BanLifecycleService) *Fail2BanHandler {
 	return &Fail2BanHandler{
-		fail2banService: fail2banService,
+		fail2banService:     fail2banService,
+		whitelistService:    whitelistService,
+		banLifecycleService: banLifecycleService,
 	}
 }
 
@@ -73,7 +77,7 @@ func (h *Fail2BanHandler) UnbanIP(c *gin.Context) {
 		return
 	}
 
-	if err := h.fail2banService.UnbanIP(req.Jail, req.IP); err != nil {
+	if err := h.banLifecycleService.Unban(req.Jail, req.IP); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "unban_failed",
 			"message": "Failed to unban IP",
@@ -99,6 +103,10 @@ func (h *Fail2BanHandler) BanIP(c *gin.Context) {
 		return
 	}
 
+	if rejectWhitelisted(c, h.whitelistService, req.IP) {
+		return
+	}
+
 	if err := h.fail2banService.BanIP(req.Jail, req.IP); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "ban_failed",
@@ -171,45 +179,6 @@ func (h *Fail2BanHandler) GetJailStatus(c *gin.Context) {
 	})
 }
 
-// GetLogs 获取日志
-func (h *Fail2BanHandler) GetLogs(c *gin.Context) {
-	// 获取查询参数
-	filePath := c.DefaultQuery("file", "/var/log/fail2ban.log")
-	linesStr := c.DefaultQuery("lines", "100")
-	search := c.Query("search")
-
-	lines, _ := strconv.Atoi(linesStr)
-	if lines <= 0 {
-		lines = 100
-	}
-	if lines > 1000 {
-		lines = 1000 // 限制最大行数
-	}
-
-	var logLines []string
-	var err error
-
-	if search != "" {
-		logLines, err = h.fail2banService.SearchLogs(filePath, search, lines)
-	} else {
-		logLines, err = h.fail2banService.ParseLogFile(filePath, lines)
-	}
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "logs_fetch_failed",
-			"message": "Failed to fetch logs",
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"logs":  logLines,
-		"total": len(logLines),
-		"file":  filePath,
-	})
-}
-
 // GetVersion 获取Fail2Ban版本
 func (h *Fail2BanHandler) GetVersion(c *gin.Context) {
 	version, err := h.fail2banService.GetVersion()
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GeoHandler struct {
+	geoService *service.GeoService
+}
+
+func NewGeoHandler(geoService *service.GeoService) *GeoHandler {
+	return &GeoHandler{
+		geoService: geoService,
+	}
+}
+
+// GetStatus 获取GeoIP数据库加载状态
+func (h *GeoHandler) GetStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": h.geoService.Status(),
+	})
+}
+
+// Reload 立即检查并重新加载GeoIP数据库
+func (h *GeoHandler) Reload(c *gin.Context) {
+	if err := h.geoService.Reload(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_reload_geoip",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "GeoIP databases reloaded",
+		"status":  h.geoService.Status(),
+	})
+}
+
+// Lookup 查询单个IP的地理位置和ASN信息
+func (h *GeoHandler) Lookup(c *gin.Context) {
+	ip := c.Param("ip")
+	if net.ParseIP(ip) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_ip",
+			"message": "Invalid IP address format",
+		})
+		return
+	}
+
+	info, err := h.geoService.Lookup(ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_lookup_geoip",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"ip":  ip,
+		"geo": info,
+	})
+}
@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"fail2ban-web/internal/model"
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GeoPolicyHandler struct {
+	geoPolicyService   *service.GeoPolicyService
+	intelligentService *service.IntelligentScanService
+}
+
+func NewGeoPolicyHandler(geoPolicyService *service.GeoPolicyService, intelligentService *service.IntelligentScanService) *GeoPolicyHandler {
+	return &GeoPolicyHandler{
+		geoPolicyService:   geoPolicyService,
+		intelligentService: intelligentService,
+	}
+}
+
+// GetPolicies 获取GeoIP策略列表
+func (h *GeoPolicyHandler) GetPolicies(c *gin.Context) {
+	policies, err := h.geoPolicyService.ListPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_geo_policies",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policies": policies,
+		"total":    len(policies),
+	})
+}
+
+// GetPolicy 获取单个GeoIP策略
+func (h *GeoPolicyHandler) GetPolicy(c *gin.Context) {
+	id, ok := parseGeoPolicyID(c)
+	if !ok {
+		return
+	}
+
+	policy, err := h.geoPolicyService.GetPolicy(id)
+	if err != nil {
+		respondGeoPolicyError(c, err, "failed_to_get_geo_policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"policy": policy,
+	})
+}
+
+// CreatePolicy 创建GeoIP策略，enabled默认为true
+func (h *GeoPolicyHandler) CreatePolicy(c *gin.Context) {
+	policy := model.GeoPolicy{Enabled: true}
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.geoPolicyService.CreatePolicy(&policy); err != nil {
+		respondGeoPolicyError(c, err, "failed_to_create_geo_policy")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Geo policy created successfully",
+		"policy":  policy,
+	})
+}
+
+// UpdatePolicy 更新GeoIP策略
+func (h *GeoPolicyHandler) UpdatePolicy(c *gin.Context) {
+	id, ok := parseGeoPolicyID(c)
+	if !ok {
+		return
+	}
+
+	policy := model.GeoPolicy{Enabled: true}
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	updated, err := h.geoPolicyService.UpdatePolicy(id, &policy)
+	if err != nil {
+		respondGeoPolicyError(c, err, "failed_to_update_geo_policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Geo policy updated successfully",
+		"policy":  updated,
+	})
+}
+
+// DeletePolicy 删除GeoIP策略
+func (h *GeoPolicyHandler) DeletePolicy(c *gin.Context) {
+	id, ok := parseGeoPolicyID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.geoPolicyService.DeletePolicy(id); err != nil {
+		respondGeoPolicyError(c, err, "failed_to_delete_geo_policy")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Geo policy deleted successfully",
+	})
+}
+
+// GetPolicyMatches 获取每个策略命中当前威胁的数量
+func (h *GeoPolicyHandler) GetPolicyMatches(c *gin.Context) {
+	matches, err := h.geoPolicyService.MatchCounts(h.intelligentService.GetCurrentThreats())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_geo_policy_matches",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"matches": matches,
+	})
+}
+
+// GenerateIPSet 为策略生成覆盖整个国家/ASN的ipset jail
+func (h *GeoPolicyHandler) GenerateIPSet(c *gin.Context) {
+	id, ok := parseGeoPolicyID(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.geoPolicyService.GenerateIPSet(id)
+	if err != nil {
+		respondGeoPolicyError(c, err, "failed_to_generate_ipset")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"result": result,
+	})
+}
+
+// parseGeoPolicyID 解析路径中的策略ID，失败时直接返回错误响应
+func parseGeoPolicyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_policy_id",
+			"message": "Policy ID must be a number",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondGeoPolicyError 将策略服务的错误转换为对应的HTTP响应
+func respondGeoPolicyError(c *gin.Context, err error, code string) {
+	switch {
+	case errors.Is(err, service.ErrGeoPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "geo_policy_not_found",
+			"message": "Geo policy not found",
+		})
+	case errors.Is(err, service.ErrInvalidGeoPolicy):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_geo_policy",
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   code,
+			"message": err.Error(),
+		})
+	}
+}
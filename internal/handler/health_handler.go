@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type HealthHandler struct {
+	healthService *service.HealthService
+}
+
+func NewHealthHandler(healthService *service.HealthService) *HealthHandler {
+	return &HealthHandler{
+		healthService: healthService,
+	}
+}
+
+// Healthz 存活检查，进程能处理请求即返回200，不检查任何依赖
+func (h *HealthHandler) Healthz(c *gin.Context) {
+	startedAt := h.healthService.StartedAt()
+	c.JSON(http.StatusOK, gin.H{
+		"status":         service.HealthStatusOK,
+		"started_at":     startedAt,
+		"uptime_seconds": int64(time.Since(startedAt) / time.Second),
+	})
+}
+
+// Readyz 就绪检查，返回各组件的检查结果；关键组件异常时返回503，非关键组件异常时为degraded但仍返回200
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	report := h.healthService.Readiness(c.Request.Context())
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -1,8 +1,10 @@
 package handler
 
 import (
-	"log"
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"fail2ban-web/internal/service"
 
@@ -11,11 +13,13 @@ import (
 
 type IntelligentHandler struct {
 	intelligentService *service.IntelligentScanService
+	logSourceService   *service.LogSourceService
 }
 
-func NewIntelligentHandler(intelligentService *service.IntelligentScanService) *IntelligentHandler {
+func NewIntelligentHandler(intelligentService *service.IntelligentScanService, logSourceService *service.LogSourceService) *IntelligentHandler {
 	return &IntelligentHandler{
 		intelligentService: intelligentService,
+		logSourceService:   logSourceService,
 	}
 }
 
@@ -29,6 +33,17 @@ func (h *IntelligentHandler) GetCurrentThreats(c *gin.Context) {
 	})
 }
 
+// GetSubnetThreats 获取网段级威胁汇总及升级阈值
+func (h *IntelligentHandler) GetSubnetThreats(c *gin.Context) {
+	subnets := h.intelligentService.GetSubnetThreats()
+	
+	c.JSON(http.StatusOK, gin.H{
+		"subnets":    subnets,
+		"total":      len(subnets),
+		"escalation": h.intelligentService.GetSubnetEscalationConfig(),
+	})
+}
+
 // GetScanResult 获取扫描结果
 func (h *IntelligentHandler) GetScanResult(c *gin.Context) {
 	result := h.intelligentService.GetScanResult()
@@ -58,6 +73,13 @@ func (h *IntelligentHandler) ManualBanIP(c *gin.Context) {
 	}
 
 	if err := h.intelligentService.ManualBanIP(req.IP, req.Reason); err != nil {
+		if errors.Is(err, service.ErrIPWhitelisted) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "ip_whitelisted",
+				"message": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed_to_ban_ip",
 			"message": err.Error(),
@@ -84,7 +106,10 @@ func (h *IntelligentHandler) GetThreatStats(c *gin.Context) {
 		AutoBanned     int `json:"auto_banned"`
 		SSHThreats     int `json:"ssh_threats"`
 		NginxThreats   int `json:"nginx_threats"`
-	}{}
+		ByCountry      map[string]int `json:"by_country"`
+	}{
+		ByCountry: make(map[string]int),
+	}
 	
 	for _, threat := range threats {
 		stats.TotalThreats++
@@ -101,6 +126,10 @@ func (h *IntelligentHandler) GetThreatStats(c *gin.Context) {
 			stats.NginxThreats++
 		}
 		
+		if threat.Country != "" {
+			stats.ByCountry[threat.Country]++
+		}
+		
 		if threat.ThreatScore >= 80 {
 			stats.HighRisk++
 		} else if threat.ThreatScore >= 50 {
@@ -118,42 +147,145 @@ func (h *IntelligentHandler) GetThreatStats(c *gin.Context) {
 // AnalyzeLogFile 分析日志文件
 func (h *IntelligentHandler) AnalyzeLogFile(c *gin.Context) {
 	var req struct {
-		LogFilePath string `json:"log_file_path" binding:"required"`
+		Source string `json:"source" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":   "invalid_request",
-			"message": "log_file_path is required",
+			"message": "source is required",
 		})
 		return
 	}
 
-	// 异步分析日志文件
-	go func() {
-		if err := h.intelligentService.AnalyzeLogFile(req.LogFilePath); err != nil {
-			log.Printf("日志分析失败: %v", err)
+	// 只允许分析已配置的日志源
+	source, err := h.logSourceService.GetSource(req.Source)
+	if err != nil {
+		if errors.Is(err, service.ErrLogSourceNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error":   "log_source_not_found",
+				"message": "Unknown log source: " + req.Source,
+			})
+			return
 		}
-	}()
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_log_source",
+			"message": err.Error(),
+		})
+		return
+	}
+	if !source.Exists {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "log_file_not_found",
+			"message": "Log file for source " + source.Name + " does not exist",
+		})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
+	// 提交异步分析任务
+	job, err := h.intelligentService.SubmitLogAnalysis(service.JobTypeAnalyzeLog, source.Path)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_submit_job",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
 		"message":       "日志分析已开始",
-		"log_file_path": req.LogFilePath,
-		"status":        "processing",
+		"source":        source.Name,
+		"status":        job.Status,
+		"job_id":        job.ID,
 	})
 }
 
 // AnalyzeAccessLog 分析access.log文件
 func (h *IntelligentHandler) AnalyzeAccessLog(c *gin.Context) {
-	// 异步分析access.log文件
-	go func() {
-		if err := h.intelligentService.AnalyzeAccessLog(); err != nil {
-			log.Printf("access.log分析失败: %v", err)
-		}
-	}()
+	logFile := h.intelligentService.FindAccessLog()
+	if logFile == "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "access_log_not_found",
+			"message": "未找到access.log文件",
+		})
+		return
+	}
+
+	// 提交异步分析任务
+	job, err := h.intelligentService.SubmitLogAnalysis(service.JobTypeAnalyzeAccessLog, logFile)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_submit_job",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":       "access.log自动分析已开始",
+		"log_file_path": logFile,
+		"status":        job.Status,
+		"job_id":        job.ID,
+	})
+}
 
+// GetObserveConfig 获取观察模式配置
+func (h *IntelligentHandler) GetObserveConfig(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
-		"message": "access.log自动分析已开始",
-		"status":  "processing",
+		"config":   h.intelligentService.GetObserveConfig(),
+		"policies": service.BanPolicies,
 	})
-}
\ No newline at end of file
+}
+
+// UpdateObserveConfig 更新观察模式配置
+func (h *IntelligentHandler) UpdateObserveConfig(c *gin.Context) {
+	var req service.ObserveConfig
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.intelligentService.SetObserveConfig(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_observe_config",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "观察模式配置已更新",
+		"config":  h.intelligentService.GetObserveConfig(),
+	})
+}
+
+// GetObserveReport 获取观察模式报告（本应封禁的IP）
+func (h *IntelligentHandler) GetObserveReport(c *gin.Context) {
+	hours, err := strconv.Atoi(c.DefaultQuery("hours", "24"))
+	if err != nil || hours <= 0 {
+		hours = 24
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		limit = 100
+	}
+
+	until := time.Now()
+	since := until.Add(-time.Duration(hours) * time.Hour)
+
+	report, err := h.intelligentService.GetObserveReport(since, until, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_report",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"report": report,
+	})
+}
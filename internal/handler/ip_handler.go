@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type IPHandler struct {
+	dossierService *service.IPDossierService
+}
+
+func NewIPHandler(dossierService *service.IPDossierService) *IPHandler {
+	return &IPHandler{
+		dossierService: dossierService,
+	}
+}
+
+// GetIPDossier 获取IP的汇总调查信息
+func (h *IPHandler) GetIPDossier(c *gin.Context) {
+	ip := c.Param("ip")
+	if net.ParseIP(ip) == nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_ip",
+			"message": "Invalid IP address format",
+		})
+		return
+	}
+
+	dossier, err := h.dossierService.GetDossier(ip)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_ip_dossier",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"dossier": dossier,
+	})
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxIPListUploadSize IP列表文件的最大大小
+const maxIPListUploadSize = 64 << 20
+
+type IPListHandler struct {
+	ipListService *service.IPListService
+}
+
+func NewIPListHandler(ipListService *service.IPListService) *IPListHandler {
+	return &IPListHandler{
+		ipListService: ipListService,
+	}
+}
+
+// GetLists 获取所有IP列表，不包含网段内容
+func (h *IPListHandler) GetLists(c *gin.Context) {
+	lists, err := h.ipListService.ListLists()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_ip_lists",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"lists": lists,
+		"total": len(lists),
+	})
+}
+
+// GetList 获取单个IP列表及其网段
+func (h *IPListHandler) GetList(c *gin.Context) {
+	id, ok := parseIPListID(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.ipListService.GetList(id)
+	if err != nil {
+		respondIPListError(c, err, "failed_to_get_ip_list")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"list": list,
+	})
+}
+
+// ImportList 导入IP列表，支持multipart文件上传（字段file）或直接在请求体中提交文件内容
+// 参数name、kind(allow/deny)、format(text/csv/json)、description可以通过表单或查询参数传递
+func (h *IPListHandler) ImportList(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxIPListUploadSize)
+
+	var (
+		reader   io.Reader
+		filename string
+	)
+	if file, header, err := c.Request.FormFile("file"); err == nil {
+		defer file.Close()
+		reader = file
+		filename = header.Filename
+	} else {
+		reader = c.Request.Body
+		filename = c.Query("filename")
+	}
+
+	name := c.DefaultPostForm("name", c.Query("name"))
+	kind := c.DefaultPostForm("kind", c.DefaultQuery("kind", service.IPListKindDeny))
+	format := c.DefaultPostForm("format", c.Query("format"))
+	description := c.DefaultPostForm("description", c.Query("description"))
+
+	list, result, err := h.ipListService.ImportList(name, kind, description, filename, format, reader)
+	if err != nil {
+		respondIPListError(c, err, "failed_to_import_ip_list")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "IP list imported successfully",
+		"list":    list,
+		"result":  result,
+	})
+}
+
+// DeleteList 删除IP列表
+func (h *IPListHandler) DeleteList(c *gin.Context) {
+	id, ok := parseIPListID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.ipListService.DeleteList(id); err != nil {
+		respondIPListError(c, err, "failed_to_delete_ip_list")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "IP list deleted successfully",
+	})
+}
+
+// CheckIP 检查IP命中的允许和拒绝列表
+func (h *IPListHandler) CheckIP(c *gin.Context) {
+	ip := c.Param("ip")
+
+	c.JSON(http.StatusOK, gin.H{
+		"ip":    ip,
+		"allow": h.ipListService.MatchAllow(ip),
+		"deny":  h.ipListService.MatchDeny(ip),
+	})
+}
+
+// parseIPListID 解析路径中的IP列表ID，失败时直接返回错误响应
+func parseIPListID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_ip_list_id",
+			"message": "IP list ID must be a number",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondIPListError 将IP列表服务的错误转换为对应的HTTP响应
+func respondIPListError(c *gin.Context, err error, code string) {
+	switch {
+	case errors.Is(err, service.ErrIPListNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "ip_list_not_found",
+			"message": "IP list not found",
+		})
+	case errors.Is(err, service.ErrInvalidIPList):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_ip_list",
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   code,
+			"message": err.Error(),
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LogHandler struct {
+	logSourceService *service.LogSourceService
+}
+
+func NewLogHandler(logSourceService *service.LogSourceService) *LogHandler {
+	return &LogHandler{
+		logSourceService: logSourceService,
+	}
+}
+
+// GetLogSources 获取可用的日志源
+func (h *LogHandler) GetLogSources(c *gin.Context) {
+	sources := h.logSourceService.ListSources()
+
+	c.JSON(http.StatusOK, gin.H{
+		"sources": sources,
+		"total":   len(sources),
+	})
+}
+
+// GetLogs 获取日志，支持按内容、正则和时间范围搜索
+func (h *LogHandler) GetLogs(c *gin.Context) {
+	if c.Query("file") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "file_not_supported",
+			"message": "Log files must be referenced by source name, see /api/v1/log-sources",
+		})
+		return
+	}
+
+	source := c.DefaultQuery("source", "fail2ban")
+
+	lines, _ := strconv.Atoi(c.DefaultQuery("lines", "100"))
+	if lines <= 0 {
+		lines = 100
+	}
+	if lines > 1000 {
+		lines = 1000 // 限制最大行数
+	}
+
+	opts := service.LogSearchOptions{
+		Query:         c.Query("search"),
+		Regex:         c.Query("regex") == "true",
+		CaseSensitive: c.Query("case_sensitive") == "true",
+		Limit:         lines,
+	}
+	opts.Context, _ = strconv.Atoi(c.DefaultQuery("context", "0"))
+
+	var err error
+	if opts.Since, err = parseTimeQuery(c, "since"); err != nil {
+		return
+	}
+	if opts.Until, err = parseTimeQuery(c, "until"); err != nil {
+		return
+	}
+
+	// 没有搜索条件时直接读取末尾的日志
+	if opts.Query == "" && opts.Since.IsZero() && opts.Until.IsZero() {
+		logLines, err := h.logSourceService.TailLines(source, lines)
+		if err != nil {
+			h.respondLogError(c, source, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"logs":   logLines,
+			"total":  len(logLines),
+			"source": source,
+		})
+		return
+	}
+
+	result, err := h.logSourceService.Search(source, opts)
+	if err != nil {
+		h.respondLogError(c, source, err)
+		return
+	}
+
+	logLines := make([]string, len(result.Matches))
+	for i, match := range result.Matches {
+		logLines[i] = match.Line
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":        logLines,
+		"matches":     result.Matches,
+		"total":       len(logLines),
+		"total_found": result.TotalFound,
+		"truncated":   result.Truncated,
+		"source":      source,
+	})
+}
+
+// SearchLogs 结构化日志搜索，返回解析后的记录，通过cursor参数翻页
+func (h *LogHandler) SearchLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	query := service.LogQuery{
+		IP:     c.Query("ip"),
+		CIDR:   c.Query("cidr"),
+		Jail:   c.Query("jail"),
+		Event:  c.Query("event"),
+		Status: c.Query("status"),
+		Text:   c.Query("q"),
+		Limit:  limit,
+		Cursor: c.Query("cursor"),
+	}
+
+	var err error
+	if query.Since, err = parseTimeQuery(c, "since"); err != nil {
+		return
+	}
+	if query.Until, err = parseTimeQuery(c, "until"); err != nil {
+		return
+	}
+
+	// 未指定起始时间时默认搜索最近24小时
+	if query.Since.IsZero() && query.Cursor == "" {
+		query.Since = time.Now().Add(-24 * time.Hour)
+	}
+
+	source := c.DefaultQuery("source", "fail2ban")
+	result, err := h.logSourceService.QueryLogs(source, query)
+	if err != nil {
+		h.respondLogError(c, source, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// respondLogError 返回日志读取错误
+func (h *LogHandler) respondLogError(c *gin.Context, source string, err error) {
+	if errors.Is(err, service.ErrLogSourceNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "log_source_not_found",
+			"message": "Unknown log source: " + source,
+		})
+		return
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":   "logs_fetch_failed",
+		"message": err.Error(),
+	})
+}
+
+// parseTimeQuery 解析RFC3339格式的时间参数，失败时直接返回错误响应
+func parseTimeQuery(c *gin.Context, key string) (time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_time",
+			"message": key + " must be an RFC3339 timestamp",
+		})
+		return time.Time{}, err
+	}
+	return t, nil
+}
@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"net/http"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsHandler struct {
+	handler http.Handler
+}
+
+func NewMetricsHandler(metrics *service.Metrics) *MetricsHandler {
+	return &MetricsHandler{
+		handler: metrics.Handler(),
+	}
+}
+
+// GetMetrics 以Prometheus文本格式输出指标
+func (h *MetricsHandler) GetMetrics(c *gin.Context) {
+	h.handler.ServeHTTP(c.Writer, c.Request)
+}
@@ -13,13 +13,15 @@ type NginxHandler struct {
 	nginxService *service.NginxService
 	defaultNginxService *service.DefaultNginxService
 	defaultNginxAdvancedService *service.DefaultNginxAdvancedService
+	whitelistService *service.WhitelistService
 }
 
-func NewNginxHandler(nginxService *service.NginxService, defaultNginxService *service.DefaultNginxService, defaultNginxAdvancedService *service.DefaultNginxAdvancedService) *NginxHandler {
+func NewNginxHandler(nginxService *service.NginxService, defaultNginxService *service.DefaultNginxService, defaultNginxAdvancedService *service.DefaultNginxAdvancedService, whitelistService *service.WhitelistService) *NginxHandler {
 	return &NginxHandler{
 		nginxService: nginxService,
 		defaultNginxService: defaultNginxService,
 		defaultNginxAdvancedService: defaultNginxAdvancedService,
+		whitelistService: whitelistService,
 	}
 }
 
@@ -93,6 +95,10 @@ func (h *NginxHandler) BanNginxIP(c *gin.Context) {
 		return
 	}
 
+	if rejectWhitelisted(c, h.whitelistService, req.IP) {
+		return
+	}
+
 	if err := h.nginxService.BanNginxIP(req.IP, req.Jail); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed_to_ban_ip",
@@ -12,12 +12,14 @@ import (
 type SSHHandler struct {
 	sshService *service.SSHService
 	defaultSSHService *service.DefaultSSHService
+	whitelistService *service.WhitelistService
 }
 
-func NewSSHHandler(sshService *service.SSHService, defaultSSHService *service.DefaultSSHService) *SSHHandler {
+func NewSSHHandler(sshService *service.SSHService, defaultSSHService *service.DefaultSSHService, whitelistService *service.WhitelistService) *SSHHandler {
 	return &SSHHandler{
 		sshService: sshService,
 		defaultSSHService: defaultSSHService,
+		whitelistService: whitelistService,
 	}
 }
 
@@ -91,6 +93,10 @@ func (h *SSHHandler) BanSSHIP(c *gin.Context) {
 		return
 	}
 
+	if rejectWhitelisted(c, h.whitelistService, req.IP) {
+		return
+	}
+
 	if err := h.sshService.BanSSHIP(req.IP, req.Jail); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"error":   "failed_to_ban_ip",
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"fail2ban-web/internal/model"
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// webhookRequest 创建/更新Webhook的请求，签名密钥只写不读
+type webhookRequest struct {
+	Name        string            `json:"name"`
+	URL         string            `json:"url"`
+	Secret      *string           `json:"secret"`
+	Events      []string          `json:"events"`
+	Template    string            `json:"template"`
+	ContentType string            `json:"content_type"`
+	Headers     map[string]string `json:"headers"`
+	MaxAttempts int               `json:"max_attempts"`
+	Enabled     *bool             `json:"enabled"`
+}
+
+// endpoint 转换为Webhook模型，enabled默认为true
+func (r *webhookRequest) endpoint() *model.WebhookEndpoint {
+	endpoint := &model.WebhookEndpoint{
+		Name:        r.Name,
+		URL:         r.URL,
+		Events:      r.Events,
+		Template:    r.Template,
+		ContentType: r.ContentType,
+		Headers:     r.Headers,
+		MaxAttempts: r.MaxAttempts,
+		Enabled:     true,
+	}
+	if r.Secret != nil {
+		endpoint.Secret = *r.Secret
+	}
+	if r.Enabled != nil {
+		endpoint.Enabled = *r.Enabled
+	}
+	return endpoint
+}
+
+// GetWebhooks 获取Webhook列表
+func (h *WebhookHandler) GetWebhooks(c *gin.Context) {
+	webhooks, err := h.webhookService.ListWebhooks()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_webhooks",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhooks": webhooks,
+		"total":    len(webhooks),
+	})
+}
+
+// GetWebhook 获取单个Webhook
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	webhook, err := h.webhookService.GetWebhook(id)
+	if err != nil {
+		respondWebhookError(c, err, "failed_to_get_webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhook": webhook,
+	})
+}
+
+// CreateWebhook 创建Webhook
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	webhook := req.endpoint()
+	if err := h.webhookService.CreateWebhook(webhook); err != nil {
+		respondWebhookError(c, err, "failed_to_create_webhook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Webhook created successfully",
+		"webhook": webhook,
+	})
+}
+
+// UpdateWebhook 更新Webhook，不传secret时保留原有的签名密钥
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	var req webhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	updated, err := h.webhookService.UpdateWebhook(id, req.endpoint(), req.Secret)
+	if err != nil {
+		respondWebhookError(c, err, "failed_to_update_webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook updated successfully",
+		"webhook": updated,
+	})
+}
+
+// DeleteWebhook 删除Webhook
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.webhookService.DeleteWebhook(id); err != nil {
+		respondWebhookError(c, err, "failed_to_delete_webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Webhook deleted successfully",
+	})
+}
+
+// GetDeliveries 获取Webhook的投递记录，可按status筛选
+func (h *WebhookHandler) GetDeliveries(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+
+	deliveries, err := h.webhookService.ListDeliveries(id, c.Query("status"), limit)
+	if err != nil {
+		respondWebhookError(c, err, "failed_to_get_webhook_deliveries")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"deliveries": deliveries,
+		"total":      len(deliveries),
+	})
+}
+
+// TestWebhook 立即发送一条测试事件并返回投递结果
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	id, ok := parseWebhookID(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.webhookService.SendTest(id)
+	if err != nil {
+		respondWebhookError(c, err, "failed_to_test_webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  delivery.Status == service.WebhookStatusDelivered,
+		"delivery": delivery,
+	})
+}
+
+// parseWebhookID 解析路径中的Webhook ID，失败时直接返回错误响应
+func parseWebhookID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_webhook_id",
+			"message": "Webhook ID must be a number",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWebhookError 将Webhook服务的错误转换为对应的HTTP响应
+func respondWebhookError(c *gin.Context, err error, code string) {
+	switch {
+	case errors.Is(err, service.ErrWebhookNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "webhook_not_found",
+			"message": "Webhook not found",
+		})
+	case errors.Is(err, service.ErrInvalidWebhook):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_webhook",
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   code,
+			"message": err.Error(),
+		})
+	}
+}
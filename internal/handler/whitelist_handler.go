@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"fail2ban-web/internal/model"
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WhitelistHandler struct {
+	whitelistService *service.WhitelistService
+}
+
+func NewWhitelistHandler(whitelistService *service.WhitelistService) *WhitelistHandler {
+	return &WhitelistHandler{
+		whitelistService: whitelistService,
+	}
+}
+
+// GetEntries 获取白名单列表，builtin=true时包含内置网段
+func (h *WhitelistHandler) GetEntries(c *gin.Context) {
+	entries, err := h.whitelistService.ListEntries(c.Query("builtin") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "failed_to_get_whitelist",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": entries,
+		"total":   len(entries),
+	})
+}
+
+// GetEntry 获取单个白名单条目
+func (h *WhitelistHandler) GetEntry(c *gin.Context) {
+	id, ok := parseWhitelistID(c)
+	if !ok {
+		return
+	}
+
+	entry, err := h.whitelistService.GetEntry(id)
+	if err != nil {
+		respondWhitelistError(c, err, "failed_to_get_whitelist_entry")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entry": entry,
+	})
+}
+
+// CreateEntry 添加白名单条目
+func (h *WhitelistHandler) CreateEntry(c *gin.Context) {
+	var req struct {
+		Value     string     `json:"value" binding:"required"`
+		Type      string     `json:"type"`
+		Comment   string     `json:"comment"`
+		CreatedBy string     `json:"created_by"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 启用认证时以登录用户为准
+	createdBy := c.GetString("username")
+	if createdBy == "" {
+		createdBy = req.CreatedBy
+	}
+
+	entry := &model.WhitelistEntry{
+		Type:      req.Type,
+		Value:     req.Value,
+		Comment:   req.Comment,
+		CreatedBy: createdBy,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := h.whitelistService.CreateEntry(entry); err != nil {
+		respondWhitelistError(c, err, "failed_to_create_whitelist_entry")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Whitelist entry created successfully",
+		"entry":   entry,
+	})
+}
+
+// UpdateEntry 更新白名单条目的备注和过期时间，expires_at为空表示永久有效
+func (h *WhitelistHandler) UpdateEntry(c *gin.Context) {
+	id, ok := parseWhitelistID(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Comment   string     `json:"comment"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_request",
+			"message": err.Error(),
+		})
+		return
+	}
+
+	entry, err := h.whitelistService.UpdateEntry(id, req.Comment, req.ExpiresAt)
+	if err != nil {
+		respondWhitelistError(c, err, "failed_to_update_whitelist_entry")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Whitelist entry updated successfully",
+		"entry":   entry,
+	})
+}
+
+// DeleteEntry 删除白名单条目
+func (h *WhitelistHandler) DeleteEntry(c *gin.Context) {
+	id, ok := parseWhitelistID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.whitelistService.DeleteEntry(id); err != nil {
+		respondWhitelistError(c, err, "failed_to_delete_whitelist_entry")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Whitelist entry deleted successfully",
+	})
+}
+
+// CheckIP 检查IP是否命中白名单
+func (h *WhitelistHandler) CheckIP(c *gin.Context) {
+	entry := h.whitelistService.Match(c.Param("ip"))
+
+	c.JSON(http.StatusOK, gin.H{
+		"ip":          c.Param("ip"),
+		"whitelisted": entry != nil,
+		"entry":       entry,
+	})
+}
+
+// parseWhitelistID 解析路径中的白名单条目ID，失败时直接返回错误响应
+func parseWhitelistID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_whitelist_id",
+			"message": "Whitelist entry ID must be a number",
+		})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// respondWhitelistError 将白名单服务的错误转换为对应的HTTP响应
+func respondWhitelistError(c *gin.Context, err error, code string) {
+	switch {
+	case errors.Is(err, service.ErrWhitelistEntryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error":   "whitelist_entry_not_found",
+			"message": "Whitelist entry not found",
+		})
+	case errors.Is(err, service.ErrInvalidWhitelistEntry):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_whitelist_entry",
+			"message": err.Error(),
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   code,
+			"message": err.Error(),
+		})
+	}
+}
+
+// rejectWhitelisted IP在白名单中时返回403，返回true表示请求已被拒绝
+func rejectWhitelisted(c *gin.Context, whitelistService *service.WhitelistService, ip string) bool {
+	entry := whitelistService.Match(ip)
+	if entry == nil {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "ip_whitelisted",
+		"message": "IP " + ip + " is whitelisted by " + entry.Value,
+		"entry":   entry,
+	})
+	return true
+}
@@ -0,0 +1,297 @@
+package ipset
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/bits"
+	"net/netip"
+	"path/filepath"
+	"strings"
+)
+
+// 网段文件格式
+const (
+	FormatText = "text" // 每行一个IP、CIDR或范围，支持#和;注释
+	FormatCSV  = "csv"  // 每行使用第一个可以解析的字段
+	FormatJSON = "json" // 提取文档中所有可以解析的字符串，兼容云厂商的IP范围文件
+)
+
+const maxInvalidSamples = 20
+
+// ImportResult 网段文件的解析结果
+type ImportResult struct {
+	Prefixes       []netip.Prefix `json:"-"`
+	Count          int            `json:"count"`
+	Invalid        int            `json:"invalid"`                   // 无法解析的行数
+	InvalidSamples []string       `json:"invalid_samples,omitempty"` // 部分无法解析的行
+}
+
+func (r *ImportResult) add(prefixes ...netip.Prefix) {
+	r.Prefixes = append(r.Prefixes, prefixes...)
+	r.Count = len(r.Prefixes)
+}
+
+func (r *ImportResult) invalid(line string) {
+	r.Invalid++
+	if len(r.InvalidSamples) < maxInvalidSamples {
+		r.InvalidSamples = append(r.InvalidSamples, line)
+	}
+}
+
+// DetectFormat 根据文件扩展名判断格式，无法判断时按纯文本处理
+func DetectFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return FormatCSV
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatText
+	}
+}
+
+// Parse 按格式解析网段文件
+func Parse(r io.Reader, format string) (*ImportResult, error) {
+	switch format {
+	case FormatText, "":
+		return parseText(r)
+	case FormatCSV:
+		return parseCSV(r)
+	case FormatJSON:
+		return parseJSON(r)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// ParseEntry 解析单个IP、CIDR或 "起始IP-结束IP" 形式的范围
+func ParseEntry(s string) ([]netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+
+	if from, to, ok := strings.Cut(s, "-"); ok {
+		start, err := netip.ParseAddr(strings.TrimSpace(from))
+		if err != nil {
+			return nil, err
+		}
+		end, err := netip.ParseAddr(strings.TrimSpace(to))
+		if err != nil {
+			return nil, err
+		}
+		return RangePrefixes(start, end)
+	}
+
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, err
+		}
+		return []netip.Prefix{p.Masked()}, nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil, err
+	}
+	addr = addr.WithZone("")
+	return []netip.Prefix{netip.PrefixFrom(addr, addr.BitLen())}, nil
+}
+
+// ParsePrefix 解析IP或CIDR，单个IP返回/32或/128网段，IPv4映射地址按IPv4处理
+func ParsePrefix(s string) (netip.Prefix, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return p.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.WithZone("").Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// RangePrefixes 将地址范围拆分为最少的CIDR网段
+func RangePrefixes(start, end netip.Addr) ([]netip.Prefix, error) {
+	if start.Is4() != end.Is4() {
+		return nil, errors.New("range endpoints must be the same address family")
+	}
+	if end.Less(start) {
+		return nil, errors.New("range end is before start")
+	}
+
+	offset := 0
+	if start.Is4() {
+		offset = 96
+	}
+	lo, hi := keyFromAddr(start), keyFromAddr(end)
+
+	var prefixes []netip.Prefix
+	for {
+		// 从lo开始，找到不超过hi的最大对齐网段
+		n := 128 - trailingZeros(lo)
+		if n < offset {
+			n = offset
+		}
+		for n < 128 && lastKey(lo, n).greater(hi) {
+			n++
+		}
+		prefixes = append(prefixes, lo.toPrefix(n))
+
+		last := lastKey(lo, n)
+		if last == hi {
+			return prefixes, nil
+		}
+		lo = last.next()
+	}
+}
+
+// trailingZeros key末尾连续0的位数
+func trailingZeros(k key) int {
+	if k.lo != 0 {
+		return bits.TrailingZeros64(k.lo)
+	}
+	if k.hi != 0 {
+		return 64 + bits.TrailingZeros64(k.hi)
+	}
+	return 128
+}
+
+// lastKey 网段的最后一个地址
+func lastKey(k key, n int) key {
+	switch {
+	case n <= 0:
+		return key{hi: ^uint64(0), lo: ^uint64(0)}
+	case n < 64:
+		return key{hi: k.hi | ^uint64(0)>>n, lo: ^uint64(0)}
+	case n < 128:
+		return key{hi: k.hi, lo: k.lo | ^uint64(0)>>(n-64)}
+	default:
+		return k
+	}
+}
+
+func (k key) greater(o key) bool {
+	return k.hi > o.hi || (k.hi == o.hi && k.lo > o.lo)
+}
+
+func (k key) next() key {
+	lo := k.lo + 1
+	hi := k.hi
+	if lo == 0 {
+		hi++
+	}
+	return key{hi: hi, lo: lo}
+}
+
+// parseText 解析纯文本，每行第一个字段为IP、CIDR或范围
+func parseText(r io.Reader) (*ImportResult, error) {
+	result := &ImportResult{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		prefixes, err := ParseEntry(fields[0])
+		if err != nil {
+			result.invalid(strings.TrimSpace(scanner.Text()))
+			continue
+		}
+		result.add(prefixes...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// parseCSV 解析CSV，每行使用第一个可以解析的字段，没有可解析字段的首行视为表头
+func parseCSV(r io.Reader) (*ImportResult, error) {
+	result := &ImportResult{}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	first := true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var prefixes []netip.Prefix
+		for _, field := range record {
+			if field = strings.TrimSpace(field); field == "" {
+				continue
+			}
+			if parsed, err := ParseEntry(field); err == nil {
+				prefixes = parsed
+				break
+			}
+		}
+
+		switch {
+		case prefixes != nil:
+			result.add(prefixes...)
+		case !first:
+			result.invalid(strings.Join(record, ","))
+		}
+		first = false
+	}
+
+	return result, nil
+}
+
+// parseJSON 递归提取JSON文档中所有可以解析为IP、CIDR或范围的字符串
+// 可以直接导入AWS、GCP、Azure、Cloudflare等发布的IP范围文件
+func parseJSON(r io.Reader) (*ImportResult, error) {
+	var doc interface{}
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	result := &ImportResult{}
+	var visit func(v interface{})
+	visit = func(v interface{}) {
+		switch value := v.(type) {
+		case string:
+			if prefixes, err := ParseEntry(value); err == nil {
+				result.add(prefixes...)
+			}
+		case []interface{}:
+			for _, item := range value {
+				visit(item)
+			}
+		case map[string]interface{}:
+			for _, item := range value {
+				visit(item)
+			}
+		}
+	}
+	visit(doc)
+
+	return result, nil
+}
@@ -0,0 +1,374 @@
+// Package ipset 基于net/netip的IP网段前缀树，用于大规模白名单、黑名单和策略匹配
+package ipset
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net/netip"
+)
+
+// key 128位地址，IPv4地址以IPv4映射的IPv6形式(::ffff:a.b.c.d)存储，
+// 因此 1.2.3.4 和 ::ffff:1.2.3.4 命中相同的网段
+type key struct {
+	hi, lo uint64
+}
+
+func keyFromAddr(addr netip.Addr) key {
+	b := addr.As16()
+	return key{
+		hi: binary.BigEndian.Uint64(b[:8]),
+		lo: binary.BigEndian.Uint64(b[8:]),
+	}
+}
+
+// bit 返回第i位(0为最高位)
+func (k key) bit(i int) int {
+	if i < 64 {
+		return int(k.hi>>(63-i)) & 1
+	}
+	return int(k.lo>>(127-i)) & 1
+}
+
+// mask 只保留前n位
+func (k key) mask(n int) key {
+	switch {
+	case n <= 0:
+		return key{}
+	case n < 64:
+		return key{hi: k.hi &^ (^uint64(0) >> n)}
+	case n == 64:
+		return key{hi: k.hi}
+	case n < 128:
+		return key{hi: k.hi, lo: k.lo &^ (^uint64(0) >> (n - 64))}
+	default:
+		return k
+	}
+}
+
+// commonBits 两个地址相同的前导位数
+func commonBits(a, b key) int {
+	if x := a.hi ^ b.hi; x != 0 {
+		return bits.LeadingZeros64(x)
+	}
+	return 64 + bits.LeadingZeros64(a.lo^b.lo)
+}
+
+// isV4Mapped 是否位于 ::ffff:0:0/96 中
+func (k key) isV4Mapped() bool {
+	return k.hi == 0 && k.lo>>32 == 0xffff
+}
+
+// prefixKey 将网段转换为128位空间中的key和前缀长度
+func prefixKey(p netip.Prefix) (key, int, bool) {
+	if !p.IsValid() {
+		return key{}, 0, false
+	}
+	p = p.Masked()
+	n := p.Bits()
+	if p.Addr().Is4() {
+		n += 96
+	}
+	return keyFromAddr(p.Addr()), n, true
+}
+
+// toPrefix 将key转换回网段，IPv4映射的网段以IPv4形式返回
+func (k key) toPrefix(n int) netip.Prefix {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], k.hi)
+	binary.BigEndian.PutUint64(b[8:], k.lo)
+	addr := netip.AddrFrom16(b)
+	if n >= 96 && k.isV4Mapped() {
+		return netip.PrefixFrom(addr.Unmap(), n-96)
+	}
+	return netip.PrefixFrom(addr, n)
+}
+
+type node[V any] struct {
+	key      key
+	bits     int
+	set      bool // 是否是插入的网段，否则只是分支节点
+	value    V
+	children [2]*node[V]
+}
+
+// Table 路径压缩的二进制前缀树，按最长前缀匹配查找IP所属的网段
+// 查询复杂度与网段数量无关，最多比较128位；Table不是并发安全的，
+// 并发使用时需要调用方加锁，或者构建好后整体替换
+type Table[V any] struct {
+	root *node[V]
+	size int
+}
+
+// Len 网段数量
+func (t *Table[V]) Len() int {
+	return t.size
+}
+
+// Insert 插入网段，网段已存在时替换其值，无效网段被忽略
+func (t *Table[V]) Insert(p netip.Prefix, value V) {
+	k, n, ok := prefixKey(p)
+	if !ok {
+		return
+	}
+
+	link := &t.root
+	for {
+		cur := *link
+		if cur == nil {
+			*link = &node[V]{key: k, bits: n, set: true, value: value}
+			t.size++
+			return
+		}
+
+		common := min(commonBits(cur.key, k), cur.bits, n)
+		switch {
+		case common == cur.bits && common == n:
+			// 相同网段
+			if !cur.set {
+				t.size++
+			}
+			cur.set = true
+			cur.value = value
+			return
+		case common == cur.bits:
+			// cur包含新网段，继续向下
+			link = &cur.children[k.bit(cur.bits)]
+		case common == n:
+			// 新网段包含cur
+			inserted := &node[V]{key: k, bits: n, set: true, value: value}
+			inserted.children[cur.key.bit(n)] = cur
+			*link = inserted
+			t.size++
+			return
+		default:
+			// 在分叉处插入分支节点
+			branch := &node[V]{key: k.mask(common), bits: common}
+			branch.children[k.bit(common)] = &node[V]{key: k, bits: n, set: true, value: value}
+			branch.children[cur.key.bit(common)] = cur
+			*link = branch
+			t.size++
+			return
+		}
+	}
+}
+
+// Remove 删除网段，返回网段是否存在
+func (t *Table[V]) Remove(p netip.Prefix) bool {
+	k, n, ok := prefixKey(p)
+	if !ok {
+		return false
+	}
+
+	var removed bool
+	t.root, removed = remove(t.root, k, n)
+	if removed {
+		t.size--
+	}
+	return removed
+}
+
+func remove[V any](cur *node[V], k key, n int) (*node[V], bool) {
+	if cur == nil || cur.bits > n || commonBits(cur.key, k) < cur.bits {
+		return cur, false
+	}
+
+	if cur.bits == n {
+		if !cur.set {
+			return cur, false
+		}
+		var zero V
+		cur.set = false
+		cur.value = zero
+		return compact(cur), true
+	}
+
+	i := k.bit(cur.bits)
+	child, removed := remove(cur.children[i], k, n)
+	if !removed {
+		return cur, false
+	}
+	cur.children[i] = child
+	return compact(cur), true
+}
+
+// compact 删除不再需要的分支节点
+func compact[V any](cur *node[V]) *node[V] {
+	if cur.set {
+		return cur
+	}
+	switch {
+	case cur.children[0] == nil:
+		return cur.children[1]
+	case cur.children[1] == nil:
+		return cur.children[0]
+	default:
+		return cur
+	}
+}
+
+// Get 精确查找网段的值
+func (t *Table[V]) Get(p netip.Prefix) (V, bool) {
+	var zero V
+	k, n, ok := prefixKey(p)
+	if !ok {
+		return zero, false
+	}
+
+	for cur := t.root; cur != nil && cur.bits <= n; {
+		if commonBits(cur.key, k) < cur.bits {
+			break
+		}
+		if cur.bits == n {
+			if cur.set {
+				return cur.value, true
+			}
+			break
+		}
+		cur = cur.children[k.bit(cur.bits)]
+	}
+	return zero, false
+}
+
+// Lookup 查找包含IP的最长网段
+func (t *Table[V]) Lookup(addr netip.Addr) (netip.Prefix, V, bool) {
+	var zero V
+	if !addr.IsValid() {
+		return netip.Prefix{}, zero, false
+	}
+
+	k := keyFromAddr(addr.WithZone(""))
+	var best *node[V]
+	for cur := t.root; cur != nil; {
+		if commonBits(cur.key, k) < cur.bits {
+			break
+		}
+		if cur.set {
+			best = cur
+		}
+		if cur.bits == 128 {
+			break
+		}
+		cur = cur.children[k.bit(cur.bits)]
+	}
+
+	if best == nil {
+		return netip.Prefix{}, zero, false
+	}
+	return best.key.toPrefix(best.bits), best.value, true
+}
+
+// Overlaps 查找与网段重叠的网段，优先返回包含它的最长网段，
+// 没有时返回被它包含的第一个网段；p为单个地址时等同于Lookup
+func (t *Table[V]) Overlaps(p netip.Prefix) (netip.Prefix, V, bool) {
+	var zero V
+	k, n, ok := prefixKey(p)
+	if !ok {
+		return netip.Prefix{}, zero, false
+	}
+
+	var best *node[V]
+	for cur := t.root; cur != nil; {
+		common := commonBits(cur.key, k)
+		if cur.bits >= n {
+			// cur位于p之内，其子树中任意网段都与p重叠
+			if best == nil && common >= n {
+				best = firstSet(cur)
+			}
+			break
+		}
+		if common < cur.bits {
+			break
+		}
+		if cur.set {
+			best = cur
+		}
+		cur = cur.children[k.bit(cur.bits)]
+	}
+
+	if best == nil {
+		return netip.Prefix{}, zero, false
+	}
+	return best.key.toPrefix(best.bits), best.value, true
+}
+
+// firstSet 子树中地址最小的网段，分支节点总有两个子节点，因此一定存在
+func firstSet[V any](cur *node[V]) *node[V] {
+	for !cur.set {
+		if cur.children[0] != nil {
+			cur = cur.children[0]
+		} else {
+			cur = cur.children[1]
+		}
+	}
+	return cur
+}
+
+// Contains 是否有网段包含IP
+func (t *Table[V]) Contains(addr netip.Addr) bool {
+	_, _, ok := t.Lookup(addr)
+	return ok
+}
+
+// Walk 按地址顺序遍历所有网段，fn返回false时停止
+func (t *Table[V]) Walk(fn func(netip.Prefix, V) bool) {
+	walk(t.root, fn)
+}
+
+func walk[V any](cur *node[V], fn func(netip.Prefix, V) bool) bool {
+	if cur == nil {
+		return true
+	}
+	if cur.set && !fn(cur.key.toPrefix(cur.bits), cur.value) {
+		return false
+	}
+	return walk(cur.children[0], fn) && walk(cur.children[1], fn)
+}
+
+// Set 不关联值的IP网段集合
+type Set struct {
+	table Table[struct{}]
+}
+
+// Add 添加网段
+func (s *Set) Add(p netip.Prefix) {
+	s.table.Insert(p, struct{}{})
+}
+
+// AddAddr 添加单个IP
+func (s *Set) AddAddr(addr netip.Addr) {
+	if addr.IsValid() {
+		addr = addr.WithZone("")
+		s.table.Insert(netip.PrefixFrom(addr, addr.BitLen()), struct{}{})
+	}
+}
+
+// Remove 删除网段
+func (s *Set) Remove(p netip.Prefix) bool {
+	return s.table.Remove(p)
+}
+
+// Contains 是否有网段包含IP
+func (s *Set) Contains(addr netip.Addr) bool {
+	return s.table.Contains(addr)
+}
+
+// Match 返回包含IP的最长网段
+func (s *Set) Match(addr netip.Addr) (netip.Prefix, bool) {
+	p, _, ok := s.table.Lookup(addr)
+	return p, ok
+}
+
+// Len 网段数量
+func (s *Set) Len() int {
+	return s.table.Len()
+}
+
+// Prefixes 按地址顺序返回所有网段
+func (s *Set) Prefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, s.table.Len())
+	s.table.Walk(func(p netip.Prefix, _ struct{}) bool {
+		prefixes = append(prefixes, p)
+		return true
+	})
+	return prefixes
+}
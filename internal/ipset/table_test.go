@@ -0,0 +1,456 @@
+package ipset
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustPrefix(t testing.TB, s string) netip.Prefix {
+	t.Helper()
+	p, err := ParsePrefix(s)
+	if err != nil {
+		t.Fatalf("ParsePrefix(%q): %v", s, err)
+	}
+	return p
+}
+
+func mustAddr(t testing.TB, s string) netip.Addr {
+	t.Helper()
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		t.Fatalf("ParseAddr(%q): %v", s, err)
+	}
+	return addr
+}
+
+func TestTableLookup(t *testing.T) {
+	var table Table[string]
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.1.2.0/24", "192.168.1.1", "2001:db8::/32", "2001:db8:1::/48"} {
+		table.Insert(mustPrefix(t, p), p)
+	}
+	if table.Len() != 6 {
+		t.Fatalf("Len() = %d, want 6", table.Len())
+	}
+
+	tests := []struct {
+		addr string
+		want string // 空字符串表示不命中
+	}{
+		{"10.9.9.9", "10.0.0.0/8"},
+		{"10.1.9.9", "10.1.0.0/16"},
+		{"10.1.2.3", "10.1.2.0/24"},
+		{"192.168.1.1", "192.168.1.1"},
+		{"192.168.1.2", ""},
+		{"11.0.0.1", ""},
+		{"2001:db8:ffff::1", "2001:db8::/32"},
+		{"2001:db8:1::1", "2001:db8:1::/48"},
+		{"2001:db9::1", ""},
+		{"fe80::1%eth0", ""},
+	}
+	for _, tt := range tests {
+		_, value, ok := table.Lookup(mustAddr(t, tt.addr))
+		if tt.want == "" {
+			if ok {
+				t.Errorf("Lookup(%s) = %q, want no match", tt.addr, value)
+			}
+			continue
+		}
+		if !ok || value != tt.want {
+			t.Errorf("Lookup(%s) = %q, %v, want %q", tt.addr, value, ok, tt.want)
+		}
+	}
+}
+
+func TestTableInsertReplacesValue(t *testing.T) {
+	var table Table[int]
+	p := mustPrefix(t, "198.51.100.0/24")
+	table.Insert(p, 1)
+	table.Insert(p, 2)
+
+	if table.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", table.Len())
+	}
+	if value, ok := table.Get(p); !ok || value != 2 {
+		t.Fatalf("Get(%s) = %d, %v, want 2", p, value, ok)
+	}
+
+	// 无效网段被忽略
+	table.Insert(netip.Prefix{}, 3)
+	if table.Len() != 1 {
+		t.Fatalf("Len() after invalid insert = %d, want 1", table.Len())
+	}
+}
+
+func TestTableRemove(t *testing.T) {
+	var table Table[string]
+	for _, p := range []string{"10.0.0.0/8", "10.1.0.0/16", "10.2.0.0/16"} {
+		table.Insert(mustPrefix(t, p), p)
+	}
+
+	if table.Remove(mustPrefix(t, "10.3.0.0/16")) {
+		t.Fatal("Remove of missing prefix returned true")
+	}
+	// 分支节点不是插入的网段，不能被删除
+	if table.Remove(mustPrefix(t, "10.0.0.0/14")) {
+		t.Fatal("Remove of branch node returned true")
+	}
+	if !table.Remove(mustPrefix(t, "10.1.0.0/16")) {
+		t.Fatal("Remove(10.1.0.0/16) returned false")
+	}
+	if table.Len() != 2 {
+		t.Fatalf("Len() = %d, want 2", table.Len())
+	}
+	if _, value, _ := table.Lookup(mustAddr(t, "10.1.2.3")); value != "10.0.0.0/8" {
+		t.Fatalf("Lookup after remove = %q, want 10.0.0.0/8", value)
+	}
+
+	if !table.Remove(mustPrefix(t, "10.0.0.0/8")) || !table.Remove(mustPrefix(t, "10.2.0.0/16")) {
+		t.Fatal("Remove of remaining prefixes failed")
+	}
+	if table.Len() != 0 || table.Contains(mustAddr(t, "10.2.0.1")) {
+		t.Fatal("table not empty after removing all prefixes")
+	}
+}
+
+func TestTableOverlaps(t *testing.T) {
+	var table Table[string]
+	for _, p := range []string{"10.0.0.0/8", "172.16.5.0/24", "172.16.9.0/24", "2001:db8:1::/48"} {
+		table.Insert(mustPrefix(t, p), p)
+	}
+
+	tests := []struct {
+		prefix string
+		want   string
+	}{
+		{"10.1.0.0/16", "10.0.0.0/8"},        // 被已有网段包含
+		{"10.1.2.3", "10.0.0.0/8"},           // 单个地址等同于Lookup
+		{"172.16.0.0/16", "172.16.5.0/24"},   // 包含已有网段时返回地址最小的一个
+		{"172.16.8.0/22", "172.16.9.0/24"},   // 只包含其中一个
+		{"172.16.0.0/22", ""},                // 不重叠
+		{"2001:db8::/32", "2001:db8:1::/48"}, // IPv6
+		{"0.0.0.0/0", "10.0.0.0/8"},
+	}
+	for _, tt := range tests {
+		_, value, ok := table.Overlaps(mustPrefix(t, tt.prefix))
+		if tt.want == "" {
+			if ok {
+				t.Errorf("Overlaps(%s) = %q, want no match", tt.prefix, value)
+			}
+			continue
+		}
+		if !ok || value != tt.want {
+			t.Errorf("Overlaps(%s) = %q, %v, want %q", tt.prefix, value, ok, tt.want)
+		}
+	}
+}
+
+func TestTableIPv4MappedIPv6(t *testing.T) {
+	var table Table[string]
+	table.Insert(mustPrefix(t, "203.0.113.0/24"), "v4")
+
+	// IPv4映射的IPv6地址命中IPv4网段
+	for _, s := range []string{"203.0.113.7", "::ffff:203.0.113.7"} {
+		p, value, ok := table.Lookup(mustAddr(t, s))
+		if !ok || value != "v4" {
+			t.Errorf("Lookup(%s) = %q, %v, want v4", s, value, ok)
+		}
+		if p.String() != "203.0.113.0/24" {
+			t.Errorf("Lookup(%s) prefix = %s, want 203.0.113.0/24 in IPv4 form", s, p)
+		}
+	}
+
+	// 以映射形式插入的单个地址和IPv4形式等价
+	var mapped Table[string]
+	entry, err := ParseEntry("::ffff:198.51.100.9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapped.Insert(entry[0], "mapped")
+	if _, value, ok := mapped.Lookup(mustAddr(t, "198.51.100.9")); !ok || value != "mapped" {
+		t.Errorf("Lookup(198.51.100.9) = %q, %v, want mapped", value, ok)
+	}
+
+	// 其他IPv6地址不命中IPv4网段
+	if _, _, ok := table.Lookup(mustAddr(t, "2001:db8::cb00:7107")); ok {
+		t.Error("non-mapped IPv6 address matched an IPv4 prefix")
+	}
+}
+
+func TestParsePrefixUnmapsIPv4MappedAddress(t *testing.T) {
+	if got := mustPrefix(t, "::ffff:192.0.2.1").String(); got != "192.0.2.1/32" {
+		t.Fatalf("ParsePrefix(::ffff:192.0.2.1) = %s, want 192.0.2.1/32", got)
+	}
+	if got := mustPrefix(t, "192.0.2.77/24").String(); got != "192.0.2.0/24" {
+		t.Fatalf("ParsePrefix(192.0.2.77/24) = %s, want masked 192.0.2.0/24", got)
+	}
+}
+
+func TestSetPrefixesInAddressOrder(t *testing.T) {
+	var set Set
+	for _, p := range []string{"192.0.2.0/24", "10.0.0.0/8", "2001:db8::/32", "10.0.0.0/16"} {
+		set.Add(mustPrefix(t, p))
+	}
+	set.AddAddr(mustAddr(t, "198.51.100.1"))
+
+	var got []string
+	for _, p := range set.Prefixes() {
+		got = append(got, p.String())
+	}
+	want := []string{"10.0.0.0/8", "10.0.0.0/16", "192.0.2.0/24", "198.51.100.1/32", "2001:db8::/32"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Prefixes() = %v, want %v", got, want)
+	}
+}
+
+func TestRangePrefixes(t *testing.T) {
+	tests := []struct {
+		start, end string
+		want       []string
+	}{
+		{"10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.1", "10.0.0.1", []string{"10.0.0.1/32"}},
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"192.168.0.0", "192.168.3.255", []string{"192.168.0.0/22"}},
+		{"192.168.0.255", "192.168.2.0", []string{"192.168.0.255/32", "192.168.1.0/24", "192.168.2.0/32"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"2001:db8::", "2001:db8::ffff", []string{"2001:db8::/112"}},
+		{"2001:db8::1", "2001:db8::2", []string{"2001:db8::1/128", "2001:db8::2/128"}},
+	}
+	for _, tt := range tests {
+		prefixes, err := RangePrefixes(mustAddr(t, tt.start), mustAddr(t, tt.end))
+		if err != nil {
+			t.Errorf("RangePrefixes(%s, %s): %v", tt.start, tt.end, err)
+			continue
+		}
+		var got []string
+		for _, p := range prefixes {
+			got = append(got, p.String())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RangePrefixes(%s, %s) = %v, want %v", tt.start, tt.end, got, tt.want)
+		}
+	}
+}
+
+func TestRangePrefixesErrors(t *testing.T) {
+	if _, err := RangePrefixes(mustAddr(t, "10.0.0.2"), mustAddr(t, "10.0.0.1")); err == nil {
+		t.Error("expected error for end before start")
+	}
+	if _, err := RangePrefixes(mustAddr(t, "10.0.0.1"), mustAddr(t, "2001:db8::1")); err == nil {
+		t.Error("expected error for mixed address families")
+	}
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	var result []string
+	for _, p := range prefixes {
+		result = append(result, p.String())
+	}
+	return result
+}
+
+func TestParseText(t *testing.T) {
+	input := `# 注释行
+10.0.0.0/8
+192.0.2.1   某个主机
+; 分号注释
+198.51.100.0-198.51.100.3 # 范围
+not-an-ip
+2001:db8::/32
+
+10.0.0.300
+`
+	result, err := Parse(strings.NewReader(input), FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"10.0.0.0/8", "192.0.2.1/32", "198.51.100.0/30", "2001:db8::/32"}
+	if got := prefixStrings(result.Prefixes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("prefixes = %v, want %v", got, want)
+	}
+	if result.Count != len(want) {
+		t.Errorf("Count = %d, want %d", result.Count, len(want))
+	}
+	if result.Invalid != 2 {
+		t.Errorf("Invalid = %d, want 2", result.Invalid)
+	}
+	if want := []string{"not-an-ip", "10.0.0.300"}; !reflect.DeepEqual(result.InvalidSamples, want) {
+		t.Errorf("InvalidSamples = %v, want %v", result.InvalidSamples, want)
+	}
+}
+
+func TestParseTextLimitsInvalidSamples(t *testing.T) {
+	input := strings.Repeat("bad\n", maxInvalidSamples+5)
+	result, err := Parse(strings.NewReader(input), FormatText)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Invalid != maxInvalidSamples+5 {
+		t.Errorf("Invalid = %d, want %d", result.Invalid, maxInvalidSamples+5)
+	}
+	if len(result.InvalidSamples) != maxInvalidSamples {
+		t.Errorf("len(InvalidSamples) = %d, want %d", len(result.InvalidSamples), maxInvalidSamples)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	input := `name,network,comment
+office,192.0.2.0/24,main office
+# 注释
+vpn,198.51.100.7,
+broken,nothing here,
+203.0.113.0/25,first column,
+`
+	result, err := Parse(strings.NewReader(input), FormatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"192.0.2.0/24", "198.51.100.7/32", "203.0.113.0/25"}
+	if got := prefixStrings(result.Prefixes); !reflect.DeepEqual(got, want) {
+		t.Fatalf("prefixes = %v, want %v", got, want)
+	}
+	// 首行表头不计为无效行
+	if result.Invalid != 1 {
+		t.Errorf("Invalid = %d, want 1", result.Invalid)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	input := `{
+  "syncToken": "1700000000",
+  "prefixes": [
+    {"ip_prefix": "3.5.140.0/22", "region": "ap-northeast-2"},
+    {"ip_prefix": "13.34.37.64/27", "region": "ap-southeast-4"}
+  ],
+  "ipv6_prefixes": [
+    {"ipv6_prefix": "2600:1f14::/35", "region": "us-west-2"}
+  ],
+  "ranges": ["10.0.0.0-10.0.0.1"],
+  "count": 4
+}`
+	result, err := Parse(strings.NewReader(input), FormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// map的遍历顺序不固定，通过Set按地址排序后比较
+	var set Set
+	for _, p := range result.Prefixes {
+		set.Add(p)
+	}
+	want := []string{"3.5.140.0/22", "10.0.0.0/31", "13.34.37.64/27", "2600:1f14::/35"}
+	if got := prefixStrings(set.Prefixes()); result.Count != len(want) || !reflect.DeepEqual(got, want) {
+		t.Fatalf("prefixes = %v (count %d), want %v", got, result.Count, want)
+	}
+	if result.Invalid != 0 {
+		t.Errorf("Invalid = %d, want 0 (non-address strings are ignored)", result.Invalid)
+	}
+
+	if _, err := Parse(strings.NewReader("{"), FormatJSON); err == nil {
+		t.Error("expected error for malformed JSON")
+	}
+}
+
+func TestParseUnsupportedFormat(t *testing.T) {
+	if _, err := Parse(strings.NewReader(""), "xml"); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+	if got := DetectFormat("list.CSV"); got != FormatCSV {
+		t.Errorf("DetectFormat(list.CSV) = %s, want %s", got, FormatCSV)
+	}
+	if got := DetectFormat("ranges.json"); got != FormatJSON {
+		t.Errorf("DetectFormat(ranges.json) = %s, want %s", got, FormatJSON)
+	}
+	if got := DetectFormat("blocklist.netset"); got != FormatText {
+		t.Errorf("DetectFormat(blocklist.netset) = %s, want %s", got, FormatText)
+	}
+}
+
+const benchmarkPrefixes = 50000
+
+// benchmarkTable 构建包含约5万个随机IPv4和IPv6网段的表
+func benchmarkTable(b *testing.B) (*Table[int], []netip.Addr) {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+
+	table := &Table[int]{}
+	for i := 0; i < benchmarkPrefixes; i++ {
+		if i%4 == 0 {
+			var a [16]byte
+			binary.BigEndian.PutUint64(a[:8], 0x20010db8<<32|rng.Uint64()>>32)
+			table.Insert(netip.PrefixFrom(netip.AddrFrom16(a), 32+rng.Intn(33)).Masked(), i)
+			continue
+		}
+		var a [4]byte
+		binary.BigEndian.PutUint32(a[:], rng.Uint32())
+		table.Insert(netip.PrefixFrom(netip.AddrFrom4(a), 16+rng.Intn(17)).Masked(), i)
+	}
+
+	addrs := make([]netip.Addr, 1024)
+	for i := range addrs {
+		if i%4 == 0 {
+			var a [16]byte
+			binary.BigEndian.PutUint64(a[:8], 0x20010db8<<32|rng.Uint64()>>32)
+			binary.BigEndian.PutUint64(a[8:], rng.Uint64())
+			addrs[i] = netip.AddrFrom16(a)
+			continue
+		}
+		var a [4]byte
+		binary.BigEndian.PutUint32(a[:], rng.Uint32())
+		addrs[i] = netip.AddrFrom4(a)
+	}
+	return table, addrs
+}
+
+func BenchmarkLookup(b *testing.B) {
+	table, addrs := benchmarkTable(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		table.Lookup(addrs[i%len(addrs)])
+	}
+}
+
+func BenchmarkOverlaps(b *testing.B) {
+	table, addrs := benchmarkTable(b)
+	prefixes := make([]netip.Prefix, len(addrs))
+	for i, addr := range addrs {
+		bits := 24
+		if addr.Is6() {
+			bits = 48
+		}
+		prefixes[i] = netip.PrefixFrom(addr, bits).Masked()
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		table.Overlaps(prefixes[i%len(prefixes)])
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	prefixes := make([]netip.Prefix, benchmarkPrefixes)
+	for i := range prefixes {
+		var a [4]byte
+		binary.BigEndian.PutUint32(a[:], rng.Uint32())
+		prefixes[i] = netip.PrefixFrom(netip.AddrFrom4(a), 16+rng.Intn(17)).Masked()
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var table Table[int]
+		for j, p := range prefixes {
+			table.Insert(p, j)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"crypto/x509"
 	"net/http"
 	"strings"
 	"time"
@@ -11,13 +12,15 @@ import (
 
 // JWTMiddleware JWT中间件结构体
 type JWTMiddleware struct {
-	secret []byte
+	secret   []byte
+	certAuth *ClientCertAuth
 }
 
-// NewJWTMiddleware 创建JWT中间件
-func NewJWTMiddleware(secret string) *JWTMiddleware {
+// NewJWTMiddleware 创建JWT中间件，certAuth为nil时不接受客户端证书认证
+func NewJWTMiddleware(secret string, certAuth *ClientCertAuth) *JWTMiddleware {
 	return &JWTMiddleware{
-		secret: []byte(secret),
+		secret:   []byte(secret),
+		certAuth: certAuth,
 	}
 }
 
@@ -71,9 +74,70 @@ func ParseToken(tokenString string) (*JWTClaims, error) {
 	return nil, jwt.ErrInvalidKey
 }
 
+// ClientCertAuth TLS客户端证书认证：证书由配置的客户端CA校验通过，
+// 且CN或SAN（DNS名称、邮件地址、URI）在允许列表中时，视为管理员API客户端
+type ClientCertAuth struct {
+	admins map[string]bool
+}
+
+// NewClientCertAuth 创建客户端证书认证，允许列表为空时返回nil，证书不能代替JWT认证
+func NewClientCertAuth(admins []string) *ClientCertAuth {
+	if len(admins) == 0 {
+		return nil
+	}
+
+	auth := &ClientCertAuth{admins: make(map[string]bool, len(admins))}
+	for _, name := range admins {
+		if name = strings.TrimSpace(name); name != "" {
+			auth.admins[name] = true
+		}
+	}
+	return auth
+}
+
+// certificateIdentities 证书的CN和SAN
+func certificateIdentities(cert *x509.Certificate) []string {
+	identities := []string{}
+	if cert.Subject.CommonName != "" {
+		identities = append(identities, cert.Subject.CommonName)
+	}
+	identities = append(identities, cert.DNSNames...)
+	identities = append(identities, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	return identities
+}
+
+// authenticate 使用已校验的客户端证书认证请求，以匹配的CN或SAN作为用户名
+func (a *ClientCertAuth) authenticate(c *gin.Context) bool {
+	if a == nil {
+		return false
+	}
+	state := c.Request.TLS
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return false
+	}
+
+	for _, identity := range certificateIdentities(state.VerifiedChains[0][0]) {
+		if a.admins[identity] {
+			c.Set("username", identity)
+			c.Set("role", "admin")
+			c.Set("auth_method", "client_certificate")
+			return true
+		}
+	}
+	return false
+}
+
 // JWTAuth JWT认证中间件方法
 func (j *JWTMiddleware) JWTAuth() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if j.certAuth.authenticate(c) {
+			c.Next()
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -115,31 +179,37 @@ func (j *JWTMiddleware) JWTAuth() gin.HandlerFunc {
 	}
 }
 
-// JWTAuthMiddleware JWT认证中间件
-func JWTAuthMiddleware() gin.HandlerFunc {
+// StreamAuthMiddleware 事件流认证中间件
+// 浏览器的EventSource和WebSocket无法设置请求头，除Authorization头外也接受token查询参数
+func StreamAuthMiddleware(certAuth *ClientCertAuth) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "missing_token",
-				"message": "Authorization header is required",
-			})
-			c.Abort()
+		if certAuth.authenticate(c) {
+			c.Next()
 			return
 		}
 
-		// Bearer token 格式检查
-		parts := strings.SplitN(authHeader, " ", 2)
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		tokenString := c.Query("token")
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			parts := strings.SplitN(authHeader, " ", 2)
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":   "invalid_token_format",
+					"message": "Authorization header format must be Bearer {token}",
+				})
+				c.Abort()
+				return
+			}
+			tokenString = parts[1]
+		}
+		if tokenString == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "invalid_token_format",
-				"message": "Authorization header format must be Bearer {token}",
+				"error":   "missing_token",
+				"message": "Authorization header or token query parameter is required",
 			})
 			c.Abort()
 			return
 		}
 
-		tokenString := parts[1]
 		claims, err := ParseToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
@@ -150,7 +220,6 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 将用户信息存储在上下文中
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
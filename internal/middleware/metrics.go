@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"time"
+
+	"fail2ban-web/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware 记录HTTP请求数、耗时和处理中的请求数
+// 路由标签使用路由模板（如 /api/v1/jails/:id），未匹配路由的请求记为 unmatched，避免标签数量无限增长
+func MetricsMiddleware(metrics *service.Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.HTTPRequestStarted()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequestFinished(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
@@ -62,10 +62,129 @@ type BannedIP struct {
 	UnbanTime   time.Time `json:"unban_time"`
 	IsActive    bool      `json:"is_active" gorm:"default:true"`
 	Reason      string    `json:"reason"`
+	Policy      string    `json:"policy" gorm:"index"` // 触发封禁的策略，手动封禁为空
+	Offense     int       `json:"offense"`             // 回溯窗口内的第几次封禁，0表示未统计
+	Permanent   bool      `json:"permanent"`           // 永久封禁，不会按UnbanTime解封
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// ScanDecision 智能扫描的封禁决策记录（观察模式下的"本应封禁"）
+type ScanDecision struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	IPAddress   string    `json:"ip_address" gorm:"index;not null"`
+	Policy      string    `json:"policy" gorm:"index"`
+	Source      string    `json:"source"` // scan / log_analysis
+	Action      string    `json:"action"` // would_ban / alert
+	ThreatScore int       `json:"threat_score"`
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index"`
+}
+
+// GeoPolicy 按国家或ASN匹配的封禁策略，在内置策略之前评估
+type GeoPolicy struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	Name             string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description      string    `json:"description"`
+	Enabled          bool      `json:"enabled"`
+	Priority         int       `json:"priority"`                      // 数值小的先匹配
+	MatchType        string    `json:"match_type"`                    // country / asn
+	Values           []string  `json:"values" gorm:"serializer:json"` // ISO国家代码或ASN号
+	Action           string    `json:"action"`                        // ban / alert
+	MinSSHAttempts   int       `json:"min_ssh_attempts"`
+	MinNginxAttempts int       `json:"min_nginx_attempts"`
+	MinThreatScore   int       `json:"min_threat_score"`
+	IPSet            bool      `json:"ipset"` // 生成整个国家/ASN网段的ipset jail
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// WhitelistEntry 白名单条目，支持IP、CIDR和定期解析的主机名
+type WhitelistEntry struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	Type         string     `json:"type" gorm:"index"`                 // ip / cidr / hostname
+	Value        string     `json:"value" gorm:"uniqueIndex;not null"` // 规范化后的IP、CIDR或主机名
+	Comment      string     `json:"comment"`
+	CreatedBy    string     `json:"created_by"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty" gorm:"index"` // 为空表示永久有效
+	ResolvedIPs  []string   `json:"resolved_ips,omitempty" gorm:"serializer:json"`
+	ResolvedAt   *time.Time `json:"resolved_at,omitempty"`
+	ResolveError string     `json:"resolve_error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// WhitelistIgnoreIP 白名单服务添加到jail ignoreip的地址，同步时只移除这些地址
+type WhitelistIgnoreIP struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Jail      string    `json:"jail" gorm:"uniqueIndex:idx_whitelist_ignore_ip;not null"`
+	Value     string    `json:"value" gorm:"uniqueIndex:idx_whitelist_ignore_ip;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IPList 从文件导入的IP网段列表，allow列表并入白名单，deny列表参与自动封禁决策
+type IPList struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name" gorm:"uniqueIndex;not null"`
+	Kind        string    `json:"kind" gorm:"index"` // allow / deny
+	Description string    `json:"description"`
+	SourceFile  string    `json:"source_file"`
+	Prefixes    []string  `json:"prefixes,omitempty" gorm:"serializer:json"`
+	Count       int       `json:"count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// WebhookEndpoint 出站Webhook，按事件类型推送通知
+type WebhookEndpoint struct {
+	ID          uint              `json:"id" gorm:"primaryKey"`
+	Name        string            `json:"name" gorm:"uniqueIndex;not null"`
+	URL         string            `json:"url" gorm:"not null"`
+	Secret      string            `json:"-"`                              // HMAC签名密钥，不在JSON中返回
+	HasSecret   bool              `json:"has_secret" gorm:"-"`            // 是否设置了签名密钥
+	Events      []string          `json:"events" gorm:"serializer:json"`  // 主题或 主题.类型，* 表示全部
+	Template    string            `json:"template"`                       // Go模板，为空时发送事件JSON
+	ContentType string            `json:"content_type"`                   // 默认application/json
+	Headers     map[string]string `json:"headers" gorm:"serializer:json"` // 附加请求头
+	MaxAttempts int               `json:"max_attempts"`                   // 最大投递次数
+	Enabled     bool              `json:"enabled"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// WebhookDelivery Webhook投递记录，同时作为待投递的发件箱
+type WebhookDelivery struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	EndpointID    uint       `json:"endpoint_id" gorm:"index"`
+	EventID       uint64     `json:"event_id"`
+	Event         string     `json:"event"` // 主题.类型
+	Payload       string     `json:"payload"`
+	Status        string     `json:"status" gorm:"index"` // pending / delivered / failed
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index"`
+	LastError     string     `json:"last_error,omitempty"`
+	ResponseCode  int        `json:"response_code,omitempty"`
+	DeliveredAt   *time.Time `json:"delivered_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// EmailReport 定期发送的摘要报告，每个报告对应一组收件人和发送周期
+type EmailReport struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Name          string     `json:"name" gorm:"uniqueIndex;not null"`
+	Recipients    []string   `json:"recipients" gorm:"serializer:json"`
+	Frequency     string     `json:"frequency"` // daily / weekly
+	Hour          int        `json:"hour"`      // 发送时间（服务器本地时间的小时）
+	Weekday       int        `json:"weekday"`   // 每周报告的发送日，0为周日
+	Enabled       bool       `json:"enabled"`
+	LastSentAt    *time.Time `json:"last_sent_at,omitempty"`
+	LastAttemptAt *time.Time `json:"last_attempt_at,omitempty"`
+	LastError     string     `json:"last_error,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
 // Fail2banJail jail 配置模型
 type Fail2banJail struct {
 	ID          uint   `json:"id" gorm:"primaryKey"`
@@ -83,6 +202,61 @@ type Fail2banJail struct {
 	UpdatedAt   time.Time `json:"updated_at"`
 }
 
+// AnalysisJob 异步分析任务
+type AnalysisJob struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	Type       string      `json:"type" gorm:"index"`   // analyze_log / analyze_access_log / backtest
+	Target     string      `json:"target"`
+	Status     string      `json:"status" gorm:"index"` // pending / running / completed / failed / cancelled
+	LinesRead  int64       `json:"lines_read"`
+	BytesRead  int64       `json:"bytes_read"`
+	TotalBytes int64       `json:"total_bytes"`
+	Findings   interface{} `json:"findings,omitempty" gorm:"serializer:json"`
+	Bans       []string    `json:"bans" gorm:"serializer:json"`
+	Errors     []string    `json:"errors" gorm:"serializer:json"`
+	StartedAt  *time.Time  `json:"started_at,omitempty"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// BanEvent 从fail2ban.log解析出的封禁/解封等事件
+type BanEvent struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Time      time.Time  `json:"time" gorm:"index"`
+	Jail      string     `json:"jail" gorm:"index"`
+	IPAddress string     `json:"ip_address" gorm:"index"`
+	Event     string     `json:"event" gorm:"index"` // found / ban / unban / restore_ban / increase_ban / jail_start / jail_stop / error ...
+	Level     string     `json:"level"`
+	BanUntil  *time.Time `json:"ban_until,omitempty"`
+	Message   string     `json:"message"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// LogIngestState 日志增量导入的读取位置
+type LogIngestState struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Source      string    `json:"source" gorm:"uniqueIndex;not null"`
+	Fingerprint string    `json:"fingerprint"` // 文件首行的摘要，用于识别日志轮转
+	Offset      int64     `json:"offset"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// BacktestRun 回测任务记录
+type BacktestRun struct {
+	ID         uint        `json:"id" gorm:"primaryKey"`
+	JobID      uint        `json:"job_id" gorm:"index"`
+	Status     string      `json:"status" gorm:"index"` // running / completed / failed / cancelled
+	Files      []string    `json:"files" gorm:"serializer:json"`
+	LogType    string      `json:"log_type"`
+	Result     interface{} `json:"result,omitempty" gorm:"serializer:json"`
+	Error      string      `json:"error,omitempty"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt *time.Time  `json:"finished_at,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
 // LoginRequest 登录请求
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
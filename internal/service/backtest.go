@@ -0,0 +1,607 @@
+package service
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// BacktestRequest 回测请求
+type BacktestRequest struct {
+	Sources []string `json:"sources" binding:"required"` // 日志源名称，包含其轮转文件
+	LogType string   `json:"log_type"`                   // auto / ssh / nginx，为空时按日志源类型推断
+}
+
+// BacktestResult 回测结果
+type BacktestResult struct {
+	Files                   []string                `json:"files"`
+	LinesRead               int64                   `json:"lines_read"`
+	EventsParsed            int64                   `json:"events_parsed"`
+	SimulatedFrom           time.Time               `json:"simulated_from"`
+	SimulatedTo             time.Time               `json:"simulated_to"`
+	TotalBans               int                     `json:"total_bans"`
+	PermanentBans           int                     `json:"permanent_bans"` // 达到永久封禁次数的封禁
+	BansPerDay              map[string]int          `json:"bans_per_day"`
+	BansByPolicy            map[string]int          `json:"bans_by_policy"`
+	TotalAlerts             int                     `json:"total_alerts"` // GeoIP告警策略替代的封禁
+	AlertsByPolicy          map[string]int          `json:"alerts_by_policy"`
+	AffectedIPs             []BacktestIPResult      `json:"affected_ips"`
+	FalsePositiveCandidates []BacktestFalsePositive `json:"false_positive_candidates"`
+}
+
+// BacktestIPResult 单个IP的回测结果
+type BacktestIPResult struct {
+	IP          string    `json:"ip"`
+	Bans        int       `json:"bans"`
+	MaxOffense  int       `json:"max_offense"` // 回溯窗口内的最大封禁次数
+	Permanent   bool      `json:"permanent"`
+	FirstBan    time.Time `json:"first_ban"`
+	LastBan     time.Time `json:"last_ban"`
+	MaxScore    int       `json:"max_score"`
+	Policies    []string  `json:"policies"`
+	AttackTypes []string  `json:"attack_types"`
+}
+
+// BacktestFalsePositive 可能误封的IP
+type BacktestFalsePositive struct {
+	IP     string    `json:"ip"`
+	Reason string    `json:"reason"` // whitelisted / successful_login
+	Policy string    `json:"policy"`
+	Time   time.Time `json:"time"`
+}
+
+// BacktestService 回测服务，用历史日志评估规则和封禁策略
+type BacktestService struct {
+	db                 *gorm.DB
+	intelligentService *IntelligentScanService
+	jobService         *JobService
+	logSourceService   *LogSourceService
+}
+
+// NewBacktestService 创建回测服务
+func NewBacktestService(db *gorm.DB, intelligentService *IntelligentScanService, jobService *JobService, logSourceService *LogSourceService) *BacktestService {
+	return &BacktestService{
+		db:                 db,
+		intelligentService: intelligentService,
+		jobService:         jobService,
+		logSourceService:   logSourceService,
+	}
+}
+
+// backtestSandbox 回测沙箱，使用日志时间作为模拟时钟，不影响线上威胁数据和fail2ban
+type backtestSandbox struct {
+	scanner       *IntelligentScanService
+	threats       map[string]*IPThreatLevel
+	bannedUntil   map[string]time.Time
+	banHistory    map[string][]time.Time // 沙箱中每个目标的模拟封禁时间，用于计算递增封禁时长
+	alertedUntil  map[string]time.Time   // 告警在一个封禁周期内只记录一次，与recordDecision一致
+	successLogins map[string]bool
+	clock         time.Time
+	lastCleanup   time.Time
+	result        *BacktestResult
+	ipResults     map[string]*BacktestIPResult
+	reportedFPs   map[string]bool
+}
+
+// StartBacktest 创建回测任务并提交到任务队列
+func (s *BacktestService) StartBacktest(req BacktestRequest) (*model.BacktestRun, error) {
+	if len(req.Sources) == 0 {
+		return nil, fmt.Errorf("至少需要一个日志源")
+	}
+
+	var patterns []string
+	sourceTypes := make(map[string]bool)
+	for _, name := range req.Sources {
+		source, err := s.logSourceService.GetSource(name)
+		if err != nil {
+			return nil, fmt.Errorf("日志源 %s: %w", name, err)
+		}
+		sourceTypes[source.Type] = true
+		patterns = append(patterns, source.RotationPatterns()...)
+	}
+
+	files, err := resolveLogFiles(patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	logType := req.LogType
+	if logType == "" {
+		logType = "auto"
+		// 所有日志源类型一致时直接使用该类型解析
+		if len(sourceTypes) == 1 && (sourceTypes[LogSourceTypeSSH] || sourceTypes[LogSourceTypeNginx]) {
+			for sourceType := range sourceTypes {
+				logType = sourceType
+			}
+		}
+	}
+	if logType != "auto" && logType != "ssh" && logType != "nginx" {
+		return nil, fmt.Errorf("不支持的日志类型: %s", logType)
+	}
+
+	run := &model.BacktestRun{
+		Status:    "running",
+		Files:     files,
+		LogType:   logType,
+		StartedAt: time.Now(),
+	}
+	if err := s.db.Create(run).Error; err != nil {
+		return nil, fmt.Errorf("创建回测任务失败: %w", err)
+	}
+
+	job, err := s.jobService.Submit(JobTypeBacktest, strings.Join(files, ","), func(ctx context.Context, progress *JobProgress) (interface{}, error) {
+		return s.execute(ctx, run.ID, files, logType, progress)
+	})
+	if err != nil {
+		s.db.Model(run).Updates(map[string]interface{}{"status": "failed", "error": err.Error()})
+		return nil, err
+	}
+
+	run.JobID = job.ID
+	if err := s.db.Model(run).Update("job_id", job.ID).Error; err != nil {
+		log.Printf("保存回测任务 #%d 的任务ID失败: %v", run.ID, err)
+	}
+
+	return run, nil
+}
+
+// execute 执行回测并保存结果
+func (s *BacktestService) execute(ctx context.Context, runID uint, files []string, logType string, progress *JobProgress) (interface{}, error) {
+	log.Printf("开始回测任务 #%d: %v", runID, files)
+
+	result, err := s.Run(ctx, files, logType, progress)
+	finishedAt := time.Now()
+
+	updates := map[string]interface{}{
+		"finished_at": &finishedAt,
+	}
+	if errors.Is(err, context.Canceled) {
+		log.Printf("回测任务 #%d 已取消", runID)
+		updates["status"] = "cancelled"
+	} else if err != nil {
+		log.Printf("回测任务 #%d 失败: %v", runID, err)
+		updates["status"] = "failed"
+		updates["error"] = err.Error()
+	} else {
+		log.Printf("回测任务 #%d 完成: 模拟封禁 %d 次, 涉及 %d 个IP", runID, result.TotalBans, len(result.AffectedIPs))
+		updates["status"] = "completed"
+		updates["result"] = result
+	}
+
+	if err := s.db.Model(&model.BacktestRun{ID: runID}).Updates(updates).Error; err != nil {
+		log.Printf("保存回测任务 #%d 结果失败: %v", runID, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 详细结果保存在回测记录中，任务只保留摘要
+	return map[string]interface{}{
+		"backtest_id":  runID,
+		"total_bans":   result.TotalBans,
+		"affected_ips": len(result.AffectedIPs),
+	}, nil
+}
+
+// Run 同步执行回测
+func (s *BacktestService) Run(ctx context.Context, files []string, logType string, progress *JobProgress) (*BacktestResult, error) {
+	sandbox := &backtestSandbox{
+		scanner:       s.intelligentService,
+		threats:       make(map[string]*IPThreatLevel),
+		bannedUntil:   make(map[string]time.Time),
+		banHistory:    make(map[string][]time.Time),
+		alertedUntil:  make(map[string]time.Time),
+		successLogins: make(map[string]bool),
+		ipResults:     make(map[string]*BacktestIPResult),
+		reportedFPs:   make(map[string]bool),
+		result: &BacktestResult{
+			Files:                   files,
+			BansPerDay:              make(map[string]int),
+			BansByPolicy:            make(map[string]int),
+			AlertsByPolicy:          make(map[string]int),
+			AffectedIPs:             []BacktestIPResult{},
+			FalsePositiveCandidates: []BacktestFalsePositive{},
+		},
+	}
+
+	for _, file := range files {
+		if stat, err := os.Stat(file); err == nil {
+			progress.AddTotalBytes(stat.Size())
+		}
+	}
+
+	for _, file := range files {
+		if err := sandbox.replayFile(ctx, file, logType, progress); err != nil {
+			return nil, err
+		}
+	}
+
+	return sandbox.finish(), nil
+}
+
+// GetBacktest 获取回测任务
+func (s *BacktestService) GetBacktest(id uint) (*model.BacktestRun, error) {
+	var run model.BacktestRun
+	if err := s.db.First(&run, id).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// ListBacktests 获取回测任务列表（不含详细结果）
+func (s *BacktestService) ListBacktests(limit int) ([]model.BacktestRun, error) {
+	var runs []model.BacktestRun
+	err := s.db.Omit("result").Order("id DESC").Limit(limit).Find(&runs).Error
+	return runs, err
+}
+
+// resolveLogFiles 展开通配符并按修改时间从旧到新排序，保证轮转日志按时间顺序回放
+func resolveLogFiles(patterns []string) ([]string, error) {
+	type fileInfo struct {
+		path    string
+		modTime time.Time
+	}
+
+	seen := make(map[string]bool)
+	var infos []fileInfo
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("无效的文件模式 %s: %w", pattern, err)
+		}
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			stat, err := os.Stat(path)
+			if err != nil || stat.IsDir() {
+				continue
+			}
+			seen[path] = true
+			infos = append(infos, fileInfo{path: path, modTime: stat.ModTime()})
+		}
+	}
+
+	if len(infos) == 0 {
+		return nil, fmt.Errorf("没有找到匹配的日志文件: %v", patterns)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].modTime.Before(infos[j].modTime)
+	})
+
+	files := make([]string, len(infos))
+	for i, info := range infos {
+		files[i] = info.path
+	}
+	return files, nil
+}
+
+// openLogFile 打开日志文件，gzip压缩的轮转日志会自动解压，读取的字节数按文件原始大小统计
+func openLogFile(path string, progress *JobProgress) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader := progress.Reader(file)
+	if !strings.HasSuffix(path, ".gz") {
+		return &logFileReader{Reader: reader, file: file}, nil
+	}
+
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("无法解压日志文件 %s: %w", path, err)
+	}
+	return &logFileReader{Reader: gz, file: file}, nil
+}
+
+// logFileReader 读取（可能经过解压的）日志内容，关闭时关闭底层文件
+type logFileReader struct {
+	io.Reader
+	file *os.File
+}
+
+func (r *logFileReader) Close() error {
+	return r.file.Close()
+}
+
+// replayFile 回放单个日志文件
+func (b *backtestSandbox) replayFile(ctx context.Context, path, logType string, progress *JobProgress) error {
+	reader, err := openLogFile(path, progress)
+	if err != nil {
+		return fmt.Errorf("无法打开日志文件 %s: %w", path, err)
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	buf := make([]byte, 1024*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	for scanner.Scan() {
+		b.result.LinesRead++
+		progress.AddLines(1)
+
+		// 定期检查任务是否被取消
+		if b.result.LinesRead%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		b.replayLine(scanner.Text(), logType)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("读取日志文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+// replayLine 解析一行日志并送入规则引擎
+func (b *backtestSandbox) replayLine(line, logType string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+
+	if logType == "auto" || logType == "ssh" {
+		if entry := parseSSHLogLine(line); entry != nil {
+			b.result.EventsParsed++
+			b.handleSSHEvent(entry)
+			return
+		}
+	}
+
+	if logType == "auto" || logType == "nginx" {
+		if entry := parseNginxAccessLine(line); entry != nil && !entry.Timestamp.IsZero() {
+			b.result.EventsParsed++
+			b.handleNginxEvent(entry)
+		}
+	}
+}
+
+// handleSSHEvent 处理SSH事件，与scanSSHLogs保持一致
+func (b *backtestSandbox) handleSSHEvent(entry *SSHLog) {
+	if entry.IP == "" || entry.Timestamp.IsZero() {
+		return
+	}
+	b.advanceClock(entry.Timestamp)
+
+	if entry.Status == "success" {
+		b.successLogins[b.scanner.threatKey(entry.IP)] = true
+		return
+	}
+	if entry.Status == "failed" {
+		b.applyEvent(entry.IP, "ssh", entry.Event, entry.Timestamp)
+	}
+}
+
+// handleNginxEvent 处理Nginx事件，与scanNginxLogs保持一致
+func (b *backtestSandbox) handleNginxEvent(entry *NginxLog) {
+	if entry.IP == "" {
+		return
+	}
+	b.advanceClock(entry.Timestamp)
+
+	if entry.AttackType != "" {
+		b.applyEvent(entry.IP, "nginx", entry.AttackType, entry.Timestamp)
+	} else if entry.StatusCode >= 400 {
+		b.applyEvent(entry.IP, "nginx", "http_error", entry.Timestamp)
+	}
+}
+
+// advanceClock 推进模拟时钟并清理过期数据
+func (b *backtestSandbox) advanceClock(timestamp time.Time) {
+	if b.result.SimulatedFrom.IsZero() || timestamp.Before(b.result.SimulatedFrom) {
+		b.result.SimulatedFrom = timestamp
+	}
+	if !timestamp.After(b.clock) {
+		return
+	}
+	b.clock = timestamp
+	b.result.SimulatedTo = timestamp
+
+	// 每模拟一小时清理一次过期的威胁和封禁
+	if b.clock.Sub(b.lastCleanup) < time.Hour {
+		return
+	}
+	b.lastCleanup = b.clock
+
+	expirationTime := b.clock.Add(-24 * time.Hour)
+	for ip, threat := range b.threats {
+		if threat.LastSeen.Before(expirationTime) {
+			delete(b.threats, ip)
+		}
+	}
+	for ip, until := range b.bannedUntil {
+		if !until.After(b.clock) {
+			delete(b.bannedUntil, ip)
+		}
+	}
+	for ip, until := range b.alertedUntil {
+		if !until.After(b.clock) {
+			delete(b.alertedUntil, ip)
+		}
+	}
+	if lookback := b.scanner.banConfig().Lookback; lookback > 0 {
+		cutoff := b.clock.Add(-lookback)
+		for target, times := range b.banHistory {
+			kept := times[:0]
+			for _, banTime := range times {
+				if !banTime.Before(cutoff) {
+					kept = append(kept, banTime)
+				}
+			}
+			if len(kept) == 0 {
+				delete(b.banHistory, target)
+			} else {
+				b.banHistory[target] = kept
+			}
+		}
+	}
+}
+
+// applyEvent 更新沙箱中的威胁记录并评估封禁策略，IPv6地址与扫描器一致按网段聚合
+func (b *backtestSandbox) applyEvent(address, source, attackType string, timestamp time.Time) {
+	ip := b.scanner.threatKey(address)
+
+	// 封禁期间的请求会被防火墙拦截，不再计入
+	if until, banned := b.bannedUntil[ip]; banned && until.After(timestamp) {
+		return
+	}
+
+	threat, exists := b.threats[ip]
+	if !exists {
+		threat = &IPThreatLevel{
+			IP:          ip,
+			AttackTypes: []string{},
+			FirstSeen:   timestamp,
+			LastSeen:    timestamp,
+		}
+		b.threats[ip] = threat
+	}
+	b.scanner.applyThreatEvent(threat, source, attackType, timestamp)
+
+	// 与线上自动处理相同：黑名单和GeoIP策略优先于内置策略
+	policy, action := b.scanner.resolveBanDecision(threat, b.scanner.matchBanPolicy(threat))
+	if policy == "" {
+		return
+	}
+	if action == GeoPolicyActionAlert {
+		b.recordAlert(ip, policy, timestamp)
+		return
+	}
+
+	// 白名单IP和曾经成功登录的IP视为可能的误封
+	if b.scanner.IsIPWhitelisted(ip) {
+		b.reportFalsePositive(ip, "whitelisted", policy, timestamp)
+		delete(b.threats, ip)
+		return
+	}
+	if b.successLogins[ip] {
+		b.reportFalsePositive(ip, "successful_login", policy, timestamp)
+	}
+
+	b.recordBan(ip, threat, policy, timestamp)
+}
+
+// recordAlert 记录一次告警，同一IP在一个封禁周期内只记录一次
+func (b *backtestSandbox) recordAlert(ip, policy string, timestamp time.Time) {
+	if until, alerted := b.alertedUntil[ip]; alerted && until.After(timestamp) {
+		return
+	}
+	b.alertedUntil[ip] = timestamp.Add(b.scanner.getBanDuration())
+	b.result.TotalAlerts++
+	b.result.AlertsByPolicy[policy]++
+}
+
+// planBan 与线上planBan相同的递增封禁计算，历史封禁次数来自沙箱中的模拟封禁
+func (b *backtestSandbox) planBan(ip string, banTime time.Time) banPlan {
+	cfg := b.scanner.banConfig()
+	prior := 0
+	for _, target := range b.scanner.banHistoryTargets(ip) {
+		for _, previous := range b.banHistory[target] {
+			if cfg.Lookback <= 0 || !previous.Before(banTime.Add(-cfg.Lookback)) {
+				prior++
+			}
+		}
+	}
+	return calculateBanPlan(cfg, prior)
+}
+
+// recordBan 记录一次模拟封禁
+func (b *backtestSandbox) recordBan(ip string, threat *IPThreatLevel, policy string, banTime time.Time) {
+	plan := b.planBan(ip, banTime)
+	if plan.Permanent {
+		// 永久封禁的IP在回测剩余时间内不会再出现
+		b.bannedUntil[ip] = banTime.Add(maxBanDuration)
+		b.result.PermanentBans++
+	} else {
+		b.bannedUntil[ip] = banTime.Add(plan.Duration)
+	}
+	b.banHistory[ip] = append(b.banHistory[ip], banTime)
+	b.result.TotalBans++
+	b.result.BansPerDay[banTime.Format("2006-01-02")]++
+	b.result.BansByPolicy[policy]++
+
+	ipResult, exists := b.ipResults[ip]
+	if !exists {
+		ipResult = &BacktestIPResult{
+			IP:          ip,
+			FirstBan:    banTime,
+			Policies:    []string{},
+			AttackTypes: []string{},
+		}
+		b.ipResults[ip] = ipResult
+	}
+	ipResult.Bans++
+	if plan.Offense > ipResult.MaxOffense {
+		ipResult.MaxOffense = plan.Offense
+	}
+	ipResult.Permanent = ipResult.Permanent || plan.Permanent
+	if banTime.Before(ipResult.FirstBan) {
+		ipResult.FirstBan = banTime
+	}
+	if banTime.After(ipResult.LastBan) {
+		ipResult.LastBan = banTime
+	}
+	if threat.ThreatScore > ipResult.MaxScore {
+		ipResult.MaxScore = threat.ThreatScore
+	}
+	if !contains(ipResult.Policies, policy) {
+		ipResult.Policies = append(ipResult.Policies, policy)
+	}
+	for _, attackType := range threat.AttackTypes {
+		if !contains(ipResult.AttackTypes, attackType) {
+			ipResult.AttackTypes = append(ipResult.AttackTypes, attackType)
+		}
+	}
+
+	// 封禁后威胁记录重新计算
+	delete(b.threats, ip)
+}
+
+// reportFalsePositive 记录可能的误封，每个IP每种原因只记录一次
+func (b *backtestSandbox) reportFalsePositive(ip, reason, policy string, timestamp time.Time) {
+	key := ip + "|" + reason
+	if b.reportedFPs[key] {
+		return
+	}
+	b.reportedFPs[key] = true
+
+	b.result.FalsePositiveCandidates = append(b.result.FalsePositiveCandidates, BacktestFalsePositive{
+		IP:     ip,
+		Reason: reason,
+		Policy: policy,
+		Time:   timestamp,
+	})
+}
+
+// finish 汇总回测结果
+func (b *backtestSandbox) finish() *BacktestResult {
+	for _, ipResult := range b.ipResults {
+		b.result.AffectedIPs = append(b.result.AffectedIPs, *ipResult)
+	}
+	sort.Slice(b.result.AffectedIPs, func(i, j int) bool {
+		if b.result.AffectedIPs[i].Bans != b.result.AffectedIPs[j].Bans {
+			return b.result.AffectedIPs[i].Bans > b.result.AffectedIPs[j].Bans
+		}
+		return b.result.AffectedIPs[i].IP < b.result.AffectedIPs[j].IP
+	})
+
+	return b.result
+}
@@ -0,0 +1,571 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	banEventSource        = "fail2ban"
+	banEventPollInterval  = 10 * time.Second
+	banEventBatchSize     = 500
+	banEventFingerprintSz = 4096
+	// banEventLiveWindow 只发布该时间内的日志事件，首次导入的历史日志不推送到事件流
+	banEventLiveWindow = 5 * time.Minute
+)
+
+// BanEventFilter 事件查询条件
+type BanEventFilter struct {
+	IP       string
+	Jail     string
+	Event    string
+	Since    time.Time
+	Until    time.Time
+	BeforeID uint // 按ID倒序翻页
+	Limit    int
+}
+
+// IPBanHistory 单个IP的封禁历史
+type IPBanHistory struct {
+	IP          string           `json:"ip"`
+	TotalFound  int              `json:"total_found"`
+	TotalBans   int              `json:"total_bans"`
+	TotalUnbans int              `json:"total_unbans"`
+	FirstSeen   *time.Time       `json:"first_seen,omitempty"`
+	LastSeen    *time.Time       `json:"last_seen,omitempty"`
+	Jails       []string         `json:"jails"`
+	BannedIn    []string         `json:"banned_in"` // 按日志判断当前仍处于封禁的jail
+	Events      []model.BanEvent `json:"events"`
+}
+
+// JailBanHistory 单个jail的封禁历史
+type JailBanHistory struct {
+	Jail        string           `json:"jail"`
+	Since       time.Time        `json:"since"`
+	TotalFound  int64            `json:"total_found"`
+	TotalBans   int64            `json:"total_bans"`
+	TotalUnbans int64            `json:"total_unbans"`
+	UniqueIPs   int64            `json:"unique_ips"`
+	BansPerDay  map[string]int   `json:"bans_per_day"`
+	TopIPs      []IPCount        `json:"top_ips"`
+	Events      []model.BanEvent `json:"events"`
+}
+
+// IPCount IP及其次数
+type IPCount struct {
+	IP    string `json:"ip"`
+	Count int    `json:"count"`
+}
+
+// BanEventService fail2ban事件服务，持续增量读取fail2ban.log写入BanEvent表，并据此同步BannedIP表
+type BanEventService struct {
+	db               *gorm.DB
+	logSourceService *LogSourceService
+	fail2banService  *Fail2BanService
+	eventBus         *EventBus
+	metrics          *Metrics
+	ctx              context.Context
+	cancel           context.CancelFunc
+	wg               sync.WaitGroup
+	mu               sync.Mutex // 保证同一时间只有一次导入
+}
+
+// NewBanEventService 创建fail2ban事件服务
+func NewBanEventService(db *gorm.DB, logSourceService *LogSourceService, fail2banService *Fail2BanService, eventBus *EventBus, metrics *Metrics) *BanEventService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &BanEventService{
+		db:               db,
+		logSourceService: logSourceService,
+		fail2banService:  fail2banService,
+		eventBus:         eventBus,
+		metrics:          metrics,
+		ctx:              ctx,
+		cancel:           cancel,
+	}
+}
+
+// Start 启动后台导入
+func (s *BanEventService) Start() {
+	s.wg.Add(1)
+	go s.ingestLoop()
+}
+
+// Stop 停止后台导入
+func (s *BanEventService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// ingestLoop 定期导入fail2ban.log中新增的内容
+func (s *BanEventService) ingestLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(banEventPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Ingest(); err != nil {
+			log.Printf("导入fail2ban日志失败: %v", err)
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Ingest 从上次的位置继续读取fail2ban.log，返回导入的事件数
+func (s *BanEventService) Ingest() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, err := s.logSourceService.GetSource(banEventSource)
+	if err != nil {
+		return 0, err
+	}
+	if !source.Exists {
+		return 0, nil
+	}
+
+	var state model.LogIngestState
+	if err := s.db.Where("source = ?", banEventSource).FirstOrInit(&state, model.LogIngestState{Source: banEventSource}).Error; err != nil {
+		return 0, fmt.Errorf("读取导入状态失败: %w", err)
+	}
+
+	fingerprint, err := fileFingerprint(source.Path)
+	if err != nil {
+		return 0, err
+	}
+
+	total := 0
+	if state.Fingerprint != "" && (fingerprint != state.Fingerprint || source.Size < state.Offset) {
+		// 日志已轮转：先读完轮转前文件剩余的部分，再从新文件开头读取
+		rotated := source.Path + ".1"
+		if rotatedFingerprint, err := fileFingerprint(rotated); err == nil && rotatedFingerprint == state.Fingerprint {
+			n, err := s.ingestFile(rotated, &state)
+			total += n
+			if err != nil {
+				return total, err
+			}
+		}
+		log.Printf("检测到fail2ban日志轮转，从头读取 %s", source.Path)
+		state.Offset = 0
+	}
+	state.Fingerprint = fingerprint
+
+	n, err := s.ingestFile(source.Path, &state)
+	total += n
+	if total > 0 {
+		log.Printf("已导入 %d 条fail2ban事件", total)
+	}
+	return total, err
+}
+
+// ingestFile 从state.Offset开始读取文件中完整的行，分批写入事件并保存读取位置
+func (s *BanEventService) ingestFile(path string, state *model.LogIngestState) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(state.Offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	offset := state.Offset
+	total := 0
+	var batch []*Fail2BanLogEntry
+
+	parsed, failed := 0, 0
+	defer func() {
+		s.metrics.RecordLogLines(LogMetricSourceFail2ban, parsed, failed)
+	}()
+
+	flush := func() error {
+		if err := s.saveBatch(batch, state, offset); err != nil {
+			return err
+		}
+		s.publishEntries(batch)
+		total += len(batch)
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		// 只处理完整的行，写了一半的行留到下次读取
+		if err != nil {
+			if err != io.EOF {
+				return total, err
+			}
+			break
+		}
+		offset += int64(len(line))
+
+		entry := parseFail2BanLogLine(strings.TrimRight(line, "\r\n"))
+		if entry == nil {
+			if strings.TrimSpace(line) != "" {
+				failed++
+			}
+			continue
+		}
+		parsed++
+		if entry.Event == Fail2BanEventInfo {
+			continue
+		}
+
+		batch = append(batch, entry)
+		if len(batch) >= banEventBatchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+			if err := s.ctx.Err(); err != nil {
+				return total, nil
+			}
+		}
+	}
+
+	if len(batch) > 0 || offset != state.Offset {
+		if err := flush(); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// saveBatch 在一个事务中写入事件、同步BannedIP并更新读取位置
+func (s *BanEventService) saveBatch(entries []*Fail2BanLogEntry, state *model.LogIngestState, offset int64) error {
+	// 在事务外查询jail的bantime，避免执行fail2ban-client时占用数据库
+	unbanTimes := make([]time.Time, len(entries))
+	banTimes := make(map[string]time.Duration)
+	for i, entry := range entries {
+		unbanTimes[i] = s.unbanTime(entry, banTimes)
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if len(entries) > 0 {
+			events := make([]model.BanEvent, len(entries))
+			for i, entry := range entries {
+				events[i] = model.BanEvent{
+					Time:      entry.Timestamp,
+					Jail:      entry.Jail,
+					IPAddress: entry.IP,
+					Event:     entry.Event,
+					Level:     entry.Level,
+					BanUntil:  entry.BanUntil,
+					Message:   entry.Message,
+				}
+			}
+			if err := tx.Create(&events).Error; err != nil {
+				return fmt.Errorf("保存fail2ban事件失败: %w", err)
+			}
+
+			for i, entry := range entries {
+				if err := reconcileBannedIP(tx, entry, unbanTimes[i]); err != nil {
+					return err
+				}
+			}
+		}
+
+		state.Offset = offset
+		if err := tx.Save(state).Error; err != nil {
+			return fmt.Errorf("保存导入状态失败: %w", err)
+		}
+		return nil
+	})
+}
+
+// publishEntries 将新写入的fail2ban事件发布到事件总线并计入封禁指标
+func (s *BanEventService) publishEntries(entries []*Fail2BanLogEntry) {
+	cutoff := time.Now().Add(-banEventLiveWindow)
+	for _, entry := range entries {
+		if entry.Timestamp.Before(cutoff) {
+			continue
+		}
+		s.eventBus.Publish(fail2banEventTopic(entry.Event), entry.Event, entry)
+
+		switch entry.Event {
+		case Fail2BanEventBan:
+			s.metrics.RecordLogBan(entry.Jail)
+		case Fail2BanEventUnban:
+			s.metrics.RecordLogUnban(entry.Jail)
+		}
+	}
+}
+
+// fail2banEventTopic fail2ban日志事件对应的事件主题
+func fail2banEventTopic(event string) string {
+	switch event {
+	case Fail2BanEventBan, Fail2BanEventRestoreBan, Fail2BanEventIncreaseBan:
+		return EventTopicBan
+	case Fail2BanEventUnban:
+		return EventTopicUnban
+	case Fail2BanEventJailStart, Fail2BanEventJailStop:
+		return EventTopicJail
+	default:
+		return EventTopicLog
+	}
+}
+
+// unbanTime 封禁事件的预计解封时间：日志中有解封时间时直接使用，
+// 普通的Ban行没有解封时间，按jail当前的bantime推算。无法推算或永久封禁时返回零值。
+// banTimes缓存本批次中各jail的bantime，获取失败的jail记为-1，避免重复执行fail2ban-client
+func (s *BanEventService) unbanTime(entry *Fail2BanLogEntry, banTimes map[string]time.Duration) time.Time {
+	switch entry.Event {
+	case Fail2BanEventBan, Fail2BanEventRestoreBan, Fail2BanEventIncreaseBan:
+	default:
+		return time.Time{}
+	}
+	if entry.BanUntil != nil {
+		return *entry.BanUntil
+	}
+	if s.fail2banService == nil || entry.Jail == "" {
+		return time.Time{}
+	}
+
+	banTime, cached := banTimes[entry.Jail]
+	if !cached {
+		var err error
+		if banTime, err = s.fail2banService.GetBanTime(entry.Jail); err != nil {
+			// jail已停止或删除时无法获取，解封时间留空
+			banTime = -1
+		}
+		banTimes[entry.Jail] = banTime
+	}
+	if banTime < 0 {
+		return time.Time{}
+	}
+	return entry.Timestamp.Add(banTime)
+}
+
+// reconcileBannedIP 根据fail2ban事件同步BannedIP表，unbanTime为预计解封时间，零值表示未知
+func reconcileBannedIP(tx *gorm.DB, entry *Fail2BanLogEntry, unbanTime time.Time) error {
+	if entry.IP == "" || entry.Jail == "" {
+		return nil
+	}
+
+	switch entry.Event {
+	case Fail2BanEventBan, Fail2BanEventRestoreBan, Fail2BanEventIncreaseBan:
+		var existing model.BannedIP
+		err := tx.Where("ip_address = ? AND jail = ? AND is_active = ?", entry.IP, entry.Jail, true).First(&existing).Error
+		if err == nil {
+			if entry.BanUntil != nil {
+				return tx.Model(&existing).Update("unban_time", *entry.BanUntil).Error
+			}
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return fmt.Errorf("查询封禁记录失败: %w", err)
+		}
+
+		bannedIP := &model.BannedIP{
+			IPAddress: entry.IP,
+			Jail:      entry.Jail,
+			BanTime:   entry.Timestamp,
+			UnbanTime: unbanTime,
+			IsActive:  true,
+			Reason:    "fail2ban: " + entry.Message,
+		}
+		return tx.Create(bannedIP).Error
+
+	case Fail2BanEventUnban:
+		var records []model.BannedIP
+		if err := tx.Where("ip_address = ? AND jail = ? AND is_active = ?", entry.IP, entry.Jail, true).Find(&records).Error; err != nil {
+			return fmt.Errorf("查询封禁记录失败: %w", err)
+		}
+		for _, record := range records {
+			// 仍在封禁时长内的递增、永久和延长封禁被提前解封，保留记录由封禁生命周期重新封禁
+			if banEnforced(&record, entry.Timestamp) {
+				continue
+			}
+			if err := tx.Model(&record).Updates(map[string]interface{}{
+				"is_active":  false,
+				"unban_time": entry.Timestamp,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// fileFingerprint 计算文件开头内容的摘要，首行未写完时返回空字符串
+func fileFingerprint(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	buf := make([]byte, banEventFingerprintSz)
+	n, err := io.ReadFull(file, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+
+	idx := strings.IndexByte(string(buf[:n]), '\n')
+	if idx < 0 {
+		return "", nil
+	}
+
+	sum := sha1.Sum(buf[:idx])
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ListEvents 查询fail2ban事件，按时间倒序
+func (s *BanEventService) ListEvents(filter BanEventFilter) ([]model.BanEvent, error) {
+	if filter.Limit <= 0 || filter.Limit > 1000 {
+		filter.Limit = 100
+	}
+
+	query := s.db.Model(&model.BanEvent{}).Order("id DESC").Limit(filter.Limit)
+	if filter.IP != "" {
+		query = query.Where("ip_address = ?", filter.IP)
+	}
+	if filter.Jail != "" {
+		query = query.Where("jail = ?", filter.Jail)
+	}
+	if filter.Event != "" {
+		query = query.Where("event = ?", filter.Event)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("time >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("time <= ?", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	var events []model.BanEvent
+	err := query.Find(&events).Error
+	return events, err
+}
+
+// GetIPHistory 获取IP的完整封禁历史
+func (s *BanEventService) GetIPHistory(ip string) (*IPBanHistory, error) {
+	var events []model.BanEvent
+	if err := s.db.Where("ip_address = ?", ip).Order("time ASC, id ASC").Find(&events).Error; err != nil {
+		return nil, err
+	}
+
+	history := &IPBanHistory{
+		IP:       ip,
+		Jails:    []string{},
+		BannedIn: []string{},
+		Events:   events,
+	}
+
+	jails := make(map[string]bool)
+	banned := make(map[string]bool)
+	for i := range events {
+		event := &events[i]
+		if history.FirstSeen == nil {
+			history.FirstSeen = &event.Time
+		}
+		history.LastSeen = &event.Time
+		if event.Jail != "" {
+			jails[event.Jail] = true
+		}
+
+		switch event.Event {
+		case Fail2BanEventFound:
+			history.TotalFound++
+		case Fail2BanEventBan, Fail2BanEventRestoreBan, Fail2BanEventIncreaseBan:
+			if event.Event == Fail2BanEventBan {
+				history.TotalBans++
+			}
+			banned[event.Jail] = true
+		case Fail2BanEventUnban:
+			history.TotalUnbans++
+			banned[event.Jail] = false
+		}
+	}
+
+	for jail := range jails {
+		history.Jails = append(history.Jails, jail)
+		if banned[jail] {
+			history.BannedIn = append(history.BannedIn, jail)
+		}
+	}
+	sort.Strings(history.Jails)
+	sort.Strings(history.BannedIn)
+
+	return history, nil
+}
+
+// GetJailHistory 获取jail在指定时间之后的封禁统计和最近事件
+func (s *BanEventService) GetJailHistory(jail string, since time.Time, limit int) (*JailBanHistory, error) {
+	history := &JailBanHistory{
+		Jail:       jail,
+		Since:      since,
+		BansPerDay: make(map[string]int),
+		TopIPs:     []IPCount{},
+	}
+
+	base := func() *gorm.DB {
+		return s.db.Model(&model.BanEvent{}).Where("jail = ? AND time >= ?", jail, since)
+	}
+
+	if err := base().Where("event = ?", Fail2BanEventFound).Count(&history.TotalFound).Error; err != nil {
+		return nil, err
+	}
+	if err := base().Where("event = ?", Fail2BanEventBan).Count(&history.TotalBans).Error; err != nil {
+		return nil, err
+	}
+	if err := base().Where("event = ?", Fail2BanEventUnban).Count(&history.TotalUnbans).Error; err != nil {
+		return nil, err
+	}
+	if err := base().Where("event = ?", Fail2BanEventBan).Distinct("ip_address").Count(&history.UniqueIPs).Error; err != nil {
+		return nil, err
+	}
+
+	var bans []model.BanEvent
+	if err := base().Select("ip_address", "time").Where("event = ?", Fail2BanEventBan).Find(&bans).Error; err != nil {
+		return nil, err
+	}
+	ipCounts := make(map[string]int)
+	for _, ban := range bans {
+		history.BansPerDay[ban.Time.Format("2006-01-02")]++
+		ipCounts[ban.IPAddress]++
+	}
+	for ip, count := range ipCounts {
+		history.TopIPs = append(history.TopIPs, IPCount{IP: ip, Count: count})
+	}
+	sort.Slice(history.TopIPs, func(i, j int) bool {
+		if history.TopIPs[i].Count != history.TopIPs[j].Count {
+			return history.TopIPs[i].Count > history.TopIPs[j].Count
+		}
+		return history.TopIPs[i].IP < history.TopIPs[j].IP
+	})
+	if len(history.TopIPs) > 10 {
+		history.TopIPs = history.TopIPs[:10]
+	}
+
+	if err := base().Order("id DESC").Limit(limit).Find(&history.Events).Error; err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
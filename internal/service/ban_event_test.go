@@ -0,0 +1,312 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/model"
+)
+
+func localTime(value string) time.Time {
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.000", value, time.Local)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestParseFail2BanLogLine(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		event    string // 空字符串表示格式不符
+		jail     string
+		ip       string
+		level    string
+		time     string
+		banUntil string
+	}{
+		{
+			name:  "Found",
+			line:  "2024-01-02 15:04:05,123 fail2ban.filter         [1234]: INFO    [sshd] Found 192.0.2.1 - 2024-01-02 15:04:05",
+			event: Fail2BanEventFound, jail: "sshd", ip: "192.0.2.1", level: "INFO", time: "2024-01-02 15:04:05.123",
+		},
+		{
+			name:  "Ban",
+			line:  "2024-01-02 15:04:06,001 fail2ban.actions        [1234]: NOTICE  [sshd] Ban 192.0.2.1",
+			event: Fail2BanEventBan, jail: "sshd", ip: "192.0.2.1", level: "NOTICE", time: "2024-01-02 15:04:06.001",
+		},
+		{
+			name:  "IPv6 Ban",
+			line:  "2024-01-02 15:04:07,500 fail2ban.actions        [1234]: NOTICE  [nginx-http-auth] Ban 2001:db8::1",
+			event: Fail2BanEventBan, jail: "nginx-http-auth", ip: "2001:db8::1", level: "NOTICE", time: "2024-01-02 15:04:07.500",
+		},
+		{
+			name:  "Unban",
+			line:  "2024-01-02 16:04:06,002 fail2ban.actions        [1234]: NOTICE  [sshd] Unban 192.0.2.1",
+			event: Fail2BanEventUnban, jail: "sshd", ip: "192.0.2.1", level: "NOTICE", time: "2024-01-02 16:04:06.002",
+		},
+		{
+			name:  "Restore Ban",
+			line:  "2024-01-02 15:00:01,010 fail2ban.actions        [987]: NOTICE  [sshd] Restore Ban 198.51.100.7",
+			event: Fail2BanEventRestoreBan, jail: "sshd", ip: "198.51.100.7", level: "NOTICE", time: "2024-01-02 15:00:01.010",
+		},
+		{
+			name:  "Increase Ban",
+			line:  "2024-01-02 15:04:05,000 fail2ban.actions        [1234]: NOTICE  [recidive] Increase Ban 203.0.113.5 (2 # 2:00:00 -> 2024-01-02 17:04:05)",
+			event: Fail2BanEventIncreaseBan, jail: "recidive", ip: "203.0.113.5", level: "NOTICE", time: "2024-01-02 15:04:05.000",
+			banUntil: "2024-01-02 17:04:05.000",
+		},
+		{
+			name:  "IPv6 Increase Ban",
+			line:  "2024-01-02 15:04:05,000 fail2ban.actions        [1234]: NOTICE  [sshd] Increase Ban 2001:db8:1::5 (3 # 4:00:00 -> 2024-01-02 19:04:05)",
+			event: Fail2BanEventIncreaseBan, jail: "sshd", ip: "2001:db8:1::5", level: "NOTICE", time: "2024-01-02 15:04:05.000",
+			banUntil: "2024-01-02 19:04:05.000",
+		},
+		{
+			name:  "already banned",
+			line:  "2024-01-02 15:04:08,100 fail2ban.actions        [1234]: WARNING [sshd] 192.0.2.1 already banned",
+			event: Fail2BanEventAlreadyBanned, jail: "sshd", ip: "192.0.2.1", level: "WARNING", time: "2024-01-02 15:04:08.100",
+		},
+		{
+			name:  "jail启动",
+			line:  "2024-01-02 15:00:00,200 fail2ban.jail           [987]: INFO    Jail 'sshd' started",
+			event: Fail2BanEventJailStart, jail: "sshd", level: "INFO", time: "2024-01-02 15:00:00.200",
+		},
+		{
+			name:  "jail停止",
+			line:  "2024-01-02 18:00:00,300 fail2ban.jail           [987]: INFO    Jail 'nginx-botsearch' stopped",
+			event: Fail2BanEventJailStop, jail: "nginx-botsearch", level: "INFO", time: "2024-01-02 18:00:00.300",
+		},
+		{
+			name:  "服务启动",
+			line:  "2024-01-02 14:59:59,900 fail2ban.server         [987]: INFO    Starting Fail2ban v0.11.2",
+			event: Fail2BanEventServerStart, level: "INFO", time: "2024-01-02 14:59:59.900",
+		},
+		{
+			name:  "服务停止",
+			line:  "2024-01-02 18:00:01,000 fail2ban.server         [987]: INFO    Exiting Fail2ban",
+			event: Fail2BanEventServerStop, level: "INFO", time: "2024-01-02 18:00:01.000",
+		},
+		{
+			name:  "动作执行失败",
+			line:  "2024-01-02 15:04:06,050 fail2ban.utils          [1234]: ERROR   7f2b5c0d2f70 -- returned 1",
+			event: Fail2BanEventError, level: "ERROR", time: "2024-01-02 15:04:06.050",
+		},
+		{
+			name:  "带jail的错误",
+			line:  "2024-01-02 15:04:06,060 fail2ban.actions        [1234]: ERROR   Failed to execute ban jail 'sshd' action 'iptables-multiport' info 'ActionInfo({'ip': '192.0.2.1'})': Error banning 192.0.2.1",
+			event: Fail2BanEventError, level: "ERROR", time: "2024-01-02 15:04:06.060",
+		},
+		{
+			name:  "没有毫秒",
+			line:  "2024-01-02 15:04:05 fail2ban.actions [1]: NOTICE [sshd] Ban 192.0.2.9",
+			event: Fail2BanEventBan, jail: "sshd", ip: "192.0.2.9", level: "NOTICE", time: "2024-01-02 15:04:05.000",
+		},
+		{
+			name:  "其他信息",
+			line:  "2024-01-02 15:00:00,100 fail2ban.filter         [987]: INFO    [sshd] Added logfile: '/var/log/auth.log' (pos = 0, hash = da39a3ee)",
+			event: Fail2BanEventInfo, jail: "sshd", level: "INFO", time: "2024-01-02 15:00:00.100",
+		},
+		{name: "空行", line: ""},
+		{name: "不是日志行", line: "Traceback (most recent call last):"},
+		{name: "缺少进程号", line: "2024-01-02 15:04:05,123 fail2ban.actions: NOTICE  [sshd] Ban 192.0.2.1"},
+		{name: "无效日期", line: "2024-13-45 25:61:00,000 fail2ban.actions        [1234]: NOTICE  [sshd] Ban 192.0.2.1"},
+		{name: "小写日志级别", line: "2024-01-02 15:04:05,123 fail2ban.actions        [1234]: notice  [sshd] Ban 192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parseFail2BanLogLine(tt.line)
+			if tt.event == "" {
+				if entry != nil {
+					t.Fatalf("格式不符的行被解析为 %+v", entry)
+				}
+				return
+			}
+			if entry == nil {
+				t.Fatal("解析失败")
+			}
+			if entry.Event != tt.event || entry.Jail != tt.jail || entry.IP != tt.ip || entry.Level != tt.level {
+				t.Errorf("entry = {Event:%s Jail:%s IP:%s Level:%s}, want {%s %s %s %s}",
+					entry.Event, entry.Jail, entry.IP, entry.Level, tt.event, tt.jail, tt.ip, tt.level)
+			}
+			if want := localTime(tt.time); !entry.Timestamp.Equal(want) {
+				t.Errorf("Timestamp = %v, want %v", entry.Timestamp, want)
+			}
+			switch {
+			case tt.banUntil == "" && entry.BanUntil != nil:
+				t.Errorf("BanUntil = %v, want nil", entry.BanUntil)
+			case tt.banUntil != "" && (entry.BanUntil == nil || !entry.BanUntil.Equal(localTime(tt.banUntil))):
+				t.Errorf("BanUntil = %v, want %s", entry.BanUntil, tt.banUntil)
+			}
+		})
+	}
+}
+
+func TestReconcileBannedIP(t *testing.T) {
+	db := newTestDB(t, &model.BannedIP{})
+	base := time.Now().Add(-time.Hour).Truncate(time.Second)
+	entry := func(event, jail, ip string, offset time.Duration) *Fail2BanLogEntry {
+		return &Fail2BanLogEntry{Timestamp: base.Add(offset), Event: event, Jail: jail, IP: ip, Message: event + " " + ip}
+	}
+	active := func(ip, jail string) []model.BannedIP {
+		var records []model.BannedIP
+		db.Where("ip_address = ? AND jail = ? AND is_active = ?", ip, jail, true).Find(&records)
+		return records
+	}
+
+	// fail2ban发现的封禁新建记录，解封时间由jail的bantime推算
+	if err := reconcileBannedIP(db, entry(Fail2BanEventBan, "sshd", "192.0.2.1", 0), base.Add(10*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	// 重复的Ban和Restore Ban不新建记录
+	if err := reconcileBannedIP(db, entry(Fail2BanEventRestoreBan, "sshd", "192.0.2.1", time.Minute), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	records := active("192.0.2.1", "sshd")
+	if len(records) != 1 || !records[0].BanTime.Equal(base) || !records[0].UnbanTime.Equal(base.Add(10*time.Minute)) {
+		t.Fatalf("封禁记录 = %+v", records)
+	}
+
+	// Increase Ban更新解封时间
+	increase := entry(Fail2BanEventIncreaseBan, "sshd", "192.0.2.1", 2*time.Minute)
+	until := base.Add(3 * time.Hour)
+	increase.BanUntil = &until
+	if err := reconcileBannedIP(db, increase, until); err != nil {
+		t.Fatal(err)
+	}
+	if records = active("192.0.2.1", "sshd"); len(records) != 1 || !records[0].UnbanTime.Equal(until) {
+		t.Fatalf("Increase Ban后的记录 = %+v", records)
+	}
+
+	// IPv6封禁按jail独立记录，解封时间未知时留空
+	if err := reconcileBannedIP(db, entry(Fail2BanEventBan, "sshd", "2001:db8::1", 0), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if records = active("2001:db8::1", "sshd"); len(records) != 1 || !records[0].UnbanTime.IsZero() {
+		t.Fatalf("IPv6封禁记录 = %+v", records)
+	}
+
+	// Unban使fail2ban自己的封禁失效
+	for _, ip := range []string{"192.0.2.1", "2001:db8::1"} {
+		if err := reconcileBannedIP(db, entry(Fail2BanEventUnban, "sshd", ip, 30*time.Minute), time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+		if records = active(ip, "sshd"); len(records) != 0 {
+			t.Fatalf("Unban后 %s 仍有有效记录: %+v", ip, records)
+		}
+	}
+	var unbanned model.BannedIP
+	db.Where("ip_address = ?", "192.0.2.1").First(&unbanned)
+	if !unbanned.UnbanTime.Equal(base.Add(30 * time.Minute)) {
+		t.Errorf("解封时间 = %v, want Unban行的时间", unbanned.UnbanTime)
+	}
+
+	// 本服务的递增封禁在封禁时长内被提前解封时保留记录，由封禁生命周期重新封禁
+	escalated := model.BannedIP{IPAddress: "198.51.100.7", Jail: "sshd", BanTime: base, UnbanTime: time.Now().Add(time.Hour), IsActive: true, Offense: 2}
+	db.Create(&escalated)
+	if err := reconcileBannedIP(db, entry(Fail2BanEventUnban, "sshd", "198.51.100.7", 10*time.Minute), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if records = active("198.51.100.7", "sshd"); len(records) != 1 {
+		t.Fatal("仍在封禁时长内的递增封禁被标记为失效")
+	}
+
+	// 没有IP或jail的事件和其他事件不影响封禁记录
+	for _, e := range []*Fail2BanLogEntry{
+		entry(Fail2BanEventBan, "", "203.0.113.1", 0),
+		entry(Fail2BanEventFound, "sshd", "203.0.113.1", 0),
+		entry(Fail2BanEventAlreadyBanned, "sshd", "203.0.113.1", 0),
+	} {
+		if err := reconcileBannedIP(db, e, time.Time{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var count int64
+	db.Model(&model.BannedIP{}).Where("ip_address = ?", "203.0.113.1").Count(&count)
+	if count != 0 {
+		t.Fatalf("非封禁事件创建了 %d 条封禁记录", count)
+	}
+}
+
+func TestBanEventIngest(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "fail2ban.log")
+	cfg := config.Defaults()
+	cfg.Fail2Ban.LogPath = logPath
+
+	db := newTestDB(t, &model.BanEvent{}, &model.LogIngestState{}, &model.BannedIP{})
+	s := NewBanEventService(db, NewLogSourceService(cfg), nil, NewEventBus(), nil)
+
+	appendLog := func(path, content string) {
+		t.Helper()
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+		if _, err := file.WriteString(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ingest := func(want int) {
+		t.Helper()
+		n, err := s.Ingest()
+		if err != nil {
+			t.Fatalf("Ingest() error = %v", err)
+		}
+		if n != want {
+			t.Fatalf("Ingest() = %d, want %d", n, want)
+		}
+	}
+
+	// 日志文件不存在时不报错
+	ingest(0)
+
+	appendLog(logPath, "2024-01-02 15:00:00,200 fail2ban.jail           [987]: INFO    Jail 'sshd' started\n"+
+		"2024-01-02 15:00:00,300 fail2ban.filter         [987]: INFO    [sshd] Added logfile: '/var/log/auth.log'\n"+
+		"garbage line\n"+
+		"2024-01-02 15:04:05,123 fail2ban.filter         [987]: INFO    [sshd] Found 192.0.2.1 - 2024-01-02 15:04:05\n"+
+		"2024-01-02 15:04:06,001 fail2ban.actions        [987]: NOTICE  [sshd] Ban 192.0.2.1\n"+
+		// 写了一半的行留到下次读取
+		"2024-01-02 15:05:00,000 fail2ban.actions        [987]: NOTICE  [sshd] Ban 2001:db8")
+	// 信息行和格式不符的行不保存
+	ingest(3)
+
+	appendLog(logPath, "::1\n")
+	ingest(1)
+	ingest(0)
+
+	var events []model.BanEvent
+	db.Order("id").Find(&events)
+	if len(events) != 4 || events[3].Event != Fail2BanEventBan || events[3].IPAddress != "2001:db8::1" {
+		t.Fatalf("events = %+v", events)
+	}
+	var banned int64
+	db.Model(&model.BannedIP{}).Where("is_active = ?", true).Count(&banned)
+	if banned != 2 {
+		t.Fatalf("有效封禁记录 = %d, want 2", banned)
+	}
+
+	// 日志轮转：先读完旧文件新增的部分，再从新文件开头读取
+	appendLog(logPath, "2024-01-02 16:04:06,002 fail2ban.actions        [987]: NOTICE  [sshd] Unban 192.0.2.1\n")
+	if err := os.Rename(logPath, logPath+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendLog(logPath, "2024-01-03 00:00:01,000 fail2ban.server         [987]: INFO    Starting Fail2ban v0.11.2\n")
+	ingest(2)
+
+	var state model.LogIngestState
+	db.First(&state)
+	if info, _ := os.Stat(logPath); state.Offset != info.Size() {
+		t.Errorf("读取位置 = %d, want %d", state.Offset, info.Size())
+	}
+	db.Model(&model.BannedIP{}).Where("is_active = ?", true).Count(&banned)
+	if banned != 1 {
+		t.Fatalf("轮转后有效封禁记录 = %d, want 1", banned)
+	}
+}
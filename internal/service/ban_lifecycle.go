@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	banLifecycleInterval = time.Minute
+	// banReconcileInterval 与fail2ban封禁列表对账的间隔，重新封禁被提前解封的记录
+	banReconcileInterval = 5 * time.Minute
+)
+
+var (
+	ErrBanRecordNotFound   = errors.New("ban record not found")
+	ErrBanNotActive        = errors.New("ban is not active")
+	ErrInvalidBanExtension = errors.New("invalid ban extension")
+)
+
+// BanExtension 延长封禁的参数，三者只能指定一个
+type BanExtension struct {
+	Duration  time.Duration // 在当前解封时间（已过期时为现在）的基础上延长
+	UnbanTime *time.Time    // 直接指定新的解封时间
+	Permanent bool          // 改为永久封禁
+}
+
+// BanLifecycleService 管理本服务记录的封禁：到期通过对应的jail解封，
+// 定期与fail2ban当前的封禁列表对账，被提前解封的递增、永久和延长封禁重新封禁
+type BanLifecycleService struct {
+	db              *gorm.DB
+	fail2banService *Fail2BanService
+	extendedBans    *ExtendedBanJail
+	ctx             context.Context
+	cancel          context.CancelFunc
+	wg              sync.WaitGroup
+	mu              sync.Mutex // 避免到期处理和延长操作并发修改同一条记录
+}
+
+// NewBanLifecycleService 创建封禁生命周期服务
+func NewBanLifecycleService(db *gorm.DB, fail2banService *Fail2BanService, extendedBans *ExtendedBanJail) *BanLifecycleService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &BanLifecycleService{
+		db:              db,
+		fail2banService: fail2banService,
+		extendedBans:    extendedBans,
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+}
+
+// Start 启动后台对账和到期解封
+func (s *BanLifecycleService) Start() {
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop 停止后台任务
+func (s *BanLifecycleService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *BanLifecycleService) run() {
+	defer s.wg.Done()
+
+	if err := s.Reconcile(); err != nil {
+		log.Printf("封禁记录对账失败: %v", err)
+	}
+
+	ticker := time.NewTicker(banLifecycleInterval)
+	defer ticker.Stop()
+	reconcileTicker := time.NewTicker(banReconcileInterval)
+	defer reconcileTicker.Stop()
+
+	for {
+		if _, err := s.ExpireDue(); err != nil {
+			log.Printf("处理到期封禁失败: %v", err)
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-reconcileTicker.C:
+			if err := s.Reconcile(); err != nil {
+				log.Printf("封禁记录对账失败: %v", err)
+			}
+		}
+	}
+}
+
+// banEnforced 封禁是否应在解封时间前保持有效。本服务计算的递增、永久封禁和转移到长期jail的封禁
+// 被fail2ban提前解封（jail的bantime到期、重启后未恢复）时需要重新封禁；
+// fail2ban自己发现的封禁以fail2ban为准
+func banEnforced(record *model.BannedIP, now time.Time) bool {
+	if record.Offense == 0 && !record.Permanent && record.Jail != extendedBanJailName {
+		return false
+	}
+	return record.Permanent || record.UnbanTime.After(now)
+}
+
+// deactivateBanRecords 将IP在jail中的有效封禁记录标记为失效，用于手动解封，
+// 否则仍在封禁时长内的记录会在对账时被重新封禁
+func deactivateBanRecords(db *gorm.DB, ip, jail string) error {
+	if err := db.Model(&model.BannedIP{}).
+		Where("ip_address = ? AND jail = ? AND is_active = ?", ip, jail, true).
+		Updates(map[string]interface{}{
+			"is_active":  false,
+			"unban_time": time.Now(),
+		}).Error; err != nil {
+		return fmt.Errorf("更新封禁记录失败: %w", err)
+	}
+	return nil
+}
+
+// Unban 手动解封IP并将对应的封禁记录标记为失效
+func (s *BanLifecycleService) Unban(jail, ip string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.fail2banService.UnbanIP(jail, ip); err != nil {
+		return err
+	}
+	return deactivateBanRecords(s.db, ip, jail)
+}
+
+// liveBans 获取fail2ban当前每个jail的封禁列表
+func (s *BanLifecycleService) liveBans() (map[string]map[string]bool, error) {
+	jails, err := s.fail2banService.GetJails()
+	if err != nil {
+		return nil, err
+	}
+
+	live := make(map[string]map[string]bool, len(jails))
+	for _, jail := range jails {
+		ips, err := s.fail2banService.GetBannedIPsForJail(jail)
+		if err != nil {
+			return nil, err
+		}
+		live[jail] = make(map[string]bool, len(ips))
+		for _, ip := range ips {
+			live[jail][ip.Address] = true
+		}
+	}
+	return live, nil
+}
+
+// liveJailsFor IP当前被封禁的jail
+func liveJailsFor(live map[string]map[string]bool, ip string) []string {
+	var jails []string
+	for jail, ips := range live {
+		if ips[ip] {
+			jails = append(jails, jail)
+		}
+	}
+	return jails
+}
+
+// Reconcile 将有效的封禁记录与fail2ban当前的封禁列表对账：
+// 记录的jail不存在时（如旧版本手动封禁的manual）改为实际封禁的jail，
+// 仍在封禁时长内的递增、永久和延长封禁重新封禁，其余fail2ban中已经没有的封禁标记为失效
+func (s *BanLifecycleService) Reconcile() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	live, err := s.liveBans()
+	if err != nil {
+		return fmt.Errorf("获取fail2ban封禁列表失败: %w", err)
+	}
+
+	var records []model.BannedIP
+	if err := s.db.Where("is_active = ?", true).Find(&records).Error; err != nil {
+		return fmt.Errorf("查询封禁记录失败: %w", err)
+	}
+
+	now := time.Now()
+	kept, moved, restored, deactivated := 0, 0, 0, 0
+	for _, record := range records {
+		if ips, exists := live[record.Jail]; exists && ips[record.IPAddress] {
+			kept++
+			continue
+		}
+
+		if _, exists := live[record.Jail]; !exists {
+			if jails := liveJailsFor(live, record.IPAddress); len(jails) > 0 {
+				if err := s.db.Model(&record).Update("jail", jails[0]).Error; err != nil {
+					return fmt.Errorf("更新封禁记录失败: %w", err)
+				}
+				moved++
+				continue
+			}
+		}
+
+		if banEnforced(&record, now) {
+			if err := s.restore(&record, live); err != nil {
+				// 重新封禁失败时保留记录，下次对账重试
+				log.Printf("重新封禁 %s (jail %s) 失败: %v", record.IPAddress, record.Jail, err)
+				continue
+			}
+			restored++
+			continue
+		}
+
+		if err := s.deactivate(&record, now); err != nil {
+			return err
+		}
+		deactivated++
+	}
+
+	if moved > 0 || restored > 0 || deactivated > 0 {
+		log.Printf("封禁记录对账完成: 有效 %d 条, 修正jail %d 条, 重新封禁 %d 条, 标记失效 %d 条", kept, moved, restored, deactivated)
+	}
+	return nil
+}
+
+// restore 重新封禁被fail2ban提前解封的记录：原jail的bantime足够时在原jail封禁，否则转移到长期jail
+func (s *BanLifecycleService) restore(record *model.BannedIP, live map[string]map[string]bool) error {
+	now := time.Now()
+	if _, exists := live[record.Jail]; exists && !s.extendedBans.Required(record.Jail, now, record.UnbanTime, record.Permanent) {
+		return s.fail2banService.banIP(record.Jail, record.IPAddress, BanSourceAuto)
+	}
+	return s.holdExtended(record, BanSourceAuto)
+}
+
+// holdExtended 在长期jail中封禁并更新记录的jail
+func (s *BanLifecycleService) holdExtended(record *model.BannedIP, source string) error {
+	if err := s.extendedBans.Ensure(); err != nil {
+		return err
+	}
+	if err := s.extendedBans.Hold(record.IPAddress, source); err != nil {
+		return err
+	}
+	if record.Jail == extendedBanJailName {
+		return nil
+	}
+	record.Jail = extendedBanJailName
+	if err := s.db.Model(record).Update("jail", record.Jail).Error; err != nil {
+		return fmt.Errorf("更新封禁记录失败: %w", err)
+	}
+	return nil
+}
+
+// ExpireDue 解封已到解封时间的记录，返回处理的记录数
+func (s *BanLifecycleService) ExpireDue() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var records []model.BannedIP
+	if err := s.db.Where("is_active = ? AND permanent = ? AND unban_time > ? AND unban_time <= ?", true, false, time.Time{}, now).
+		Order("unban_time ASC").Find(&records).Error; err != nil {
+		return 0, fmt.Errorf("查询到期封禁失败: %w", err)
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+
+	live, err := s.liveBans()
+	if err != nil {
+		return 0, fmt.Errorf("获取fail2ban封禁列表失败: %w", err)
+	}
+
+	expired := 0
+	for _, record := range records {
+		if err := s.unbanRecord(&record, live); err != nil {
+			// 解封失败时保留记录，下次重试
+			log.Printf("解封到期IP %s (jail %s) 失败: %v", record.IPAddress, record.Jail, err)
+			continue
+		}
+		if err := s.deactivate(&record, record.UnbanTime); err != nil {
+			return expired, err
+		}
+		expired++
+	}
+
+	if expired > 0 {
+		log.Printf("已解封 %d 个到期IP", expired)
+	}
+	return expired, nil
+}
+
+// unbanRecord 通过记录的jail解封，jail不存在时从所有实际封禁该IP的jail中解封
+func (s *BanLifecycleService) unbanRecord(record *model.BannedIP, live map[string]map[string]bool) error {
+	jails := []string{record.Jail}
+	if _, exists := live[record.Jail]; !exists {
+		jails = liveJailsFor(live, record.IPAddress)
+	}
+
+	for _, jail := range jails {
+		// fail2ban已经自行解封的不需要再处理
+		if !live[jail][record.IPAddress] {
+			continue
+		}
+		if err := s.fail2banService.unbanIP(jail, record.IPAddress, BanSourceAuto); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *BanLifecycleService) deactivate(record *model.BannedIP, unbanTime time.Time) error {
+	if err := s.db.Model(record).Updates(map[string]interface{}{
+		"is_active":  false,
+		"unban_time": unbanTime,
+	}).Error; err != nil {
+		return fmt.Errorf("更新封禁记录失败: %w", err)
+	}
+	return nil
+}
+
+// UpcomingExpiries 获取在指定时间内到期的有效封禁，按解封时间排序
+func (s *BanLifecycleService) UpcomingExpiries(within time.Duration, limit int) ([]model.BannedIP, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	var records []model.BannedIP
+	if err := s.db.Where("is_active = ? AND permanent = ? AND unban_time > ? AND unban_time <= ?",
+		true, false, time.Time{}, time.Now().Add(within)).
+		Order("unban_time ASC").Limit(limit).Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询即将到期的封禁失败: %w", err)
+	}
+	return records, nil
+}
+
+// ExtendBan 延长有效封禁的解封时间或改为永久封禁
+func (s *BanLifecycleService) ExtendBan(id uint, ext BanExtension) (*model.BannedIP, error) {
+	options := 0
+	if ext.Duration != 0 {
+		options++
+	}
+	if ext.UnbanTime != nil {
+		options++
+	}
+	if ext.Permanent {
+		options++
+	}
+	if options != 1 {
+		return nil, fmt.Errorf("%w: duration、unban_time、permanent 必须且只能指定一个", ErrInvalidBanExtension)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var record model.BannedIP
+	if err := s.db.First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrBanRecordNotFound
+		}
+		return nil, fmt.Errorf("查询封禁记录失败: %w", err)
+	}
+	if !record.IsActive {
+		return nil, ErrBanNotActive
+	}
+
+	now := time.Now()
+	switch {
+	case ext.Permanent:
+		record.Permanent = true
+	case ext.UnbanTime != nil:
+		if !ext.UnbanTime.After(now) {
+			return nil, fmt.Errorf("%w: 解封时间必须晚于当前时间", ErrInvalidBanExtension)
+		}
+		record.UnbanTime = *ext.UnbanTime
+		record.Permanent = false
+	default:
+		if ext.Duration < 0 {
+			return nil, fmt.Errorf("%w: 延长时长必须为正数", ErrInvalidBanExtension)
+		}
+		base := record.UnbanTime
+		if record.Permanent || base.Before(now) {
+			base = now
+		}
+		record.UnbanTime = base.Add(ext.Duration)
+		record.Permanent = false
+	}
+
+	// 原jail的bantime不足以覆盖新的解封时间时转移到长期jail，否则fail2ban仍会按原jail的bantime解封
+	if s.extendedBans.Required(record.Jail, record.BanTime, record.UnbanTime, record.Permanent) {
+		if err := s.holdExtended(&record, BanSourceManual); err != nil {
+			return nil, fmt.Errorf("转移到长期封禁jail失败: %w", err)
+		}
+	}
+
+	if err := s.db.Model(&record).Select("unban_time", "permanent").Updates(&record).Error; err != nil {
+		return nil, fmt.Errorf("更新封禁记录失败: %w", err)
+	}
+
+	log.Printf("封禁 %s (jail %s) 已延长: 永久 %v, 解封时间 %s", record.IPAddress, record.Jail, record.Permanent, record.UnbanTime.Format(time.RFC3339))
+	return &record, nil
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"github.com/sirupsen/logrus"
+)
+
+// newFakeFail2BanService 使用PATH中的假fail2ban-client，banned为每个jail当前的封禁列表，
+// failing中的命令（如"set sshd unbanip 192.0.2.1"）返回错误。返回的函数读取已执行的命令
+func newFakeFail2BanService(t *testing.T, banned map[string][]string, failing ...string) (*Fail2BanService, func() []string) {
+	t.Helper()
+	dir := t.TempDir()
+	callsPath := filepath.Join(dir, "calls")
+
+	var jails []string
+	var script strings.Builder
+	script.WriteString("#!/bin/sh\n")
+	script.WriteString("echo \"$*\" >> " + callsPath + "\n")
+	script.WriteString("case \"$*\" in\n")
+	for jail, ips := range banned {
+		jails = append(jails, jail)
+		script.WriteString("\"status " + jail + "\") printf 'Status for the jail: " + jail +
+			"\\n`- Actions\\n   `- Banned IP list:\\t" + strings.Join(ips, " ") + "\\n' ;;\n")
+	}
+	script.WriteString("status) printf 'Status\\n|- Number of jail:\\t1\\n`- Jail list:\\t" + strings.Join(jails, ", ") + "\\n' ;;\n")
+	for _, command := range failing {
+		script.WriteString("\"" + command + "\") echo 'ERROR' >&2; exit 1 ;;\n")
+	}
+	script.WriteString("esac\n")
+
+	if err := os.WriteFile(filepath.Join(dir, "fail2ban-client"), []byte(script.String()), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := &Fail2BanService{logger: logger, banTimes: make(map[string]time.Duration)}
+
+	calls := func() []string {
+		data, err := os.ReadFile(callsPath)
+		if err != nil {
+			return nil
+		}
+		return strings.Split(strings.TrimSpace(string(data)), "\n")
+	}
+	return s, calls
+}
+
+func TestBanEnforced(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name   string
+		record model.BannedIP
+		want   bool
+	}{
+		{"fail2ban自己的封禁", model.BannedIP{Jail: "sshd", UnbanTime: now.Add(time.Hour)}, false},
+		{"递增封禁未到期", model.BannedIP{Jail: "sshd", Offense: 2, UnbanTime: now.Add(time.Hour)}, true},
+		{"递增封禁已到期", model.BannedIP{Jail: "sshd", Offense: 2, UnbanTime: now.Add(-time.Second)}, false},
+		{"递增封禁刚好到期", model.BannedIP{Jail: "sshd", Offense: 2, UnbanTime: now}, false},
+		{"未记录解封时间", model.BannedIP{Jail: "sshd", Offense: 1}, false},
+		{"永久封禁", model.BannedIP{Jail: "sshd", Permanent: true}, true},
+		{"长期jail未到期", model.BannedIP{Jail: extendedBanJailName, UnbanTime: now.Add(time.Hour)}, true},
+		{"长期jail已到期", model.BannedIP{Jail: extendedBanJailName, UnbanTime: now.Add(-time.Hour)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := banEnforced(&tt.record, now); got != tt.want {
+				t.Errorf("banEnforced() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpireDue(t *testing.T) {
+	db := newTestDB(t, &model.BannedIP{})
+	fail2ban, calls := newFakeFail2BanService(t, map[string][]string{
+		"sshd": {"192.0.2.1", "192.0.2.3", "192.0.2.9"},
+	}, "set sshd unbanip 192.0.2.9")
+	s := NewBanLifecycleService(db, fail2ban, nil)
+
+	// 没有到期记录时不查询fail2ban
+	if n, err := s.ExpireDue(); err != nil || n != 0 {
+		t.Fatalf("ExpireDue() = %d, %v", n, err)
+	}
+	if got := calls(); got != nil {
+		t.Fatalf("没有到期记录时执行了 %v", got)
+	}
+
+	now := time.Now()
+	due := now.Add(-time.Minute).Truncate(time.Second)
+	records := map[string]*model.BannedIP{
+		"expired":     {IPAddress: "192.0.2.1", Jail: "sshd", UnbanTime: due},
+		"gone":        {IPAddress: "192.0.2.2", Jail: "sshd", UnbanTime: due},
+		"legacy_jail": {IPAddress: "192.0.2.3", Jail: "manual", UnbanTime: due},
+		"unban_fails": {IPAddress: "192.0.2.9", Jail: "sshd", UnbanTime: due},
+		"future":      {IPAddress: "198.51.100.1", Jail: "sshd", UnbanTime: now.Add(time.Hour)},
+		"permanent":   {IPAddress: "198.51.100.2", Jail: "sshd", UnbanTime: due, Permanent: true},
+		"no_unban":    {IPAddress: "198.51.100.3", Jail: "sshd"},
+	}
+	for _, record := range records {
+		record.BanTime = now.Add(-time.Hour)
+		record.IsActive = true
+		if err := db.Create(record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := s.ExpireDue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Fatalf("ExpireDue() = %d, want 3", n)
+	}
+
+	// 只解封fail2ban中仍然封禁的IP，jail不存在时从实际封禁的jail中解封
+	var unbans []string
+	for _, call := range calls() {
+		if strings.Contains(call, "unbanip") {
+			unbans = append(unbans, call)
+		}
+	}
+	want := []string{"set sshd unbanip 192.0.2.1", "set sshd unbanip 192.0.2.3", "set sshd unbanip 192.0.2.9"}
+	sort.Strings(unbans)
+	if !reflect.DeepEqual(unbans, want) {
+		t.Errorf("unban命令 = %v, want %v", unbans, want)
+	}
+
+	for name, record := range records {
+		var got model.BannedIP
+		db.First(&got, record.ID)
+		wantActive := name == "unban_fails" || name == "future" || name == "permanent" || name == "no_unban"
+		if got.IsActive != wantActive {
+			t.Errorf("%s: IsActive = %v, want %v", name, got.IsActive, wantActive)
+		}
+		// 解封时间记为计划的解封时间
+		if !got.IsActive && !got.UnbanTime.Equal(due) {
+			t.Errorf("%s: UnbanTime = %v, want %v", name, got.UnbanTime, due)
+		}
+	}
+}
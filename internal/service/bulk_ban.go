@@ -0,0 +1,438 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fail2ban-web/internal/ipset"
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// BulkAllJails 批量操作作用于所有jail
+	BulkAllJails = "all"
+	// maxBulkTargets 单次批量操作的最大目标数
+	maxBulkTargets = 10000
+	// bulkBanConcurrency 同时执行的fail2ban-client命令数
+	bulkBanConcurrency = 8
+)
+
+var ErrInvalidBulkRequest = errors.New("invalid bulk request")
+
+// BulkBanRequest 批量封禁请求
+type BulkBanRequest struct {
+	Targets []string `json:"targets"` // IP或CIDR，CIDR通过网段jail封禁
+	Jail    string   `json:"jail"`    // jail名称，all表示所有jail
+	Reason  string   `json:"reason"`
+}
+
+// BulkUnbanRequest 批量解封请求，Targets与Policy/Since可以同时指定，结果取并集
+type BulkUnbanRequest struct {
+	Targets []string      `json:"targets"` // IP或CIDR，CIDR解封其中所有被封禁的地址
+	Jail    string        `json:"jail"`    // jail名称，为空或all表示所有jail
+	Policy  string        `json:"policy"`  // 按封禁记录的策略筛选
+	Since   time.Duration `json:"since"`   // 按封禁时间筛选，如最近1小时
+}
+
+// BulkItemResult 单个目标在单个jail中的执行结果
+type BulkItemResult struct {
+	Target  string `json:"target"`
+	Jail    string `json:"jail,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// BulkResult 批量操作结果
+type BulkResult struct {
+	Total     int              `json:"total"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+// UnbanEverywhereResult 从所有jail解封的结果
+type UnbanEverywhereResult struct {
+	IP                 string                `json:"ip"`
+	Jails              []string              `json:"jails"`            // 已解封的jail
+	Failed             []BulkItemResult      `json:"failed,omitempty"` // 解封失败的jail
+	RecordsDeactivated int64                 `json:"records_deactivated"`
+	ThreatCleared      bool                  `json:"threat_cleared"`
+	Whitelist          *model.WhitelistEntry `json:"whitelist,omitempty"`
+}
+
+// BulkBanService 批量封禁和解封，以有限并发执行并返回每一项的结果
+type BulkBanService struct {
+	db                  *gorm.DB
+	fail2banService     *Fail2BanService
+	whitelistService    *WhitelistService
+	intelligentService  *IntelligentScanService
+	banLifecycleService *BanLifecycleService
+}
+
+// NewBulkBanService 创建批量封禁服务
+func NewBulkBanService(db *gorm.DB, fail2banService *Fail2BanService, whitelistService *WhitelistService,
+	intelligentService *IntelligentScanService, banLifecycleService *BanLifecycleService) *BulkBanService {
+	return &BulkBanService{
+		db:                  db,
+		fail2banService:     fail2banService,
+		whitelistService:    whitelistService,
+		intelligentService:  intelligentService,
+		banLifecycleService: banLifecycleService,
+	}
+}
+
+// bulkTask 一个待执行的目标和jail
+type bulkTask struct {
+	target string
+	jail   string
+}
+
+// runBulk 以有限并发执行任务，结果顺序与任务顺序一致
+func runBulk(tasks []bulkTask, fn func(bulkTask) error) *BulkResult {
+	result := &BulkResult{
+		Total:   len(tasks),
+		Results: make([]BulkItemResult, len(tasks)),
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, bulkBanConcurrency)
+	for i, task := range tasks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, task bulkTask) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			item := BulkItemResult{Target: task.target, Jail: task.jail, Success: true}
+			if err := fn(task); err != nil {
+				item.Success = false
+				item.Error = err.Error()
+			}
+			result.Results[i] = item
+		}(i, task)
+	}
+	wg.Wait()
+
+	for _, item := range result.Results {
+		if item.Success {
+			result.Succeeded++
+		} else {
+			result.Failed++
+		}
+	}
+	return result
+}
+
+// parseBulkTargets 解析并去重目标，无效的目标直接记为失败
+func parseBulkTargets(targets []string) ([]netip.Prefix, []BulkItemResult) {
+	var prefixes []netip.Prefix
+	var invalid []BulkItemResult
+	seen := make(map[netip.Prefix]bool, len(targets))
+	for _, target := range targets {
+		target = strings.TrimSpace(target)
+		if target == "" {
+			continue
+		}
+		prefix, err := ipset.ParsePrefix(target)
+		if err != nil {
+			invalid = append(invalid, BulkItemResult{Target: target, Error: "invalid IP or CIDR"})
+			continue
+		}
+		if seen[prefix] {
+			continue
+		}
+		seen[prefix] = true
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes, invalid
+}
+
+// prefixTarget 单个地址使用IP形式，网段使用CIDR形式
+func prefixTarget(prefix netip.Prefix) string {
+	if prefix.IsSingleIP() {
+		return prefix.Addr().String()
+	}
+	return prefix.String()
+}
+
+// mergeInvalid 将无效目标追加到结果中
+func (r *BulkResult) mergeInvalid(invalid []BulkItemResult) {
+	r.Results = append(r.Results, invalid...)
+	r.Total += len(invalid)
+	r.Failed += len(invalid)
+}
+
+// BulkBan 批量封禁IP或网段，白名单中的目标不会被封禁
+func (s *BulkBanService) BulkBan(req BulkBanRequest) (*BulkResult, error) {
+	if len(req.Targets) == 0 {
+		return nil, fmt.Errorf("%w: targets不能为空", ErrInvalidBulkRequest)
+	}
+	if len(req.Targets) > maxBulkTargets {
+		return nil, fmt.Errorf("%w: 单次最多 %d 个目标", ErrInvalidBulkRequest, maxBulkTargets)
+	}
+	if req.Jail == "" {
+		return nil, fmt.Errorf("%w: 必须指定jail，或使用 %s 表示所有jail", ErrInvalidBulkRequest, BulkAllJails)
+	}
+
+	jails := []string{req.Jail}
+	if req.Jail == BulkAllJails {
+		all, err := s.fail2banService.GetJails()
+		if err != nil {
+			return nil, fmt.Errorf("获取jail列表失败: %w", err)
+		}
+		jails = all
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "批量封禁"
+	}
+
+	prefixes, invalid := parseBulkTargets(req.Targets)
+	var tasks []bulkTask
+	for _, prefix := range prefixes {
+		target := prefixTarget(prefix)
+		// 常见的banaction无法封禁网段，网段统一通过网段jail封禁
+		if !prefix.IsSingleIP() {
+			tasks = append(tasks, bulkTask{target: target, jail: subnetJailName})
+			continue
+		}
+		for _, jail := range jails {
+			tasks = append(tasks, bulkTask{target: target, jail: jail})
+		}
+	}
+
+	// 同一目标的多条记录使用相同的封禁时间，递增封禁按次统计
+	banTimes := make(map[string]time.Time, len(prefixes))
+	plans := make(map[string]banPlan, len(prefixes))
+	for _, task := range tasks {
+		if _, ok := plans[task.target]; !ok {
+			plans[task.target] = s.intelligentService.planBan(task.target)
+			banTimes[task.target] = time.Now()
+		}
+	}
+
+	// 封禁时长超过jail的bantime时转移到长期jail，同一目标只转移和记录一次
+	s.intelligentService.ensureManagedJails()
+	var heldMu sync.Mutex
+	held := make(map[string]bool)
+
+	result := runBulk(tasks, func(task bulkTask) error {
+		if s.whitelistService.IsWhitelisted(task.target) {
+			return ErrIPWhitelisted
+		}
+
+		if task.jail == subnetJailName {
+			if _, err := s.intelligentService.banSubnet(task.target, BanSourceManual); err != nil {
+				return err
+			}
+		} else if err := s.fail2banService.BanIP(task.jail, task.target); err != nil {
+			return err
+		}
+
+		plan := plans[task.target]
+		heldMu.Lock()
+		if held[task.target] {
+			heldMu.Unlock()
+			return nil
+		}
+		jail := s.intelligentService.holdForPlan(task.target, task.jail, banTimes[task.target], plan, BanSourceManual)
+		held[task.target] = jail == extendedBanJailName
+		heldMu.Unlock()
+
+		bannedIP := &model.BannedIP{
+			IPAddress: task.target,
+			Jail:      jail,
+			BanTime:   banTimes[task.target],
+			IsActive:  true,
+			Reason:    fmt.Sprintf("%s, %s", reason, plan.describe()),
+		}
+		plan.apply(bannedIP)
+		if err := s.db.Create(bannedIP).Error; err != nil {
+			return fmt.Errorf("已封禁但保存封禁记录失败: %w", err)
+		}
+		return nil
+	})
+	result.mergeInvalid(invalid)
+
+	log.Printf("批量封禁完成: 共 %d 项, 成功 %d, 失败 %d", result.Total, result.Succeeded, result.Failed)
+	return result, nil
+}
+
+// BulkUnban 批量解封：目标IP或网段内所有被封禁的地址，以及按策略和封禁时间筛选出的封禁记录
+func (s *BulkBanService) BulkUnban(req BulkUnbanRequest) (*BulkResult, error) {
+	if len(req.Targets) == 0 && req.Policy == "" && req.Since <= 0 {
+		return nil, fmt.Errorf("%w: 必须指定targets，或按policy/since筛选", ErrInvalidBulkRequest)
+	}
+	if len(req.Targets) > maxBulkTargets {
+		return nil, fmt.Errorf("%w: 单次最多 %d 个目标", ErrInvalidBulkRequest, maxBulkTargets)
+	}
+	if req.Since < 0 {
+		return nil, fmt.Errorf("%w: since必须为正数", ErrInvalidBulkRequest)
+	}
+
+	live, err := s.banLifecycleService.liveBans()
+	if err != nil {
+		return nil, fmt.Errorf("获取fail2ban封禁列表失败: %w", err)
+	}
+	if req.Jail != "" && req.Jail != BulkAllJails {
+		if _, exists := live[req.Jail]; !exists {
+			return nil, fmt.Errorf("%w: jail %s 不存在", ErrInvalidBulkRequest, req.Jail)
+		}
+		live = map[string]map[string]bool{req.Jail: live[req.Jail]}
+	}
+
+	prefixes, invalid := parseBulkTargets(req.Targets)
+	if req.Policy != "" || req.Since > 0 {
+		matched, err := s.matchBanRecords(req.Policy, req.Since)
+		if err != nil {
+			return nil, err
+		}
+		more, bad := parseBulkTargets(matched)
+		prefixes = append(prefixes, more...)
+		invalid = append(invalid, bad...)
+	}
+
+	var tasks []bulkTask
+	var notBanned []BulkItemResult
+	seen := make(map[bulkTask]bool)
+	for _, prefix := range prefixes {
+		found := false
+		for _, task := range liveTasksFor(live, prefix) {
+			found = true
+			if !seen[task] {
+				seen[task] = true
+				tasks = append(tasks, task)
+			}
+		}
+		if !found {
+			notBanned = append(notBanned, BulkItemResult{Target: prefixTarget(prefix), Error: "not banned"})
+		}
+	}
+
+	result := runBulk(tasks, func(task bulkTask) error {
+		if err := s.fail2banService.UnbanIP(task.jail, task.target); err != nil {
+			return err
+		}
+		if err := s.db.Model(&model.BannedIP{}).
+			Where("ip_address = ? AND jail = ? AND is_active = ?", task.target, task.jail, true).
+			Updates(map[string]interface{}{
+				"is_active":  false,
+				"unban_time": time.Now(),
+			}).Error; err != nil {
+			return fmt.Errorf("已解封但更新封禁记录失败: %w", err)
+		}
+		return nil
+	})
+	result.mergeInvalid(invalid)
+	result.mergeInvalid(notBanned)
+
+	log.Printf("批量解封完成: 共 %d 项, 成功 %d, 失败 %d", result.Total, result.Succeeded, result.Failed)
+	return result, nil
+}
+
+// matchBanRecords 按策略和封禁时间筛选有效的封禁记录
+func (s *BulkBanService) matchBanRecords(policy string, since time.Duration) ([]string, error) {
+	query := s.db.Model(&model.BannedIP{}).Where("is_active = ?", true)
+	if policy != "" {
+		query = query.Where("policy = ?", policy)
+	}
+	if since > 0 {
+		query = query.Where("ban_time >= ?", time.Now().Add(-since))
+	}
+
+	var addresses []string
+	if err := query.Distinct("ip_address").Pluck("ip_address", &addresses).Error; err != nil {
+		return nil, fmt.Errorf("查询封禁记录失败: %w", err)
+	}
+	return addresses, nil
+}
+
+// liveTasksFor 网段内（或与IP相同）当前被封禁的地址及其jail
+func liveTasksFor(live map[string]map[string]bool, prefix netip.Prefix) []bulkTask {
+	var tasks []bulkTask
+	for jail, ips := range live {
+		for ip := range ips {
+			banned, err := ipset.ParsePrefix(ip)
+			if err != nil || banned.Bits() < prefix.Bits() || !prefix.Contains(banned.Addr()) {
+				continue
+			}
+			tasks = append(tasks, bulkTask{target: ip, jail: jail})
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].target != tasks[j].target {
+			return tasks[i].target < tasks[j].target
+		}
+		return tasks[i].jail < tasks[j].jail
+	})
+	return tasks
+}
+
+// UnbanEverywhere 从所有当前封禁该IP的jail中解封，标记封禁记录失效并清除威胁记录
+// whitelistFor大于0时先添加临时白名单，避免扫描器在解封后立即重新封禁
+func (s *BulkBanService) UnbanEverywhere(ip string, whitelistFor time.Duration, operator string) (*UnbanEverywhereResult, error) {
+	prefix, err := ipset.ParsePrefix(strings.TrimSpace(ip))
+	if err != nil || !prefix.IsSingleIP() {
+		return nil, fmt.Errorf("%w: 无效的IP地址 %s", ErrInvalidBulkRequest, ip)
+	}
+	if whitelistFor < 0 {
+		return nil, fmt.Errorf("%w: 临时白名单时长必须为正数", ErrInvalidBulkRequest)
+	}
+	ip = prefix.Addr().String()
+	result := &UnbanEverywhereResult{IP: ip, Jails: []string{}}
+
+	if whitelistFor > 0 && !s.whitelistService.IsWhitelisted(ip) {
+		expiresAt := time.Now().Add(whitelistFor)
+		entry := &model.WhitelistEntry{
+			Value:     ip,
+			Comment:   fmt.Sprintf("解封后临时白名单 %s", whitelistFor),
+			CreatedBy: operator,
+			ExpiresAt: &expiresAt,
+		}
+		if err := s.whitelistService.CreateEntry(entry); err != nil {
+			return nil, fmt.Errorf("添加临时白名单失败: %w", err)
+		}
+		result.Whitelist = entry
+	}
+
+	live, err := s.banLifecycleService.liveBans()
+	if err != nil {
+		return nil, fmt.Errorf("获取fail2ban封禁列表失败: %w", err)
+	}
+
+	for _, task := range liveTasksFor(live, prefix) {
+		if err := s.fail2banService.UnbanIP(task.jail, task.target); err != nil {
+			result.Failed = append(result.Failed, BulkItemResult{Target: task.target, Jail: task.jail, Error: err.Error()})
+			continue
+		}
+		result.Jails = append(result.Jails, task.jail)
+	}
+
+	// 解封失败的jail中封禁仍然有效，保留对应的记录
+	query := s.db.Model(&model.BannedIP{}).Where("ip_address = ? AND is_active = ?", ip, true)
+	for _, failed := range result.Failed {
+		query = query.Where("jail <> ?", failed.Jail)
+	}
+	update := query.Updates(map[string]interface{}{
+		"is_active":  false,
+		"unban_time": time.Now(),
+	})
+	if update.Error != nil {
+		return nil, fmt.Errorf("更新封禁记录失败: %w", update.Error)
+	}
+	result.RecordsDeactivated = update.RowsAffected
+
+	result.ThreatCleared = s.intelligentService.ClearThreat(ip)
+
+	log.Printf("已从 %d 个jail中解封IP %s, 失败 %d 个, 标记失效记录 %d 条", len(result.Jails), ip, len(result.Failed), result.RecordsDeactivated)
+	return result, nil
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"fail2ban-web/internal/model"
+)
+
+func TestParseBulkTargets(t *testing.T) {
+	prefixes, invalid := parseBulkTargets([]string{
+		"192.0.2.1",
+		" 192.0.2.1 ",
+		"",
+		"   ",
+		// 网段按网络地址规范化后去重
+		"198.51.100.7/24",
+		"198.51.100.0/24",
+		"2001:db8::1",
+		"2001:0db8:0::1",
+		"::ffff:192.0.2.1",
+		"2001:db8:1::/48",
+		"192.0.2.256",
+		"not-an-ip",
+		"10.0.0.0/33",
+	})
+
+	var targets []string
+	for _, prefix := range prefixes {
+		targets = append(targets, prefixTarget(prefix))
+	}
+	wantTargets := []string{"192.0.2.1", "198.51.100.0/24", "2001:db8::1", "2001:db8:1::/48"}
+	if !reflect.DeepEqual(targets, wantTargets) {
+		t.Errorf("targets = %v, want %v", targets, wantTargets)
+	}
+
+	wantInvalid := []BulkItemResult{
+		{Target: "192.0.2.256", Error: "invalid IP or CIDR"},
+		{Target: "not-an-ip", Error: "invalid IP or CIDR"},
+		{Target: "10.0.0.0/33", Error: "invalid IP or CIDR"},
+	}
+	if !reflect.DeepEqual(invalid, wantInvalid) {
+		t.Errorf("invalid = %+v, want %+v", invalid, wantInvalid)
+	}
+}
+
+func TestLiveTasksFor(t *testing.T) {
+	live := map[string]map[string]bool{
+		"sshd":          {"192.0.2.1": true, "192.0.2.200": true, "198.51.100.1": true, "2001:db8::1": true},
+		"nginx":         {"192.0.2.1": true, "garbage": true},
+		subnetJailName:  {"192.0.2.0/25": true, "192.0.0.0/16": true},
+		"empty":         {},
+		"ipv6-prefixes": {"2001:db8::/64": true},
+	}
+
+	tests := []struct {
+		name   string
+		target string
+		want   []bulkTask
+	}{
+		{"单个IP在多个jail中", "192.0.2.1", []bulkTask{{"192.0.2.1", "nginx"}, {"192.0.2.1", "sshd"}}},
+		// 网段包含其中的地址和更小的网段，不包含更大的网段
+		{"网段", "192.0.2.0/24", []bulkTask{
+			{"192.0.2.0/25", subnetJailName},
+			{"192.0.2.1", "nginx"},
+			{"192.0.2.1", "sshd"},
+			{"192.0.2.200", "sshd"},
+		}},
+		{"精确的网段", "192.0.2.0/25", []bulkTask{
+			{"192.0.2.0/25", subnetJailName},
+			{"192.0.2.1", "nginx"},
+			{"192.0.2.1", "sshd"},
+		}},
+		{"IPv6网段", "2001:db8::/32", []bulkTask{{"2001:db8::/64", "ipv6-prefixes"}, {"2001:db8::1", "sshd"}}},
+		{"IPv6地址不匹配更大的网段", "2001:db8::1", []bulkTask{{"2001:db8::1", "sshd"}}},
+		{"没有封禁", "203.0.113.1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefixes, _ := parseBulkTargets([]string{tt.target})
+			if got := liveTasksFor(live, prefixes[0]); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("liveTasksFor(%s) = %v, want %v", tt.target, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunBulk(t *testing.T) {
+	var tasks []bulkTask
+	for _, target := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3", "192.0.2.4"} {
+		for _, jail := range []string{"sshd", "nginx", "recidive"} {
+			tasks = append(tasks, bulkTask{target: target, jail: jail})
+		}
+	}
+
+	result := runBulk(tasks, func(task bulkTask) error {
+		if task.jail == "nginx" {
+			return errors.New("jail not running")
+		}
+		return nil
+	})
+	if result.Total != 12 || result.Succeeded != 8 || result.Failed != 4 {
+		t.Fatalf("Total = %d, Succeeded = %d, Failed = %d", result.Total, result.Succeeded, result.Failed)
+	}
+	// 结果顺序与任务顺序一致
+	for i, item := range result.Results {
+		if item.Target != tasks[i].target || item.Jail != tasks[i].jail || item.Success != (tasks[i].jail != "nginx") {
+			t.Errorf("Results[%d] = %+v, task %+v", i, item, tasks[i])
+		}
+		if !item.Success && item.Error != "jail not running" {
+			t.Errorf("Results[%d].Error = %q", i, item.Error)
+		}
+	}
+
+	result.mergeInvalid([]BulkItemResult{{Target: "bad", Error: "invalid IP or CIDR"}})
+	if result.Total != 13 || result.Failed != 5 || result.Results[12].Target != "bad" {
+		t.Errorf("mergeInvalid后 = Total %d, Failed %d", result.Total, result.Failed)
+	}
+}
+
+func TestUnbanEverywhere(t *testing.T) {
+	db := newTestDB(t, &model.BannedIP{}, &model.WhitelistEntry{})
+	fail2ban, calls := newFakeFail2BanService(t, map[string][]string{
+		"sshd":     {"192.0.2.1", "198.51.100.1"},
+		"nginx":    {"192.0.2.1"},
+		"recidive": {"192.0.2.1"},
+	}, "set recidive unbanip 192.0.2.1")
+	whitelist := NewWhitelistService(db, nil, nil)
+	scan := newTestScanService(t, nil, db)
+	s := NewBulkBanService(db, fail2ban, whitelist, scan, NewBanLifecycleService(db, fail2ban, nil))
+
+	for _, record := range []model.BannedIP{
+		{IPAddress: "192.0.2.1", Jail: "sshd"},
+		{IPAddress: "192.0.2.1", Jail: "nginx"},
+		{IPAddress: "192.0.2.1", Jail: "recidive"},
+		{IPAddress: "198.51.100.1", Jail: "sshd"},
+	} {
+		record.BanTime, record.IsActive = time.Now(), true
+		if err := db.Create(&record).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	scan.suspiciousIPs["192.0.2.1"] = &IPThreatLevel{IP: "192.0.2.1", ThreatScore: 80, IsBanned: true}
+
+	for _, tt := range []struct {
+		ip           string
+		whitelistFor time.Duration
+	}{
+		{"192.0.2.0/24", 0},
+		{"not-an-ip", 0},
+		{"192.0.2.1", -time.Hour},
+	} {
+		if _, err := s.UnbanEverywhere(tt.ip, tt.whitelistFor, "admin"); !errors.Is(err, ErrInvalidBulkRequest) {
+			t.Errorf("UnbanEverywhere(%s, %s) error = %v, want ErrInvalidBulkRequest", tt.ip, tt.whitelistFor, err)
+		}
+	}
+	if got := calls(); got != nil {
+		t.Fatalf("无效请求执行了 %v", got)
+	}
+
+	result, err := s.UnbanEverywhere(" 192.0.2.1 ", time.Hour, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.IP != "192.0.2.1" || !reflect.DeepEqual(result.Jails, []string{"nginx", "sshd"}) {
+		t.Errorf("IP = %s, Jails = %v", result.IP, result.Jails)
+	}
+	if len(result.Failed) != 1 || result.Failed[0].Jail != "recidive" {
+		t.Errorf("Failed = %+v", result.Failed)
+	}
+	// 解封失败的jail中的记录保留
+	if result.RecordsDeactivated != 2 {
+		t.Errorf("RecordsDeactivated = %d, want 2", result.RecordsDeactivated)
+	}
+	var active []model.BannedIP
+	db.Where("is_active = ?", true).Order("ip_address, jail").Find(&active)
+	if len(active) != 2 || active[0].Jail != "recidive" || active[1].IPAddress != "198.51.100.1" {
+		t.Errorf("有效记录 = %+v", active)
+	}
+
+	if !result.ThreatCleared {
+		t.Error("ThreatCleared = false")
+	}
+	if _, exists := scan.suspiciousIPs["192.0.2.1"]; exists {
+		t.Error("威胁记录没有清除")
+	}
+	if result.Whitelist == nil || result.Whitelist.ExpiresAt == nil || !whitelist.IsWhitelisted("192.0.2.1") {
+		t.Errorf("没有添加临时白名单: %+v", result.Whitelist)
+	}
+
+	// 已在白名单中时不重复添加临时白名单
+	result, err = s.UnbanEverywhere("192.0.2.1", time.Hour, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Whitelist != nil || result.ThreatCleared {
+		t.Errorf("重复解封结果 = %+v", result)
+	}
+}
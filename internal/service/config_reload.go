@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// configWatchInterval 检查配置文件是否变化的间隔
+const configWatchInterval = 5 * time.Second
+
+// 配置重新加载的触发方式
+const (
+	ConfigReloadSignal = "sighup"
+	ConfigReloadFile   = "file_change"
+	ConfigReloadAPI    = "api"
+)
+
+// reloadableSections 可以不重启热加载的配置段，其余配置段变化时需要重启才能生效
+var reloadableSections = map[string]bool{
+	"scanner": true,
+	"ban":     true,
+	"smtp":    true,
+}
+
+var ErrNoConfigFile = errors.New("no config file is loaded")
+
+// ConfigReloadResult 一次配置重新加载的结果
+type ConfigReloadResult struct {
+	Trigger         string    `json:"trigger"`
+	Time            time.Time `json:"time"`
+	Success         bool      `json:"success"`
+	Applied         []string  `json:"applied"`          // 已热加载的配置段
+	RestartRequired []string  `json:"restart_required"` // 已变化但需要重启才能生效的配置段
+	Error           string    `json:"error,omitempty"`
+}
+
+// ConfigReloadService 在收到SIGHUP或配置文件变化时重新加载配置，
+// 校验通过后把可热加载的配置段应用到各服务，校验失败时保留当前配置
+type ConfigReloadService struct {
+	intelligentService *IntelligentScanService
+	mailer             *Mailer
+	emailAlertService  *EmailAlertService
+	defaultSSHService  *DefaultSSHService
+	ctx                context.Context
+	cancel             context.CancelFunc
+	wg                 sync.WaitGroup
+
+	path       string // 配置文件路径，为空时不热加载
+	mu         sync.Mutex
+	current    *config.Config
+	fileHash   [sha256.Size]byte
+	lastReload *ConfigReloadResult
+}
+
+// NewConfigReloadService 创建配置热加载服务
+func NewConfigReloadService(cfg *config.Config, intelligentService *IntelligentScanService, mailer *Mailer, emailAlertService *EmailAlertService, defaultSSHService *DefaultSSHService) *ConfigReloadService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &ConfigReloadService{
+		intelligentService: intelligentService,
+		mailer:             mailer,
+		emailAlertService:  emailAlertService,
+		defaultSSHService:  defaultSSHService,
+		ctx:                ctx,
+		cancel:             cancel,
+		path:               cfg.File,
+		current:            cfg,
+	}
+	if s.path != "" {
+		s.fileHash, _ = hashFile(s.path)
+	}
+	return s
+}
+
+// Start 监听SIGHUP并定期检查配置文件，未使用配置文件时不启动
+func (s *ConfigReloadService) Start() {
+	if s.path == "" {
+		log.Printf("未指定配置文件，配置热加载未启用")
+		return
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	s.wg.Add(1)
+	go s.watch(signals)
+	log.Printf("配置热加载已启用: %s（SIGHUP或文件变化时重新加载）", s.path)
+}
+
+// Stop 停止监听
+func (s *ConfigReloadService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// watch 处理SIGHUP和配置文件变化
+func (s *ConfigReloadService) watch(signals chan os.Signal) {
+	defer s.wg.Done()
+	defer signal.Stop(signals)
+
+	ticker := time.NewTicker(configWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-signals:
+			s.Reload(ConfigReloadSignal)
+		case <-ticker.C:
+			if s.fileChanged() {
+				s.Reload(ConfigReloadFile)
+			}
+		}
+	}
+}
+
+// fileChanged 配置文件内容是否与上次加载时不同，读取失败时视为未变化
+func (s *ConfigReloadService) fileChanged() bool {
+	hash, err := hashFile(s.path)
+	if err != nil {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return hash != s.fileHash
+}
+
+// Reload 重新加载配置文件和环境变量，返回本次加载的结果
+func (s *ConfigReloadService) Reload(trigger string) (*ConfigReloadResult, error) {
+	if s.path == "" {
+		return nil, ErrNoConfigFile
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &ConfigReloadResult{
+		Trigger:         trigger,
+		Time:            time.Now(),
+		Applied:         []string{},
+		RestartRequired: []string{},
+	}
+
+	// 无论加载成功与否都记录文件内容，避免同一个错误文件被反复加载
+	s.fileHash, _ = hashFile(s.path)
+
+	next, err := config.Load(s.path)
+	if err == nil {
+		err = s.apply(next, result)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		s.lastReload = result
+		log.Printf("重新加载配置失败（%s），继续使用当前配置: %v", trigger, err)
+		return result, err
+	}
+
+	result.Success = true
+	s.lastReload = result
+	log.Printf("配置已重新加载（%s），已应用: %v，需要重启: %v", trigger, result.Applied, result.RestartRequired)
+	return result, nil
+}
+
+// apply 将可热加载的配置段应用到各服务，并更新当前配置
+func (s *ConfigReloadService) apply(next *config.Config, result *ConfigReloadResult) error {
+	for _, section := range changedConfigSections(s.current, next) {
+		if reloadableSections[section] {
+			result.Applied = append(result.Applied, section)
+		} else {
+			result.RestartRequired = append(result.RestartRequired, section)
+		}
+	}
+
+	// 扫描服务会校验观察模式策略，失败时其余服务也不更新
+	if err := s.intelligentService.ApplyConfig(next); err != nil {
+		return err
+	}
+	s.mailer.ApplyConfig(next)
+	s.emailAlertService.ApplyConfig(next)
+	s.defaultSSHService.ApplyConfig(next)
+
+	updated := *s.current
+	updated.Scanner = next.Scanner
+	updated.Ban = next.Ban
+	updated.SMTP = next.SMTP
+	s.current = &updated
+	return nil
+}
+
+// Effective 当前生效的配置，已隐藏密码和密钥
+func (s *ConfigReloadService) Effective() *config.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.current.Redacted()
+}
+
+// LastReload 最近一次重新加载的结果，尚未重新加载时为nil
+func (s *ConfigReloadService) LastReload() *ConfigReloadResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.lastReload
+}
+
+// changedConfigSections 比较两份配置，返回发生变化的配置段名称（与YAML中的名称一致）
+func changedConfigSections(previous, next *config.Config) []string {
+	prev := reflect.ValueOf(previous).Elem()
+	curr := reflect.ValueOf(next).Elem()
+	configType := prev.Type()
+
+	var changed []string
+	for i := 0; i < configType.NumField(); i++ {
+		name := configType.Field(i).Tag.Get("yaml")
+		if name == "" || name == "-" {
+			continue
+		}
+		if !reflect.DeepEqual(prev.Field(i).Interface(), curr.Field(i).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// hashFile 计算文件内容的SHA-256
+func hashFile(path string) ([sha256.Size]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(data), nil
+}
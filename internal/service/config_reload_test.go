@@ -0,0 +1,131 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+func TestChangedConfigSections(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*config.Config)
+		want   []string
+	}{
+		{"没有变化", func(*config.Config) {}, nil},
+		{"可热加载的配置段", func(c *config.Config) {
+			c.Scanner.HighScoreThreshold = 70
+			c.Ban.PermanentAfter = 5
+		}, []string{"scanner", "ban"}},
+		{"嵌套字段", func(c *config.Config) { c.Server.TLS.HSTSMaxAge = time.Hour }, []string{"server"}},
+		{"切片元素", func(c *config.Config) { c.SMTP.AlertRecipients = []string{"ops@example.com"} }, []string{"smtp"}},
+		{"按结构体字段顺序返回", func(c *config.Config) {
+			c.SMTP.Port = 465
+			c.JWT.Secret = "changed"
+			c.Server.Port = "9000"
+		}, []string{"server", "jwt", "smtp"}},
+		// 配置文件路径不是配置段
+		{"配置文件路径", func(c *config.Config) { c.File = "/etc/fail2ban-web.yaml" }, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := config.Defaults()
+			tt.modify(next)
+			if got := changedConfigSections(config.Defaults(), next); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changedConfigSections() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("scanner:\n  high_score_threshold: 80\n")
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scan := newTestScanService(t, cfg, nil)
+	mailer := NewMailer(cfg)
+	s := NewConfigReloadService(cfg, scan, mailer, NewEmailAlertService(cfg, mailer, NewEventBus()), NewDefaultSSHService(cfg, nil))
+	if s.fileChanged() {
+		t.Fatal("配置文件未修改时 fileChanged() = true")
+	}
+
+	writeConfig(`
+server:
+  port: "9000"
+scanner:
+  high_score_threshold: 70
+ban:
+  duration: 2h
+`)
+	if !s.fileChanged() {
+		t.Fatal("配置文件修改后 fileChanged() = false")
+	}
+	result, err := s.Reload(ConfigReloadAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success || result.Trigger != ConfigReloadAPI ||
+		!reflect.DeepEqual(result.Applied, []string{"scanner", "ban"}) ||
+		!reflect.DeepEqual(result.RestartRequired, []string{"server"}) {
+		t.Fatalf("Reload() = %+v", result)
+	}
+	if s.fileChanged() {
+		t.Error("重新加载后 fileChanged() = true")
+	}
+
+	// 只应用可热加载的配置段
+	if got := scan.scannerConfig().HighScoreThreshold; got != 70 {
+		t.Errorf("扫描服务 HighScoreThreshold = %d, want 70", got)
+	}
+	effective := s.Effective()
+	if effective.Scanner.HighScoreThreshold != 70 || effective.Ban.Duration != 2*time.Hour || effective.Server.Port != "8092" {
+		t.Errorf("Effective() = scanner %d, ban %s, port %s", effective.Scanner.HighScoreThreshold, effective.Ban.Duration, effective.Server.Port)
+	}
+	if effective.JWT.Secret == cfg.JWT.Secret {
+		t.Error("Effective() 没有隐藏JWT密钥")
+	}
+
+	// 校验失败或扫描服务拒绝时保留当前配置
+	for _, content := range []string{
+		"scanner:\n  high_score_threshold: 500\n",
+		"scanner:\n  observe_policies: [no_such_policy]\n  high_score_threshold: 60\n",
+		"scanner: [\n",
+	} {
+		writeConfig(content)
+		result, err := s.Reload(ConfigReloadFile)
+		if err == nil || result.Success || result.Error == "" {
+			t.Fatalf("Reload(%q) = %+v, %v", content, result, err)
+		}
+		if last := s.LastReload(); last != result {
+			t.Errorf("LastReload() = %+v, want the failed result", last)
+		}
+		// 同一个错误文件不会被反复加载
+		if s.fileChanged() {
+			t.Error("加载失败后 fileChanged() = true")
+		}
+		if got := s.Effective().Scanner.HighScoreThreshold; got != 70 {
+			t.Errorf("加载失败后 HighScoreThreshold = %d, want 70", got)
+		}
+	}
+
+	// 未使用配置文件时不能重新加载
+	noFile := NewConfigReloadService(config.Defaults(), scan, mailer, nil, nil)
+	if _, err := noFile.Reload(ConfigReloadAPI); !errors.Is(err, ErrNoConfigFile) {
+		t.Errorf("Reload() error = %v, want ErrNoConfigFile", err)
+	}
+}
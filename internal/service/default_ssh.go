@@ -1,19 +1,44 @@
 package service
 
 import (
+	"sync"
+
+	"fail2ban-web/config"
 	"fail2ban-web/internal/model"
 )
 
 type DefaultSSHService struct {
+	config      *config.Config
 	jailService *JailService
+
+	banMu     sync.RWMutex
+	banConfig config.BanConfig // 可热加载，生成jail配置时使用
 }
 
-func NewDefaultSSHService(jailService *JailService) *DefaultSSHService {
+func NewDefaultSSHService(cfg *config.Config, jailService *JailService) *DefaultSSHService {
 	return &DefaultSSHService{
+		config:      cfg,
 		jailService: jailService,
+		banConfig:   cfg.Ban,
 	}
 }
 
+// ApplyConfig 热加载封禁时长配置，之后生成的jail配置使用新的递增设置
+func (s *DefaultSSHService) ApplyConfig(cfg *config.Config) {
+	s.banMu.Lock()
+	defer s.banMu.Unlock()
+
+	s.banConfig = cfg.Ban
+}
+
+// currentBanConfig 当前封禁时长配置
+func (s *DefaultSSHService) currentBanConfig() config.BanConfig {
+	s.banMu.RLock()
+	defer s.banMu.RUnlock()
+
+	return s.banConfig
+}
+
 // GetDefaultSSHJails 获取默认SSH jail配置
 func (s *DefaultSSHService) GetDefaultSSHJails() []model.Fail2banJail {
 	return []model.Fail2banJail{
@@ -125,10 +150,13 @@ func (s *DefaultSSHService) InstallSSHDefaults() error {
 	return nil
 }
 
-// GetSSHJailConfig 获取SSH jail配置文件内容
+// GetSSHJailConfig 获取SSH jail配置文件内容，重复封禁的递增规则与智能封禁保持一致
 func (s *DefaultSSHService) GetSSHJailConfig() string {
 	return `# SSH相关的Fail2Ban配置
 
+[DEFAULT]
+# 重复封禁时按倍数递增封禁时长
+` + renderBanIncrement(s.currentBanConfig()) + `
 [sshd]
 # 标准SSH保护
 enabled = true
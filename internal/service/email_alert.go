@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// emailAlertCleanupInterval 清理过期告警冷却记录的间隔
+const emailAlertCleanupInterval = 10 * time.Minute
+
+// EmailAlertService 订阅威胁事件，威胁评分首次达到阈值时立即发送邮件告警，
+// 同一IP在冷却时间内只告警一次
+type EmailAlertService struct {
+	mailer   *Mailer
+	eventBus *EventBus
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+
+	configMu sync.RWMutex // 保护config和running，配置可热加载
+	config   config.SMTPConfig
+	running  bool // 是否已订阅威胁事件
+
+	mu        sync.Mutex
+	lastAlert map[string]time.Time
+}
+
+// NewEmailAlertService 创建邮件告警服务
+func NewEmailAlertService(cfg *config.Config, mailer *Mailer, eventBus *EventBus) *EmailAlertService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &EmailAlertService{
+		config:    cfg.SMTP,
+		mailer:    mailer,
+		eventBus:  eventBus,
+		ctx:       ctx,
+		cancel:    cancel,
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// Start 启动威胁事件订阅，未配置SMTP或告警收件人时不启动
+func (s *EmailAlertService) Start() error {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	if !s.enabledLocked() {
+		log.Printf("未配置SMTP服务器或告警收件人，邮件告警未启用")
+		return nil
+	}
+	s.subscribeLocked()
+	return nil
+}
+
+// ApplyConfig 热加载告警收件人、阈值和冷却时间，启动时未启用的告警在配置完整后开始订阅
+func (s *EmailAlertService) ApplyConfig(cfg *config.Config) {
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	s.config = cfg.SMTP
+	if !s.running && s.enabledLocked() && s.ctx.Err() == nil {
+		s.subscribeLocked()
+	}
+}
+
+// enabledLocked 是否配置了SMTP服务器和告警收件人，调用方需持有configMu
+func (s *EmailAlertService) enabledLocked() bool {
+	return s.mailer.Enabled() && len(s.config.AlertRecipients) > 0
+}
+
+// subscribeLocked 订阅威胁事件，调用方需持有configMu。
+// 在调用方的goroutine中订阅，之后发布的事件不会因consume尚未运行而遗漏
+func (s *EmailAlertService) subscribeLocked() {
+	sub, _ := s.eventBus.Subscribe([]string{EventTopicThreat}, 0)
+	s.running = true
+	s.wg.Add(1)
+	go s.consume(sub)
+	log.Printf("邮件告警已启用，威胁评分阈值: %d，收件人: %s",
+		s.config.AlertMinScore, strings.Join(s.config.AlertRecipients, ", "))
+}
+
+// alertConfig 当前告警配置
+func (s *EmailAlertService) alertConfig() config.SMTPConfig {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+
+	return s.config
+}
+
+// Stop 停止邮件告警
+func (s *EmailAlertService) Stop() {
+	s.configMu.Lock()
+	s.cancel()
+	s.configMu.Unlock()
+	s.wg.Wait()
+}
+
+// consume 处理威胁事件，订阅因处理过慢被断开时续传
+func (s *EmailAlertService) consume(sub *EventSubscription) {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(emailAlertCleanupInterval)
+	defer ticker.Stop()
+
+	var lastID uint64
+	for {
+		for open := true; open; {
+			select {
+			case <-s.ctx.Done():
+				sub.Close()
+				return
+			case <-ticker.C:
+				s.cleanup()
+			case event, ok := <-sub.Events:
+				if !ok {
+					open = false
+					break
+				}
+				lastID = event.ID
+				if threat, ok := event.Data.(ThreatEvent); ok && s.shouldAlert(threat) {
+					s.send(threat, event.Time)
+				}
+			}
+		}
+		sub, _ = s.eventBus.Subscribe([]string{EventTopicThreat}, lastID)
+	}
+}
+
+// shouldAlert 评分从阈值以下升到阈值以上，且不在冷却时间内
+func (s *EmailAlertService) shouldAlert(threat ThreatEvent) bool {
+	cfg := s.alertConfig()
+	if len(cfg.AlertRecipients) == 0 {
+		return false
+	}
+	if threat.ThreatScore < cfg.AlertMinScore || threat.PreviousScore >= cfg.AlertMinScore {
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, exists := s.lastAlert[threat.IP]; exists && time.Since(last) < cfg.AlertCooldown {
+		return false
+	}
+	s.lastAlert[threat.IP] = time.Now()
+	return true
+}
+
+// cleanup 清理已过冷却时间的告警记录
+func (s *EmailAlertService) cleanup() {
+	cooldown := s.alertConfig().AlertCooldown
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for ip, last := range s.lastAlert {
+		if time.Since(last) >= cooldown {
+			delete(s.lastAlert, ip)
+		}
+	}
+}
+
+// send 发送告警邮件，失败时只记录日志
+func (s *EmailAlertService) send(threat ThreatEvent, at time.Time) {
+	subject := fmt.Sprintf("[fail2ban-web] 严重威胁: %s (评分 %d)", threat.IP, threat.ThreatScore)
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "检测到严重威胁\n\n")
+	fmt.Fprintf(&text, "IP地址:   %s\n", threat.IP)
+	fmt.Fprintf(&text, "威胁评分: %d (之前 %d)\n", threat.ThreatScore, threat.PreviousScore)
+	fmt.Fprintf(&text, "威胁等级: %s\n", threat.ThreatLevel)
+	fmt.Fprintf(&text, "来源:     %s\n", threat.Source)
+	fmt.Fprintf(&text, "攻击类型: %s\n", strings.Join(threat.AttackTypes, ", "))
+	fmt.Fprintf(&text, "已封禁:   %t\n", threat.IsBanned)
+	fmt.Fprintf(&text, "时间:     %s\n", at.Format("2006-01-02 15:04:05"))
+
+	if err := s.mailer.Send(s.alertConfig().AlertRecipients, subject, text.String(), ""); err != nil {
+		log.Printf("发送威胁告警邮件失败 %s: %v", threat.IP, err)
+		return
+	}
+	log.Printf("已发送威胁告警邮件: %s (评分 %d)", threat.IP, threat.ThreatScore)
+}
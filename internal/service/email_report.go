@@ -0,0 +1,570 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"net/mail"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 摘要报告发送周期
+const (
+	EmailReportDaily  = "daily"
+	EmailReportWeekly = "weekly"
+)
+
+const (
+	emailReportCheckInterval = time.Minute
+	// emailReportRetryInterval 发送失败后重试的间隔
+	emailReportRetryInterval = 15 * time.Minute
+	// digestTopN 摘要中各排行榜的条数
+	digestTopN = 10
+)
+
+var (
+	ErrEmailReportNotFound = errors.New("email report not found")
+	ErrInvalidEmailReport  = errors.New("invalid email report")
+)
+
+// NamedCount 名称及其次数
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// DigestAttacker 摘要中的攻击来源，威胁信息来自当前的威胁记录
+type DigestAttacker struct {
+	IP          string   `json:"ip"`
+	Bans        int      `json:"bans"`
+	Jails       []string `json:"jails"`
+	ThreatScore int      `json:"threat_score"`
+	ThreatLevel string   `json:"threat_level,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	AttackTypes []string `json:"attack_types,omitempty"`
+}
+
+// Digest 一个周期内的封禁和威胁摘要
+type Digest struct {
+	Report          string           `json:"report"`
+	Frequency       string           `json:"frequency"`
+	Since           time.Time        `json:"since"`
+	Until           time.Time        `json:"until"`
+	TotalBans       int              `json:"total_bans"`
+	UniqueIPs       int              `json:"unique_ips"`
+	AutoBans        int              `json:"auto_bans"` // 智能扫描策略触发的封禁
+	BansByJail      []NamedCount     `json:"bans_by_jail"`
+	TopAttackers    []DigestAttacker `json:"top_attackers"`
+	TopPolicies     []NamedCount     `json:"top_policies"`
+	TopAttackTypes  []NamedCount     `json:"top_attack_types"`
+	CriticalThreats []IPThreatLevel  `json:"critical_threats"`
+}
+
+// EmailReportService 按每个报告的周期生成封禁和威胁摘要，以HTML和纯文本邮件发送
+type EmailReportService struct {
+	db                 *gorm.DB
+	mailer             *Mailer
+	intelligentService *IntelligentScanService
+	ctx                context.Context
+	cancel             context.CancelFunc
+	wg                 sync.WaitGroup
+}
+
+// NewEmailReportService 创建摘要报告服务
+func NewEmailReportService(db *gorm.DB, mailer *Mailer, intelligentService *IntelligentScanService) *EmailReportService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &EmailReportService{
+		db:                 db,
+		mailer:             mailer,
+		intelligentService: intelligentService,
+		ctx:                ctx,
+		cancel:             cancel,
+	}
+}
+
+// Start 启动报告调度，未配置SMTP时不启动
+func (s *EmailReportService) Start() {
+	if !s.mailer.Enabled() {
+		log.Printf("未配置SMTP服务器，摘要报告调度未启用")
+		return
+	}
+
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop 停止报告调度
+func (s *EmailReportService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *EmailReportService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(emailReportCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.sendDue(time.Now())
+		}
+	}
+}
+
+// sendDue 发送所有到期的报告
+func (s *EmailReportService) sendDue(now time.Time) {
+	var reports []model.EmailReport
+	if err := s.db.Where("enabled = ?", true).Find(&reports).Error; err != nil {
+		log.Printf("查询摘要报告失败: %v", err)
+		return
+	}
+
+	for i := range reports {
+		if s.ctx.Err() != nil {
+			return
+		}
+		report := &reports[i]
+		scheduled := lastScheduledTime(report, now)
+		if !reportDue(report, scheduled, now) {
+			continue
+		}
+		if err := s.send(report, scheduled); err != nil {
+			log.Printf("发送摘要报告 %s 失败: %v", report.Name, err)
+		} else {
+			log.Printf("已发送摘要报告 %s 给 %s", report.Name, strings.Join(report.Recipients, ", "))
+		}
+	}
+}
+
+// lastScheduledTime 不晚于now的最近一次计划发送时间
+func lastScheduledTime(report *model.EmailReport, now time.Time) time.Time {
+	scheduled := time.Date(now.Year(), now.Month(), now.Day(), report.Hour, 0, 0, 0, now.Location())
+	if report.Frequency == EmailReportWeekly {
+		scheduled = scheduled.AddDate(0, 0, -((int(now.Weekday()) - report.Weekday + 7) % 7))
+		if scheduled.After(now) {
+			scheduled = scheduled.AddDate(0, 0, -7)
+		}
+		return scheduled
+	}
+	if scheduled.After(now) {
+		scheduled = scheduled.AddDate(0, 0, -1)
+	}
+	return scheduled
+}
+
+// reportDue 计划时间之后尚未发送过，且距上次失败已超过重试间隔
+// 报告创建之前的计划时间不补发
+func reportDue(report *model.EmailReport, scheduled, now time.Time) bool {
+	last := report.CreatedAt
+	if report.LastSentAt != nil {
+		last = *report.LastSentAt
+	}
+	if !last.Before(scheduled) {
+		return false
+	}
+	return report.LastAttemptAt == nil || now.Sub(*report.LastAttemptAt) >= emailReportRetryInterval
+}
+
+// reportPeriod 报告覆盖的时间长度
+func reportPeriod(report *model.EmailReport) time.Duration {
+	if report.Frequency == EmailReportWeekly {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// send 生成截至until的摘要并发送，记录发送结果
+func (s *EmailReportService) send(report *model.EmailReport, until time.Time) error {
+	digest, err := s.BuildDigest(report, until)
+	if err == nil {
+		var text, html string
+		if text, html, err = renderDigest(digest); err == nil {
+			err = s.mailer.Send(report.Recipients, digestSubject(digest), text, html)
+		}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"last_attempt_at": now, "last_error": ""}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	} else {
+		updates["last_sent_at"] = now
+	}
+	if dbErr := s.db.Model(&model.EmailReport{}).Where("id = ?", report.ID).Updates(updates).Error; dbErr != nil {
+		log.Printf("更新摘要报告 %s 的发送状态失败: %v", report.Name, dbErr)
+	}
+	return err
+}
+
+// BuildDigest 统计截至until的一个报告周期内的封禁和威胁
+func (s *EmailReportService) BuildDigest(report *model.EmailReport, until time.Time) (*Digest, error) {
+	digest := &Digest{
+		Report:          report.Name,
+		Frequency:       report.Frequency,
+		Since:           until.Add(-reportPeriod(report)),
+		Until:           until,
+		BansByJail:      []NamedCount{},
+		TopAttackers:    []DigestAttacker{},
+		TopPolicies:     []NamedCount{},
+		TopAttackTypes:  []NamedCount{},
+		CriticalThreats: []IPThreatLevel{},
+	}
+
+	var bans []model.BannedIP
+	if err := s.db.Select("ip_address", "jail", "policy").
+		Where("ban_time >= ? AND ban_time < ?", digest.Since, digest.Until).
+		Find(&bans).Error; err != nil {
+		return nil, fmt.Errorf("查询封禁记录失败: %w", err)
+	}
+
+	jailCounts := make(map[string]int)
+	policyCounts := make(map[string]int)
+	attackers := make(map[string]*DigestAttacker)
+	for _, ban := range bans {
+		digest.TotalBans++
+		jailCounts[ban.Jail]++
+		if ban.Policy != "" {
+			digest.AutoBans++
+			policyCounts[ban.Policy]++
+		}
+
+		attacker, exists := attackers[ban.IPAddress]
+		if !exists {
+			attacker = &DigestAttacker{IP: ban.IPAddress}
+			attackers[ban.IPAddress] = attacker
+		}
+		attacker.Bans++
+		if !contains(attacker.Jails, ban.Jail) {
+			attacker.Jails = append(attacker.Jails, ban.Jail)
+		}
+	}
+	digest.UniqueIPs = len(attackers)
+	digest.BansByJail = topNamedCounts(jailCounts, 0)
+	digest.TopPolicies = topNamedCounts(policyCounts, digestTopN)
+
+	for _, attacker := range attackers {
+		digest.TopAttackers = append(digest.TopAttackers, *attacker)
+	}
+	sort.Slice(digest.TopAttackers, func(i, j int) bool {
+		if digest.TopAttackers[i].Bans != digest.TopAttackers[j].Bans {
+			return digest.TopAttackers[i].Bans > digest.TopAttackers[j].Bans
+		}
+		return digest.TopAttackers[i].IP < digest.TopAttackers[j].IP
+	})
+	if len(digest.TopAttackers) > digestTopN {
+		digest.TopAttackers = digest.TopAttackers[:digestTopN]
+	}
+
+	if s.intelligentService == nil {
+		return digest, nil
+	}
+
+	for i := range digest.TopAttackers {
+		attacker := &digest.TopAttackers[i]
+		if threat := s.intelligentService.GetThreat(attacker.IP); threat != nil {
+			attacker.ThreatScore = threat.ThreatScore
+			attacker.ThreatLevel = threat.ThreatLevel
+			attacker.Country = threat.Country
+			attacker.AttackTypes = threat.AttackTypes
+		}
+	}
+
+	// 威胁记录只在内存中保留24小时，攻击类型统计以当前的威胁记录为准
+	attackTypeCounts := make(map[string]int)
+	for _, threat := range s.intelligentService.GetCurrentThreats() {
+		if threat.LastSeen.Before(digest.Since) {
+			continue
+		}
+		for _, attackType := range threat.AttackTypes {
+			attackTypeCounts[attackType]++
+		}
+		if threat.ThreatLevel == "严重" {
+			digest.CriticalThreats = append(digest.CriticalThreats, *threat)
+		}
+	}
+	digest.TopAttackTypes = topNamedCounts(attackTypeCounts, digestTopN)
+	sort.Slice(digest.CriticalThreats, func(i, j int) bool {
+		return digest.CriticalThreats[i].ThreatScore > digest.CriticalThreats[j].ThreatScore
+	})
+	if len(digest.CriticalThreats) > digestTopN {
+		digest.CriticalThreats = digest.CriticalThreats[:digestTopN]
+	}
+
+	return digest, nil
+}
+
+// topNamedCounts 按次数降序排列，limit为0时不限制条数
+func topNamedCounts(counts map[string]int, limit int) []NamedCount {
+	result := make([]NamedCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, NamedCount{Name: name, Count: count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// ListReports 获取摘要报告列表
+func (s *EmailReportService) ListReports() ([]model.EmailReport, error) {
+	var reports []model.EmailReport
+	if err := s.db.Order("id ASC").Find(&reports).Error; err != nil {
+		return nil, fmt.Errorf("查询摘要报告失败: %w", err)
+	}
+	return reports, nil
+}
+
+// GetReport 获取单个摘要报告
+func (s *EmailReportService) GetReport(id uint) (*model.EmailReport, error) {
+	var report model.EmailReport
+	if err := s.db.First(&report, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrEmailReportNotFound
+		}
+		return nil, fmt.Errorf("查询摘要报告失败: %w", err)
+	}
+	return &report, nil
+}
+
+// CreateReport 创建摘要报告
+func (s *EmailReportService) CreateReport(report *model.EmailReport) error {
+	if err := normalizeEmailReport(report); err != nil {
+		return err
+	}
+
+	report.ID = 0
+	report.LastSentAt = nil
+	report.LastAttemptAt = nil
+	report.LastError = ""
+	if err := s.db.Create(report).Error; err != nil {
+		return fmt.Errorf("创建摘要报告失败: %w", err)
+	}
+	return nil
+}
+
+// UpdateReport 更新摘要报告，保留发送状态
+func (s *EmailReportService) UpdateReport(id uint, report *model.EmailReport) (*model.EmailReport, error) {
+	existing, err := s.GetReport(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeEmailReport(report); err != nil {
+		return nil, err
+	}
+
+	report.ID = existing.ID
+	report.CreatedAt = existing.CreatedAt
+	report.LastSentAt = existing.LastSentAt
+	report.LastAttemptAt = existing.LastAttemptAt
+	report.LastError = existing.LastError
+	if err := s.db.Save(report).Error; err != nil {
+		return nil, fmt.Errorf("更新摘要报告失败: %w", err)
+	}
+	return report, nil
+}
+
+// DeleteReport 删除摘要报告
+func (s *EmailReportService) DeleteReport(id uint) error {
+	if _, err := s.GetReport(id); err != nil {
+		return err
+	}
+	if err := s.db.Delete(&model.EmailReport{}, id).Error; err != nil {
+		return fmt.Errorf("删除摘要报告失败: %w", err)
+	}
+	return nil
+}
+
+// SendNow 立即发送截至当前时间的摘要（不论是否启用），不影响计划发送
+func (s *EmailReportService) SendNow(id uint) (*model.EmailReport, error) {
+	report, err := s.GetReport(id)
+	if err != nil {
+		return nil, err
+	}
+	if !s.mailer.Enabled() {
+		return nil, ErrSMTPNotConfigured
+	}
+
+	digest, err := s.BuildDigest(report, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	text, html, err := renderDigest(digest)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.mailer.Send(report.Recipients, digestSubject(digest), text, html); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Preview 生成截至当前时间的摘要及其邮件正文，不发送
+func (s *EmailReportService) Preview(id uint) (*Digest, string, string, error) {
+	report, err := s.GetReport(id)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	digest, err := s.BuildDigest(report, time.Now())
+	if err != nil {
+		return nil, "", "", err
+	}
+	text, html, err := renderDigest(digest)
+	if err != nil {
+		return nil, "", "", err
+	}
+	return digest, text, html, nil
+}
+
+// normalizeEmailReport 校验报告配置并填充默认值
+func normalizeEmailReport(report *model.EmailReport) error {
+	report.Name = strings.TrimSpace(report.Name)
+	if report.Name == "" {
+		return fmt.Errorf("%w: 名称不能为空", ErrInvalidEmailReport)
+	}
+
+	var recipients []string
+	for _, recipient := range report.Recipients {
+		if recipient = strings.TrimSpace(recipient); recipient == "" {
+			continue
+		}
+		address, err := mail.ParseAddress(recipient)
+		if err != nil {
+			return fmt.Errorf("%w: 无效的收件人 %s", ErrInvalidEmailReport, recipient)
+		}
+		recipients = append(recipients, address.Address)
+	}
+	if len(recipients) == 0 {
+		return fmt.Errorf("%w: 收件人不能为空", ErrInvalidEmailReport)
+	}
+	report.Recipients = recipients
+
+	switch report.Frequency {
+	case "":
+		report.Frequency = EmailReportDaily
+	case EmailReportDaily, EmailReportWeekly:
+	default:
+		return fmt.Errorf("%w: 发送周期必须为 daily 或 weekly", ErrInvalidEmailReport)
+	}
+	if report.Hour < 0 || report.Hour > 23 {
+		return fmt.Errorf("%w: 发送时间必须在0-23之间", ErrInvalidEmailReport)
+	}
+	if report.Weekday < 0 || report.Weekday > 6 {
+		return fmt.Errorf("%w: 发送日必须在0-6之间", ErrInvalidEmailReport)
+	}
+	return nil
+}
+
+// digestSubject 摘要邮件标题
+func digestSubject(digest *Digest) string {
+	period := "每日"
+	if digest.Frequency == EmailReportWeekly {
+		period = "每周"
+	}
+	return fmt.Sprintf("[fail2ban-web] %s摘要 %s: %d 次封禁, %d 个IP",
+		period, digest.Until.Format("2006-01-02"), digest.TotalBans, digest.UniqueIPs)
+}
+
+// renderDigest 渲染摘要邮件的纯文本和HTML正文
+func renderDigest(digest *Digest) (string, string, error) {
+	var text, html bytes.Buffer
+	if err := digestTextTemplate.Execute(&text, digest); err != nil {
+		return "", "", fmt.Errorf("渲染摘要失败: %w", err)
+	}
+	if err := digestHTMLTemplate.Execute(&html, digest); err != nil {
+		return "", "", fmt.Errorf("渲染摘要失败: %w", err)
+	}
+	return text.String(), html.String(), nil
+}
+
+var digestTemplateFuncs = map[string]interface{}{
+	"time": func(t time.Time) string { return t.Format("2006-01-02 15:04") },
+	"join": strings.Join,
+}
+
+var digestTextTemplate = texttemplate.Must(texttemplate.New("digest").Funcs(digestTemplateFuncs).Parse(
+	`fail2ban-web 摘要报告: {{.Report}}
+统计时间: {{time .Since}} - {{time .Until}}
+
+封禁次数: {{.TotalBans}}
+封禁IP数: {{.UniqueIPs}}
+自动封禁: {{.AutoBans}}
+{{if .BansByJail}}
+按jail统计:
+{{range .BansByJail}}  {{.Name}}: {{.Count}}
+{{end}}{{end}}{{if .TopAttackers}}
+主要攻击来源:
+{{range .TopAttackers}}  {{.IP}}  封禁 {{.Bans}} 次  [{{join .Jails ", "}}]{{if .ThreatLevel}}  评分 {{.ThreatScore}} ({{.ThreatLevel}}){{end}}{{if .Country}}  {{.Country}}{{end}}
+{{end}}{{end}}{{if .TopAttackTypes}}
+主要攻击类型:
+{{range .TopAttackTypes}}  {{.Name}}: {{.Count}}
+{{end}}{{end}}{{if .TopPolicies}}
+智能扫描自动封禁策略:
+{{range .TopPolicies}}  {{.Name}}: {{.Count}}
+{{end}}{{end}}{{if .CriticalThreats}}
+严重威胁:
+{{range .CriticalThreats}}  {{.IP}}  评分 {{.ThreatScore}}  [{{join .AttackTypes ", "}}]{{if .IsBanned}}  已封禁{{end}}
+{{end}}{{end}}`))
+
+var digestHTMLTemplate = htmltemplate.Must(htmltemplate.New("digest").Funcs(digestTemplateFuncs).Parse(
+	`<!DOCTYPE html>
+<html>
+<head><meta charset="UTF-8"><title>fail2ban-web 摘要报告</title></head>
+<body style="font-family: sans-serif; color: #222;">
+<h2>fail2ban-web 摘要报告: {{.Report}}</h2>
+<p>统计时间: {{time .Since}} - {{time .Until}}</p>
+<table cellpadding="4" style="border-collapse: collapse;">
+<tr><td>封禁次数</td><td><b>{{.TotalBans}}</b></td></tr>
+<tr><td>封禁IP数</td><td><b>{{.UniqueIPs}}</b></td></tr>
+<tr><td>自动封禁</td><td><b>{{.AutoBans}}</b></td></tr>
+</table>
+{{if .BansByJail}}<h3>按jail统计</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse;">
+<tr><th>jail</th><th>封禁次数</th></tr>
+{{range .BansByJail}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+{{if .TopAttackers}}<h3>主要攻击来源</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse;">
+<tr><th>IP</th><th>封禁次数</th><th>jail</th><th>威胁评分</th><th>国家</th><th>攻击类型</th></tr>
+{{range .TopAttackers}}<tr><td>{{.IP}}</td><td>{{.Bans}}</td><td>{{join .Jails ", "}}</td><td>{{if .ThreatLevel}}{{.ThreatScore}} ({{.ThreatLevel}}){{end}}</td><td>{{.Country}}</td><td>{{join .AttackTypes ", "}}</td></tr>
+{{end}}</table>{{end}}
+{{if .TopAttackTypes}}<h3>主要攻击类型</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse;">
+<tr><th>攻击类型</th><th>IP数</th></tr>
+{{range .TopAttackTypes}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+{{if .TopPolicies}}<h3>智能扫描自动封禁策略</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse;">
+<tr><th>策略</th><th>封禁次数</th></tr>
+{{range .TopPolicies}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>{{end}}
+{{if .CriticalThreats}}<h3>严重威胁</h3>
+<table border="1" cellpadding="4" style="border-collapse: collapse;">
+<tr><th>IP</th><th>威胁评分</th><th>攻击类型</th><th>已封禁</th></tr>
+{{range .CriticalThreats}}<tr><td>{{.IP}}</td><td>{{.ThreatScore}}</td><td>{{join .AttackTypes ", "}}</td><td>{{if .IsBanned}}是{{else}}否{{end}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
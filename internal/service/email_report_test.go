@@ -0,0 +1,139 @@
+package service
+
+import (
+	"mime"
+	"strings"
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/model"
+)
+
+func testDigest() *Digest {
+	until := time.Date(2024, 3, 10, 8, 0, 0, 0, time.UTC)
+	return &Digest{
+		Report:     "ops <daily>",
+		Frequency:  EmailReportDaily,
+		Since:      until.Add(-24 * time.Hour),
+		Until:      until,
+		TotalBans:  3,
+		UniqueIPs:  2,
+		AutoBans:   1,
+		BansByJail: []NamedCount{{Name: "sshd", Count: 2}, {Name: "nginx-<limit>", Count: 1}},
+		TopAttackers: []DigestAttacker{
+			{IP: "192.0.2.1", Bans: 2, Jails: []string{"sshd", "nginx-<limit>"}, ThreatScore: 90, ThreatLevel: "严重", Country: "CN"},
+			{IP: "198.51.100.7", Bans: 1, Jails: []string{"sshd"}},
+		},
+		TopPolicies:    []NamedCount{{Name: "critical", Count: 1}},
+		TopAttackTypes: []NamedCount{{Name: "SSH暴力破解", Count: 2}},
+		CriticalThreats: []IPThreatLevel{
+			{IP: "192.0.2.1", ThreatScore: 90, AttackTypes: []string{"SSH暴力破解", "扫描"}, IsBanned: true},
+		},
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	text, html, err := renderDigest(testDigest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		"fail2ban-web 摘要报告: ops <daily>",
+		"统计时间: 2024-03-09 08:00 - 2024-03-10 08:00",
+		"封禁次数: 3",
+		"封禁IP数: 2",
+		"  nginx-<limit>: 1",
+		"  192.0.2.1  封禁 2 次  [sshd, nginx-<limit>]  评分 90 (严重)  CN",
+		"  198.51.100.7  封禁 1 次  [sshd]\n",
+		"  critical: 1",
+		"  192.0.2.1  评分 90  [SSH暴力破解, 扫描]  已封禁",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("纯文本摘要缺少 %q:\n%s", want, text)
+		}
+	}
+
+	for _, want := range []string{
+		"<h2>fail2ban-web 摘要报告: ops &lt;daily&gt;</h2>",
+		"<tr><td>nginx-&lt;limit&gt;</td><td>1</td></tr>",
+		"<td>192.0.2.1</td><td>2</td><td>sshd, nginx-&lt;limit&gt;</td><td>90 (严重)</td><td>CN</td>",
+		"<h3>严重威胁</h3>",
+		"<td>SSH暴力破解, 扫描</td><td>是</td>",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML摘要缺少 %q:\n%s", want, html)
+		}
+	}
+	// HTML模板转义数据中的标签
+	if strings.Contains(html, "<limit>") || strings.Contains(html, "<daily>") {
+		t.Error("HTML摘要中的数据没有转义")
+	}
+
+	// 空摘要省略各排行榜
+	empty := testDigest()
+	empty.BansByJail, empty.TopAttackers, empty.TopPolicies = nil, nil, nil
+	empty.TopAttackTypes, empty.CriticalThreats = nil, nil
+	text, html, err = renderDigest(empty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(text, "主要攻击来源") || strings.Contains(html, "<h3>") {
+		t.Errorf("空摘要包含排行榜:\n%s\n%s", text, html)
+	}
+}
+
+func TestEmailReportSendNow(t *testing.T) {
+	server := newTestSMTPServer(t)
+	mailer := NewMailer(&config.Config{SMTP: server.config(SMTPTLSNone)})
+	db := newTestDB(t, &model.EmailReport{}, &model.BannedIP{})
+	s := NewEmailReportService(db, mailer, nil)
+
+	now := time.Now()
+	for _, ban := range []model.BannedIP{
+		{IPAddress: "192.0.2.1", Jail: "sshd", BanTime: now.Add(-time.Hour), Policy: "critical"},
+		{IPAddress: "192.0.2.1", Jail: "nginx-http-auth", BanTime: now.Add(-2 * time.Hour)},
+		{IPAddress: "198.51.100.7", Jail: "sshd", BanTime: now.Add(-3 * time.Hour)},
+		// 超出统计周期
+		{IPAddress: "203.0.113.9", Jail: "sshd", BanTime: now.Add(-48 * time.Hour)},
+	} {
+		if err := db.Create(&ban).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := &model.EmailReport{Name: "daily", Recipients: []string{" Ops <ops@example.com> "}, Hour: 8, Enabled: true}
+	if err := s.CreateReport(report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Recipients[0] != "ops@example.com" || report.Frequency != EmailReportDaily {
+		t.Fatalf("规范化后的报告 = %v, %s", report.Recipients, report.Frequency)
+	}
+
+	if _, err := s.SendNow(report.ID); err != nil {
+		t.Fatalf("SendNow() error = %v", err)
+	}
+
+	_, messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("服务器收到 %d 封邮件, want 1", len(messages))
+	}
+	header, parts := readMailParts(t, messages[0].Data)
+	subject, _ := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if !strings.Contains(subject, "每日摘要") || !strings.Contains(subject, "3 次封禁, 2 个IP") {
+		t.Errorf("Subject = %q", subject)
+	}
+
+	text := parts["text/plain; charset=UTF-8"]
+	if !strings.Contains(text, "封禁次数: 3") || !strings.Contains(text, "  192.0.2.1  封禁 2 次  [sshd, nginx-http-auth]") {
+		t.Errorf("纯文本正文:\n%s", text)
+	}
+	if strings.Contains(text, "203.0.113.9") {
+		t.Error("摘要包含统计周期之外的封禁")
+	}
+	html := parts["text/html; charset=UTF-8"]
+	if !strings.Contains(html, "<tr><td>自动封禁</td><td><b>1</b></td></tr>") || !strings.Contains(html, "<tr><td>critical</td><td>1</td></tr>") {
+		t.Errorf("HTML正文:\n%s", html)
+	}
+}
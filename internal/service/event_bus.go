@@ -0,0 +1,172 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+// 事件主题
+const (
+	EventTopicBan    = "ban"    // fail2ban封禁（含恢复、延长封禁）
+	EventTopicUnban  = "unban"  // fail2ban解封
+	EventTopicThreat = "threat" // 威胁评分变化
+	EventTopicJail   = "jail"   // jail启停和配置变化
+	EventTopicLog    = "log"    // 解析出的fail2ban日志事件
+	EventTopicJob    = "job"    // 异步任务状态和进度
+	EventTopicStream = "stream" // 事件流自身的控制消息，不需要订阅
+)
+
+// EventTopics 可订阅的事件主题
+var EventTopics = []string{
+	EventTopicBan,
+	EventTopicUnban,
+	EventTopicThreat,
+	EventTopicJail,
+	EventTopicLog,
+	EventTopicJob,
+}
+
+// IsEventTopic 是否为可订阅的事件主题
+func IsEventTopic(topic string) bool {
+	return contains(EventTopics, topic)
+}
+
+const (
+	// eventBufferSize 保留最近的事件数，用于断线后按Last-Event-ID补发
+	eventBufferSize = 1024
+	// eventSubscriberBuffer 订阅者的待发送队列长度，队列满时断开订阅者
+	eventSubscriberBuffer = 256
+)
+
+// Event 事件总线中的一条事件
+type Event struct {
+	ID    uint64      `json:"id"`
+	Topic string      `json:"topic"`
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// EventSubscription 事件订阅，Events关闭表示订阅结束（取消或处理过慢）
+type EventSubscription struct {
+	Events <-chan Event
+	Lagged bool // 因处理过慢被断开，客户端应使用最后的事件ID重新订阅
+
+	events chan Event
+	topics map[string]bool
+	bus    *EventBus
+}
+
+// EventBus 服务层内部的发布订阅总线，保留最近的事件供断线续传
+// 发布不会阻塞：订阅者队列满时直接断开，由客户端续传
+type EventBus struct {
+	mu          sync.Mutex
+	nextID      uint64
+	buffer      []Event // 环形缓冲区
+	start       int
+	subscribers map[*EventSubscription]struct{}
+}
+
+// NewEventBus 创建事件总线
+func NewEventBus() *EventBus {
+	return &EventBus{
+		// 以启动时间作为起始ID，重启后的ID大于重启前，旧的Last-Event-ID不会误匹配
+		nextID:      uint64(time.Now().UnixMilli()) * 1000,
+		buffer:      make([]Event, 0, eventBufferSize),
+		subscribers: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// Publish 发布事件，bus为nil时忽略
+func (b *EventBus) Publish(topic, eventType string, data interface{}) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event := Event{
+		ID:    b.nextID,
+		Topic: topic,
+		Type:  eventType,
+		Time:  time.Now(),
+		Data:  data,
+	}
+
+	if len(b.buffer) < eventBufferSize {
+		b.buffer = append(b.buffer, event)
+	} else {
+		b.buffer[b.start] = event
+		b.start = (b.start + 1) % eventBufferSize
+	}
+
+	for sub := range b.subscribers {
+		if !sub.wants(topic) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.Lagged = true
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe 订阅指定主题（为空时订阅全部），lastID不为0时先补发之后的事件
+// 返回的complete为false表示lastID之后的部分事件已不在缓冲区中
+func (b *EventBus) Subscribe(topics []string, lastID uint64) (*EventSubscription, bool) {
+	sub := &EventSubscription{
+		events: make(chan Event, eventSubscriberBuffer+eventBufferSize),
+		bus:    b,
+	}
+	sub.Events = sub.events
+	if len(topics) > 0 {
+		sub.topics = make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			sub.topics[topic] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete := true
+	if lastID > 0 {
+		n := len(b.buffer)
+		if n == 0 || b.buffer[b.start].ID > lastID+1 {
+			complete = lastID >= b.nextID
+		}
+		for i := 0; i < n; i++ {
+			event := b.buffer[(b.start+i)%n]
+			if event.ID > lastID && sub.wants(event.Topic) {
+				sub.events <- event
+			}
+		}
+	}
+
+	b.subscribers[sub] = struct{}{}
+	return sub, complete
+}
+
+// Close 取消订阅
+func (s *EventSubscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// remove 移除订阅者并关闭其队列，调用方需持有锁
+func (b *EventBus) remove(sub *EventSubscription) {
+	if _, exists := b.subscribers[sub]; !exists {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.events)
+}
+
+func (s *EventSubscription) wants(topic string) bool {
+	return s.topics == nil || s.topics[topic]
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// extendedBanJailName 递增、永久和手动延长的封禁使用的jail，由fail2ban-web生成。
+// bantime为-1，fail2ban不会自行解封，到期由BanLifecycleService按记录的解封时间解封
+const extendedBanJailName = "fail2ban-web-extended"
+
+// ExtendedBanJail 管理长期封禁jail：封禁时长超过原jail的bantime时把封禁转移到该jail，
+// 避免fail2ban按原jail的bantime提前解封
+type ExtendedBanJail struct {
+	config          *config.Config
+	fail2banService *Fail2BanService
+	mu              sync.Mutex
+	ready           bool
+}
+
+// NewExtendedBanJail 创建长期封禁jail管理
+func NewExtendedBanJail(cfg *config.Config, fail2banService *Fail2BanService) *ExtendedBanJail {
+	return &ExtendedBanJail{
+		config:          cfg,
+		fail2banService: fail2banService,
+	}
+}
+
+// Ensure 生成长期封禁jail的配置文件，内容变化时重新加载fail2ban
+func (j *ExtendedBanJail) Ensure() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.ready {
+		return nil
+	}
+
+	root := j.config.Fail2Ban.ConfigPath
+	files := map[string]string{
+		// 与网段jail共用基于hash:net的action，单个地址和网段都可以封禁
+		filepath.Join(root, "action.d", subnetJailName+".conf"):      subnetJailAction,
+		filepath.Join(root, "filter.d", extendedBanJailName+".conf"): extendedBanJailFilter,
+		filepath.Join(root, "jail.d", extendedBanJailName+".local"):  j.buildJail(),
+	}
+
+	changed := false
+	for path, content := range files {
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, []byte(content)) {
+			continue
+		}
+		if err := writeFileAtomic(path, []byte(content)); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if changed {
+		log.Printf("已生成长期封禁jail %s 的配置", extendedBanJailName)
+		if err := j.fail2banService.Reload(); err != nil {
+			return fmt.Errorf("重新加载fail2ban失败: %w", err)
+		}
+	}
+
+	j.ready = true
+	return nil
+}
+
+// buildJail 生成长期封禁jail配置
+func (j *ExtendedBanJail) buildJail() string {
+	return fmt.Sprintf(`# Generated by fail2ban-web. Do not edit.
+[%s]
+enabled = true
+filter = %s
+logpath = %s
+backend = polling
+bantime = -1
+action = %s[setprefix=f2b-extended]
+`, extendedBanJailName, extendedBanJailName, j.config.Fail2Ban.LogPath, subnetJailName)
+}
+
+// Required 封禁是否需要转移到长期jail：永久封禁，或解封时间晚于原jail按bantime自行解封的时间。
+// 无法获取原jail的bantime时按需要处理
+func (j *ExtendedBanJail) Required(jail string, bannedAt, unbanTime time.Time, permanent bool) bool {
+	if jail == extendedBanJailName {
+		return false
+	}
+	if permanent {
+		return true
+	}
+
+	banTime, err := j.fail2banService.GetBanTime(jail)
+	if err != nil {
+		log.Printf("获取jail %s 的bantime失败，按长期封禁处理: %v", jail, err)
+		return true
+	}
+	if banTime < 0 {
+		return false
+	}
+	return unbanTime.After(bannedAt.Add(banTime))
+}
+
+// Hold 在长期jail中封禁IP或网段，source为指标中记录的封禁来源。
+// 不生成jail配置（重新加载fail2ban较慢，调用方可能持有锁），jail配置需要先通过Ensure生成
+func (j *ExtendedBanJail) Hold(target, source string) error {
+	j.mu.Lock()
+	ready := j.ready
+	j.mu.Unlock()
+	if !ready {
+		return fmt.Errorf("长期封禁jail %s 的配置尚未生成", extendedBanJailName)
+	}
+	return j.fail2banService.banIP(extendedBanJailName, target, source)
+}
+
+// extendedBanJailFilter 长期封禁jail只接受手动封禁，使用一个不会命中的过滤器
+const extendedBanJailFilter = `# Generated by fail2ban-web. Do not edit.
+# Placeholder filter for the extended ban jail, never matches any line.
+[Definition]
+failregex = ^fail2ban-web extended placeholder <HOST>$
+ignoreregex =
+`
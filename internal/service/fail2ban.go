@@ -6,6 +6,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"fail2ban-web/internal/model"
@@ -16,15 +17,21 @@ import (
 type Fail2BanService struct {
 	logger  *logrus.Logger
 	useSudo bool
+	metrics *Metrics
+
+	banTimeMu sync.Mutex
+	banTimes  map[string]time.Duration // 各jail的bantime缓存，重新加载fail2ban时清空
 }
 
-func NewFail2BanService(logger *logrus.Logger) *Fail2BanService {
+func NewFail2BanService(logger *logrus.Logger, metrics *Metrics) *Fail2BanService {
 	// 检查是否需要使用sudo
 	useSudo := shouldUseSudo()
 	
 	service := &Fail2BanService{
-		logger:  logger,
-		useSudo: useSudo,
+		logger:   logger,
+		useSudo:  useSudo,
+		metrics:  metrics,
+		banTimes: make(map[string]time.Duration),
 	}
 	
 	// 记录权限状态
@@ -82,7 +89,10 @@ func (s *Fail2BanService) execFail2banCommand(args ...string) ([]byte, error) {
 		"use_sudo": s.useSudo,
 	}).Debug("Executing fail2ban command")
 	
-	return cmd.Output()
+	start := time.Now()
+	output, err := cmd.Output()
+	s.metrics.ObserveCommand(args, time.Since(start), err)
+	return output, err
 }
 
 // execFail2banCommandCombined 执行fail2ban命令并返回合并输出
@@ -101,7 +111,10 @@ func (s *Fail2BanService) execFail2banCommandCombined(args ...string) ([]byte, e
 		"use_sudo": s.useSudo,
 	}).Debug("Executing fail2ban command (combined output)")
 	
-	return cmd.CombinedOutput()
+	start := time.Now()
+	output, err := cmd.CombinedOutput()
+	s.metrics.ObserveCommand(args, time.Since(start), err)
+	return output, err
 }
 
 // TestConnection 测试与Fail2Ban的连接
@@ -254,6 +267,11 @@ func (s *Fail2BanService) getBanTimeInfo(jail, ip string) (time.Time, int64) {
 
 // UnbanIP 解禁IP
 func (s *Fail2BanService) UnbanIP(jail, ip string) error {
+	return s.unbanIP(jail, ip, BanSourceManual)
+}
+
+// unbanIP 解禁IP并按来源记录指标
+func (s *Fail2BanService) unbanIP(jail, ip, source string) error {
 	output, err := s.execFail2banCommandCombined("set", jail, "unbanip", ip)
 	if err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
@@ -268,12 +286,18 @@ func (s *Fail2BanService) UnbanIP(jail, ip string) error {
 		"jail": jail,
 		"ip":   ip,
 	}).Info("Successfully unbanned IP")
+	s.metrics.RecordUnban(source, jail)
 
 	return nil
 }
 
 // BanIP 手动禁止IP
 func (s *Fail2BanService) BanIP(jail, ip string) error {
+	return s.banIP(jail, ip, BanSourceManual)
+}
+
+// banIP 禁止IP并按来源记录指标
+func (s *Fail2BanService) banIP(jail, ip, source string) error {
 	output, err := s.execFail2banCommandCombined("set", jail, "banip", ip)
 	if err != nil {
 		s.logger.WithError(err).WithFields(logrus.Fields{
@@ -288,7 +312,100 @@ func (s *Fail2BanService) BanIP(jail, ip string) error {
 		"jail": jail,
 		"ip":   ip,
 	}).Info("Successfully banned IP")
+	s.metrics.RecordBan(source, jail)
+
+	return nil
+}
+
+// Reload 重新加载fail2ban配置
+func (s *Fail2BanService) Reload() error {
+	output, err := s.execFail2banCommandCombined("reload")
+	if err != nil {
+		s.logger.WithError(err).WithField("output", string(output)).Error("Failed to reload fail2ban")
+		return fmt.Errorf("failed to reload fail2ban: %w", err)
+	}
+
+	s.logger.Info("Successfully reloaded fail2ban")
+
+	// 重新加载后jail的bantime可能变化
+	s.banTimeMu.Lock()
+	s.banTimes = make(map[string]time.Duration)
+	s.banTimeMu.Unlock()
+	return nil
+}
+
+// GetBanTime 获取jail的bantime，-1秒表示永久封禁，结果按jail缓存
+func (s *Fail2BanService) GetBanTime(jail string) (time.Duration, error) {
+	s.banTimeMu.Lock()
+	banTime, cached := s.banTimes[jail]
+	s.banTimeMu.Unlock()
+	if cached {
+		return banTime, nil
+	}
+
+	output, err := s.execFail2banCommand("get", jail, "bantime")
+	if err != nil {
+		return 0, fmt.Errorf("failed to get bantime of jail %s: %w", jail, err)
+	}
+	seconds, err := strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected bantime of jail %s: %q", jail, strings.TrimSpace(string(output)))
+	}
+	banTime = time.Duration(seconds) * time.Second
+
+	s.banTimeMu.Lock()
+	s.banTimes[jail] = banTime
+	s.banTimeMu.Unlock()
+	return banTime, nil
+}
+
+// GetIgnoreIPs 获取jail的ignoreip列表
+func (s *Fail2BanService) GetIgnoreIPs(jail string) ([]string, error) {
+	output, err := s.execFail2banCommand("get", jail, "ignoreip")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get ignoreip of jail %s: %w", jail, err)
+	}
+
+	// 输出格式:
+	// These IP addresses/networks are ignored:
+	// |- 127.0.0.1/8
+	// `- 192.168.1.0/24
+	ips := []string{}
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "|-") || strings.HasPrefix(line, "`-") {
+			ips = append(ips, strings.TrimSpace(line[2:]))
+		}
+	}
+
+	return ips, nil
+}
 
+// AddIgnoreIP 添加IP或网段到jail的ignoreip
+func (s *Fail2BanService) AddIgnoreIP(jail, ip string) error {
+	output, err := s.execFail2banCommandCombined("set", jail, "addignoreip", ip)
+	if err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"jail":   jail,
+			"ip":     ip,
+			"output": string(output),
+		}).Error("Failed to add ignoreip")
+		return fmt.Errorf("failed to add ignoreip %s to jail %s: %w", ip, jail, err)
+	}
+	return nil
+}
+
+// DelIgnoreIP 从jail的ignoreip中移除IP或网段
+func (s *Fail2BanService) DelIgnoreIP(jail, ip string) error {
+	output, err := s.execFail2banCommandCombined("set", jail, "delignoreip", ip)
+	if err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"jail":   jail,
+			"ip":     ip,
+			"output": string(output),
+		}).Error("Failed to delete ignoreip")
+		return fmt.Errorf("failed to delete ignoreip %s from jail %s: %w", ip, jail, err)
+	}
 	return nil
 }
 
@@ -410,51 +527,3 @@ func (s *Fail2BanService) GetSystemInfo() (*model.SystemInfoResponse, error) {
 	return info, nil
 }
 
-// ParseLogFile 解析日志文件
-func (s *Fail2BanService) ParseLogFile(filePath string, lines int) ([]string, error) {
-	cmd := exec.Command("tail", "-n", strconv.Itoa(lines), filePath)
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("failed to read log file %s: %w", filePath, err)
-	}
-
-	logLines := strings.Split(string(output), "\n")
-	var filteredLines []string
-
-	// 过滤掉空行
-	for _, line := range logLines {
-		if strings.TrimSpace(line) != "" {
-			filteredLines = append(filteredLines, line)
-		}
-	}
-
-	return filteredLines, nil
-}
-
-// SearchLogs 搜索日志
-func (s *Fail2BanService) SearchLogs(filePath, pattern string, lines int) ([]string, error) {
-	cmd := exec.Command("grep", "-i", pattern, filePath)
-	if lines > 0 {
-		cmd = exec.Command("sh", "-c", fmt.Sprintf("grep -i '%s' '%s' | tail -n %d", pattern, filePath, lines))
-	}
-	
-	output, err := cmd.Output()
-	if err != nil {
-		// grep 返回1表示没有找到匹配，这不是错误
-		if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
-			return []string{}, nil
-		}
-		return nil, fmt.Errorf("failed to search logs: %w", err)
-	}
-
-	logLines := strings.Split(string(output), "\n")
-	var filteredLines []string
-
-	for _, line := range logLines {
-		if strings.TrimSpace(line) != "" {
-			filteredLines = append(filteredLines, line)
-		}
-	}
-
-	return filteredLines, nil
-}
\ No newline at end of file
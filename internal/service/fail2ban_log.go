@@ -0,0 +1,120 @@
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fail2ban日志事件类型
+const (
+	Fail2BanEventFound         = "found"
+	Fail2BanEventBan           = "ban"
+	Fail2BanEventUnban         = "unban"
+	Fail2BanEventRestoreBan    = "restore_ban"
+	Fail2BanEventIncreaseBan   = "increase_ban"
+	Fail2BanEventAlreadyBanned = "already_banned"
+	Fail2BanEventJailStart     = "jail_start"
+	Fail2BanEventJailStop      = "jail_stop"
+	Fail2BanEventServerStart   = "server_start"
+	Fail2BanEventServerStop    = "server_stop"
+	Fail2BanEventError         = "error"
+	Fail2BanEventInfo          = "info"
+)
+
+// Fail2BanLogEntry fail2ban.log中的一条记录
+type Fail2BanLogEntry struct {
+	Timestamp time.Time  `json:"timestamp"`
+	Logger    string     `json:"logger"` // fail2ban.actions / fail2ban.filter 等
+	PID       int        `json:"pid"`
+	Level     string     `json:"level"`
+	Jail      string     `json:"jail,omitempty"`
+	Event     string     `json:"event"`
+	IP        string     `json:"ip,omitempty"`
+	BanUntil  *time.Time `json:"ban_until,omitempty"` // Increase Ban 给出的封禁结束时间
+	Message   string     `json:"message"`
+}
+
+// fail2banLogLineRegex 2024-01-02 15:04:05,123 fail2ban.actions [1234]: NOTICE  [sshd] Ban 1.2.3.4
+var fail2banLogLineRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})(?:,(\d+))?\s+(\S+)\s+\[(\d+)\]:\s+([A-Z]+)\s+(?:\[([^\]]+)\]\s+)?(.*)$`)
+
+// fail2banEventPatterns 日志消息对应的事件类型
+var fail2banEventPatterns = []struct {
+	event string
+	re    *regexp.Regexp
+}{
+	{Fail2BanEventFound, regexp.MustCompile(`^Found (\S+)`)},
+	{Fail2BanEventRestoreBan, regexp.MustCompile(`^Restore Ban (\S+)`)},
+	{Fail2BanEventIncreaseBan, regexp.MustCompile(`^Increase Ban (\S+)`)},
+	{Fail2BanEventBan, regexp.MustCompile(`^Ban (\S+)`)},
+	{Fail2BanEventUnban, regexp.MustCompile(`^Unban (\S+)`)},
+	{Fail2BanEventAlreadyBanned, regexp.MustCompile(`^(\S+) already banned`)},
+}
+
+// fail2banJailStateRegex Jail 'sshd' started / Jail 'sshd' stopped
+var fail2banJailStateRegex = regexp.MustCompile(`^Jail '([^']+)' (started|stopped)`)
+
+// fail2banBanUntilRegex Increase Ban 1.2.3.4 (2 # 2:00:00 -> 2024-01-02 17:04:05)
+var fail2banBanUntilRegex = regexp.MustCompile(`-> (\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})`)
+
+// parseFail2BanLogLine 解析fail2ban日志行，格式不符时返回nil
+func parseFail2BanLogLine(line string) *Fail2BanLogEntry {
+	matches := fail2banLogLineRegex.FindStringSubmatch(line)
+	if matches == nil {
+		return nil
+	}
+
+	timestamp, err := time.ParseInLocation("2006-01-02 15:04:05", matches[1], time.Local)
+	if err != nil {
+		return nil
+	}
+	if matches[2] != "" {
+		if ms, err := strconv.Atoi(matches[2]); err == nil {
+			timestamp = timestamp.Add(time.Duration(ms) * time.Millisecond)
+		}
+	}
+	pid, _ := strconv.Atoi(matches[4])
+
+	entry := &Fail2BanLogEntry{
+		Timestamp: timestamp,
+		Logger:    matches[3],
+		PID:       pid,
+		Level:     matches[5],
+		Jail:      matches[6],
+		Message:   strings.TrimSpace(matches[7]),
+		Event:     Fail2BanEventInfo,
+	}
+
+	for _, pattern := range fail2banEventPatterns {
+		if m := pattern.re.FindStringSubmatch(entry.Message); m != nil {
+			entry.Event = pattern.event
+			entry.IP = m[1]
+			if until := fail2banBanUntilRegex.FindStringSubmatch(entry.Message); until != nil {
+				if t, err := time.ParseInLocation("2006-01-02 15:04:05", until[1], time.Local); err == nil {
+					entry.BanUntil = &t
+				}
+			}
+			return entry
+		}
+	}
+
+	switch {
+	case fail2banJailStateRegex.MatchString(entry.Message):
+		m := fail2banJailStateRegex.FindStringSubmatch(entry.Message)
+		entry.Jail = m[1]
+		if m[2] == "started" {
+			entry.Event = Fail2BanEventJailStart
+		} else {
+			entry.Event = Fail2BanEventJailStop
+		}
+	case strings.HasPrefix(entry.Message, "Starting Fail2ban"):
+		entry.Event = Fail2BanEventServerStart
+	case strings.HasPrefix(entry.Message, "Exiting Fail2ban"):
+		entry.Event = Fail2BanEventServerStop
+	case entry.Level == "ERROR" || entry.Level == "CRITICAL":
+		entry.Event = Fail2BanEventError
+	}
+
+	return entry
+}
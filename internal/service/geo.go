@@ -0,0 +1,392 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/ipset"
+
+	"github.com/oschwald/geoip2-golang/v2"
+)
+
+const geoReloadCheckInterval = time.Minute
+
+// GeoInfo IP的地理位置和ASN信息
+type GeoInfo struct {
+	CountryCode string   `json:"country_code,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	Region      string   `json:"region,omitempty"`
+	City        string   `json:"city,omitempty"`
+	Latitude    *float64 `json:"latitude,omitempty"`
+	Longitude   *float64 `json:"longitude,omitempty"`
+	TimeZone    string   `json:"time_zone,omitempty"`
+	ASN         uint     `json:"asn,omitempty"`
+	ASOrg       string   `json:"as_org,omitempty"`
+	Network     string   `json:"network,omitempty"`
+}
+
+// GeoDatabaseStatus GeoIP数据库加载状态
+type GeoDatabaseStatus struct {
+	Path      string     `json:"path"`
+	Loaded    bool       `json:"loaded"`
+	Type      string     `json:"type,omitempty"`
+	BuildTime *time.Time `json:"build_time,omitempty"`
+	LoadedAt  *time.Time `json:"loaded_at,omitempty"`
+}
+
+// GeoStatus GeoIP服务状态
+type GeoStatus struct {
+	City      GeoDatabaseStatus `json:"city"`
+	ASN       GeoDatabaseStatus `json:"asn"`
+	CacheSize int               `json:"cache_size"`
+	CacheCap  int               `json:"cache_capacity"`
+}
+
+// geoDatabase 一个已加载的mmdb文件
+type geoDatabase struct {
+	path     string
+	reader   *geoip2.Reader
+	modTime  time.Time
+	size     int64
+	loadedAt time.Time
+}
+
+// GeoService 离线GeoIP服务，从GeoLite2 City/ASN数据库查询IP信息
+// 查询结果缓存在LRU中，数据库文件被替换后自动重新加载
+type GeoService struct {
+	config config.GeoIPConfig
+
+	// reloadMu 串行化定期检测和手动触发的重新加载，避免并发打开同一文件后泄漏reader
+	reloadMu sync.Mutex
+
+	mu   sync.RWMutex
+	city *geoDatabase
+	asn  *geoDatabase
+
+	cache *geoCache
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewGeoService 创建GeoIP服务，数据库文件不存在时服务仍可使用，查询结果为空
+func NewGeoService(cfg *config.Config) *GeoService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &GeoService{
+		config: cfg.GeoIP,
+		cache:  newGeoCache(cfg.GeoIP.CacheSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	if err := s.Reload(); err != nil {
+		log.Printf("加载GeoIP数据库失败: %v", err)
+	}
+
+	return s
+}
+
+// Start 启动数据库文件变更检测
+func (s *GeoService) Start() {
+	s.wg.Add(1)
+	go s.watch()
+}
+
+// Stop 停止文件检测并关闭数据库
+func (s *GeoService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, db := range []*geoDatabase{s.city, s.asn} {
+		if db != nil {
+			db.reader.Close()
+		}
+	}
+	s.city, s.asn = nil, nil
+}
+
+// watch 定期检查数据库文件是否被替换
+func (s *GeoService) watch() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(geoReloadCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(); err != nil {
+				log.Printf("重新加载GeoIP数据库失败: %v", err)
+			}
+		}
+	}
+}
+
+// Reload 重新加载发生变化的数据库文件，替换成功后清空查询缓存
+func (s *GeoService) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	s.mu.RLock()
+	city, asn := s.city, s.asn
+	s.mu.RUnlock()
+
+	newCity, cityErr := reloadGeoDatabase(s.config.CityDB, city)
+	newASN, asnErr := reloadGeoDatabase(s.config.ASNDB, asn)
+
+	if newCity != city || newASN != asn {
+		s.mu.Lock()
+		s.city, s.asn = newCity, newASN
+		s.mu.Unlock()
+		s.cache.clear()
+
+		// 旧的reader在切换后关闭，查询都在读锁内完成，此时已没有使用者
+		if city != nil && newCity != city {
+			city.reader.Close()
+		}
+		if asn != nil && newASN != asn {
+			asn.reader.Close()
+		}
+	}
+
+	if cityErr != nil {
+		return cityErr
+	}
+	return asnErr
+}
+
+// reloadGeoDatabase 文件变化时打开新数据库，未变化时返回原数据库，文件被删除时返回nil
+func reloadGeoDatabase(path string, current *geoDatabase) (*geoDatabase, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if current != nil {
+				log.Printf("GeoIP数据库 %s 已被删除", path)
+			}
+			return nil, nil
+		}
+		return current, err
+	}
+
+	if current != nil && current.modTime.Equal(stat.ModTime()) && current.size == stat.Size() {
+		return current, nil
+	}
+
+	reader, err := geoip2.Open(path)
+	if err != nil {
+		// 新文件可能还在写入，保留原数据库等待下次检查
+		return current, fmt.Errorf("打开GeoIP数据库 %s 失败: %w", path, err)
+	}
+
+	log.Printf("已加载GeoIP数据库 %s (%s)", path, reader.Metadata().DatabaseType)
+	return &geoDatabase{
+		path:     path,
+		reader:   reader,
+		modTime:  stat.ModTime(),
+		size:     stat.Size(),
+		loadedAt: time.Now(),
+	}, nil
+}
+
+// Available 是否至少加载了一个数据库
+func (s *GeoService) Available() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.city != nil || s.asn != nil
+}
+
+// Lookup 查询IP的地理位置和ASN信息，没有数据时返回nil
+// 参数为网段（聚合后的IPv6威胁）时使用网段起始地址查询
+func (s *GeoService) Lookup(ip string) (*GeoInfo, error) {
+	prefix, err := ipset.ParsePrefix(ip)
+	if err != nil {
+		return nil, fmt.Errorf("无效的IP地址: %s", ip)
+	}
+	addr := prefix.Addr()
+
+	if info, ok := s.cache.get(addr); ok {
+		return info, nil
+	}
+
+	s.mu.RLock()
+	info, err := s.lookup(addr)
+	s.mu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+
+	s.cache.put(addr, info)
+	return info, nil
+}
+
+// lookup 在已加载的数据库中查询，调用方需持有读锁
+func (s *GeoService) lookup(addr netip.Addr) (*GeoInfo, error) {
+	var info *GeoInfo
+
+	if s.city != nil {
+		record, err := s.city.reader.City(addr)
+		if err != nil {
+			return nil, fmt.Errorf("查询GeoIP城市数据失败: %w", err)
+		}
+		if record.HasData() {
+			info = &GeoInfo{
+				CountryCode: record.Country.ISOCode,
+				Country:     record.Country.Names.English,
+				City:        record.City.Names.English,
+				Latitude:    record.Location.Latitude,
+				Longitude:   record.Location.Longitude,
+				TimeZone:    record.Location.TimeZone,
+				Network:     record.Traits.Network.String(),
+			}
+			if len(record.Subdivisions) > 0 {
+				info.Region = record.Subdivisions[0].Names.English
+			}
+		}
+	}
+
+	if s.asn != nil {
+		record, err := s.asn.reader.ASN(addr)
+		if err != nil {
+			return nil, fmt.Errorf("查询GeoIP ASN数据失败: %w", err)
+		}
+		if record.HasData() {
+			if info == nil {
+				info = &GeoInfo{Network: record.Network.String()}
+			}
+			info.ASN = record.AutonomousSystemNumber
+			info.ASOrg = record.AutonomousSystemOrganization
+		}
+	}
+
+	return info, nil
+}
+
+// CountryOf 获取IP的国家名称，查询不到时返回空字符串
+func (s *GeoService) CountryOf(ip string) string {
+	info, err := s.Lookup(ip)
+	if err != nil || info == nil {
+		return ""
+	}
+	if info.Country != "" {
+		return info.Country
+	}
+	return info.CountryCode
+}
+
+// Status 获取数据库加载状态
+func (s *GeoService) Status() GeoStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return GeoStatus{
+		City:      geoDatabaseStatus(s.config.CityDB, s.city),
+		ASN:       geoDatabaseStatus(s.config.ASNDB, s.asn),
+		CacheSize: s.cache.len(),
+		CacheCap:  s.cache.capacity,
+	}
+}
+
+// geoDatabaseStatus 生成单个数据库的状态
+func geoDatabaseStatus(path string, db *geoDatabase) GeoDatabaseStatus {
+	status := GeoDatabaseStatus{Path: path}
+	if db == nil {
+		return status
+	}
+
+	metadata := db.reader.Metadata()
+	buildTime := time.Unix(int64(metadata.BuildEpoch), 0)
+	loadedAt := db.loadedAt
+
+	status.Loaded = true
+	status.Type = metadata.DatabaseType
+	status.BuildTime = &buildTime
+	status.LoadedAt = &loadedAt
+	return status
+}
+
+// geoCache 并发安全的LRU缓存，也缓存没有数据的结果
+type geoCache struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[netip.Addr]*list.Element
+	order    *list.List
+}
+
+type geoCacheEntry struct {
+	addr netip.Addr
+	info *GeoInfo
+}
+
+func newGeoCache(capacity int) *geoCache {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &geoCache{
+		capacity: capacity,
+		items:    make(map[netip.Addr]*list.Element),
+		order:    list.New(),
+	}
+}
+
+func (c *geoCache) get(addr netip.Addr) (*GeoInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[addr]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*geoCacheEntry).info, true
+}
+
+func (c *geoCache) put(addr netip.Addr, info *GeoInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[addr]; ok {
+		elem.Value.(*geoCacheEntry).info = info
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.items[addr] = c.order.PushFront(&geoCacheEntry{addr: addr, info: info})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*geoCacheEntry).addr)
+	}
+}
+
+func (c *geoCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[netip.Addr]*list.Element)
+	c.order.Init()
+}
+
+func (c *geoCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
@@ -0,0 +1,611 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/model"
+
+	"github.com/oschwald/maxminddb-golang/v2"
+	"gorm.io/gorm"
+)
+
+// GeoIP策略的匹配类型和动作
+const (
+	GeoPolicyMatchCountry = "country"
+	GeoPolicyMatchASN     = "asn"
+
+	GeoPolicyActionBan   = "ban"   // 命中后立即封禁
+	GeoPolicyActionAlert = "alert" // 命中后只记录告警，不自动封禁
+
+	// geoPolicyPrefix 封禁记录和扫描决策中GeoIP策略名称的前缀
+	geoPolicyPrefix = "geo:"
+
+	geoPolicyMaxMatchIPs = 100
+)
+
+var (
+	ErrGeoPolicyNotFound = errors.New("geo policy not found")
+	ErrInvalidGeoPolicy  = errors.New("invalid geo policy")
+
+	// 策略名称会用于jail和ipset名称，ipset名称最长31个字符
+	geoPolicyNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,20}$`)
+	countryCodePattern   = regexp.MustCompile(`^[A-Z]{2}$`)
+)
+
+// GeoPolicyMatches 单个策略命中当前威胁的统计
+type GeoPolicyMatches struct {
+	PolicyID   uint     `json:"policy_id"`
+	Name       string   `json:"name"`
+	Action     string   `json:"action"`
+	Enabled    bool     `json:"enabled"`
+	GeoMatched int      `json:"geo_matched"` // 国家/ASN命中的威胁数
+	Matched    int      `json:"matched"`     // 同时满足阈值的威胁数
+	IPs        []string `json:"ips"`         // 满足阈值的IP，最多100个
+}
+
+// GeoIPSetResult ipset jail的生成结果
+type GeoIPSetResult struct {
+	Policy       string `json:"policy"`
+	Jail         string `json:"jail"`
+	IPv4Networks int    `json:"ipv4_networks"`
+	IPv6Networks int    `json:"ipv6_networks"`
+	SetFile      string `json:"set_file"`
+	ActionFile   string `json:"action_file"`
+	FilterFile   string `json:"filter_file"`
+	JailFile     string `json:"jail_file"`
+	Reloaded     bool   `json:"reloaded"`
+	ReloadError  string `json:"reload_error,omitempty"`
+}
+
+// GeoPolicyService 按国家/ASN匹配的封禁策略服务
+// 启用的策略缓存在内存中，每次修改后重新加载
+type GeoPolicyService struct {
+	config          *config.Config
+	db              *gorm.DB
+	geoService      *GeoService
+	fail2banService *Fail2BanService
+
+	mu       sync.RWMutex
+	policies []model.GeoPolicy // 启用的策略，按优先级排序
+}
+
+// NewGeoPolicyService 创建GeoIP策略服务
+func NewGeoPolicyService(cfg *config.Config, db *gorm.DB, geoService *GeoService, fail2banService *Fail2BanService) *GeoPolicyService {
+	return &GeoPolicyService{
+		config:          cfg,
+		db:              db,
+		geoService:      geoService,
+		fail2banService: fail2banService,
+	}
+}
+
+// Start 加载策略，需要在数据库迁移完成后调用
+func (s *GeoPolicyService) Start() error {
+	return s.reload()
+}
+
+// reload 从数据库重新加载启用的策略
+func (s *GeoPolicyService) reload() error {
+	var policies []model.GeoPolicy
+	if err := s.db.Where("enabled = ?", true).Order("priority ASC, id ASC").Find(&policies).Error; err != nil {
+		return fmt.Errorf("加载GeoIP策略失败: %w", err)
+	}
+
+	s.mu.Lock()
+	s.policies = policies
+	s.mu.Unlock()
+
+	log.Printf("已加载 %d 条GeoIP策略", len(policies))
+	return nil
+}
+
+// ListPolicies 获取所有策略
+func (s *GeoPolicyService) ListPolicies() ([]model.GeoPolicy, error) {
+	var policies []model.GeoPolicy
+	if err := s.db.Order("priority ASC, id ASC").Find(&policies).Error; err != nil {
+		return nil, fmt.Errorf("查询GeoIP策略失败: %w", err)
+	}
+	return policies, nil
+}
+
+// GetPolicy 获取单个策略
+func (s *GeoPolicyService) GetPolicy(id uint) (*model.GeoPolicy, error) {
+	var policy model.GeoPolicy
+	if err := s.db.First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrGeoPolicyNotFound
+		}
+		return nil, fmt.Errorf("查询GeoIP策略失败: %w", err)
+	}
+	return &policy, nil
+}
+
+// CreatePolicy 创建策略
+func (s *GeoPolicyService) CreatePolicy(policy *model.GeoPolicy) error {
+	if err := normalizeGeoPolicy(policy); err != nil {
+		return err
+	}
+
+	policy.ID = 0
+	if err := s.db.Create(policy).Error; err != nil {
+		return fmt.Errorf("创建GeoIP策略失败: %w", err)
+	}
+
+	return s.reload()
+}
+
+// UpdatePolicy 更新策略，名称变化或关闭ipset模式时移除原有的ipset jail
+func (s *GeoPolicyService) UpdatePolicy(id uint, policy *model.GeoPolicy) (*model.GeoPolicy, error) {
+	existing, err := s.GetPolicy(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := normalizeGeoPolicy(policy); err != nil {
+		return nil, err
+	}
+
+	removeIPSet := existing.IPSet && (!policy.IPSet || !policy.Enabled || policy.Name != existing.Name)
+	oldName := existing.Name
+
+	policy.ID = existing.ID
+	policy.CreatedAt = existing.CreatedAt
+	if err := s.db.Save(policy).Error; err != nil {
+		return nil, fmt.Errorf("更新GeoIP策略失败: %w", err)
+	}
+
+	if removeIPSet {
+		if err := s.removeIPSet(oldName); err != nil {
+			log.Printf("移除GeoIP策略 %s 的ipset jail失败: %v", oldName, err)
+		}
+	}
+
+	return policy, s.reload()
+}
+
+// DeletePolicy 删除策略及其ipset jail
+func (s *GeoPolicyService) DeletePolicy(id uint) error {
+	policy, err := s.GetPolicy(id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Delete(&model.GeoPolicy{}, id).Error; err != nil {
+		return fmt.Errorf("删除GeoIP策略失败: %w", err)
+	}
+
+	if policy.IPSet {
+		if err := s.removeIPSet(policy.Name); err != nil {
+			log.Printf("移除GeoIP策略 %s 的ipset jail失败: %v", policy.Name, err)
+		}
+	}
+
+	return s.reload()
+}
+
+// normalizeGeoPolicy 校验并规范化策略字段
+func normalizeGeoPolicy(policy *model.GeoPolicy) error {
+	policy.Name = strings.TrimSpace(policy.Name)
+	if !geoPolicyNamePattern.MatchString(policy.Name) {
+		return invalidGeoPolicy("策略名称只能包含字母、数字、下划线和连字符，最长20个字符")
+	}
+
+	policy.MatchType = strings.ToLower(strings.TrimSpace(policy.MatchType))
+	values := make([]string, 0, len(policy.Values))
+	seen := make(map[string]bool)
+	for _, value := range policy.Values {
+		value = strings.TrimSpace(value)
+		switch policy.MatchType {
+		case GeoPolicyMatchCountry:
+			value = strings.ToUpper(value)
+			if !countryCodePattern.MatchString(value) {
+				return invalidGeoPolicy("无效的国家代码: %s", value)
+			}
+		case GeoPolicyMatchASN:
+			value = strings.TrimPrefix(strings.ToUpper(value), "AS")
+			asn, err := strconv.ParseUint(value, 10, 32)
+			if err != nil || asn == 0 {
+				return invalidGeoPolicy("无效的ASN: %s", value)
+			}
+			value = strconv.FormatUint(asn, 10)
+		default:
+			return invalidGeoPolicy("未知的匹配类型: %s", policy.MatchType)
+		}
+		if !seen[value] {
+			seen[value] = true
+			values = append(values, value)
+		}
+	}
+	if len(values) == 0 {
+		return invalidGeoPolicy("至少需要一个国家代码或ASN")
+	}
+	policy.Values = values
+
+	policy.Action = strings.ToLower(strings.TrimSpace(policy.Action))
+	if policy.Action == "" {
+		policy.Action = GeoPolicyActionBan
+	}
+	if policy.Action != GeoPolicyActionBan && policy.Action != GeoPolicyActionAlert {
+		return invalidGeoPolicy("未知的策略动作: %s", policy.Action)
+	}
+	if policy.IPSet && policy.Action != GeoPolicyActionBan {
+		return invalidGeoPolicy("只有ban动作的策略可以生成ipset")
+	}
+
+	if policy.MinSSHAttempts < 0 || policy.MinNginxAttempts < 0 || policy.MinThreatScore < 0 {
+		return invalidGeoPolicy("阈值不能为负数")
+	}
+
+	return nil
+}
+
+// invalidGeoPolicy 生成策略校验错误
+func invalidGeoPolicy(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidGeoPolicy, fmt.Sprintf(format, args...))
+}
+
+// Match 按优先级返回第一个命中威胁的启用策略，未命中返回nil
+func (s *GeoPolicyService) Match(threat *IPThreatLevel) *model.GeoPolicy {
+	s.mu.RLock()
+	policies := s.policies
+	s.mu.RUnlock()
+
+	if len(policies) == 0 || s.geoService == nil {
+		return nil
+	}
+
+	info, err := s.geoService.Lookup(threat.IP)
+	if err != nil || info == nil {
+		return nil
+	}
+
+	for i := range policies {
+		if geoPolicyMatchesGeo(&policies[i], info) && geoPolicyMatchesThreat(&policies[i], threat) {
+			policy := policies[i]
+			return &policy
+		}
+	}
+	return nil
+}
+
+// geoPolicyMatchesGeo 判断IP的国家/ASN是否命中策略
+func geoPolicyMatchesGeo(policy *model.GeoPolicy, info *GeoInfo) bool {
+	var value string
+	switch policy.MatchType {
+	case GeoPolicyMatchCountry:
+		value = info.CountryCode
+	case GeoPolicyMatchASN:
+		if info.ASN == 0 {
+			return false
+		}
+		value = strconv.FormatUint(uint64(info.ASN), 10)
+	}
+	return value != "" && contains(policy.Values, value)
+}
+
+// geoPolicyMatchesThreat 判断威胁是否达到策略阈值，未设置的阈值不参与判断
+func geoPolicyMatchesThreat(policy *model.GeoPolicy, threat *IPThreatLevel) bool {
+	if policy.MinSSHAttempts > 0 && threat.SSHAttempts < policy.MinSSHAttempts {
+		return false
+	}
+	if policy.MinNginxAttempts > 0 && threat.NginxAttempts < policy.MinNginxAttempts {
+		return false
+	}
+	if policy.MinThreatScore > 0 && threat.ThreatScore < policy.MinThreatScore {
+		return false
+	}
+	return true
+}
+
+// MatchCounts 统计每个策略（包括未启用的）命中当前威胁的数量
+func (s *GeoPolicyService) MatchCounts(threats map[string]*IPThreatLevel) ([]GeoPolicyMatches, error) {
+	policies, err := s.ListPolicies()
+	if err != nil {
+		return nil, err
+	}
+
+	geoInfos := make(map[string]*GeoInfo, len(threats))
+	if s.geoService != nil {
+		for ip := range threats {
+			if info, err := s.geoService.Lookup(ip); err == nil && info != nil {
+				geoInfos[ip] = info
+			}
+		}
+	}
+
+	matches := make([]GeoPolicyMatches, 0, len(policies))
+	for i := range policies {
+		policy := &policies[i]
+		match := GeoPolicyMatches{
+			PolicyID: policy.ID,
+			Name:     policy.Name,
+			Action:   policy.Action,
+			Enabled:  policy.Enabled,
+			IPs:      []string{},
+		}
+
+		for ip, threat := range threats {
+			info, ok := geoInfos[ip]
+			if !ok || !geoPolicyMatchesGeo(policy, info) {
+				continue
+			}
+			match.GeoMatched++
+			if geoPolicyMatchesThreat(policy, threat) {
+				match.Matched++
+				match.IPs = append(match.IPs, ip)
+			}
+		}
+
+		sort.Strings(match.IPs)
+		if len(match.IPs) > geoPolicyMaxMatchIPs {
+			match.IPs = match.IPs[:geoPolicyMaxMatchIPs]
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, nil
+}
+
+// GenerateIPSet 根据GeoIP数据库生成覆盖整个国家/ASN的ipset和对应的jail，并重新加载fail2ban
+func (s *GeoPolicyService) GenerateIPSet(id uint) (*GeoIPSetResult, error) {
+	policy, err := s.GetPolicy(id)
+	if err != nil {
+		return nil, err
+	}
+	if !policy.IPSet || !policy.Enabled {
+		return nil, invalidGeoPolicy("策略 %s 未启用ipset模式", policy.Name)
+	}
+
+	ipv4, ipv6, err := s.collectNetworks(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := s.ipsetPaths(policy.Name)
+	result := &GeoIPSetResult{
+		Policy:       policy.Name,
+		Jail:         geoIPSetJailName(policy.Name),
+		IPv4Networks: len(ipv4),
+		IPv6Networks: len(ipv6),
+		SetFile:      paths.set,
+		ActionFile:   paths.action,
+		FilterFile:   paths.filter,
+		JailFile:     paths.jail,
+	}
+
+	files := []struct {
+		path    string
+		content string
+	}{
+		{paths.set, buildIPSetRestore(policy.Name, ipv4, ipv6)},
+		{paths.action, buildGeoIPSetAction(policy, paths.set)},
+		{paths.filter, geoIPSetFilter},
+		{paths.jail, s.buildGeoIPSetJail(policy)},
+	}
+	for _, file := range files {
+		if err := writeFileAtomic(file.path, []byte(file.content)); err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("已生成GeoIP策略 %s 的ipset: IPv4网段 %d 个, IPv6网段 %d 个", policy.Name, len(ipv4), len(ipv6))
+
+	if err := s.fail2banService.Reload(); err != nil {
+		result.ReloadError = err.Error()
+	} else {
+		result.Reloaded = true
+	}
+
+	return result, nil
+}
+
+// collectNetworks 遍历GeoIP数据库，收集命中策略的所有网段
+func (s *GeoPolicyService) collectNetworks(policy *model.GeoPolicy) ([]netip.Prefix, []netip.Prefix, error) {
+	dbPath := s.config.GeoIP.CityDB
+	if policy.MatchType == GeoPolicyMatchASN {
+		dbPath = s.config.GeoIP.ASNDB
+	}
+
+	reader, err := maxminddb.Open(dbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开GeoIP数据库 %s 失败: %w", dbPath, err)
+	}
+	defer reader.Close()
+
+	var ipv4, ipv6 []netip.Prefix
+	for network := range reader.Networks(maxminddb.SkipEmptyValues()) {
+		var value string
+		switch policy.MatchType {
+		case GeoPolicyMatchCountry:
+			err = network.DecodePath(&value, "country", "iso_code")
+		case GeoPolicyMatchASN:
+			var asn uint
+			err = network.DecodePath(&asn, "autonomous_system_number")
+			value = strconv.FormatUint(uint64(asn), 10)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取GeoIP数据库 %s 失败: %w", dbPath, err)
+		}
+		if !contains(policy.Values, value) {
+			continue
+		}
+
+		prefix := network.Prefix()
+		if prefix.Addr().Is4() {
+			ipv4 = append(ipv4, prefix)
+		} else {
+			ipv6 = append(ipv6, prefix)
+		}
+	}
+
+	return ipv4, ipv6, nil
+}
+
+// removeIPSet 删除策略的ipset jail文件并重新加载fail2ban，jail停止时会清理防火墙规则
+func (s *GeoPolicyService) removeIPSet(name string) error {
+	paths := s.ipsetPaths(name)
+	removed := false
+	for _, path := range []string{paths.jail, paths.action, paths.set} {
+		if err := os.Remove(path); err == nil {
+			removed = true
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("删除文件 %s 失败: %w", path, err)
+		}
+	}
+
+	if !removed {
+		return nil
+	}
+	return s.fail2banService.Reload()
+}
+
+type geoIPSetPaths struct {
+	set    string
+	action string
+	filter string
+	jail   string
+}
+
+// ipsetPaths 策略ipset相关文件在fail2ban配置目录中的位置
+func (s *GeoPolicyService) ipsetPaths(name string) geoIPSetPaths {
+	root := s.config.Fail2Ban.ConfigPath
+	jail := geoIPSetJailName(name)
+	return geoIPSetPaths{
+		set:    filepath.Join(root, "geo", name+".ipset"),
+		action: filepath.Join(root, "action.d", jail+".conf"),
+		filter: filepath.Join(root, "filter.d", "geo-ipset.conf"),
+		jail:   filepath.Join(root, "jail.d", jail+".local"),
+	}
+}
+
+func geoIPSetJailName(name string) string {
+	return "geo-" + name
+}
+
+func geoIPSetNames(name string) (string, string) {
+	return "f2b-geo-" + name + "-4", "f2b-geo-" + name + "-6"
+}
+
+// geoIPSetFilter ipset jail不需要从日志中匹配，使用一个不会命中的过滤器
+const geoIPSetFilter = `# Generated by fail2ban-web. Do not edit.
+# Placeholder filter for GeoIP ipset jails, never matches any line.
+[Definition]
+failregex = ^fail2ban-web geo-ipset placeholder <HOST>$
+ignoreregex =
+`
+
+// buildIPSetRestore 生成ipset restore格式的网段列表，重复加载时先清空原有网段
+func buildIPSetRestore(name string, ipv4, ipv6 []netip.Prefix) string {
+	set4, set6 := geoIPSetNames(name)
+
+	var b strings.Builder
+	for _, set := range []struct {
+		name     string
+		family   string
+		networks []netip.Prefix
+	}{
+		{set4, "inet", ipv4},
+		{set6, "inet6", ipv6},
+	} {
+		maxElem := len(set.networks)
+		if maxElem < 65536 {
+			maxElem = 65536
+		}
+		fmt.Fprintf(&b, "create %s hash:net family %s maxelem %d\n", set.name, set.family, maxElem)
+		fmt.Fprintf(&b, "flush %s\n", set.name)
+		for _, network := range set.networks {
+			fmt.Fprintf(&b, "add %s %s\n", set.name, network)
+		}
+	}
+	return b.String()
+}
+
+// buildGeoIPSetAction 生成加载ipset并添加防火墙规则的fail2ban action
+func buildGeoIPSetAction(policy *model.GeoPolicy, setFile string) string {
+	set4, set6 := geoIPSetNames(policy.Name)
+	return fmt.Sprintf(`# Generated by fail2ban-web. Do not edit.
+# GeoIP policy %s: %s %s
+[Definition]
+actionstart = ipset -exist restore < %s
+              iptables -I INPUT -m set --match-set %s src -j DROP
+              ip6tables -I INPUT -m set --match-set %s src -j DROP
+actionstop = iptables -D INPUT -m set --match-set %s src -j DROP
+             ip6tables -D INPUT -m set --match-set %s src -j DROP
+             ipset destroy %s
+             ipset destroy %s
+actioncheck =
+actionban =
+actionunban =
+`, policy.Name, policy.MatchType, strings.Join(policy.Values, ","),
+		setFile, set4, set6, set4, set6, set4, set6)
+}
+
+// buildGeoIPSetJail 生成使用ipset action的jail配置
+func (s *GeoPolicyService) buildGeoIPSetJail(policy *model.GeoPolicy) string {
+	jail := geoIPSetJailName(policy.Name)
+	return fmt.Sprintf(`# Generated by fail2ban-web. Do not edit.
+[%s]
+enabled = true
+filter = geo-ipset
+logpath = %s
+backend = polling
+action = %s
+`, jail, s.config.Fail2Ban.LogPath, jail)
+}
+
+// writeFileAtomic 先写入临时文件再重命名，避免fail2ban读到写了一半的文件
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("写入文件 %s 失败: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入文件 %s 失败: %w", path, err)
+	}
+	return nil
+}
+
+// resolveBanDecision 先评估GeoIP策略，再使用黑名单和内置策略的结果
+// 返回要执行的策略名称和动作（ban/alert），策略为空表示不处理
+// 告警策略只在黑名单或内置策略本应封禁时生效，用于替代自动封禁
+func (s *IntelligentScanService) resolveBanDecision(threat *IPThreatLevel, builtinPolicy string) (string, string) {
+	if s.ipListService != nil {
+		if match := s.ipListService.MatchDeny(threat.IP); match != nil {
+			builtinPolicy = blocklistPolicyPrefix + match.List
+		}
+	}
+
+	if s.geoPolicyService != nil {
+		if policy := s.geoPolicyService.Match(threat); policy != nil {
+			switch policy.Action {
+			case GeoPolicyActionBan:
+				return geoPolicyPrefix + policy.Name, GeoPolicyActionBan
+			case GeoPolicyActionAlert:
+				if builtinPolicy == "" {
+					return "", ""
+				}
+				return geoPolicyPrefix + policy.Name, GeoPolicyActionAlert
+			}
+		}
+	}
+
+	if builtinPolicy == "" {
+		return "", ""
+	}
+	return builtinPolicy, GeoPolicyActionBan
+}
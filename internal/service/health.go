@@ -0,0 +1,268 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"fail2ban-web/config"
+
+	"gorm.io/gorm"
+)
+
+// 组件和整体的健康状态
+const (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded" // 非关键组件异常，服务仍可使用
+	HealthStatusDown     = "down"
+)
+
+// healthCheckTimeout 单个组件检查的超时时间，fail2ban-client无响应时不阻塞就绪检查
+const healthCheckTimeout = 3 * time.Second
+
+// tlsExpiryWarning 证书剩余有效期少于该时间时标记为降级
+const tlsExpiryWarning = 14 * 24 * time.Hour
+
+// ComponentHealth 单个组件的检查结果
+type ComponentHealth struct {
+	Status    string      `json:"status"`
+	Critical  bool        `json:"critical"` // 关键组件异常时服务未就绪
+	Message   string      `json:"message,omitempty"`
+	LatencyMS int64       `json:"latency_ms"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// ReadinessReport 就绪检查结果
+type ReadinessReport struct {
+	Status     string                      `json:"status"`
+	Ready      bool                        `json:"ready"`
+	CheckedAt  time.Time                   `json:"checked_at"`
+	Components map[string]*ComponentHealth `json:"components"`
+}
+
+// LogSourceHealth 日志源的可读状态
+type LogSourceHealth struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Readable bool   `json:"readable"`
+	Error    string `json:"error,omitempty"`
+}
+
+// healthCheck 组件检查，critical为true的组件异常时服务未就绪
+type healthCheck struct {
+	name     string
+	critical bool
+	check    func(ctx context.Context) *ComponentHealth
+}
+
+// HealthService 存活和就绪检查
+// 数据库和智能扫描是关键组件；fail2ban、日志源和GeoIP异常时面板仍可使用，只标记为降级
+type HealthService struct {
+	config             *config.Config
+	db                 *gorm.DB
+	fail2banService    *Fail2BanService
+	logSourceService   *LogSourceService
+	geoService         *GeoService
+	intelligentService *IntelligentScanService
+	tlsService         *TLSService
+	startedAt          time.Time
+}
+
+// NewHealthService 创建健康检查服务
+func NewHealthService(cfg *config.Config, db *gorm.DB, fail2banService *Fail2BanService, logSourceService *LogSourceService, geoService *GeoService, intelligentService *IntelligentScanService, tlsService *TLSService) *HealthService {
+	return &HealthService{
+		config:             cfg,
+		db:                 db,
+		fail2banService:    fail2banService,
+		logSourceService:   logSourceService,
+		geoService:         geoService,
+		intelligentService: intelligentService,
+		tlsService:         tlsService,
+		startedAt:          time.Now(),
+	}
+}
+
+// StartedAt 进程启动时间
+func (s *HealthService) StartedAt() time.Time {
+	return s.startedAt
+}
+
+// Readiness 并发检查所有组件
+func (s *HealthService) Readiness(ctx context.Context) *ReadinessReport {
+	checks := []healthCheck{
+		{name: "database", critical: true, check: s.checkDatabase},
+		{name: "scanner", critical: true, check: s.checkScanner},
+		{name: "fail2ban", check: s.checkFail2ban},
+		{name: "log_sources", check: s.checkLogSources},
+		{name: "geoip", check: s.checkGeoIP},
+	}
+	if s.tlsService.Enabled() {
+		checks = append(checks, healthCheck{name: "tls", check: s.checkTLS})
+	}
+
+	report := &ReadinessReport{
+		Status:     HealthStatusOK,
+		Ready:      true,
+		CheckedAt:  time.Now(),
+		Components: make(map[string]*ComponentHealth, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check healthCheck) {
+			defer wg.Done()
+			result := runHealthCheck(ctx, check)
+			mu.Lock()
+			report.Components[check.name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	for _, component := range report.Components {
+		if component.Status == HealthStatusOK {
+			continue
+		}
+		if component.Critical {
+			report.Status = HealthStatusDown
+			report.Ready = false
+		} else if report.Status == HealthStatusOK {
+			report.Status = HealthStatusDegraded
+		}
+	}
+	return report
+}
+
+// runHealthCheck 执行检查并记录耗时，超时的检查视为失败
+func runHealthCheck(ctx context.Context, check healthCheck) *ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan *ComponentHealth, 1)
+	go func() {
+		done <- check.check(ctx)
+	}()
+
+	var result *ComponentHealth
+	select {
+	case result = <-done:
+	case <-ctx.Done():
+		result = &ComponentHealth{
+			Status:  HealthStatusDown,
+			Message: fmt.Sprintf("检查超时（%s）", healthCheckTimeout),
+		}
+	}
+
+	result.Critical = check.critical
+	result.LatencyMS = time.Since(start).Milliseconds()
+	return result
+}
+
+// checkDatabase 检查数据库连接
+func (s *HealthService) checkDatabase(ctx context.Context) *ComponentHealth {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return &ComponentHealth{Status: HealthStatusDown, Message: err.Error()}
+	}
+	if err := sqlDB.PingContext(ctx); err != nil {
+		return &ComponentHealth{Status: HealthStatusDown, Message: fmt.Sprintf("数据库连接失败: %v", err)}
+	}
+
+	var one int
+	if err := s.db.WithContext(ctx).Raw("SELECT 1").Scan(&one).Error; err != nil {
+		return &ComponentHealth{Status: HealthStatusDown, Message: fmt.Sprintf("数据库查询失败: %v", err)}
+	}
+	return &ComponentHealth{Status: HealthStatusOK, Details: sqlDB.Stats()}
+}
+
+// checkFail2ban 检查fail2ban socket是否存在以及fail2ban-client能否连接
+func (s *HealthService) checkFail2ban(ctx context.Context) *ComponentHealth {
+	socketPath := s.config.Fail2Ban.SocketPath
+	details := map[string]interface{}{"socket": socketPath}
+
+	stat, err := os.Stat(socketPath)
+	if err != nil {
+		return &ComponentHealth{Status: HealthStatusDown, Message: fmt.Sprintf("无法访问fail2ban socket: %v", err), Details: details}
+	}
+	if stat.Mode()&os.ModeSocket == 0 {
+		return &ComponentHealth{Status: HealthStatusDown, Message: "fail2ban socket路径不是socket文件", Details: details}
+	}
+
+	if err := s.fail2banService.TestConnection(); err != nil {
+		return &ComponentHealth{Status: HealthStatusDown, Message: err.Error(), Details: details}
+	}
+	return &ComponentHealth{Status: HealthStatusOK, Details: details}
+}
+
+// checkLogSources 检查各日志源能否读取，任一不可读时为降级
+func (s *HealthService) checkLogSources(ctx context.Context) *ComponentHealth {
+	var sources []LogSourceHealth
+	unreadable := 0
+	for _, source := range s.logSourceService.ListSources() {
+		health := LogSourceHealth{Name: source.Name, Path: source.Path, Readable: true}
+		file, err := s.logSourceService.openSource(source.Name)
+		if err != nil {
+			health.Readable = false
+			health.Error = err.Error()
+			unreadable++
+		} else {
+			file.Close()
+		}
+		sources = append(sources, health)
+	}
+
+	result := &ComponentHealth{Status: HealthStatusOK, Details: sources}
+	if unreadable > 0 {
+		result.Status = HealthStatusDegraded
+		result.Message = fmt.Sprintf("%d 个日志源不可读", unreadable)
+	}
+	return result
+}
+
+// checkGeoIP 检查GeoIP数据库是否已加载
+func (s *HealthService) checkGeoIP(ctx context.Context) *ComponentHealth {
+	status := s.geoService.Status()
+	if !s.geoService.Available() {
+		return &ComponentHealth{Status: HealthStatusDegraded, Message: "未加载GeoIP数据库", Details: status}
+	}
+	return &ComponentHealth{Status: HealthStatusOK, Details: status}
+}
+
+// checkScanner 检查智能扫描的后台循环是否仍在运行
+func (s *HealthService) checkScanner(ctx context.Context) *ComponentHealth {
+	heartbeats := s.intelligentService.LoopHeartbeats()
+	if len(heartbeats) == 0 {
+		return &ComponentHealth{Status: HealthStatusDown, Message: "智能扫描服务未启动"}
+	}
+
+	result := &ComponentHealth{Status: HealthStatusOK, Details: heartbeats}
+	for _, heartbeat := range heartbeats {
+		if heartbeat.Stale {
+			result.Status = HealthStatusDown
+			result.Message = fmt.Sprintf("后台循环 %s 自 %s 起没有心跳", heartbeat.Name, heartbeat.LastBeat.Format(time.RFC3339))
+			break
+		}
+	}
+	return result
+}
+
+// checkTLS 检查HTTPS证书是否过期或即将过期，以及最近一次重新加载是否成功
+func (s *HealthService) checkTLS(ctx context.Context) *ComponentHealth {
+	status := s.tlsService.Status()
+	remaining := time.Until(status.NotAfter)
+
+	switch {
+	case remaining <= 0:
+		return &ComponentHealth{Status: HealthStatusDown, Message: "TLS证书已过期", Details: status}
+	case remaining < tlsExpiryWarning:
+		return &ComponentHealth{Status: HealthStatusDegraded, Message: fmt.Sprintf("TLS证书将在 %d 天内过期", int(remaining.Hours()/24)+1), Details: status}
+	case status.LastError != "":
+		return &ComponentHealth{Status: HealthStatusDegraded, Message: "重新加载TLS证书失败，仍在使用之前的证书", Details: status}
+	}
+	return &ComponentHealth{Status: HealthStatusOK, Details: status}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -18,7 +19,7 @@ import (
 
 // IPThreatLevel 表示IP威胁等级信息
 type IPThreatLevel struct {
-	IP            string    `json:"ip"`
+	IP            string    `json:"ip"`                // IP地址，IPv6为聚合后的网段
 	ThreatScore   int       `json:"threat_score"`      // 威胁评分 0-100
 	SSHAttempts   int       `json:"ssh_attempts"`      // SSH攻击次数
 	NginxAttempts int       `json:"nginx_attempts"`    // Nginx攻击次数
@@ -28,8 +29,10 @@ type IPThreatLevel struct {
 	AttackTypes   []string  `json:"attack_types"`      // 攻击类型
 	IsBanned      bool      `json:"is_banned"`         // 是否已被禁止
 	AutoBanned    bool      `json:"auto_banned"`       // 是否自动禁止
+	WouldBan      bool      `json:"would_ban"`         // 观察模式下本应被封禁
 	Country       string    `json:"country"`           // 国家
 	ISP           string    `json:"isp"`               // ISP
+	Addresses     []string  `json:"addresses,omitempty"` // 聚合网段内出现过的地址
 }
 
 // ScanResult 扫描结果
@@ -52,22 +55,39 @@ type IntelligentScanService struct {
 	jailService       *JailService
 	fail2banService   *Fail2BanService
 	whitelistService  *WhitelistService
+	jobService        *JobService
+	geoService        *GeoService
+	geoPolicyService  *GeoPolicyService
+	ipListService     *IPListService
+	extendedBans      *ExtendedBanJail // 封禁时长超过原jail的bantime时转移到的长期jail
+	eventBus          *EventBus
+	metrics           *Metrics
 	ctx               context.Context
 	cancel            context.CancelFunc
 	wg                sync.WaitGroup
 	suspiciousIPs     map[string]*IPThreatLevel
-	ipMutex           sync.RWMutex // 保护suspiciousIPs的并发访问
-	scanInterval      time.Duration
-	analysisInterval  time.Duration
-	logAnalysisTicker *time.Ticker // 日志分析定时器，便于关闭
+	subnetThreats     map[string]*SubnetThreat // 网段级威胁记录
+	ipMutex           sync.RWMutex // 保护suspiciousIPs和subnetThreats的并发访问
+	settings          scannerSettings // 可热加载的扫描周期、封禁策略阈值和封禁时长
+	observeMode       bool            // 全局观察模式
+	observePolicies   map[string]bool // 处于观察模式的策略
+	observeMutex      sync.RWMutex    // 保护观察模式配置
+	subnetJailMutex   sync.Mutex      // 保护网段jail配置的生成
+	subnetJailReady   bool            // 网段jail配置是否已生成
+	heartbeats        loopHeartbeats  // 后台循环心跳，用于就绪检查
 }
 
 // NewIntelligentScanService 创建新的智能扫描服务实例
 func NewIntelligentScanService(cfg *config.Config, db *gorm.DB, sshService *SSHService, 
-	nginxService *NginxService, jailService *JailService, fail2banService *Fail2BanService) *IntelligentScanService {
+	nginxService *NginxService, jailService *JailService, fail2banService *Fail2BanService, whitelistService *WhitelistService, jobService *JobService, geoService *GeoService, geoPolicyService *GeoPolicyService, ipListService *IPListService, extendedBans *ExtendedBanJail, eventBus *EventBus, metrics *Metrics) *IntelligentScanService {
 	
 	ctx, cancel := context.WithCancel(context.Background())
 	
+	observePolicies := make(map[string]bool)
+	for _, policy := range cfg.Scanner.ObservePolicies {
+		observePolicies[policy] = true
+	}
+	
 	return &IntelligentScanService{
 		config:           cfg,
 		db:               db,
@@ -75,12 +95,21 @@ func NewIntelligentScanService(cfg *config.Config, db *gorm.DB, sshService *SSHS
 		nginxService:     nginxService,
 		jailService:      jailService,
 		fail2banService:  fail2banService,
-		whitelistService: NewWhitelistService(),
+		whitelistService: whitelistService,
+		jobService:       jobService,
+		geoService:       geoService,
+		geoPolicyService: geoPolicyService,
+		ipListService:    ipListService,
+		extendedBans:     extendedBans,
+		eventBus:         eventBus,
+		metrics:          metrics,
 		ctx:              ctx,
 		cancel:           cancel,
 		suspiciousIPs:    make(map[string]*IPThreatLevel),
-		scanInterval:     5 * time.Minute,  // 5分钟扫描一次
-		analysisInterval: 1 * time.Minute,  // 1分钟分析一次
+		subnetThreats:    make(map[string]*SubnetThreat),
+		settings:         newScannerSettings(cfg),
+		observeMode:      cfg.Scanner.ObserveMode,
+		observePolicies:  observePolicies,
 	}
 }
 
@@ -88,6 +117,9 @@ func NewIntelligentScanService(cfg *config.Config, db *gorm.DB, sshService *SSHS
 func (s *IntelligentScanService) Start() {
 	log.Println("智能扫描服务启动...")
 	
+	// 生成jail配置需要重新加载fail2ban，在启动时而不是持有锁封禁时完成
+	s.ensureManagedJails()
+	
 	// 启动日志扫描协程
 	s.wg.Add(1)
 	go s.startLogScanning()
@@ -111,69 +143,35 @@ func (s *IntelligentScanService) Stop() {
 	log.Println("正在停止智能扫描服务...")
 	s.cancel()
 	
-	// 停止日志分析定时器
-	if s.logAnalysisTicker != nil {
-		s.logAnalysisTicker.Stop()
-	}
-	
 	s.wg.Wait()
 	log.Println("智能扫描服务已停止")
 }
 
 // startLogScanning 启动日志扫描
 func (s *IntelligentScanService) startLogScanning() {
-	defer s.wg.Done()
-	
-	ticker := time.NewTicker(s.scanInterval)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			s.scanLogs()
-		}
-	}
+	s.runLoop(ScannerLoopLogScan, func(cfg config.ScannerConfig) time.Duration {
+		return cfg.ScanInterval
+	}, s.scanLogs)
 }
 
 // startIntelligentAnalysis 启动智能分析
 func (s *IntelligentScanService) startIntelligentAnalysis() {
-	defer s.wg.Done()
-	
-	ticker := time.NewTicker(s.analysisInterval)
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			s.analyzeThreats()
-		}
-	}
+	s.runLoop(ScannerLoopThreatAnalysis, func(cfg config.ScannerConfig) time.Duration {
+		return cfg.AnalysisInterval
+	}, s.analyzeThreats)
 }
 
 // startAutoProcessing 启动自动处理
 func (s *IntelligentScanService) startAutoProcessing() {
-	defer s.wg.Done()
-	
-	ticker := time.NewTicker(30 * time.Second) // 30秒检查一次
-	defer ticker.Stop()
-	
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-ticker.C:
-			s.autoProcessThreats()
-		}
-	}
+	s.runLoop(ScannerLoopAutoProcessing, func(cfg config.ScannerConfig) time.Duration {
+		return cfg.AutoProcessInterval
+	}, s.autoProcessThreats)
 }
 
 // scanLogs 扫描日志
 func (s *IntelligentScanService) scanLogs() {
 	log.Println("开始扫描日志...")
+	start := time.Now()
 	
 	// 扫描SSH日志
 	sshCount := s.scanSSHLogs()
@@ -183,6 +181,7 @@ func (s *IntelligentScanService) scanLogs() {
 	
 	// 清理过期的威胁数据
 	s.cleanupOldThreats()
+	s.metrics.ObserveScan(ScanMetricPeriodic, time.Since(start))
 	
 	s.ipMutex.RLock()
 	defer s.ipMutex.RUnlock()
@@ -201,6 +200,11 @@ func (s *IntelligentScanService) cleanupOldThreats() {
 			delete(s.suspiciousIPs, ip)
 		}
 	}
+	for subnet, threat := range s.subnetThreats {
+		if threat.LastSeen.Before(expirationTime) {
+			delete(s.subnetThreats, subnet)
+		}
+	}
 }
 
 // scanSSHLogs 扫描SSH日志
@@ -267,23 +271,78 @@ func (s *IntelligentScanService) scanNginxLogs() int {
 	return eventCount
 }
 
-// updateThreatLevel 更新威胁等级
+// updateThreatLevel 更新威胁等级，IPv6地址累加到所在网段的威胁记录上
 func (s *IntelligentScanService) updateThreatLevel(ip, source, attackType string, timestamp time.Time) {
 	s.ipMutex.Lock()
 	defer s.ipMutex.Unlock()
 	
-	threat, exists := s.suspiciousIPs[ip]
+	key := s.threatKey(ip)
+	threat, exists := s.suspiciousIPs[key]
 	if !exists {
 		threat = &IPThreatLevel{
-			IP:          ip,
+			IP:          key,
 			ThreatScore: 0,
 			AttackTypes: []string{},
 			FirstSeen:   timestamp,
 			LastSeen:    timestamp,
 		}
-		s.suspiciousIPs[ip] = threat
+		s.enrichGeo(threat)
+		s.suspiciousIPs[key] = threat
+	}
+	
+	previous := threat.ThreatScore
+	addThreatAddress(threat, ip)
+	s.applyThreatEvent(threat, source, attackType, timestamp)
+	s.trackSubnet(threat)
+	if !exists || threat.ThreatScore != previous {
+		s.publishThreat(threat, previous, source)
+	}
+}
+
+// ThreatEvent 威胁评分变化事件
+type ThreatEvent struct {
+	IP            string   `json:"ip"`
+	PreviousScore int      `json:"previous_score"`
+	ThreatScore   int      `json:"threat_score"`
+	ThreatLevel   string   `json:"threat_level"`
+	Source        string   `json:"source"` // ssh / nginx / log_analysis
+	AttackTypes   []string `json:"attack_types"`
+	IsBanned      bool     `json:"is_banned"`
+}
+
+// publishThreat 发布威胁评分变化事件，调用方需持有ipMutex
+func (s *IntelligentScanService) publishThreat(threat *IPThreatLevel, previous int, source string) {
+	s.eventBus.Publish(EventTopicThreat, "score_changed", ThreatEvent{
+		IP:            threat.IP,
+		PreviousScore: previous,
+		ThreatScore:   threat.ThreatScore,
+		ThreatLevel:   threat.ThreatLevel,
+		Source:        source,
+		AttackTypes:   append([]string(nil), threat.AttackTypes...),
+		IsBanned:      threat.IsBanned,
+	})
+}
+
+// enrichGeo 使用离线GeoIP数据填充威胁记录的国家和ISP
+func (s *IntelligentScanService) enrichGeo(threat *IPThreatLevel) {
+	if s.geoService == nil {
+		return
+	}
+	
+	info, err := s.geoService.Lookup(threat.IP)
+	if err != nil || info == nil {
+		return
 	}
 	
+	threat.Country = info.Country
+	if threat.Country == "" {
+		threat.Country = info.CountryCode
+	}
+	threat.ISP = info.ASOrg
+}
+
+// applyThreatEvent 将一次攻击事件累加到威胁记录上
+func (s *IntelligentScanService) applyThreatEvent(threat *IPThreatLevel, source, attackType string, timestamp time.Time) {
 	// 更新最后发现时间
 	if timestamp.After(threat.LastSeen) {
 		threat.LastSeen = timestamp
@@ -390,77 +449,144 @@ func (s *IntelligentScanService) analyzeThreats() {
 }
 
 // autoProcessThreats 自动处理威胁
+// 加锁只复制未封禁的威胁记录，策略匹配（GeoIP查询）、fail2ban命令和数据库写入都在锁外执行，
+// 避免fail2ban命令较慢时阻塞读取威胁状态的接口
 func (s *IntelligentScanService) autoProcessThreats() {
-	s.ipMutex.Lock()
-	defer s.ipMutex.Unlock()
+	// 启动时生成失败的jail配置在处理前重试
+	s.ensureManagedJails()
 	
 	bannedCount := 0
 	errorCount := 0
 	processedCount := 0
+	observedCount := 0
+	alertedCount := 0
 	
-	for ip, threat := range s.suspiciousIPs {
-		// 跳过已经处理的IP
-		if threat.IsBanned || threat.AutoBanned {
+	for ip, threat := range s.pendingThreats() {
+		// 自动封禁高威胁IP，GeoIP策略优先于内置策略
+		policy, action := s.resolveBanDecision(threat, s.matchBanPolicy(threat))
+		if policy == "" {
 			continue
 		}
+		processedCount++
 		
-		// 自动封禁高威胁IP
-		if s.shouldAutoBan(threat) {
-			processedCount++
-			if err := s.autoBanIP(ip, threat); err != nil {
-				log.Printf("自动封禁IP %s 失败: %v", ip, err)
+		// 告警策略只记录决策，不封禁
+		if action == GeoPolicyActionAlert {
+			if err := s.recordDecision(ip, threat, policy, "scan", GeoPolicyActionAlert); err != nil {
+				log.Printf("记录告警决策失败 %s: %v", ip, err)
 				errorCount++
 			} else {
+				alertedCount++
+			}
+			continue
+		}
+		
+		// 观察模式下只记录决策
+		if s.IsPolicyObserved(policy) {
+			if err := s.recordWouldBan(ip, threat, policy, "scan"); err != nil {
+				log.Printf("记录观察模式决策失败 %s: %v", ip, err)
+				errorCount++
+			} else {
+				s.updateThreat(ip, func(threat *IPThreatLevel) { threat.WouldBan = true })
+				observedCount++
+			}
+			continue
+		}
+		
+		if err := s.autoBanIP(ip, threat, policy); errors.Is(err, ErrIPWhitelisted) {
+			// 记录威胁后才加入白名单的IP，不再继续跟踪
+			log.Printf("[安全] %v", err)
+			s.ipMutex.Lock()
+			delete(s.suspiciousIPs, ip)
+			s.ipMutex.Unlock()
+		} else if err != nil {
+			log.Printf("自动封禁IP %s 失败: %v", ip, err)
+			errorCount++
+		} else {
+			s.updateThreat(ip, func(threat *IPThreatLevel) {
 				threat.AutoBanned = true
 				threat.IsBanned = true
-				bannedCount++
-				log.Printf("成功自动封禁高威胁IP: %s (威胁评分: %d)", ip, threat.ThreatScore)
-			}
+			})
+			bannedCount++
+			log.Printf("成功自动封禁高威胁IP: %s (威胁评分: %d)", ip, threat.ThreatScore)
 		}
 	}
 	
 	if processedCount > 0 {
-		log.Printf("自动处理完成: 处理 %d 个IP, 成功封禁 %d 个, 失败 %d 个", processedCount, bannedCount, errorCount)
+		log.Printf("自动处理完成: 处理 %d 个IP, 成功封禁 %d 个, 观察模式记录 %d 个, 告警 %d 个, 失败 %d 个",
+			processedCount, bannedCount, observedCount, alertedCount, errorCount)
 	}
+	
+	// 单个来源未达到阈值时，按网段汇总升级
+	s.escalateSubnets()
 }
 
-// shouldAutoBan 判断是否应该自动封禁
-func (s *IntelligentScanService) shouldAutoBan(threat *IPThreatLevel) bool {
-	// 高威胁评分自动封禁
-	if threat.ThreatScore >= 80 {
-		return true
-	}
+// pendingThreats 复制尚未封禁的威胁记录，供锁外评估和处理
+func (s *IntelligentScanService) pendingThreats() map[string]*IPThreatLevel {
+	s.ipMutex.RLock()
+	defer s.ipMutex.RUnlock()
 	
-	// SSH暴力破解自动封禁
-	if threat.SSHAttempts >= 10 {
-		return true
+	threats := make(map[string]*IPThreatLevel)
+	for ip, threat := range s.suspiciousIPs {
+		// 跳过已经处理的IP
+		if threat.IsBanned || threat.AutoBanned {
+			continue
+		}
+		clone := *threat
+		clone.AttackTypes = append([]string(nil), threat.AttackTypes...)
+		clone.Addresses = append([]string(nil), threat.Addresses...)
+		threats[ip] = &clone
 	}
+	return threats
+}
+
+// updateThreat 加锁更新威胁记录的处理状态，记录在处理期间被清除时忽略
+func (s *IntelligentScanService) updateThreat(ip string, update func(threat *IPThreatLevel)) {
+	s.ipMutex.Lock()
+	defer s.ipMutex.Unlock()
 	
-	// 多种攻击类型自动封禁
-	if len(threat.AttackTypes) >= 3 && threat.ThreatScore >= 60 {
-		return true
+	if threat, exists := s.suspiciousIPs[ip]; exists {
+		update(threat)
 	}
-	
+}
+
+// matchBanPolicy 返回命中的封禁策略名称，未命中返回空字符串
+func (s *IntelligentScanService) matchBanPolicy(threat *IPThreatLevel) string {
 	// SQL注入等严重攻击立即封禁
 	for _, attackType := range threat.AttackTypes {
 		if attackType == "sql_injection" || attackType == "xss" || attackType == "path_traversal" {
-			return true
+			return PolicyCriticalAttack
 		}
 	}
 	
-	return false
+	cfg := s.scannerConfig()
+	
+	// 高威胁评分自动封禁
+	if threat.ThreatScore >= cfg.HighScoreThreshold {
+		return PolicyHighScore
+	}
+	
+	// SSH暴力破解自动封禁
+	if threat.SSHAttempts >= cfg.SSHBruteForceAttempts {
+		return PolicySSHBruteForce
+	}
+	
+	// 多种攻击类型自动封禁
+	if len(threat.AttackTypes) >= cfg.MultiAttackTypes && threat.ThreatScore >= cfg.MultiAttackScore {
+		return PolicyMultiAttack
+	}
+	
+	return ""
 }
 
 // autoBanIP 自动封禁IP
-func (s *IntelligentScanService) autoBanIP(ip string, threat *IPThreatLevel) error {
+func (s *IntelligentScanService) autoBanIP(ip string, threat *IPThreatLevel, policy string) error {
 	if s.fail2banService == nil {
 		return fmt.Errorf("fail2ban服务未初始化")
 	}
 	
 	// 首先检查白名单
 	if s.whitelistService.IsWhitelisted(ip) {
-		log.Printf("[安全] IP %s 在白名单中，跳过自动封禁", ip)
-		return nil
+		return fmt.Errorf("%w: IP %s 在白名单中，跳过自动封禁", ErrIPWhitelisted, ip)
 	}
 	
 	// 检查是否已经被封禁
@@ -472,6 +598,15 @@ func (s *IntelligentScanService) autoBanIP(ip string, threat *IPThreatLevel) err
 		return fmt.Errorf("检查IP是否已封禁失败: %w", err)
 	}
 	
+	// 聚合后的IPv6网段使用专用的网段jail封禁
+	if isPrefixTarget(ip) {
+		jailUsed, err := s.banSubnet(ip, BanSourceAuto)
+		if err != nil {
+			return fmt.Errorf("封禁网段失败: %w", err)
+		}
+		return s.recordAutoBan(ip, jailUsed, threat, policy)
+	}
+	
 	// 获取当前可用的jails
 	availableJails, err := s.fail2banService.GetJails()
 	if err != nil {
@@ -484,12 +619,13 @@ func (s *IntelligentScanService) autoBanIP(ip string, threat *IPThreatLevel) err
 	
 	// 选择合适的jail进行封禁
 	jailUsed := ""
+	cfg := s.scannerConfig()
 	
 	// 优先使用SSH相关的jail (如果有SSH攻击)
 	if threat.SSHAttempts > 0 {
 		for _, jail := range availableJails {
-			if jail == "sshd" || jail == "sshd-ddos" {
-				if err := s.fail2banService.BanIP(jail, ip); err != nil {
+			if contains(cfg.SSHJails, jail) {
+				if err := s.fail2banService.banIP(jail, ip, BanSourceAuto); err != nil {
 					log.Printf("在jail %s 中封禁IP %s 失败: %v", jail, ip, err)
 					continue
 				}
@@ -502,8 +638,8 @@ func (s *IntelligentScanService) autoBanIP(ip string, threat *IPThreatLevel) err
 	// 如果还没有成功封禁，尝试使用nginx相关的jail
 	if jailUsed == "" && threat.NginxAttempts > 0 {
 		for _, jail := range availableJails {
-			if jail == "nginx-http-auth" || strings.Contains(jail, "nginx") {
-				if err := s.fail2banService.BanIP(jail, ip); err != nil {
+			if contains(cfg.NginxJails, jail) || strings.Contains(jail, "nginx") {
+				if err := s.fail2banService.banIP(jail, ip, BanSourceAuto); err != nil {
 					log.Printf("在jail %s 中封禁IP %s 失败: %v", jail, ip, err)
 					continue
 				}
@@ -516,31 +652,46 @@ func (s *IntelligentScanService) autoBanIP(ip string, threat *IPThreatLevel) err
 	// 如果还没有成功封禁，尝试使用第一个可用的jail
 	if jailUsed == "" {
 		jail := availableJails[0]
-		if err := s.fail2banService.BanIP(jail, ip); err != nil {
+		if err := s.fail2banService.banIP(jail, ip, BanSourceAuto); err != nil {
 			return fmt.Errorf("在jail %s 中封禁IP失败: %w", jail, err)
 		}
 		jailUsed = jail
 	}
 	
-	// 记录到数据库
+	return s.recordAutoBan(ip, jailUsed, threat, policy)
+}
+
+// recordAutoBan 将自动封禁记录到数据库，重复封禁的时长按历史次数递增
+func (s *IntelligentScanService) recordAutoBan(ip, jailUsed string, threat *IPThreatLevel, policy string) error {
+	plan := s.planBan(ip)
+	banTime := time.Now()
+	jailUsed = s.holdForPlan(ip, jailUsed, banTime, plan, BanSourceAuto)
 	bannedIP := &model.BannedIP{
 		IPAddress: ip,
 		Jail:      jailUsed,
-		BanTime:   time.Now(),
-		// 使用配置中的封禁时长，如果未配置则默认24小时
-		UnbanTime: time.Now().Add(s.getBanDuration()),
+		BanTime:   banTime,
 		IsActive:  true,
-		Reason:    s.generateBanReason(threat),
+		Reason:    s.generateBanReason(threat) + ", " + plan.describe(),
+		Policy:    policy,
 	}
+	plan.apply(bannedIP)
 	
-	log.Printf("成功在jail %s 中封禁IP %s", jailUsed, ip)
-	return s.db.Create(bannedIP).Error
+	log.Printf("成功在jail %s 中封禁IP %s (%s)", jailUsed, ip, plan.describe())
+	if err := s.db.Create(bannedIP).Error; err != nil {
+		return err
+	}
+	
+	// fail2ban日志中的封禁事件不包含策略和原因，自动封禁单独发布一条事件
+	s.eventBus.Publish(EventTopicBan, "auto_ban", bannedIP)
+	return nil
 }
 
-// getBanDuration 获取封禁时长，使用默认值
+// getBanDuration 获取首次封禁时长，未配置时默认24小时
 func (s *IntelligentScanService) getBanDuration() time.Duration {
-	// 默认24小时封禁时长
-	return 24 * time.Hour
+	if duration := s.banConfig().Duration; duration > 0 {
+		return duration
+	}
+	return defaultBanDuration
 }
 
 // IsIPWhitelisted 检查IP是否在白名单中（公开方法用于测试）
@@ -567,6 +718,10 @@ func (s *IntelligentScanService) generateBanReason(threat *IPThreatLevel) string
 		reason += fmt.Sprintf(", 攻击类型: %v", threat.AttackTypes)
 	}
 	
+	if len(threat.Addresses) > 0 {
+		reason += fmt.Sprintf(", 网段内攻击来源 %d 个", len(threat.Addresses))
+	}
+	
 	return reason
 }
 
@@ -583,6 +738,7 @@ func (s *IntelligentScanService) GetCurrentThreats() map[string]*IPThreatLevel {
 			// 深拷贝，防止外部修改
 			clone := *threat
 			clone.AttackTypes = append([]string(nil), threat.AttackTypes...)
+			clone.Addresses = append([]string(nil), threat.Addresses...)
 			threats[ip] = &clone
 		}
 	}
@@ -590,6 +746,47 @@ func (s *IntelligentScanService) GetCurrentThreats() map[string]*IPThreatLevel {
 	return threats
 }
 
+// GetThreat 获取单个IP的威胁信息，不存在时返回nil
+func (s *IntelligentScanService) GetThreat(ip string) *IPThreatLevel {
+	s.ipMutex.RLock()
+	defer s.ipMutex.RUnlock()
+	
+	threat, exists := s.suspiciousIPs[ip]
+	if !exists {
+		// IPv6地址的威胁记录在所在网段上
+		if threat, exists = s.suspiciousIPs[s.threatKey(ip)]; !exists {
+			return nil
+		}
+	}
+	
+	clone := *threat
+	clone.AttackTypes = append([]string(nil), threat.AttackTypes...)
+	clone.Addresses = append([]string(nil), threat.Addresses...)
+	return &clone
+}
+
+// ClearThreat 清除IP的威胁记录及其在网段记录中的状态，用于手动解封后重新开始评估
+func (s *IntelligentScanService) ClearThreat(ip string) bool {
+	s.ipMutex.Lock()
+	defer s.ipMutex.Unlock()
+	
+	key := ip
+	if _, exists := s.suspiciousIPs[key]; !exists {
+		key = s.threatKey(ip)
+	}
+	threat, exists := s.suspiciousIPs[key]
+	delete(s.suspiciousIPs, key)
+	s.untrackSubnet(key)
+	if exists {
+		s.eventBus.Publish(EventTopicThreat, "cleared", ThreatEvent{
+			IP:            key,
+			PreviousScore: threat.ThreatScore,
+			ThreatLevel:   s.getThreatLevelDescription(0),
+		})
+	}
+	return exists
+}
+
 // GetScanResult 获取扫描结果
 func (s *IntelligentScanService) GetScanResult() *ScanResult {
 	threats := s.GetCurrentThreats()
@@ -618,7 +815,7 @@ func (s *IntelligentScanService) GetScanResult() *ScanResult {
 			result.HighRiskIPs = append(result.HighRiskIPs, threat.IP)
 		}
 		
-		if threat.AutoBanned && time.Since(threat.LastSeen) < s.analysisInterval {
+		if threat.AutoBanned && time.Since(threat.LastSeen) < s.scannerConfig().AnalysisInterval {
 			result.NewBans = append(result.NewBans, threat.IP)
 		}
 	}
@@ -660,7 +857,7 @@ func (s *IntelligentScanService) ManualBanIP(ip, reason string) error {
 	
 	// 检查是否在白名单中
 	if s.whitelistService.IsWhitelisted(ip) {
-		return fmt.Errorf("IP %s 在白名单中，无法手动封禁", ip)
+		return fmt.Errorf("%w: IP %s 在白名单中，无法手动封禁", ErrIPWhitelisted, ip)
 	}
 	
 	// 更新威胁信息
@@ -673,38 +870,96 @@ func (s *IntelligentScanService) ManualBanIP(ip, reason string) error {
 			LastSeen:    time.Now(),
 			FirstSeen:   time.Now(),
 		}
+		s.enrichGeo(threat)
 		s.suspiciousIPs[ip] = threat
 	}
 	threat.IsBanned = true
 	threat.ThreatLevel = "严重"
 	s.ipMutex.Unlock()
 	
-	// 执行封禁
-	if s.sshService != nil {
-		if err := s.sshService.BanSSHIP(ip, "sshd"); err != nil {
-			log.Printf("SSH封禁失败: %v", err)
-			// 不返回错误，继续尝试其他封禁方式
+	s.ensureManagedJails()
+	jails, err := s.manualBanJails(ip)
+	if err != nil {
+		return err
+	}
+	
+	// 执行封禁，部分jail失败时继续尝试其他jail
+	var bannedJails []string
+	for _, jail := range jails {
+		if err := s.fail2banService.BanIP(jail, ip); err != nil {
+			log.Printf("在jail %s 中封禁IP %s 失败: %v", jail, ip, err)
+			continue
 		}
+		bannedJails = append(bannedJails, jail)
+	}
+	if len(bannedJails) == 0 {
+		return fmt.Errorf("在所有jail中封禁IP %s 失败", ip)
 	}
 	
-	if s.nginxService != nil {
-		if err := s.nginxService.BanNginxIP(ip, "nginx-http-auth"); err != nil {
-			log.Printf("Nginx封禁失败: %v", err)
-			// 不返回错误，继续尝试其他封禁方式
+	// 每个jail记录一条，到期时通过对应的jail解封；重复封禁的时长按历史次数递增，
+	// 超过jail的bantime时转移到长期jail，多个jail转移后只记录一条
+	plan := s.planBan(ip)
+	banTime := time.Now()
+	recorded := make(map[string]bool)
+	for _, jail := range bannedJails {
+		jail = s.holdForPlan(ip, jail, banTime, plan, BanSourceManual)
+		if recorded[jail] {
+			continue
+		}
+		recorded[jail] = true
+		bannedIP := &model.BannedIP{
+			IPAddress: ip,
+			Jail:      jail,
+			BanTime:   banTime,
+			IsActive:  true,
+			Reason:    reason,
+		}
+		plan.apply(bannedIP)
+		if err := s.db.Create(bannedIP).Error; err != nil {
+			return err
 		}
 	}
 	
-	// 记录到数据库
-	bannedIP := &model.BannedIP{
-		IPAddress: ip,
-		Jail:      "manual",
-		BanTime:   time.Now(),
-		UnbanTime: time.Now().Add(s.getBanDuration()),
-		IsActive:  true,
-		Reason:    reason,
+	return nil
+}
+
+// manualBanJails 手动封禁使用的jail：网段使用网段jail，
+// IP使用存在的SSH和Nginx jail，都不存在时使用第一个可用的jail
+func (s *IntelligentScanService) manualBanJails(ip string) ([]string, error) {
+	if s.fail2banService == nil {
+		return nil, fmt.Errorf("fail2ban服务未初始化")
+	}
+	
+	if isPrefixTarget(ip) {
+		if err := s.ensureSubnetJail(); err != nil {
+			return nil, err
+		}
+		return []string{subnetJailName}, nil
 	}
 	
-	return s.db.Create(bannedIP).Error
+	availableJails, err := s.fail2banService.GetJails()
+	if err != nil {
+		return nil, fmt.Errorf("获取jail列表失败: %w", err)
+	}
+	if len(availableJails) == 0 {
+		return nil, fmt.Errorf("没有可用的jail进行封禁")
+	}
+	
+	// SSH和Nginx各使用配置中第一个存在的jail
+	cfg := s.scannerConfig()
+	var jails []string
+	for _, preferred := range [][]string{cfg.SSHJails, cfg.NginxJails} {
+		for _, jail := range preferred {
+			if contains(availableJails, jail) {
+				jails = append(jails, jail)
+				break
+			}
+		}
+	}
+	if len(jails) == 0 {
+		jails = append(jails, availableJails[0])
+	}
+	return jails, nil
 }
 
 // contains 检查字符串数组是否包含指定字符串
@@ -717,21 +972,47 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// LogAnalysisResult 日志文件分析结果
+type LogAnalysisResult struct {
+	LogFilePath    string          `json:"log_file_path"`
+	TotalLines     int             `json:"total_lines"`
+	ProcessedLines int             `json:"processed_lines"`
+	MaliciousIPs   []IPThreatLevel `json:"malicious_ips"`
+	BannedIPs      []string        `json:"banned_ips"`
+	ObservedIPs    []string        `json:"observed_ips"`
+	AlertedIPs     []string        `json:"alerted_ips"`
+	FailedIPs      []string        `json:"failed_ips"`
+}
+
 // AnalyzeLogFile 分析指定的日志文件并自动封禁恶意IP
 func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
+	_, err := s.AnalyzeLogFileWithContext(s.ctx, logFilePath, nil)
+	return err
+}
+
+// AnalyzeLogFileWithContext 分析指定的日志文件并自动封禁恶意IP，支持取消和进度上报
+func (s *IntelligentScanService) AnalyzeLogFileWithContext(ctx context.Context, logFilePath string, progress *JobProgress) (*LogAnalysisResult, error) {
 	if logFilePath == "" {
-		return fmt.Errorf("日志文件路径不能为空")
+		return nil, fmt.Errorf("日志文件路径不能为空")
 	}
 	
 	log.Printf("开始分析日志文件: %s", logFilePath)
+	start := time.Now()
+	defer func() {
+		s.metrics.ObserveScan(ScanMetricLogAnalysis, time.Since(start))
+	}()
 	
 	file, err := os.Open(logFilePath)
 	if err != nil {
-		return fmt.Errorf("无法打开日志文件: %w", err)
+		return nil, fmt.Errorf("无法打开日志文件: %w", err)
 	}
 	defer file.Close()
 	
-	scanner := bufio.NewScanner(file)
+	if stat, err := file.Stat(); err == nil {
+		progress.AddTotalBytes(stat.Size())
+	}
+	
+	scanner := bufio.NewScanner(progress.Reader(file))
 	// 增加缓冲区大小以处理长日志行
 	buf := make([]byte, 1024*1024) // 1MB
 	scanner.Buffer(buf, 1024*1024)
@@ -745,12 +1026,21 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 	
 	for scanner.Scan() {
 		totalLines++
+		progress.AddLines(1)
+		
+		// 定期检查任务是否被取消
+		if totalLines%1000 == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		
 		line := scanner.Text()
 		matches := logRegex.FindStringSubmatch(line)
 		
 		if len(matches) >= 8 {
 			processedLines++
-			ip := matches[1]
+			address := normalizeIP(matches[1])
 			timeStr := matches[2]
 			method := matches[3]
 			url := matches[4]
@@ -758,9 +1048,10 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 			userAgent := matches[7]
 			
 			// 检查白名单
-			if s.whitelistService.IsWhitelisted(ip) {
+			if address == "" || s.whitelistService.IsWhitelisted(address) {
 				continue
 			}
+			ip := s.threatKey(address)
 			
 			// 解析时间
 			t, err := time.Parse("02/Jan/2006:15:04:05 -0700", timeStr)
@@ -796,6 +1087,8 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 					}
 				}
 				
+				addThreatAddress(maliciousIPs[ip], address)
+				
 				// 添加攻击类型
 				if !contains(maliciousIPs[ip].AttackTypes, attackType) {
 					maliciousIPs[ip].AttackTypes = append(maliciousIPs[ip].AttackTypes, attackType)
@@ -808,7 +1101,19 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 	}
 	
 	if err := scanner.Err(); err != nil {
-		return fmt.Errorf("读取日志文件失败: %w", err)
+		return nil, fmt.Errorf("读取日志文件失败: %w", err)
+	}
+	s.metrics.RecordLogLines(LogMetricSourceLogAnalysis, processedLines, totalLines-processedLines)
+	
+	result := &LogAnalysisResult{
+		LogFilePath:    logFilePath,
+		TotalLines:     totalLines,
+		ProcessedLines: processedLines,
+		MaliciousIPs:   []IPThreatLevel{},
+		BannedIPs:      []string{},
+		ObservedIPs:    []string{},
+		AlertedIPs:     []string{},
+		FailedIPs:      []string{},
 	}
 	
 	log.Printf("日志分析完成: 总行数 %d, 处理行数 %d, 发现恶意IP %d", totalLines, processedLines, len(maliciousIPs))
@@ -816,6 +1121,8 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 	// 分析威胁等级并自动封禁
 	bannedCount := 0
 	errorCount := 0
+	observedCount := 0
+	alertedCount := 0
 	
 	// 将分析结果合并到主威胁列表
 	s.ipMutex.Lock()
@@ -825,6 +1132,7 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 		
 		// 合并到主列表
 		if existingThreat, exists := s.suspiciousIPs[ip]; exists {
+			previous := existingThreat.ThreatScore
 			existingThreat.ThreatScore += threat.ThreatScore
 			if existingThreat.ThreatScore > 100 {
 				existingThreat.ThreatScore = 100
@@ -839,14 +1147,33 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 					existingThreat.AttackTypes = append(existingThreat.AttackTypes, atkType)
 				}
 			}
+			for _, address := range threat.Addresses {
+				addThreatAddress(existingThreat, address)
+			}
+			s.trackSubnet(existingThreat)
+			if existingThreat.ThreatScore != previous {
+				s.publishThreat(existingThreat, previous, "log_analysis")
+			}
 		} else {
+			s.enrichGeo(threat)
 			s.suspiciousIPs[ip] = threat
+			s.trackSubnet(threat)
+			s.publishThreat(threat, 0, "log_analysis")
 		}
 	}
 	s.ipMutex.Unlock()
 	
+	// 网段封禁需要的jail配置在封禁前生成
+	s.ensureManagedJails()
+	
 	// 处理需要封禁的IP
 	for ip, threat := range maliciousIPs {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		
+		result.MaliciousIPs = append(result.MaliciousIPs, *threat)
+		
 		// 检查是否已经被封禁
 		var existingBan model.BannedIP
 		if err := s.db.Where("ip_address = ? AND is_active = ?", ip, true).First(&existingBan).Error; err == nil {
@@ -854,14 +1181,52 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 			continue
 		}
 		
-		// 自动封禁高危和严重威胁
+		// 自动封禁高危和严重威胁，GeoIP策略优先于内置策略
+		builtinPolicy := ""
 		if threat.ThreatLevel == "高危" || threat.ThreatLevel == "严重" {
-			if err := s.autoBanIP(ip, threat); err != nil {
+			builtinPolicy = PolicyLogAnalysis
+		}
+		policy, action := s.resolveBanDecision(threat, builtinPolicy)
+		
+		if action == GeoPolicyActionAlert {
+			if err := s.recordDecision(ip, threat, policy, "log_analysis", GeoPolicyActionAlert); err != nil {
+				log.Printf("记录告警决策失败 %s: %v", ip, err)
+				progress.AddError(err)
+				result.FailedIPs = append(result.FailedIPs, ip)
+				errorCount++
+			} else {
+				result.AlertedIPs = append(result.AlertedIPs, ip)
+				alertedCount++
+			}
+			continue
+		}
+		
+		if policy != "" {
+			if s.IsPolicyObserved(policy) {
+				if err := s.recordWouldBan(ip, threat, policy, "log_analysis"); err != nil {
+					log.Printf("记录观察模式决策失败 %s: %v", ip, err)
+					progress.AddError(err)
+					result.FailedIPs = append(result.FailedIPs, ip)
+					errorCount++
+				} else {
+					result.ObservedIPs = append(result.ObservedIPs, ip)
+					observedCount++
+				}
+				continue
+			}
+			
+			if err := s.autoBanIP(ip, threat, policy); errors.Is(err, ErrIPWhitelisted) {
+				log.Printf("[安全] %v", err)
+			} else if err != nil {
 				log.Printf("自动封禁IP %s 失败: %v", ip, err)
+				progress.AddError(fmt.Errorf("封禁IP %s 失败: %w", ip, err))
+				result.FailedIPs = append(result.FailedIPs, ip)
 				errorCount++
 			} else {
 				log.Printf("成功自动封禁恶意IP: %s (威胁等级: %s, 攻击类型: %s)", 
 					ip, threat.ThreatLevel, strings.Join(threat.AttackTypes, ","))
+				progress.AddBan(ip)
+				result.BannedIPs = append(result.BannedIPs, ip)
 				bannedCount++
 			}
 		} else {
@@ -870,8 +1235,8 @@ func (s *IntelligentScanService) AnalyzeLogFile(logFilePath string) error {
 		}
 	}
 	
-	log.Printf("日志文件分析完成: 成功封禁 %d 个IP, 失败 %d 个", bannedCount, errorCount)
-	return nil
+	log.Printf("日志文件分析完成: 成功封禁 %d 个IP, 观察模式记录 %d 个, 告警 %d 个, 失败 %d 个", bannedCount, observedCount, alertedCount, errorCount)
+	return result, nil
 }
 
 // detectLogAttackType 检测日志中的攻击类型
@@ -1008,6 +1373,47 @@ func (s *IntelligentScanService) evaluateLogThreatLevel(threat *IPThreatLevel) {
 
 // AnalyzeAccessLog 分析access.log文件并自动处理威胁
 func (s *IntelligentScanService) AnalyzeAccessLog() error {
+	logFile := s.FindAccessLog()
+	if logFile == "" {
+		log.Printf("未找到access.log文件，跳过自动分析")
+		return nil
+	}
+	
+	if s.jobService == nil {
+		log.Printf("开始自动分析access.log: %s", logFile)
+		return s.AnalyzeLogFile(logFile)
+	}
+	
+	// 上一次分析尚未结束时跳过，避免任务堆积
+	if s.jobService.HasActiveJob(JobTypeAnalyzeAccessLog, logFile) {
+		log.Printf("access.log分析任务仍在进行，跳过本次自动分析: %s", logFile)
+		return nil
+	}
+	
+	job, err := s.SubmitLogAnalysis(JobTypeAnalyzeAccessLog, logFile)
+	if err != nil {
+		return err
+	}
+	log.Printf("已提交access.log自动分析任务 #%d: %s", job.ID, logFile)
+	return nil
+}
+
+// SubmitLogAnalysis 提交异步日志分析任务
+func (s *IntelligentScanService) SubmitLogAnalysis(jobType, logFilePath string) (*model.AnalysisJob, error) {
+	if s.jobService == nil {
+		return nil, fmt.Errorf("任务服务未初始化")
+	}
+	if logFilePath == "" {
+		return nil, fmt.Errorf("日志文件路径不能为空")
+	}
+	
+	return s.jobService.Submit(jobType, logFilePath, func(ctx context.Context, progress *JobProgress) (interface{}, error) {
+		return s.AnalyzeLogFileWithContext(ctx, logFilePath, progress)
+	})
+}
+
+// FindAccessLog 查找存在的access.log文件，未找到返回空字符串
+func (s *IntelligentScanService) FindAccessLog() string {
 	// 默认的access.log路径
 	accessLogPaths := []string{
 		"/var/log/nginx/access.log",
@@ -1016,21 +1422,13 @@ func (s *IntelligentScanService) AnalyzeAccessLog() error {
 		"/var/log/httpd/access_log",
 	}
 	
-	var logFile string
 	for _, path := range accessLogPaths {
 		if _, err := os.Stat(path); err == nil {
-			logFile = path
-			break
+			return path
 		}
 	}
 	
-	if logFile == "" {
-		log.Printf("未找到access.log文件，跳过自动分析")
-		return nil
-	}
-	
-	log.Printf("开始自动分析access.log: %s", logFile)
-	return s.AnalyzeLogFile(logFile)
+	return ""
 }
 
 // StartAutoLogAnalysis 启动自动日志分析
@@ -1041,25 +1439,16 @@ func (s *IntelligentScanService) StartAutoLogAnalysis() {
 
 // autoLogAnalysis 自动日志分析任务
 func (s *IntelligentScanService) autoLogAnalysis() {
-	defer s.wg.Done()
-	
-	// 每30分钟分析一次access.log
-	s.logAnalysisTicker = time.NewTicker(30 * time.Minute)
-	defer s.logAnalysisTicker.Stop()
-	
 	// 立即执行一次分析
 	if err := s.AnalyzeAccessLog(); err != nil {
 		log.Printf("初始日志分析失败: %v", err)
 	}
 	
-	for {
-		select {
-		case <-s.ctx.Done():
-			return
-		case <-s.logAnalysisTicker.C:
-			if err := s.AnalyzeAccessLog(); err != nil {
-				log.Printf("自动日志分析失败: %v", err)
-			}
+	s.runLoop(ScannerLoopLogAnalysis, func(cfg config.ScannerConfig) time.Duration {
+		return cfg.LogAnalysisInterval
+	}, func() {
+		if err := s.AnalyzeAccessLog(); err != nil {
+			log.Printf("自动日志分析失败: %v", err)
 		}
-	}
+	})
 }
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/netip"
+	"strings"
+)
+
+// ipAddrPattern 日志中IPv4或IPv6地址的正则片段，匹配结果需要再经过normalizeIP校验
+const ipAddrPattern = `([0-9A-Fa-f:.]*[0-9A-Fa-f])`
+
+// normalizeIP 将日志中的地址规范化：去掉方括号和zone，IPv4映射地址转换为IPv4
+// 无法解析时返回空字符串
+func normalizeIP(value string) string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(value, "[")
+	value = strings.TrimSuffix(value, "]")
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return ""
+	}
+	return addr.WithZone("").Unmap().String()
+}
+
+// ipv6ThreatKey IPv6地址按前缀长度聚合后的网段，IPv4地址和不需要聚合时原样返回
+// 攻击者通常在分配到的整个前缀内轮换地址，按单个IPv6地址统计和封禁没有意义
+func ipv6ThreatKey(ip string, bits int) string {
+	if bits <= 0 || bits >= 128 {
+		return ip
+	}
+
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is6() || addr.Is4In6() {
+		return ip
+	}
+
+	prefix, err := addr.WithZone("").Prefix(bits)
+	if err != nil {
+		return ip
+	}
+	return prefix.String()
+}
+
+// isPrefixTarget 封禁目标是否是网段
+func isPrefixTarget(target string) bool {
+	return strings.Contains(target, "/")
+}
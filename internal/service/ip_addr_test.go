@@ -0,0 +1,113 @@
+package service
+
+import "testing"
+
+func TestNormalizeIP(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"192.0.2.1", "192.0.2.1"},
+		{" 192.0.2.1 ", "192.0.2.1"},
+		{"2001:db8::1", "2001:db8::1"},
+		// 规范化IPv6的不同写法
+		{"2001:0DB8:0000:0000:0000:0000:0000:0001", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"fe80::1%eth0", "fe80::1"},
+		{"[fe80::1%eth0]", "fe80::1"},
+		// IPv4映射地址按IPv4处理
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+		{"[::ffff:192.0.2.1]", "192.0.2.1"},
+		{"::1", "::1"},
+		// 无法解析
+		{"", ""},
+		{"192.0.2", ""},
+		{"192.0.2.256", ""},
+		{"2001:db8::g", ""},
+		{"2001:db8:::1", ""},
+		{"example.com", ""},
+		{"192.0.2.1/24", ""},
+	}
+	for _, tt := range tests {
+		if got := normalizeIP(tt.value); got != tt.want {
+			t.Errorf("normalizeIP(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestIPv6ThreatKey(t *testing.T) {
+	tests := []struct {
+		ip   string
+		bits int
+		want string
+	}{
+		{"2001:db8:1:2:3:4:5:6", 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:2::ffff", 64, "2001:db8:1:2::/64"},
+		{"2001:db8:1:1234::1", 56, "2001:db8:1:1200::/56"},
+		{"2001:db8:1:2:3:4:5:6", 48, "2001:db8:1::/48"},
+		{"2001:db8:1:2:3:4:5:6", 127, "2001:db8:1:2:3:4:5:6/127"},
+		{"fe80::1%eth0", 64, "fe80::/64"},
+		// 不聚合
+		{"2001:db8::1", 0, "2001:db8::1"},
+		{"2001:db8::1", 128, "2001:db8::1"},
+		{"2001:db8::1", -1, "2001:db8::1"},
+		// IPv4和IPv4映射地址不聚合
+		{"192.0.2.1", 64, "192.0.2.1"},
+		{"::ffff:192.0.2.1", 64, "::ffff:192.0.2.1"},
+		// 无法解析时原样返回
+		{"not-an-ip", 64, "not-an-ip"},
+		{"2001:db8::/64", 64, "2001:db8::/64"},
+	}
+	for _, tt := range tests {
+		if got := ipv6ThreatKey(tt.ip, tt.bits); got != tt.want {
+			t.Errorf("ipv6ThreatKey(%q, %d) = %q, want %q", tt.ip, tt.bits, got, tt.want)
+		}
+	}
+}
+
+func TestParseLogLineIPv6(t *testing.T) {
+	sshTests := []struct {
+		line  string
+		event string
+		ip    string
+	}{
+		{"Jan  2 15:04:05 host sshd[123]: Failed password for root from 2001:db8::1 port 22 ssh2", "failed_password", "2001:db8::1"},
+		{"Jan  2 15:04:05 host sshd[123]: Failed password for invalid user admin from 2001:DB8:0:0::5 port 22 ssh2", "failed_password", "2001:db8::5"},
+		{"Jan  2 15:04:05 host sshd[123]: Invalid user test from ::ffff:192.0.2.7 port 22", "invalid_user", "192.0.2.7"},
+		{"Jan  2 15:04:05 host sshd[123]: Accepted password for deploy from 192.0.2.8 port 22 ssh2", "accepted_password", "192.0.2.8"},
+		{"Jan  2 15:04:05 host sshd[123]: Received disconnect from 2001:db8::9 port 22:11: Bye", "disconnect", "2001:db8::9"},
+	}
+	for _, tt := range sshTests {
+		entry := parseSSHLogLine(tt.line)
+		if entry == nil {
+			t.Errorf("parseSSHLogLine(%q) = nil", tt.line)
+			continue
+		}
+		if entry.Event != tt.event || entry.IP != tt.ip {
+			t.Errorf("parseSSHLogLine(%q) = {Event:%s IP:%s}, want {%s %s}", tt.line, entry.Event, entry.IP, tt.event, tt.ip)
+		}
+	}
+
+	nginxTests := []struct {
+		line string
+		ip   string
+	}{
+		{`2001:db8::1 - - [02/Jan/2024:15:04:05 +0000] "GET /index.html HTTP/1.1" 200 612 "-" "curl/8.0"`, "2001:db8::1"},
+		{`192.0.2.1 - - [02/Jan/2024:15:04:05 +0000] "GET /wp-login.php HTTP/1.1" 404 153 "-" "curl/8.0"`, "192.0.2.1"},
+		{`::ffff:192.0.2.2 - - [02/Jan/2024:15:04:05 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`, "192.0.2.2"},
+	}
+	for _, tt := range nginxTests {
+		entry := parseNginxAccessLine(tt.line)
+		if entry == nil {
+			t.Errorf("parseNginxAccessLine(%q) = nil", tt.line)
+			continue
+		}
+		if entry.IP != tt.ip {
+			t.Errorf("parseNginxAccessLine(%q).IP = %s, want %s", tt.line, entry.IP, tt.ip)
+		}
+	}
+
+	if entry := parseNginxAccessLine(`zz:zz - - [02/Jan/2024:15:04:05 +0000] "GET / HTTP/1.1" 200 612 "-" "curl/8.0"`); entry != nil {
+		t.Errorf("无效地址的行被解析为 %+v", entry)
+	}
+}
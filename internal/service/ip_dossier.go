@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+const (
+	dossierLogWindow     = 7 * 24 * time.Hour
+	dossierLogEvents     = 50
+	dossierHistoryEvents = 100
+	dossierLogScanBytes  = 256 * 1024 * 1024
+	dossierDNSTimeout    = 2 * time.Second
+)
+
+// IPDossier 单个IP在各数据源中的汇总信息
+type IPDossier struct {
+	IP          string                   `json:"ip"`
+	GeneratedAt time.Time                `json:"generated_at"`
+	FirstSeen   *time.Time               `json:"first_seen,omitempty"`
+	LastSeen    *time.Time               `json:"last_seen,omitempty"`
+	Whitelisted bool                     `json:"whitelisted"`
+	ReverseDNS  []string                 `json:"reverse_dns"`
+	Geo         *GeoInfo                 `json:"geo,omitempty"`
+	CurrentBans []model.BannedIPResponse `json:"current_bans"` // fail2ban中当前的封禁
+	BanRecords  []model.BannedIP         `json:"ban_records"`  // 本系统记录的封禁
+	BanHistory  *IPBanHistory            `json:"ban_history,omitempty"`
+	Threat      *IPThreatLevel           `json:"threat,omitempty"`
+	SSHEvents   []LogRecord              `json:"ssh_events"`
+	NginxEvents []LogRecord              `json:"nginx_events"`
+	Errors      map[string]string        `json:"errors,omitempty"` // 获取失败的数据源
+}
+
+// IPDossierService IP调查服务，汇总封禁、威胁、日志、DNS和GeoIP信息
+type IPDossierService struct {
+	db                 *gorm.DB
+	fail2banService    *Fail2BanService
+	intelligentService *IntelligentScanService
+	banEventService    *BanEventService
+	logSourceService   *LogSourceService
+	geoService         *GeoService
+}
+
+// NewIPDossierService 创建IP调查服务
+func NewIPDossierService(db *gorm.DB, fail2banService *Fail2BanService, intelligentService *IntelligentScanService, banEventService *BanEventService, logSourceService *LogSourceService, geoService *GeoService) *IPDossierService {
+	return &IPDossierService{
+		db:                 db,
+		fail2banService:    fail2banService,
+		intelligentService: intelligentService,
+		banEventService:    banEventService,
+		logSourceService:   logSourceService,
+		geoService:         geoService,
+	}
+}
+
+// GetDossier 获取IP的汇总信息，单个数据源失败不影响其他部分，失败原因记录在Errors中
+func (s *IPDossierService) GetDossier(ip string) (*IPDossier, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("无效的IP地址: %s", ip)
+	}
+	ip = parsed.String()
+
+	dossier := &IPDossier{
+		IP:          ip,
+		GeneratedAt: time.Now(),
+		ReverseDNS:  []string{},
+		CurrentBans: []model.BannedIPResponse{},
+		BanRecords:  []model.BannedIP{},
+		SSHEvents:   []LogRecord{},
+		NginxEvents: []LogRecord{},
+		Errors:      make(map[string]string),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	addError := func(section string, err error) {
+		mu.Lock()
+		dossier.Errors[section] = err.Error()
+		mu.Unlock()
+	}
+
+	// 耗时的外部查询并行执行
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		bans, err := s.fail2banService.GetBannedIPs()
+		if err != nil {
+			addError("current_bans", err)
+			return
+		}
+		for _, ban := range bans {
+			if sameIP(ban.Address, ip) {
+				dossier.CurrentBans = append(dossier.CurrentBans, ban)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), dossierDNSTimeout)
+		defer cancel()
+		names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+		if err != nil {
+			if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+				addError("reverse_dns", err)
+			}
+			return
+		}
+		for _, name := range names {
+			dossier.ReverseDNS = append(dossier.ReverseDNS, strings.TrimSuffix(name, "."))
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		records, err := s.recentLogEvents("ssh", ip)
+		if err != nil {
+			addError("ssh_events", err)
+			return
+		}
+		dossier.SSHEvents = records
+	}()
+	go func() {
+		defer wg.Done()
+		records, err := s.recentLogEvents("nginx-access", ip)
+		if err != nil {
+			addError("nginx_events", err)
+			return
+		}
+		dossier.NginxEvents = records
+	}()
+
+	dossier.Whitelisted = s.intelligentService.IsIPWhitelisted(ip)
+	dossier.Threat = s.intelligentService.GetThreat(ip)
+
+	if geo, err := s.geoService.Lookup(ip); err != nil {
+		addError("geo", err)
+	} else {
+		dossier.Geo = geo
+	}
+
+	if err := s.db.Where("ip_address = ?", ip).Order("ban_time DESC").Find(&dossier.BanRecords).Error; err != nil {
+		addError("ban_records", err)
+	}
+
+	if history, err := s.banEventService.GetIPHistory(ip); err != nil {
+		addError("ban_history", err)
+	} else {
+		if len(history.Events) > dossierHistoryEvents {
+			history.Events = history.Events[len(history.Events)-dossierHistoryEvents:]
+		}
+		dossier.BanHistory = history
+	}
+
+	wg.Wait()
+
+	s.fillSeenTimes(dossier)
+	if len(dossier.Errors) == 0 {
+		dossier.Errors = nil
+	}
+
+	return dossier, nil
+}
+
+// recentLogEvents 获取日志源中最近一段时间内该IP的记录，日志文件不存在时返回空
+func (s *IPDossierService) recentLogEvents(sourceName, ip string) ([]LogRecord, error) {
+	source, err := s.logSourceService.GetSource(sourceName)
+	if err != nil || !source.Exists {
+		return []LogRecord{}, nil
+	}
+
+	records, err := s.logSourceService.RecentRecords(sourceName, LogQuery{
+		IP:    ip,
+		Since: time.Now().Add(-dossierLogWindow),
+	}, dossierLogEvents, dossierLogScanBytes)
+	if err != nil {
+		return nil, err
+	}
+	if records == nil {
+		records = []LogRecord{}
+	}
+	return records, nil
+}
+
+// fillSeenTimes 根据各数据源计算首次和最后出现时间
+func (s *IPDossierService) fillSeenTimes(dossier *IPDossier) {
+	observe := func(t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		if dossier.FirstSeen == nil || t.Before(*dossier.FirstSeen) {
+			first := t
+			dossier.FirstSeen = &first
+		}
+		if dossier.LastSeen == nil || t.After(*dossier.LastSeen) {
+			last := t
+			dossier.LastSeen = &last
+		}
+	}
+
+	if dossier.Threat != nil {
+		observe(dossier.Threat.FirstSeen)
+		observe(dossier.Threat.LastSeen)
+	}
+	if dossier.BanHistory != nil {
+		if dossier.BanHistory.FirstSeen != nil {
+			observe(*dossier.BanHistory.FirstSeen)
+		}
+		if dossier.BanHistory.LastSeen != nil {
+			observe(*dossier.BanHistory.LastSeen)
+		}
+	}
+	for _, record := range dossier.BanRecords {
+		observe(record.BanTime)
+	}
+	for _, records := range [][]LogRecord{dossier.SSHEvents, dossier.NginxEvents} {
+		for _, record := range records {
+			if record.Time != nil {
+				observe(*record.Time)
+			}
+		}
+	}
+}
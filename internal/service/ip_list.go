@@ -0,0 +1,206 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"fail2ban-web/internal/ipset"
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// IP列表类型
+const (
+	IPListKindAllow = "allow" // 并入白名单
+	IPListKindDeny  = "deny"  // 作为黑名单参与自动封禁
+
+	// blocklistPolicyPrefix 黑名单触发封禁时的策略名前缀
+	blocklistPolicyPrefix = "blocklist:"
+)
+
+var (
+	ErrIPListNotFound = errors.New("ip list not found")
+	ErrInvalidIPList  = errors.New("invalid ip list")
+)
+
+// IPListMatch IP命中的列表
+type IPListMatch struct {
+	List   string `json:"list"`
+	Kind   string `json:"kind"`
+	Prefix string `json:"prefix"`
+}
+
+// IPListService 管理导入的大规模IP网段列表（云厂商、CDN网段等）
+// 所有列表编译到前缀树中，查询耗时与网段数量无关
+type IPListService struct {
+	db *gorm.DB
+
+	mu    sync.RWMutex
+	allow *ipset.Table[string] // 网段 -> 列表名称
+	deny  *ipset.Table[string]
+}
+
+// NewIPListService 创建IP列表服务
+func NewIPListService(db *gorm.DB) *IPListService {
+	return &IPListService{
+		db:    db,
+		allow: &ipset.Table[string]{},
+		deny:  &ipset.Table[string]{},
+	}
+}
+
+// Start 加载所有列表，需要在数据库迁移完成后调用
+func (s *IPListService) Start() error {
+	return s.rebuild()
+}
+
+// rebuild 从数据库重新构建前缀树，构建完成后整体替换
+func (s *IPListService) rebuild() error {
+	var lists []model.IPList
+	if err := s.db.Order("id ASC").Find(&lists).Error; err != nil {
+		return fmt.Errorf("加载IP列表失败: %w", err)
+	}
+
+	allow, deny := &ipset.Table[string]{}, &ipset.Table[string]{}
+	for _, list := range lists {
+		table := allow
+		if list.Kind == IPListKindDeny {
+			table = deny
+		}
+		for _, value := range list.Prefixes {
+			if prefix, err := netip.ParsePrefix(value); err == nil {
+				table.Insert(prefix, list.Name)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.allow, s.deny = allow, deny
+	s.mu.Unlock()
+
+	log.Printf("已加载 %d 个IP列表: 允许网段 %d 个, 拒绝网段 %d 个", len(lists), allow.Len(), deny.Len())
+	return nil
+}
+
+// ListLists 获取所有列表，不包含网段内容
+func (s *IPListService) ListLists() ([]model.IPList, error) {
+	var lists []model.IPList
+	if err := s.db.Omit("prefixes").Order("id ASC").Find(&lists).Error; err != nil {
+		return nil, fmt.Errorf("查询IP列表失败: %w", err)
+	}
+	return lists, nil
+}
+
+// GetList 获取单个列表及其网段
+func (s *IPListService) GetList(id uint) (*model.IPList, error) {
+	var list model.IPList
+	if err := s.db.First(&list, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIPListNotFound
+		}
+		return nil, fmt.Errorf("查询IP列表失败: %w", err)
+	}
+	return &list, nil
+}
+
+// ImportList 从文件导入列表，同名列表的内容会被替换
+func (s *IPListService) ImportList(name, kind, description, filename, format string, r io.Reader) (*model.IPList, *ipset.ImportResult, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, nil, fmt.Errorf("%w: 列表名称不能为空", ErrInvalidIPList)
+	}
+	if kind != IPListKindAllow && kind != IPListKindDeny {
+		return nil, nil, fmt.Errorf("%w: 未知的列表类型: %s", ErrInvalidIPList, kind)
+	}
+	if format == "" {
+		format = ipset.DetectFormat(filename)
+	}
+
+	result, err := ipset.Parse(r, format)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: 解析文件失败: %v", ErrInvalidIPList, err)
+	}
+	if result.Count == 0 {
+		return nil, result, fmt.Errorf("%w: 文件中没有有效的网段", ErrInvalidIPList)
+	}
+
+	// 通过前缀树去重并排序
+	var set ipset.Set
+	for _, prefix := range result.Prefixes {
+		set.Add(prefix)
+	}
+	prefixes := make([]string, 0, set.Len())
+	for _, prefix := range set.Prefixes() {
+		prefixes = append(prefixes, prefix.String())
+	}
+
+	var list model.IPList
+	if err := s.db.Where("name = ?", name).Limit(1).Find(&list).Error; err != nil {
+		return nil, nil, fmt.Errorf("查询IP列表失败: %w", err)
+	}
+
+	list.Name = name
+	list.Kind = kind
+	list.Description = description
+	list.SourceFile = filename
+	list.Prefixes = prefixes
+	list.Count = len(prefixes)
+	if err := s.db.Save(&list).Error; err != nil {
+		return nil, nil, fmt.Errorf("保存IP列表失败: %w", err)
+	}
+
+	log.Printf("已导入IP列表 %s (%s): %d 个网段, 无效行 %d", name, kind, list.Count, result.Invalid)
+	if err := s.rebuild(); err != nil {
+		return nil, nil, err
+	}
+
+	list.Prefixes = nil
+	return &list, result, nil
+}
+
+// DeleteList 删除列表
+func (s *IPListService) DeleteList(id uint) error {
+	if _, err := s.GetList(id); err != nil {
+		return err
+	}
+	if err := s.db.Delete(&model.IPList{}, id).Error; err != nil {
+		return fmt.Errorf("删除IP列表失败: %w", err)
+	}
+	return s.rebuild()
+}
+
+// MatchAllow 查找包含IP的允许列表，参数为网段时返回与其重叠的列表
+func (s *IPListService) MatchAllow(ip string) *IPListMatch {
+	return s.match(ip, IPListKindAllow)
+}
+
+// MatchDeny 查找包含IP的拒绝列表，参数为网段时返回与其重叠的列表
+func (s *IPListService) MatchDeny(ip string) *IPListMatch {
+	return s.match(ip, IPListKindDeny)
+}
+
+func (s *IPListService) match(ip, kind string) *IPListMatch {
+	target, err := ipset.ParsePrefix(ip)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	table := s.allow
+	if kind == IPListKindDeny {
+		table = s.deny
+	}
+	prefix, name, ok := table.Overlaps(target)
+	s.mu.RUnlock()
+
+	if !ok {
+		return nil
+	}
+	return &IPListMatch{List: name, Kind: kind, Prefix: prefix.String()}
+}
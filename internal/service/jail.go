@@ -7,18 +7,35 @@ import (
 )
 
 type JailService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	eventBus *EventBus
 }
 
-func NewJailService(db *gorm.DB) *JailService {
+func NewJailService(db *gorm.DB, eventBus *EventBus) *JailService {
 	return &JailService{
-		db: db,
+		db:       db,
+		eventBus: eventBus,
 	}
 }
 
+// JailConfigEvent jail配置变化事件
+type JailConfigEvent struct {
+	ID   uint                `json:"id"`
+	Jail *model.Fail2banJail `json:"jail,omitempty"`
+}
+
+// publishConfig 配置写入成功后发布jail配置变化事件
+func (s *JailService) publishConfig(eventType string, id uint, jail *model.Fail2banJail, err error) error {
+	if err == nil {
+		s.eventBus.Publish(EventTopicJail, eventType, JailConfigEvent{ID: id, Jail: jail})
+	}
+	return err
+}
+
 // CreateJail 创建jail配置
 func (s *JailService) CreateJail(jail *model.Fail2banJail) error {
-	return s.db.Create(jail).Error
+	err := s.db.Create(jail).Error
+	return s.publishConfig("config_created", jail.ID, jail, err)
 }
 
 // GetJailByID 根据ID获取jail配置
@@ -51,22 +68,26 @@ func (s *JailService) GetEnabledJails() ([]model.Fail2banJail, error) {
 
 // UpdateJail 更新jail配置
 func (s *JailService) UpdateJail(jail *model.Fail2banJail) error {
-	return s.db.Save(jail).Error
+	err := s.db.Save(jail).Error
+	return s.publishConfig("config_updated", jail.ID, jail, err)
 }
 
 // DeleteJail 删除jail配置
 func (s *JailService) DeleteJail(id uint) error {
-	return s.db.Delete(&model.Fail2banJail{}, id).Error
+	err := s.db.Delete(&model.Fail2banJail{}, id).Error
+	return s.publishConfig("config_deleted", id, nil, err)
 }
 
 // EnableJail 启用jail
 func (s *JailService) EnableJail(id uint) error {
-	return s.db.Model(&model.Fail2banJail{}).Where("id = ?", id).Update("enabled", true).Error
+	err := s.db.Model(&model.Fail2banJail{}).Where("id = ?", id).Update("enabled", true).Error
+	return s.publishConfig("config_enabled", id, nil, err)
 }
 
 // DisableJail 禁用jail
 func (s *JailService) DisableJail(id uint) error {
-	return s.db.Model(&model.Fail2banJail{}).Where("id = ?", id).Update("enabled", false).Error
+	err := s.db.Model(&model.Fail2banJail{}).Where("id = ?", id).Update("enabled", false).Error
+	return s.publishConfig("config_disabled", id, nil, err)
 }
 
 // ListJails 分页获取jail配置
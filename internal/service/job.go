@@ -0,0 +1,399 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 任务状态
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// 任务类型
+const (
+	JobTypeAnalyzeLog       = "analyze_log"
+	JobTypeAnalyzeAccessLog = "analyze_access_log"
+	JobTypeBacktest         = "backtest"
+)
+
+// JobFunc 任务执行函数，返回的结果会保存为任务的findings
+type JobFunc func(ctx context.Context, progress *JobProgress) (interface{}, error)
+
+// JobProgress 任务进度，执行函数在运行过程中更新
+type JobProgress struct {
+	linesRead  int64
+	bytesRead  int64
+	totalBytes int64
+
+	mu     sync.Mutex
+	bans   []string
+	errors []string
+}
+
+// AddLines 增加已读取行数
+func (p *JobProgress) AddLines(n int64) {
+	if p != nil {
+		atomic.AddInt64(&p.linesRead, n)
+	}
+}
+
+// AddTotalBytes 增加待处理的总字节数
+func (p *JobProgress) AddTotalBytes(n int64) {
+	if p != nil {
+		atomic.AddInt64(&p.totalBytes, n)
+	}
+}
+
+// AddBan 记录任务执行的封禁
+func (p *JobProgress) AddBan(ip string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bans = append(p.bans, ip)
+}
+
+// AddError 记录任务执行中的非致命错误
+func (p *JobProgress) AddError(err error) {
+	if p == nil || err == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.errors = append(p.errors, err.Error())
+}
+
+// Reader 包装读取器，统计已读取的字节数
+func (p *JobProgress) Reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &progressReader{reader: r, progress: p}
+}
+
+// apply 将进度写入任务记录
+func (p *JobProgress) apply(job *model.AnalysisJob) {
+	job.LinesRead = atomic.LoadInt64(&p.linesRead)
+	job.BytesRead = atomic.LoadInt64(&p.bytesRead)
+	job.TotalBytes = atomic.LoadInt64(&p.totalBytes)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	job.Bans = append([]string{}, p.bans...)
+	job.Errors = append([]string{}, p.errors...)
+}
+
+// progressReader 统计读取字节数的读取器
+type progressReader struct {
+	reader   io.Reader
+	progress *JobProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	atomic.AddInt64(&r.progress.bytesRead, int64(n))
+	return n, err
+}
+
+// JobEvent 任务状态和进度事件
+type JobEvent struct {
+	ID         uint   `json:"id"`
+	Type       string `json:"type"`
+	Target     string `json:"target"`
+	Status     string `json:"status"`
+	LinesRead  int64  `json:"lines_read"`
+	BytesRead  int64  `json:"bytes_read"`
+	TotalBytes int64  `json:"total_bytes"`
+	Bans       int    `json:"bans"`
+	Errors     int    `json:"errors"`
+}
+
+// runningJob 正在排队或执行的任务
+type runningJob struct {
+	jobType  string
+	target   string
+	cancel   context.CancelFunc
+	progress *JobProgress
+}
+
+// JobService 异步任务服务，负责日志分析等耗时任务的排队、并发限制、进度和取消
+type JobService struct {
+	db       *gorm.DB
+	eventBus *EventBus
+	slots    chan struct{}
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	running  map[uint]*runningJob
+}
+
+// NewJobService 创建任务服务
+func NewJobService(cfg *config.Config, db *gorm.DB, eventBus *EventBus) *JobService {
+	maxConcurrent := cfg.Scanner.MaxConcurrentJobs
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &JobService{
+		db:       db,
+		eventBus: eventBus,
+		slots:    make(chan struct{}, maxConcurrent),
+		ctx:      ctx,
+		cancel:   cancel,
+		running:  make(map[uint]*runningJob),
+	}
+}
+
+// Start 启动任务服务，将上次进程退出时未完成的任务标记为失败
+func (s *JobService) Start() error {
+	return s.db.Model(&model.AnalysisJob{}).
+		Where("status IN ?", []string{JobStatusPending, JobStatusRunning}).
+		Updates(model.AnalysisJob{
+			Status: JobStatusFailed,
+			Errors: []string{"服务重启，任务被中断"},
+		}).Error
+}
+
+// Stop 取消所有任务并等待其退出
+func (s *JobService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Submit 提交任务，任务会在有空闲并发槽位时执行
+func (s *JobService) Submit(jobType, target string, fn JobFunc) (*model.AnalysisJob, error) {
+	job := &model.AnalysisJob{
+		Type:   jobType,
+		Target: target,
+		Status: JobStatusPending,
+		Bans:   []string{},
+		Errors: []string{},
+	}
+	if err := s.db.Create(job).Error; err != nil {
+		return nil, fmt.Errorf("创建任务失败: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	progress := &JobProgress{}
+
+	s.mu.Lock()
+	s.running[job.ID] = &runningJob{
+		jobType:  jobType,
+		target:   target,
+		cancel:   cancel,
+		progress: progress,
+	}
+	s.mu.Unlock()
+
+	s.publishJob(job.ID, "status", JobStatusPending, progress)
+	s.wg.Add(1)
+	go s.run(ctx, job.ID, progress, fn)
+
+	return job, nil
+}
+
+// run 等待并发槽位并执行任务
+func (s *JobService) run(ctx context.Context, id uint, progress *JobProgress, fn JobFunc) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		if running, ok := s.running[id]; ok {
+			running.cancel()
+			delete(s.running, id)
+		}
+		s.mu.Unlock()
+	}()
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		s.finish(id, progress, nil, ctx.Err())
+		return
+	}
+
+	startedAt := time.Now()
+	if err := s.db.Model(&model.AnalysisJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":     JobStatusRunning,
+		"started_at": &startedAt,
+	}).Error; err != nil {
+		log.Printf("更新任务 #%d 状态失败: %v", id, err)
+	}
+	s.publishJob(id, "status", JobStatusRunning, progress)
+
+	// 定期保存进度
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(2 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.saveProgress(id, progress)
+			}
+		}
+	}()
+
+	findings, err := fn(ctx, progress)
+	close(done)
+
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	s.finish(id, progress, findings, err)
+}
+
+// saveProgress 保存任务进度
+func (s *JobService) saveProgress(id uint, progress *JobProgress) {
+	var job model.AnalysisJob
+	progress.apply(&job)
+
+	if err := s.db.Model(&model.AnalysisJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"lines_read":  job.LinesRead,
+		"bytes_read":  job.BytesRead,
+		"total_bytes": job.TotalBytes,
+	}).Error; err != nil {
+		log.Printf("保存任务 #%d 进度失败: %v", id, err)
+	}
+	s.publishJob(id, "progress", JobStatusRunning, progress)
+}
+
+// publishJob 发布任务事件，eventType为status（状态变化）或progress（运行中的进度）
+func (s *JobService) publishJob(id uint, eventType, status string, progress *JobProgress) {
+	s.mu.Lock()
+	running, ok := s.running[id]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	var job model.AnalysisJob
+	progress.apply(&job)
+	s.eventBus.Publish(EventTopicJob, eventType, JobEvent{
+		ID:         id,
+		Type:       running.jobType,
+		Target:     running.target,
+		Status:     status,
+		LinesRead:  job.LinesRead,
+		BytesRead:  job.BytesRead,
+		TotalBytes: job.TotalBytes,
+		Bans:       len(job.Bans),
+		Errors:     len(job.Errors),
+	})
+}
+
+// finish 保存任务最终状态
+func (s *JobService) finish(id uint, progress *JobProgress, findings interface{}, err error) {
+	var job model.AnalysisJob
+	if findErr := s.db.First(&job, id).Error; findErr != nil {
+		log.Printf("读取任务 #%d 失败: %v", id, findErr)
+		return
+	}
+
+	progress.apply(&job)
+	finishedAt := time.Now()
+	job.FinishedAt = &finishedAt
+	job.Findings = findings
+
+	switch {
+	case err == nil:
+		job.Status = JobStatusCompleted
+	case errors.Is(err, context.Canceled):
+		job.Status = JobStatusCancelled
+	default:
+		job.Status = JobStatusFailed
+		job.Errors = append(job.Errors, err.Error())
+	}
+
+	if saveErr := s.db.Save(&job).Error; saveErr != nil {
+		log.Printf("保存任务 #%d 结果失败: %v", id, saveErr)
+		return
+	}
+	s.publishJob(id, "status", job.Status, progress)
+	log.Printf("任务 #%d (%s) 结束: %s", id, job.Type, job.Status)
+}
+
+// GetJob 获取任务详情，运行中的任务会返回最新的内存进度
+func (s *JobService) GetJob(id uint) (*model.AnalysisJob, error) {
+	var job model.AnalysisJob
+	if err := s.db.First(&job, id).Error; err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	running, ok := s.running[id]
+	s.mu.Unlock()
+	if ok && job.Status == JobStatusRunning {
+		running.progress.apply(&job)
+	}
+
+	return &job, nil
+}
+
+// ListJobs 获取任务列表（不含详细结果），最多返回500个
+func (s *JobService) ListJobs(status, jobType string, limit int) ([]model.AnalysisJob, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	query := s.db.Omit("findings").Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var jobs []model.AnalysisJob
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+// HasActiveJob 判断是否有相同类型和目标的任务正在排队或执行
+func (s *JobService) HasActiveJob(jobType, target string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, running := range s.running {
+		if running.jobType == jobType && running.target == target {
+			return true
+		}
+	}
+	return false
+}
+
+// CancelJob 取消排队中或执行中的任务
+func (s *JobService) CancelJob(id uint) error {
+	s.mu.Lock()
+	running, ok := s.running[id]
+	s.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("任务 #%d 未在运行", id)
+	}
+
+	running.cancel()
+	return nil
+}
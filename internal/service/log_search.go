@@ -0,0 +1,409 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 结构化搜索限制
+const (
+	defaultLogQueryLimit = 100
+	maxLogQueryLimit     = 1000
+	maxLogQueryScanBytes = 64 * 1024 * 1024 // 单次请求最多扫描的字节数，超出后通过游标继续
+	logSeekWindow        = 64 * 1024        // 二分查找的最小区间和每次探测读取的字节数
+)
+
+// LogQuery 结构化日志搜索条件
+type LogQuery struct {
+	Since  time.Time // 起始时间（包含）
+	Until  time.Time // 结束时间（包含）
+	IP     string    // 精确匹配IP
+	CIDR   string    // IP所在网段
+	Jail   string    // fail2ban jail
+	Event  string    // 事件类型：fail2ban事件、SSH事件或Nginx攻击类型
+	Status string    // Nginx状态码（404、4xx）或SSH登录状态（failed/success）
+	Text   string    // 原始日志中包含的文本，不区分大小写
+	Limit  int       // 每页记录数
+	Cursor string    // 上一页返回的游标
+}
+
+// LogRecord 解析后的日志记录
+type LogRecord struct {
+	Offset   int64             `json:"offset"`
+	Time     *time.Time        `json:"time,omitempty"`
+	Type     string            `json:"type"`
+	IP       string            `json:"ip,omitempty"`
+	Fail2Ban *Fail2BanLogEntry `json:"fail2ban,omitempty"`
+	SSH      *SSHLog           `json:"ssh,omitempty"`
+	Nginx    *NginxLog         `json:"nginx,omitempty"`
+	Raw      string            `json:"raw"`
+}
+
+// LogQueryResult 结构化日志搜索结果
+type LogQueryResult struct {
+	Source       string      `json:"source"`
+	Records      []LogRecord `json:"records"`
+	NextCursor   string      `json:"next_cursor,omitempty"`
+	ScannedBytes int64       `json:"scanned_bytes"`
+	Since        *time.Time  `json:"since,omitempty"`
+	Until        *time.Time  `json:"until,omitempty"`
+}
+
+// logQueryFilter 预处理后的过滤条件
+type logQueryFilter struct {
+	query LogQuery
+	cidr  *net.IPNet
+	text  string
+}
+
+// QueryLogs 在日志源中按时间、IP、jail、事件等条件搜索，返回解析后的记录
+// 没有游标时通过二分查找定位到起始时间，结果按日志顺序分页返回
+func (s *LogSourceService) QueryLogs(name string, query LogQuery) (*LogQueryResult, error) {
+	source, ok := s.byName[name]
+	if !ok {
+		return nil, ErrLogSourceNotFound
+	}
+
+	filter, err := newLogQueryFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	query = filter.query
+
+	file, err := s.openSource(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// 确定起始位置
+	var offset int64
+	if query.Cursor != "" {
+		offset, err = strconv.ParseInt(query.Cursor, 10, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("无效的游标")
+		}
+		if offset > stat.Size() {
+			return nil, fmt.Errorf("游标超出文件范围，日志可能已轮转")
+		}
+	} else if !query.Since.IsZero() {
+		offset, err = seekLogByTime(file, stat.Size(), query.Since)
+		if err != nil {
+			return nil, fmt.Errorf("定位日志源 %s 失败: %w", name, err)
+		}
+	}
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	result := &LogQueryResult{
+		Source:  name,
+		Records: []LogRecord{},
+	}
+	if !query.Since.IsZero() {
+		result.Since = &query.Since
+	}
+	if !query.Until.IsZero() {
+		result.Until = &query.Until
+	}
+
+	reader := bufio.NewReaderSize(file, 64*1024)
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) == 0 && err != nil {
+			if err != io.EOF {
+				return nil, fmt.Errorf("读取日志源 %s 失败: %w", name, err)
+			}
+			break
+		}
+
+		lineOffset := offset
+		offset += int64(len(line))
+		result.ScannedBytes += int64(len(line))
+
+		record := parseLogRecord(source.Type, strings.TrimRight(line, "\r\n"), lineOffset)
+		if record != nil && record.Time != nil {
+			// 日志按时间顺序写入，超过结束时间后停止
+			if !query.Until.IsZero() && record.Time.After(query.Until) {
+				break
+			}
+			if !query.Since.IsZero() && record.Time.Before(query.Since) {
+				record = nil
+			}
+		}
+
+		if record != nil && filter.match(record) {
+			result.Records = append(result.Records, *record)
+			if len(result.Records) >= query.Limit {
+				result.NextCursor = strconv.FormatInt(offset, 10)
+				break
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		// 扫描量达到上限时返回游标，由调用方继续
+		if result.ScannedBytes >= maxLogQueryScanBytes {
+			result.NextCursor = strconv.FormatInt(offset, 10)
+			break
+		}
+	}
+
+	return result, nil
+}
+
+// RecentRecords 按条件向后翻页，返回最后n条匹配记录，扫描量超过maxScanBytes时提前结束
+func (s *LogSourceService) RecentRecords(name string, query LogQuery, n int, maxScanBytes int64) ([]LogRecord, error) {
+	query.Limit = maxLogQueryLimit
+
+	var records []LogRecord
+	var scanned int64
+	for {
+		result, err := s.QueryLogs(name, query)
+		if err != nil {
+			return nil, err
+		}
+
+		records = append(records, result.Records...)
+		if len(records) > n {
+			records = append([]LogRecord(nil), records[len(records)-n:]...)
+		}
+
+		scanned += result.ScannedBytes
+		if result.NextCursor == "" || scanned >= maxScanBytes {
+			break
+		}
+		query.Cursor = result.NextCursor
+	}
+
+	return records, nil
+}
+
+// newLogQueryFilter 校验并预处理搜索条件
+func newLogQueryFilter(query LogQuery) (*logQueryFilter, error) {
+	if query.Limit <= 0 {
+		query.Limit = defaultLogQueryLimit
+	}
+	if query.Limit > maxLogQueryLimit {
+		query.Limit = maxLogQueryLimit
+	}
+	if !query.Since.IsZero() && !query.Until.IsZero() && query.Until.Before(query.Since) {
+		return nil, fmt.Errorf("结束时间不能早于起始时间")
+	}
+	if query.IP != "" && net.ParseIP(query.IP) == nil {
+		return nil, fmt.Errorf("无效的IP地址: %s", query.IP)
+	}
+	if len(query.Text) > maxLogSearchPattern {
+		return nil, fmt.Errorf("搜索内容不能超过%d个字符", maxLogSearchPattern)
+	}
+
+	filter := &logQueryFilter{
+		query: query,
+		text:  strings.ToLower(query.Text),
+	}
+	if query.CIDR != "" {
+		_, cidr, err := net.ParseCIDR(query.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("无效的网段: %s", query.CIDR)
+		}
+		filter.cidr = cidr
+	}
+
+	return filter, nil
+}
+
+// match 判断记录是否满足过滤条件
+func (f *logQueryFilter) match(record *LogRecord) bool {
+	q := f.query
+
+	if q.IP != "" && !sameIP(record.IP, q.IP) {
+		return false
+	}
+	if f.cidr != nil {
+		ip := net.ParseIP(record.IP)
+		if ip == nil || !f.cidr.Contains(ip) {
+			return false
+		}
+	}
+	if q.Jail != "" && (record.Fail2Ban == nil || record.Fail2Ban.Jail != q.Jail) {
+		return false
+	}
+	if q.Event != "" && recordEvent(record) != q.Event {
+		return false
+	}
+	if q.Status != "" && !matchRecordStatus(record, q.Status) {
+		return false
+	}
+	if f.text != "" && !strings.Contains(strings.ToLower(record.Raw), f.text) {
+		return false
+	}
+
+	return true
+}
+
+// sameIP 比较两个IP是否相同（兼容IPv6的不同写法）
+func sameIP(a, b string) bool {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	if ipA == nil || ipB == nil {
+		return a == b
+	}
+	return ipA.Equal(ipB)
+}
+
+// recordEvent 获取记录的事件类型
+func recordEvent(record *LogRecord) string {
+	switch {
+	case record.Fail2Ban != nil:
+		return record.Fail2Ban.Event
+	case record.SSH != nil:
+		return record.SSH.Event
+	case record.Nginx != nil:
+		return record.Nginx.AttackType
+	}
+	return ""
+}
+
+// matchRecordStatus 匹配状态条件，Nginx支持精确状态码和4xx这样的状态码类别
+func matchRecordStatus(record *LogRecord, status string) bool {
+	switch {
+	case record.Nginx != nil:
+		code := strconv.Itoa(record.Nginx.StatusCode)
+		if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+			return code[0] == status[0]
+		}
+		return code == status
+	case record.SSH != nil:
+		return record.SSH.Status == status
+	}
+	return false
+}
+
+// parseLogRecord 按日志源类型解析一行日志，无法解析的行返回nil
+func parseLogRecord(sourceType, line string, offset int64) *LogRecord {
+	if strings.TrimSpace(line) == "" {
+		return nil
+	}
+
+	record := &LogRecord{
+		Offset: offset,
+		Type:   sourceType,
+		Raw:    line,
+	}
+
+	var timestamp time.Time
+	switch sourceType {
+	case LogSourceTypeFail2Ban:
+		entry := parseFail2BanLogLine(line)
+		if entry == nil {
+			return nil
+		}
+		record.Fail2Ban = entry
+		record.IP = entry.IP
+		timestamp = entry.Timestamp
+	case LogSourceTypeSSH:
+		entry := parseSSHLogLine(line)
+		if entry == nil {
+			return nil
+		}
+		record.SSH = entry
+		record.IP = entry.IP
+		timestamp = entry.Timestamp
+	case LogSourceTypeNginx:
+		entry := parseNginxAccessLine(line)
+		if entry == nil {
+			return nil
+		}
+		record.Nginx = entry
+		record.IP = entry.IP
+		timestamp = entry.Timestamp
+	default:
+		timestamp, _ = parseLineTimestamp(line)
+	}
+
+	if !timestamp.IsZero() {
+		record.Time = &timestamp
+	}
+	return record
+}
+
+// seekLogByTime 二分查找第一条时间不早于since的日志所在的行首位置
+// 返回的位置可能略早于目标，调用方需要继续按时间过滤
+func seekLogByTime(file *os.File, size int64, since time.Time) (int64, error) {
+	lo, hi := int64(0), size
+	for hi-lo > logSeekWindow {
+		mid := lo + (hi-lo)/2
+		timestamp, ok, err := firstTimestampAfter(file, mid)
+		if err != nil {
+			return 0, err
+		}
+		// 探测窗口内没有时间戳时保守地向前查找
+		if !ok || !timestamp.Before(since) {
+			hi = mid
+		} else {
+			lo = mid
+		}
+	}
+
+	return lineStartAfter(file, lo)
+}
+
+// firstTimestampAfter 从offset之后的第一个完整行开始，读取探测窗口内第一个可解析的时间戳
+func firstTimestampAfter(file *os.File, offset int64) (time.Time, bool, error) {
+	buf := make([]byte, logSeekWindow)
+	n, err := file.ReadAt(buf, offset)
+	if err != nil && err != io.EOF {
+		return time.Time{}, false, err
+	}
+
+	lines := strings.Split(string(buf[:n]), "\n")
+	if offset > 0 && len(lines) > 0 {
+		// 第一段可能是不完整的行
+		lines = lines[1:]
+	}
+	for _, line := range lines {
+		if timestamp, ok := parseLineTimestamp(line); ok {
+			return timestamp, true, nil
+		}
+	}
+
+	return time.Time{}, false, nil
+}
+
+// lineStartAfter 返回offset处或之后第一个行首的位置
+func lineStartAfter(file *os.File, offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+
+	buf := make([]byte, 4096)
+	pos := offset - 1
+	for {
+		n, err := file.ReadAt(buf, pos)
+		for i := 0; i < n; i++ {
+			if buf[i] == '\n' {
+				return pos + int64(i) + 1, nil
+			}
+		}
+		if err == io.EOF {
+			return pos + int64(n), nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		pos += int64(n)
+	}
+}
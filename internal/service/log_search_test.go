@@ -0,0 +1,265 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// newTestFail2BanLog 将内容写入临时的fail2ban.log，返回日志源服务和文件路径
+func newTestFail2BanLog(t *testing.T, content string) (*LogSourceService, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fail2ban.log")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Defaults()
+	cfg.Fail2Ban.LogPath = path
+	return NewLogSourceService(cfg), path
+}
+
+// testLogStart 生成的测试日志的第一条记录时间
+var testLogStart = time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+
+// fail2banBanLines 生成每秒一条的Ban日志，IP按序号递增
+func fail2banBanLines(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "%s,000 fail2ban.actions        [1234]: NOTICE  [sshd] Ban 10.%d.%d.%d\n",
+			testLogStart.Add(time.Duration(i)*time.Second).Format("2006-01-02 15:04:05"), i>>16&0xff, i>>8&0xff, i&0xff)
+	}
+	return b.String()
+}
+
+func recordIPs(records []LogRecord) []string {
+	ips := make([]string, 0, len(records))
+	for _, record := range records {
+		ips = append(ips, record.IP)
+	}
+	return ips
+}
+
+func TestQueryLogsFilters(t *testing.T) {
+	s, _ := newTestFail2BanLog(t, strings.Join([]string{
+		"2024-01-02 10:00:00,000 fail2ban.filter         [1]: INFO    [sshd] Found 192.0.2.1 - 2024-01-02 10:00:00",
+		"2024-01-02 10:00:01,000 fail2ban.actions        [1]: NOTICE  [sshd] Ban 192.0.2.1",
+		"2024-01-02 10:00:02,000 fail2ban.actions        [1]: NOTICE  [nginx-http-auth] Ban 2001:db8::1",
+		"Traceback (most recent call last):",
+		"2024-01-02 10:00:03,000 fail2ban.actions        [1]: NOTICE  [recidive] Ban 198.51.100.7",
+		"2024-01-02 11:00:01,000 fail2ban.actions        [1]: NOTICE  [sshd] Unban 192.0.2.1",
+	}, "\n")+"\n")
+
+	tests := []struct {
+		name  string
+		query LogQuery
+		ips   []string
+	}{
+		// 无法解析的行不返回
+		{"不过滤", LogQuery{}, []string{"192.0.2.1", "192.0.2.1", "2001:db8::1", "198.51.100.7", "192.0.2.1"}},
+		{"IP", LogQuery{IP: "192.0.2.1"}, []string{"192.0.2.1", "192.0.2.1", "192.0.2.1"}},
+		{"IPv6的不同写法", LogQuery{IP: "2001:0db8:0:0::1"}, []string{"2001:db8::1"}},
+		{"网段", LogQuery{CIDR: "198.51.100.0/24"}, []string{"198.51.100.7"}},
+		{"IPv6网段", LogQuery{CIDR: "2001:db8::/32"}, []string{"2001:db8::1"}},
+		{"jail", LogQuery{Jail: "sshd"}, []string{"192.0.2.1", "192.0.2.1", "192.0.2.1"}},
+		{"事件", LogQuery{Event: Fail2BanEventBan}, []string{"192.0.2.1", "2001:db8::1", "198.51.100.7"}},
+		{"组合条件", LogQuery{Jail: "sshd", Event: Fail2BanEventUnban}, []string{"192.0.2.1"}},
+		{"文本不区分大小写", LogQuery{Text: "NGINX-HTTP"}, []string{"2001:db8::1"}},
+		{"没有匹配", LogQuery{IP: "203.0.113.1"}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.QueryLogs("fail2ban", tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := recordIPs(result.Records); !reflect.DeepEqual(got, tt.ips) {
+				t.Errorf("IPs = %v, want %v", got, tt.ips)
+			}
+			if result.NextCursor != "" {
+				t.Errorf("读完文件后 NextCursor = %q", result.NextCursor)
+			}
+		})
+	}
+
+	for _, query := range []LogQuery{
+		{IP: "not-an-ip"},
+		{CIDR: "192.0.2.0/33"},
+		{Text: strings.Repeat("a", maxLogSearchPattern+1)},
+		{Since: testLogStart.Add(time.Hour), Until: testLogStart},
+		{Cursor: "abc"},
+		{Cursor: "-1"},
+		{Cursor: "1000000"},
+	} {
+		if _, err := s.QueryLogs("fail2ban", query); err == nil {
+			t.Errorf("QueryLogs(%+v) 没有返回错误", query)
+		}
+	}
+}
+
+func TestQueryLogsCursor(t *testing.T) {
+	s, _ := newTestFail2BanLog(t, fail2banBanLines(10))
+
+	var ips []string
+	query := LogQuery{Limit: 3}
+	pages := 0
+	for {
+		result, err := s.QueryLogs("fail2ban", query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		ips = append(ips, recordIPs(result.Records)...)
+		if result.NextCursor == "" {
+			break
+		}
+		if len(result.Records) != 3 {
+			t.Fatalf("第%d页 len(Records) = %d, want 3", pages, len(result.Records))
+		}
+		// 游标指向下一行的行首
+		last := result.Records[len(result.Records)-1]
+		if want := strconv.FormatInt(last.Offset+int64(len(last.Raw))+1, 10); result.NextCursor != want {
+			t.Fatalf("NextCursor = %s, want %s", result.NextCursor, want)
+		}
+		query.Cursor = result.NextCursor
+	}
+
+	if pages != 4 || len(ips) != 10 {
+		t.Fatalf("pages = %d, len(ips) = %d", pages, len(ips))
+	}
+	for i, ip := range ips {
+		if want := fmt.Sprintf("10.0.0.%d", i); ip != want {
+			t.Errorf("ips[%d] = %s, want %s", i, ip, want)
+		}
+	}
+
+	records, err := s.RecentRecords("fail2ban", LogQuery{}, 4, maxLogQueryScanBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := recordIPs(records); !reflect.DeepEqual(got, []string{"10.0.0.6", "10.0.0.7", "10.0.0.8", "10.0.0.9"}) {
+		t.Errorf("RecentRecords = %v", got)
+	}
+}
+
+func TestQueryLogsTimeRange(t *testing.T) {
+	// 远大于二分查找窗口，确保按时间定位而不是从头扫描
+	const n = 20000
+	content := fail2banBanLines(n)
+	s, path := newTestFail2BanLog(t, content)
+	at := func(i int) time.Time {
+		return testLogStart.Add(time.Duration(i) * time.Second)
+	}
+	ip := func(i int) string {
+		return fmt.Sprintf("10.%d.%d.%d", i>>16&0xff, i>>8&0xff, i&0xff)
+	}
+
+	tests := []struct {
+		name         string
+		since, until time.Time
+		first, last  int // 期望返回的第一条和最后一条，first为-1表示没有记录
+	}{
+		// 起止时间都包含在内
+		{"中间区间", at(12345), at(12350), 12345, 12350},
+		{"单个时间点", at(15000), at(15000), 15000, 15000},
+		{"文件开头", at(0), at(2), 0, 2},
+		{"早于第一条", at(-100), at(1), 0, 1},
+		{"文件末尾", at(n - 3), time.Time{}, n - 3, n - 1},
+		{"晚于最后一条", at(n + 10), time.Time{}, -1, -1},
+		{"区间内没有记录", at(100).Add(300 * time.Millisecond), at(100).Add(600 * time.Millisecond), -1, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.QueryLogs("fail2ban", LogQuery{Since: tt.since, Until: tt.until, Limit: maxLogQueryLimit})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.first < 0 {
+				if len(result.Records) != 0 {
+					t.Fatalf("Records = %v, want none", recordIPs(result.Records))
+				}
+				return
+			}
+			if len(result.Records) != tt.last-tt.first+1 {
+				t.Fatalf("len(Records) = %d, want %d", len(result.Records), tt.last-tt.first+1)
+			}
+			if got := result.Records[0].IP; got != ip(tt.first) {
+				t.Errorf("第一条 = %s, want %s", got, ip(tt.first))
+			}
+			if got := result.Records[len(result.Records)-1].IP; got != ip(tt.last) {
+				t.Errorf("最后一条 = %s, want %s", got, ip(tt.last))
+			}
+		})
+	}
+
+	// 定位后只扫描起始时间附近的内容，超过结束时间后停止
+	result, err := s.QueryLogs("fail2ban", LogQuery{Since: at(12345), Until: at(12350)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ScannedBytes > 3*logSeekWindow {
+		t.Errorf("ScannedBytes = %d, 没有按时间定位", result.ScannedBytes)
+	}
+
+	// 定位结果是行首，且不晚于第一条匹配的记录
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	for _, i := range []int{0, 1, 777, 12345, n - 1} {
+		offset, err := seekLogByTime(file, int64(len(content)), at(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := int64(strings.Index(content, " Ban "+ip(i)+"\n"))
+		target = int64(strings.LastIndex(content[:target], "\n") + 1)
+		if offset > target || target-offset > 2*logSeekWindow || (offset > 0 && content[offset-1] != '\n') {
+			t.Errorf("seekLogByTime(%d) = %d, 目标行位于 %d", i, offset, target)
+		}
+	}
+}
+
+func TestQueryLogsScanLimit(t *testing.T) {
+	// 超过单次扫描上限的不匹配内容，最后一行是唯一的匹配
+	line := strings.Repeat("x", 1023) + "\n"
+	lines := maxLogQueryScanBytes/len(line) + 10
+	content := strings.Repeat(line, lines) +
+		"2024-01-02 10:00:00,000 fail2ban.actions        [1]: NOTICE  [sshd] Ban 192.0.2.1\n"
+	s, _ := newTestFail2BanLog(t, content)
+
+	result, err := s.QueryLogs("fail2ban", LogQuery{IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Records) != 0 {
+		t.Fatalf("len(Records) = %d, want 0", len(result.Records))
+	}
+	if result.ScannedBytes != maxLogQueryScanBytes || result.NextCursor != strconv.Itoa(maxLogQueryScanBytes) {
+		t.Fatalf("ScannedBytes = %d, NextCursor = %s, want %d", result.ScannedBytes, result.NextCursor, maxLogQueryScanBytes)
+	}
+
+	// 从游标继续扫描剩余内容
+	result, err = s.QueryLogs("fail2ban", LogQuery{IP: "192.0.2.1", Cursor: result.NextCursor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Records) != 1 || result.NextCursor != "" || result.ScannedBytes != int64(len(content))-maxLogQueryScanBytes {
+		t.Fatalf("len(Records) = %d, NextCursor = %q, ScannedBytes = %d", len(result.Records), result.NextCursor, result.ScannedBytes)
+	}
+
+	// RecentRecords受调用方的扫描上限约束
+	records, err := s.RecentRecords("fail2ban", LogQuery{IP: "192.0.2.1"}, 10, maxLogQueryScanBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 0 {
+		t.Errorf("RecentRecords 超过扫描上限后仍返回 %d 条记录", len(records))
+	}
+}
@@ -0,0 +1,467 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// 日志源类型
+const (
+	LogSourceTypeFail2Ban = "fail2ban"
+	LogSourceTypeSSH      = "ssh"
+	LogSourceTypeNginx    = "nginx"
+	LogSourceTypeOther    = "other"
+)
+
+// 搜索限制
+const (
+	maxLogSearchLimit   = 1000
+	maxLogSearchContext = 10
+	maxLogSearchPattern = 512
+)
+
+// ErrLogSourceNotFound 日志源不存在
+var ErrLogSourceNotFound = errors.New("log source not found")
+
+// LogSource 由管理员配置的命名日志源，API只能通过名称引用
+type LogSource struct {
+	Name    string     `json:"name"`
+	Type    string     `json:"type"`
+	Path    string     `json:"path"`
+	Exists  bool       `json:"exists"`
+	Size    int64      `json:"size"`
+	ModTime *time.Time `json:"mod_time,omitempty"`
+}
+
+// LogSearchOptions 日志搜索条件
+type LogSearchOptions struct {
+	Query         string    // 搜索内容，为空时匹配所有行
+	Regex         bool      // 按正则表达式匹配
+	CaseSensitive bool      // 区分大小写
+	Limit         int       // 返回最近的匹配条数
+	Context       int       // 匹配行前后的上下文行数
+	Since         time.Time // 起始时间（包含）
+	Until         time.Time // 结束时间（包含）
+}
+
+// LogSearchMatch 匹配的日志行
+type LogSearchMatch struct {
+	LineNumber int        `json:"line_number"`
+	Line       string     `json:"line"`
+	Time       *time.Time `json:"time,omitempty"`
+	Before     []string   `json:"before,omitempty"`
+	After      []string   `json:"after,omitempty"`
+}
+
+// LogSearchResult 日志搜索结果
+type LogSearchResult struct {
+	Source     string           `json:"source"`
+	Matches    []LogSearchMatch `json:"matches"`
+	TotalFound int              `json:"total_found"`
+	Truncated  bool             `json:"truncated"`
+	LinesRead  int              `json:"lines_read"`
+}
+
+// LogSourceService 日志源服务，维护命名日志源并在进程内完成日志读取和搜索
+type LogSourceService struct {
+	sources []*LogSource
+	byName  map[string]*LogSource
+}
+
+// NewLogSourceService 创建日志源服务，内置fail2ban/ssh/nginx日志源，并加载LOG_SOURCES中的自定义日志源
+func NewLogSourceService(cfg *config.Config) *LogSourceService {
+	s := &LogSourceService{
+		byName: make(map[string]*LogSource),
+	}
+
+	s.addSource("fail2ban", LogSourceTypeFail2Ban, cfg.Fail2Ban.LogPath)
+	s.addSource("ssh", LogSourceTypeSSH, cfg.Fail2Ban.SSHLogPath)
+	s.addSource("nginx-access", LogSourceTypeNginx, cfg.Fail2Ban.NginxAccessLog)
+	s.addSource("nginx-error", LogSourceTypeOther, cfg.Fail2Ban.NginxErrorLog)
+
+	for _, spec := range cfg.Fail2Ban.LogSources {
+		name, sourceType, path, err := parseLogSourceSpec(spec)
+		if err != nil {
+			log.Printf("忽略无效的日志源配置 %q: %v", spec, err)
+			continue
+		}
+		s.addSource(name, sourceType, path)
+	}
+
+	return s
+}
+
+// parseLogSourceSpec 解析日志源配置，格式 name[:type]=path
+func parseLogSourceSpec(spec string) (name, sourceType, path string, err error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("格式应为 name[:type]=path")
+	}
+
+	name = strings.TrimSpace(parts[0])
+	path = strings.TrimSpace(parts[1])
+	sourceType = LogSourceTypeOther
+	if idx := strings.Index(name, ":"); idx >= 0 {
+		sourceType = strings.TrimSpace(name[idx+1:])
+		name = strings.TrimSpace(name[:idx])
+	}
+
+	if name == "" || path == "" {
+		return "", "", "", fmt.Errorf("名称和路径不能为空")
+	}
+	switch sourceType {
+	case LogSourceTypeFail2Ban, LogSourceTypeSSH, LogSourceTypeNginx, LogSourceTypeOther:
+	default:
+		return "", "", "", fmt.Errorf("未知的日志源类型: %s", sourceType)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "", "", "", fmt.Errorf("路径必须是绝对路径")
+	}
+
+	return name, sourceType, path, nil
+}
+
+// addSource 添加日志源，同名日志源会被覆盖
+func (s *LogSourceService) addSource(name, sourceType, path string) {
+	if path == "" {
+		return
+	}
+
+	if existing, ok := s.byName[name]; ok {
+		existing.Type = sourceType
+		existing.Path = path
+		return
+	}
+
+	source := &LogSource{Name: name, Type: sourceType, Path: path}
+	s.sources = append(s.sources, source)
+	s.byName[name] = source
+}
+
+// ListSources 获取所有日志源及其文件状态
+func (s *LogSourceService) ListSources() []LogSource {
+	sources := make([]LogSource, 0, len(s.sources))
+	for _, source := range s.sources {
+		sources = append(sources, statLogSource(*source))
+	}
+	return sources
+}
+
+// GetSource 根据名称获取日志源
+func (s *LogSourceService) GetSource(name string) (*LogSource, error) {
+	source, ok := s.byName[name]
+	if !ok {
+		return nil, ErrLogSourceNotFound
+	}
+
+	stated := statLogSource(*source)
+	return &stated, nil
+}
+
+// RotationPatterns 日志源当前文件及其轮转文件（access.log.1、access.log.2.gz等）的匹配模式
+func (s LogSource) RotationPatterns() []string {
+	escaped := globMetaReplacer.Replace(s.Path)
+	return []string{escaped, escaped + ".*"}
+}
+
+// globMetaReplacer 转义路径中的通配符，避免日志源路径被当作匹配模式
+var globMetaReplacer = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+// statLogSource 填充日志源的文件状态
+func statLogSource(source LogSource) LogSource {
+	stat, err := os.Stat(source.Path)
+	if err != nil || !stat.Mode().IsRegular() {
+		return source
+	}
+
+	modTime := stat.ModTime()
+	source.Exists = true
+	source.Size = stat.Size()
+	source.ModTime = &modTime
+	return source
+}
+
+// openSource 打开日志源文件
+func (s *LogSourceService) openSource(name string) (*os.File, error) {
+	source, ok := s.byName[name]
+	if !ok {
+		return nil, ErrLogSourceNotFound
+	}
+
+	stat, err := os.Stat(source.Path)
+	if err != nil {
+		return nil, fmt.Errorf("无法访问日志源 %s: %w", name, err)
+	}
+	if !stat.Mode().IsRegular() {
+		return nil, fmt.Errorf("日志源 %s 不是普通文件", name)
+	}
+
+	return os.Open(source.Path)
+}
+
+// TailLines 读取日志源末尾的n行（忽略空行）
+func (s *LogSourceService) TailLines(name string, n int) ([]string, error) {
+	file, err := s.openSource(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// 从文件末尾向前按块读取，直到凑够n行
+	const chunkSize = 64 * 1024
+	offset := stat.Size()
+	var data []byte
+	for offset > 0 && bytes.Count(data, []byte("\n")) <= n {
+		readSize := int64(chunkSize)
+		if offset < readSize {
+			readSize = offset
+		}
+		offset -= readSize
+
+		chunk := make([]byte, readSize)
+		if _, err := file.ReadAt(chunk, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("读取日志源 %s 失败: %w", name, err)
+		}
+		data = append(chunk, data...)
+	}
+
+	var lines []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) != "" {
+			lines = append(lines, line)
+		}
+	}
+	if offset > 0 && len(lines) > 0 {
+		// 第一行可能不完整
+		lines = lines[1:]
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+
+	return lines, nil
+}
+
+// Search 在日志源中搜索，返回最近的Limit条匹配
+func (s *LogSourceService) Search(name string, opts LogSearchOptions) (*LogSearchResult, error) {
+	matcher, err := newLogMatcher(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Limit <= 0 || opts.Limit > maxLogSearchLimit {
+		opts.Limit = maxLogSearchLimit
+	}
+	if opts.Context < 0 {
+		opts.Context = 0
+	}
+	if opts.Context > maxLogSearchContext {
+		opts.Context = maxLogSearchContext
+	}
+
+	file, err := s.openSource(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	result := &LogSearchResult{
+		Source:  name,
+		Matches: []LogSearchMatch{},
+	}
+	filterByTime := !opts.Since.IsZero() || !opts.Until.IsZero()
+
+	before := newLineRing(opts.Context) // 最近的上下文行
+	var pending []int                   // 等待后续上下文的匹配下标
+	var lastTime time.Time              // 没有时间戳的行（如堆栈）沿用上一行的时间
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		result.LinesRead++
+
+		// 补充之前匹配的后续上下文
+		if len(pending) > 0 {
+			remaining := pending[:0]
+			for _, idx := range pending {
+				match := &result.Matches[idx]
+				match.After = append(match.After, line)
+				if len(match.After) < opts.Context {
+					remaining = append(remaining, idx)
+				}
+			}
+			pending = remaining
+		}
+
+		if timestamp, ok := parseLineTimestamp(line); ok {
+			lastTime = timestamp
+		}
+
+		matched := matcher(line)
+		if matched && filterByTime {
+			matched = !lastTime.IsZero() &&
+				(opts.Since.IsZero() || !lastTime.Before(opts.Since)) &&
+				(opts.Until.IsZero() || !lastTime.After(opts.Until))
+		}
+
+		if matched {
+			result.TotalFound++
+			match := LogSearchMatch{
+				LineNumber: result.LinesRead,
+				Line:       line,
+			}
+			if !lastTime.IsZero() {
+				timestamp := lastTime
+				match.Time = &timestamp
+			}
+			if opts.Context > 0 {
+				match.Before = before.lines()
+			}
+
+			// 只保留最近的Limit条匹配
+			if len(result.Matches) >= opts.Limit {
+				result.Matches = append(result.Matches[:0], result.Matches[1:]...)
+				result.Truncated = true
+				for i := range pending {
+					pending[i]--
+				}
+				if len(pending) > 0 && pending[0] < 0 {
+					pending = pending[1:]
+				}
+			}
+			result.Matches = append(result.Matches, match)
+			if opts.Context > 0 {
+				pending = append(pending, len(result.Matches)-1)
+			}
+		}
+
+		before.push(line)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取日志源 %s 失败: %w", name, err)
+	}
+
+	return result, nil
+}
+
+// lineRing 固定容量的环形缓冲，保存最近的若干行
+type lineRing struct {
+	buf   []string
+	start int // 最早一行的位置
+	count int
+}
+
+// newLineRing 创建容量为size的环形缓冲，size为0时不保存任何行
+func newLineRing(size int) *lineRing {
+	return &lineRing{buf: make([]string, size)}
+}
+
+// push 追加一行，缓冲已满时覆盖最早的一行
+func (r *lineRing) push(line string) {
+	if len(r.buf) == 0 {
+		return
+	}
+	if r.count < len(r.buf) {
+		r.buf[(r.start+r.count)%len(r.buf)] = line
+		r.count++
+		return
+	}
+	r.buf[r.start] = line
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// lines 按从早到晚的顺序返回缓冲中的行
+func (r *lineRing) lines() []string {
+	result := make([]string, r.count)
+	for i := range result {
+		result[i] = r.buf[(r.start+i)%len(r.buf)]
+	}
+	return result
+}
+
+// newLogMatcher 根据搜索条件创建行匹配函数
+func newLogMatcher(opts LogSearchOptions) (func(string) bool, error) {
+	if opts.Query == "" {
+		return func(string) bool { return true }, nil
+	}
+	if len(opts.Query) > maxLogSearchPattern {
+		return nil, fmt.Errorf("搜索内容不能超过%d个字符", maxLogSearchPattern)
+	}
+
+	if opts.Regex {
+		pattern := opts.Query
+		if !opts.CaseSensitive {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("无效的正则表达式: %w", err)
+		}
+		return re.MatchString, nil
+	}
+
+	if opts.CaseSensitive {
+		return func(line string) bool {
+			return strings.Contains(line, opts.Query)
+		}, nil
+	}
+
+	query := strings.ToLower(opts.Query)
+	return func(line string) bool {
+		return strings.Contains(strings.ToLower(line), query)
+	}, nil
+}
+
+// logTimestampPatterns 常见日志的时间戳格式
+var logTimestampPatterns = []struct {
+	re     *regexp.Regexp
+	layout string
+}{
+	// fail2ban: 2024-01-02 15:04:05,123
+	{regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2})`), "2006-01-02 15:04:05"},
+	// ISO8601 / journald: 2024-01-02T15:04:05
+	{regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2})`), "2006-01-02T15:04:05"},
+	// nginx error.log: 2024/01/02 15:04:05
+	{regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2})`), "2006/01/02 15:04:05"},
+	// nginx access.log: [02/Jan/2006:15:04:05 -0700]
+	{regexp.MustCompile(`\[(\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4})\]`), "02/Jan/2006:15:04:05 -0700"},
+}
+
+// syslogTimestampRegex syslog时间戳：Jan  2 15:04:05
+var syslogTimestampRegex = regexp.MustCompile(`^[A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}`)
+
+// parseLineTimestamp 解析日志行中的时间戳
+func parseLineTimestamp(line string) (time.Time, bool) {
+	for _, pattern := range logTimestampPatterns {
+		if m := pattern.re.FindStringSubmatch(line); m != nil {
+			if timestamp, err := time.ParseInLocation(pattern.layout, m[1], time.Local); err == nil {
+				return timestamp, true
+			}
+		}
+	}
+
+	if syslogTimestampRegex.MatchString(line) {
+		if timestamp, err := parseLogTimestamp(line); err == nil {
+			return timestamp, true
+		}
+	}
+
+	return time.Time{}, false
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// newTestLogSources 将lines写入临时文件并注册为other类型的app日志源
+func newTestLogSources(t *testing.T, lines ...string) *LogSourceService {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.Defaults()
+	cfg.Fail2Ban.LogSources = []string{"app=" + path}
+	return NewLogSourceService(cfg)
+}
+
+func TestLineRing(t *testing.T) {
+	tests := []struct {
+		name   string
+		size   int
+		pushed []string
+		want   []string
+	}{
+		{"容量为0", 0, []string{"a", "b"}, []string{}},
+		{"未满", 3, []string{"a", "b"}, []string{"a", "b"}},
+		{"刚好填满", 3, []string{"a", "b", "c"}, []string{"a", "b", "c"}},
+		{"覆盖最早的行", 3, []string{"a", "b", "c", "d", "e"}, []string{"c", "d", "e"}},
+		{"多次绕回", 2, []string{"a", "b", "c", "d", "e", "f", "g"}, []string{"f", "g"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ring := newLineRing(tt.size)
+			for _, line := range tt.pushed {
+				ring.push(line)
+			}
+			if got := ring.lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("lines() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// 返回的切片不受后续写入影响
+	ring := newLineRing(2)
+	ring.push("a")
+	got := ring.lines()
+	ring.push("b")
+	ring.push("c")
+	if !reflect.DeepEqual(got, []string{"a"}) {
+		t.Errorf("lines() 被后续写入修改为 %v", got)
+	}
+}
+
+func TestSearchContext(t *testing.T) {
+	s := newTestLogSources(t,
+		"l1 match",
+		"l2",
+		"l3",
+		"l4 match",
+		"l5 match",
+		"l6",
+		"l7",
+		"l8",
+		"l9 match",
+	)
+
+	result, err := s.Search("app", LogSearchOptions{Query: "MATCH", Context: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalFound != 4 || result.Truncated || result.LinesRead != 9 {
+		t.Fatalf("TotalFound = %d, Truncated = %v, LinesRead = %d", result.TotalFound, result.Truncated, result.LinesRead)
+	}
+
+	want := []LogSearchMatch{
+		// 文件开头没有前置上下文
+		{LineNumber: 1, Line: "l1 match", After: []string{"l2", "l3"}},
+		{LineNumber: 4, Line: "l4 match", Before: []string{"l2", "l3"}, After: []string{"l5 match", "l6"}},
+		// 相邻匹配的上下文互相包含
+		{LineNumber: 5, Line: "l5 match", Before: []string{"l3", "l4 match"}, After: []string{"l6", "l7"}},
+		// 文件末尾没有后续上下文
+		{LineNumber: 9, Line: "l9 match", Before: []string{"l7", "l8"}},
+	}
+	if len(result.Matches) != len(want) {
+		t.Fatalf("len(Matches) = %d, want %d", len(result.Matches), len(want))
+	}
+	for i, match := range result.Matches {
+		if match.LineNumber != want[i].LineNumber || match.Line != want[i].Line ||
+			len(match.Before) != len(want[i].Before) || len(match.After) != len(want[i].After) ||
+			(len(want[i].Before) > 0 && !reflect.DeepEqual(match.Before, want[i].Before)) ||
+			(len(want[i].After) > 0 && !reflect.DeepEqual(match.After, want[i].After)) {
+			t.Errorf("Matches[%d] = %+v, want %+v", i, match, want[i])
+		}
+	}
+
+	// 上下文行数有上限
+	result, err = s.Search("app", LogSearchOptions{Query: "l9", Context: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(result.Matches[0].Before); got != 8 {
+		t.Errorf("len(Before) = %d, want 8", got)
+	}
+}
+
+func TestSearchLimitKeepsLatestMatches(t *testing.T) {
+	s := newTestLogSources(t, "m1", "x", "m2", "m3", "x", "m4", "tail")
+
+	result, err := s.Search("app", LogSearchOptions{Query: "m", Limit: 2, Context: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.TotalFound != 4 || !result.Truncated || len(result.Matches) != 2 {
+		t.Fatalf("TotalFound = %d, Truncated = %v, len(Matches) = %d", result.TotalFound, result.Truncated, len(result.Matches))
+	}
+	// 丢弃较早的匹配后，等待中的后续上下文仍写入正确的匹配
+	m3, m4 := result.Matches[0], result.Matches[1]
+	if m3.Line != "m3" || !reflect.DeepEqual(m3.Before, []string{"m2"}) || !reflect.DeepEqual(m3.After, []string{"x"}) {
+		t.Errorf("Matches[0] = %+v", m3)
+	}
+	if m4.Line != "m4" || !reflect.DeepEqual(m4.Before, []string{"x"}) || !reflect.DeepEqual(m4.After, []string{"tail"}) {
+		t.Errorf("Matches[1] = %+v", m4)
+	}
+}
+
+func TestSearchTimeRange(t *testing.T) {
+	s := newTestLogSources(t,
+		"2024-01-02 10:00:00,000 fail2ban.actions [1]: NOTICE [sshd] Ban 192.0.2.1",
+		"2024-01-02 11:00:00,000 fail2ban.actions [1]: NOTICE [sshd] Ban 192.0.2.2",
+		"Traceback 192.0.2.9",
+		"2024-01-02 12:00:00,000 fail2ban.actions [1]: NOTICE [sshd] Ban 192.0.2.3",
+		"2024-01-02 13:00:00,000 fail2ban.actions [1]: NOTICE [sshd] Ban 192.0.2.4",
+	)
+	at := func(hour int) time.Time {
+		return time.Date(2024, 1, 2, hour, 0, 0, 0, time.Local)
+	}
+
+	tests := []struct {
+		name  string
+		opts  LogSearchOptions
+		lines []int
+	}{
+		{"不限时间", LogSearchOptions{Query: "192.0.2."}, []int{1, 2, 3, 4, 5}},
+		// 起止时间都包含在内，没有时间戳的行沿用上一行的时间
+		{"闭区间", LogSearchOptions{Query: "192.0.2.", Since: at(11), Until: at(12)}, []int{2, 3, 4}},
+		{"只有起始时间", LogSearchOptions{Query: "192.0.2.", Since: at(12)}, []int{4, 5}},
+		{"只有结束时间", LogSearchOptions{Query: "192.0.2.", Until: at(10)}, []int{1}},
+		{"区间内没有日志", LogSearchOptions{Query: "192.0.2.", Since: at(14)}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Search("app", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var lines []int
+			for _, match := range result.Matches {
+				lines = append(lines, match.LineNumber)
+				if match.Time == nil {
+					t.Errorf("第%d行没有时间", match.LineNumber)
+				}
+			}
+			if !reflect.DeepEqual(lines, tt.lines) {
+				t.Errorf("匹配行 = %v, want %v", lines, tt.lines)
+			}
+		})
+	}
+
+	// 时间过滤前的行没有时间戳时不匹配
+	s = newTestLogSources(t, "no timestamp 192.0.2.1", "2024-01-02 10:00:00,000 x 192.0.2.2")
+	result, err := s.Search("app", LogSearchOptions{Query: "192.0.2.", Since: at(9)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Matches) != 1 || result.Matches[0].LineNumber != 2 {
+		t.Errorf("Matches = %+v", result.Matches)
+	}
+}
+
+func TestSearchMatcher(t *testing.T) {
+	s := newTestLogSources(t, "Failed password for root", "failed password for admin", "Accepted publickey")
+
+	tests := []struct {
+		name  string
+		opts  LogSearchOptions
+		found int
+	}{
+		{"空查询匹配所有行", LogSearchOptions{}, 3},
+		{"默认不区分大小写", LogSearchOptions{Query: "FAILED"}, 2},
+		{"区分大小写", LogSearchOptions{Query: "Failed", CaseSensitive: true}, 1},
+		{"正则", LogSearchOptions{Query: `for (root|admin)$`, Regex: true}, 2},
+		{"区分大小写的正则", LogSearchOptions{Query: `^failed`, Regex: true, CaseSensitive: true}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := s.Search("app", tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.TotalFound != tt.found {
+				t.Errorf("TotalFound = %d, want %d", result.TotalFound, tt.found)
+			}
+		})
+	}
+
+	if _, err := s.Search("app", LogSearchOptions{Query: "(", Regex: true}); err == nil {
+		t.Error("无效的正则表达式没有返回错误")
+	}
+	if _, err := s.Search("app", LogSearchOptions{Query: strings.Repeat("a", maxLogSearchPattern+1)}); err == nil {
+		t.Error("超长的搜索内容没有返回错误")
+	}
+	if _, err := s.Search("missing", LogSearchOptions{}); !errors.Is(err, ErrLogSourceNotFound) {
+		t.Errorf("Search(missing) error = %v, want ErrLogSourceNotFound", err)
+	}
+}
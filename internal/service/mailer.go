@@ -0,0 +1,212 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// SMTP加密方式
+const (
+	SMTPTLSStartTLS = "starttls" // 明文连接后升级，服务器不支持STARTTLS时拒绝发送
+	SMTPTLSImplicit = "tls"      // 直接建立TLS连接（通常为465端口）
+	SMTPTLSNone     = "none"     // 不加密，只适用于本机或内网的中继
+)
+
+const (
+	smtpDialTimeout = 15 * time.Second
+	smtpSendTimeout = time.Minute
+)
+
+var ErrSMTPNotConfigured = errors.New("smtp is not configured")
+
+// Mailer 通过SMTP发送包含纯文本和HTML两个版本的邮件
+type Mailer struct {
+	mu     sync.RWMutex
+	config config.SMTPConfig
+}
+
+// NewMailer 创建邮件发送器
+func NewMailer(cfg *config.Config) *Mailer {
+	return &Mailer{config: cfg.SMTP}
+}
+
+// ApplyConfig 热加载SMTP配置，之后发送的邮件使用新配置
+func (m *Mailer) ApplyConfig(cfg *config.Config) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.config = cfg.SMTP
+}
+
+// smtpConfig 当前SMTP配置
+func (m *Mailer) smtpConfig() config.SMTPConfig {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.config
+}
+
+// Enabled 是否配置了SMTP服务器
+func (m *Mailer) Enabled() bool {
+	return m.smtpConfig().Host != ""
+}
+
+// Send 发送邮件，html为空时只发送纯文本
+func (m *Mailer) Send(to []string, subject, text, html string) error {
+	cfg := m.smtpConfig()
+	if cfg.Host == "" {
+		return ErrSMTPNotConfigured
+	}
+	if len(to) == 0 {
+		return fmt.Errorf("收件人不能为空")
+	}
+
+	// From可以包含显示名称，信封发件人只使用邮件地址
+	sender, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return fmt.Errorf("无效的发件人地址 %s: %w", cfg.From, err)
+	}
+	message, err := buildMailMessage(cfg.From, to, subject, text, html)
+	if err != nil {
+		return err
+	}
+
+	client, err := dialSMTP(cfg)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if cfg.Username != "" {
+		// PlainAuth只允许在TLS连接或本机上发送密码
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP认证失败: %w", err)
+		}
+	}
+	if err := client.Mail(sender.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM失败: %w", err)
+	}
+	for _, rcpt := range to {
+		if err := client.Rcpt(rcpt); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s 失败: %w", rcpt, err)
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA失败: %w", err)
+	}
+	if _, err := w.Write(message); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("发送邮件内容失败: %w", err)
+	}
+	return client.Quit()
+}
+
+// dialSMTP 连接SMTP服务器并按配置启用TLS
+func dialSMTP(cfg config.SMTPConfig) (*smtp.Client, error) {
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	tlsConfig := &tls.Config{ServerName: cfg.Host}
+	dialer := &net.Dialer{Timeout: smtpDialTimeout}
+
+	var conn net.Conn
+	var err error
+	if cfg.TLSMode == SMTPTLSImplicit {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("连接SMTP服务器 %s 失败: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(smtpSendTimeout))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SMTP握手失败: %w", err)
+	}
+
+	if cfg.TLSMode == SMTPTLSStartTLS || cfg.TLSMode == "" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("SMTP服务器 %s 不支持STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("SMTP STARTTLS失败: %w", err)
+		}
+	}
+	return client, nil
+}
+
+// buildMailMessage 生成multipart/alternative格式的邮件
+func buildMailMessage(from string, to []string, subject, text, html string) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	var id [12]byte
+	rand.Read(id[:])
+	host := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		host = strings.Trim(from[at+1:], "> ")
+	}
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id[:]), host)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+
+	parts := []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	}
+	for _, part := range parts {
+		if part.body == "" {
+			continue
+		}
+		w, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
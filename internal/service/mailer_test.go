@@ -0,0 +1,329 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"fail2ban-web/config"
+)
+
+// testSMTPMessage 测试SMTP服务器收到的一封邮件
+type testSMTPMessage struct {
+	From string
+	To   []string
+	Data []byte
+}
+
+// testSMTPServer 只实现发送邮件所需命令的进程内SMTP服务器
+type testSMTPServer struct {
+	listener   net.Listener
+	extensions []string
+
+	mu       sync.Mutex
+	commands []string
+	messages []testSMTPMessage
+	wg       sync.WaitGroup
+}
+
+// newTestSMTPServer 启动测试SMTP服务器，extensions为EHLO响应中通告的扩展
+func newTestSMTPServer(t *testing.T, extensions ...string) *testSMTPServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &testSMTPServer{listener: listener, extensions: extensions}
+	server.wg.Add(1)
+	go server.serve()
+	t.Cleanup(func() {
+		listener.Close()
+		server.wg.Wait()
+	})
+	return server
+}
+
+// config 连接到测试服务器的SMTP配置
+func (s *testSMTPServer) config(tlsMode string) config.SMTPConfig {
+	addr := s.listener.Addr().(*net.TCPAddr)
+	return config.SMTPConfig{
+		Host:    addr.IP.String(),
+		Port:    addr.Port,
+		From:    "fail2ban-web <alerts@example.com>",
+		TLSMode: tlsMode,
+	}
+}
+
+func (s *testSMTPServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer conn.Close()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *testSMTPServer) handle(conn net.Conn) {
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP test")
+	var current testSMTPMessage
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+
+		s.mu.Lock()
+		s.commands = append(s.commands, verb)
+		s.mu.Unlock()
+
+		switch verb {
+		case "EHLO":
+			lines := append([]string{"localhost"}, s.extensions...)
+			for i, ext := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				reply("250" + sep + ext)
+			}
+		case "MAIL":
+			// 忽略 BODY=8BITMIME 等参数
+			from, _, _ := strings.Cut(line[len("MAIL FROM:"):], " ")
+			current = testSMTPMessage{From: from}
+			reply("250 OK")
+		case "RCPT":
+			current.To = append(current.To, line[len("RCPT TO:"):])
+			reply("250 OK")
+		case "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data bytes.Buffer
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(dataLine, "."))
+			}
+			current.Data = data.Bytes()
+			s.mu.Lock()
+			s.messages = append(s.messages, current)
+			s.mu.Unlock()
+			reply("250 OK: queued")
+		case "RSET", "NOOP":
+			reply("250 OK")
+		case "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// received 服务器收到的命令和邮件
+func (s *testSMTPServer) received() ([]string, []testSMTPMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...), append([]testSMTPMessage(nil), s.messages...)
+}
+
+// readMailParts 解析multipart/alternative邮件，返回邮件头和按Content-Type索引的正文
+func readMailParts(t *testing.T, data []byte) (mail.Header, map[string]string) {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("解析邮件失败: %v", err)
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, want multipart/alternative", msg.Header.Get("Content-Type"))
+	}
+
+	parts := make(map[string]string)
+	reader := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("读取邮件分段失败: %v", err)
+		}
+		// multipart.Reader 会自动解码quoted-printable并删除该请求头
+		body, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[part.Header.Get("Content-Type")] = string(body)
+	}
+	return msg.Header, parts
+}
+
+func TestBuildMailMessage(t *testing.T) {
+	text := "封禁次数: 12\n" + strings.Repeat("a long line that needs soft breaks ", 5)
+	html := `<p style="color: #222">封禁次数: <b>12</b></p>`
+	to := []string{"ops@example.com", "sec@example.com"}
+
+	data, err := buildMailMessage("fail2ban-web <alerts@example.com>", to, "[fail2ban-web] 每日摘要", text, html)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, parts := readMailParts(t, data)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(header.Get("Subject"))
+	if err != nil || subject != "[fail2ban-web] 每日摘要" {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if got := header.Get("To"); got != "ops@example.com, sec@example.com" {
+		t.Errorf("To = %q", got)
+	}
+	if got := header.Get("Message-Id"); !strings.HasSuffix(got, "@example.com>") {
+		t.Errorf("Message-ID = %q, want host from sender", got)
+	}
+	if _, err := header.Date(); err != nil {
+		t.Errorf("Date 无效: %v", err)
+	}
+
+	if len(parts) != 2 {
+		t.Fatalf("分段数 = %d, want 2", len(parts))
+	}
+	// quoted-printable文本模式下换行编码为CRLF
+	if got := strings.ReplaceAll(parts["text/plain; charset=UTF-8"], "\r\n", "\n"); got != text {
+		t.Errorf("纯文本正文 = %q, want %q", got, text)
+	}
+	if got := parts["text/html; charset=UTF-8"]; got != html {
+		t.Errorf("HTML正文 = %q, want %q", got, html)
+	}
+
+	// 编码后的行长度符合邮件规范
+	for _, line := range strings.Split(string(data), "\r\n") {
+		if len(line) > 998 {
+			t.Fatalf("邮件行超过998字节: %d", len(line))
+		}
+	}
+
+	// 没有HTML时只包含纯文本分段
+	data, err = buildMailMessage("alerts@example.com", to[:1], "alert", "only text", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, parts = readMailParts(t, data)
+	if len(parts) != 1 || parts["text/plain; charset=UTF-8"] != "only text" {
+		t.Fatalf("纯文本邮件分段 = %v", parts)
+	}
+}
+
+func TestMailerRefusesWithoutSTARTTLS(t *testing.T) {
+	server := newTestSMTPServer(t, "8BITMIME", "AUTH PLAIN")
+
+	// 默认加密方式为starttls
+	for _, mode := range []string{SMTPTLSStartTLS, ""} {
+		cfg := server.config(mode)
+		cfg.Username = "user"
+		cfg.Password = "secret"
+		mailer := NewMailer(&config.Config{SMTP: cfg})
+
+		err := mailer.Send([]string{"ops@example.com"}, "subject", "text", "")
+		if err == nil || !strings.Contains(err.Error(), "不支持STARTTLS") {
+			t.Fatalf("tls=%q: Send() error = %v, want STARTTLS refusal", mode, err)
+		}
+	}
+
+	commands, messages := server.received()
+	for _, command := range commands {
+		if command == "AUTH" || command == "MAIL" {
+			t.Fatalf("拒绝发送前向服务器发送了 %s: %v", command, commands)
+		}
+	}
+	if len(messages) != 0 {
+		t.Fatalf("服务器收到了 %d 封邮件", len(messages))
+	}
+}
+
+func TestMailerSendWithoutTLS(t *testing.T) {
+	server := newTestSMTPServer(t, "8BITMIME")
+	mailer := NewMailer(&config.Config{SMTP: server.config(SMTPTLSNone)})
+
+	to := []string{"ops@example.com", "sec@example.com"}
+	if err := mailer.Send(to, "测试", "纯文本正文", "<p>HTML正文</p>"); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	commands, messages := server.received()
+	if len(messages) != 1 {
+		t.Fatalf("服务器收到 %d 封邮件, want 1 (commands %v)", len(messages), commands)
+	}
+	message := messages[0]
+	// 信封发件人不包含显示名称
+	if message.From != "<alerts@example.com>" {
+		t.Errorf("MAIL FROM = %q, want <alerts@example.com>", message.From)
+	}
+	if strings.Join(message.To, ",") != "<ops@example.com>,<sec@example.com>" {
+		t.Errorf("RCPT TO = %v, want %v", message.To, to)
+	}
+	if commands[len(commands)-1] != "QUIT" {
+		t.Errorf("最后的命令 = %s, want QUIT", commands[len(commands)-1])
+	}
+
+	_, parts := readMailParts(t, message.Data)
+	if parts["text/plain; charset=UTF-8"] != "纯文本正文" || parts["text/html; charset=UTF-8"] != "<p>HTML正文</p>" {
+		t.Fatalf("邮件分段 = %v", parts)
+	}
+}
+
+func TestMailerNotConfigured(t *testing.T) {
+	mailer := NewMailer(&config.Config{})
+	if mailer.Enabled() {
+		t.Fatal("未配置SMTP时 Enabled() = true")
+	}
+	if err := mailer.Send([]string{"ops@example.com"}, "s", "t", ""); err != ErrSMTPNotConfigured {
+		t.Fatalf("Send() error = %v, want ErrSMTPNotConfigured", err)
+	}
+
+	// 热加载配置后生效
+	mailer.ApplyConfig(&config.Config{SMTP: config.SMTPConfig{Host: "127.0.0.1", Port: 1}})
+	if !mailer.Enabled() {
+		t.Fatal("ApplyConfig 后 Enabled() = false")
+	}
+	if err := mailer.Send(nil, "s", "t", ""); err == nil || !strings.Contains(err.Error(), "收件人") {
+		t.Fatalf("无收件人时 Send() error = %v", err)
+	}
+}
+
+func TestDialSMTPConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	_, err = dialSMTP(config.SMTPConfig{Host: "127.0.0.1", Port: port, TLSMode: SMTPTLSNone})
+	if err == nil || !strings.Contains(err.Error(), "127.0.0.1:"+strconv.Itoa(port)) {
+		t.Fatalf("dialSMTP() error = %v", err)
+	}
+}
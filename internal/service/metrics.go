@@ -0,0 +1,352 @@
+package service
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// 本服务执行的封禁/解封来源
+// fail2ban.log中记录的封禁/解封包含本服务执行的，计入单独的指标，避免与各来源的计数相加时重复计数
+const (
+	BanSourceManual = "manual" // 通过面板或API手动执行
+	BanSourceAuto   = "auto"   // 智能扫描自动封禁、到期自动解封
+)
+
+// 日志解析指标的来源
+const (
+	LogMetricSourceFail2ban    = "fail2ban"
+	LogMetricSourceSSH         = "ssh"
+	LogMetricSourceNginx       = "nginx"
+	LogMetricSourceLogAnalysis = "log_analysis"
+)
+
+// 扫描耗时指标的类型
+const (
+	ScanMetricPeriodic    = "scan"         // 定期扫描SSH和Nginx日志
+	ScanMetricLogAnalysis = "log_analysis" // 日志分析任务
+)
+
+const (
+	metricsNamespace = "fail2ban_web"
+	// metricsStateTTL 状态类指标的缓存时间，避免频繁抓取时反复调用fail2ban-client
+	metricsStateTTL = 10 * time.Second
+)
+
+// threatLevelLabels 威胁等级描述对应的指标标签
+var threatLevelLabels = map[string]string{
+	"严重": "critical",
+	"高危": "high",
+	"中危": "medium",
+	"低危": "low",
+	"可疑": "suspicious",
+}
+
+// Metrics Prometheus指标，方法在m为nil时不做任何事
+type Metrics struct {
+	registry *prometheus.Registry
+
+	bans             *prometheus.CounterVec
+	unbans           *prometheus.CounterVec
+	logBans          *prometheus.CounterVec
+	logUnbans        *prometheus.CounterVec
+	logLines         *prometheus.CounterVec
+	logParseFailures *prometheus.CounterVec
+	commandDuration  *prometheus.HistogramVec
+	commandErrors    *prometheus.CounterVec
+	scanDuration     *prometheus.HistogramVec
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	httpInFlight     prometheus.Gauge
+}
+
+// NewMetrics 创建指标并注册到独立的registry
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		bans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "bans_total",
+			Help:      "Number of bans issued by fail2ban-web by source (manual, auto) and jail.",
+		}, []string{"source", "jail"}),
+		unbans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "unbans_total",
+			Help:      "Number of unbans issued by fail2ban-web by source (manual, auto) and jail.",
+		}, []string{"source", "jail"}),
+		logBans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "fail2ban_log_bans_total",
+			Help:      "Number of Ban lines in fail2ban.log by jail, including bans issued by fail2ban-web.",
+		}, []string{"jail"}),
+		logUnbans: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "fail2ban_log_unbans_total",
+			Help:      "Number of Unban lines in fail2ban.log by jail, including unbans issued by fail2ban-web.",
+		}, []string{"jail"}),
+		logLines: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_lines_parsed_total",
+			Help:      "Number of log lines parsed by source.",
+		}, []string{"source"}),
+		logParseFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "log_parse_failures_total",
+			Help:      "Number of log lines that did not match the expected format by source.",
+		}, []string{"source"}),
+		commandDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "fail2ban_command_duration_seconds",
+			Help:      "Latency of fail2ban-client commands.",
+			Buckets:   []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+		}, []string{"command"}),
+		commandErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "fail2ban_command_errors_total",
+			Help:      "Number of failed fail2ban-client commands.",
+		}, []string{"command"}),
+		scanDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "scan_duration_seconds",
+			Help:      "Duration of periodic log scans and log analysis jobs.",
+			Buckets:   []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300},
+		}, []string{"type"}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests currently being served.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.bans,
+		m.unbans,
+		m.logBans,
+		m.logUnbans,
+		m.logLines,
+		m.logParseFailures,
+		m.commandDuration,
+		m.commandErrors,
+		m.scanDuration,
+		m.httpRequests,
+		m.httpDuration,
+		m.httpInFlight,
+	)
+	return m
+}
+
+// Handler 以Prometheus文本格式输出指标
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// RegisterStateCollector 注册抓取时查询的状态类指标：各jail的封禁数、jail运行状态、各等级的可疑IP数
+func (m *Metrics) RegisterStateCollector(fail2banService *Fail2BanService, jailService *JailService, intelligentService *IntelligentScanService) {
+	m.registry.MustRegister(&stateCollector{
+		fail2banService:    fail2banService,
+		jailService:        jailService,
+		intelligentService: intelligentService,
+	})
+}
+
+// RecordBan 记录一次封禁
+func (m *Metrics) RecordBan(source, jail string) {
+	if m == nil {
+		return
+	}
+	m.bans.WithLabelValues(source, jail).Inc()
+}
+
+// RecordUnban 记录一次解封
+func (m *Metrics) RecordUnban(source, jail string) {
+	if m == nil {
+		return
+	}
+	m.unbans.WithLabelValues(source, jail).Inc()
+}
+
+// RecordLogBan 记录fail2ban.log中的一次封禁
+func (m *Metrics) RecordLogBan(jail string) {
+	if m == nil {
+		return
+	}
+	m.logBans.WithLabelValues(jail).Inc()
+}
+
+// RecordLogUnban 记录fail2ban.log中的一次解封
+func (m *Metrics) RecordLogUnban(jail string) {
+	if m == nil {
+		return
+	}
+	m.logUnbans.WithLabelValues(jail).Inc()
+}
+
+// RecordLogLines 记录解析的日志行数和格式不符的行数
+func (m *Metrics) RecordLogLines(source string, parsed, failed int) {
+	if m == nil {
+		return
+	}
+	if parsed > 0 {
+		m.logLines.WithLabelValues(source).Add(float64(parsed))
+	}
+	if failed > 0 {
+		m.logParseFailures.WithLabelValues(source).Add(float64(failed))
+	}
+}
+
+// ObserveCommand 记录一次fail2ban-client命令的耗时和结果
+func (m *Metrics) ObserveCommand(args []string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	command := fail2banCommandLabel(args)
+	m.commandDuration.WithLabelValues(command).Observe(duration.Seconds())
+	if err != nil {
+		m.commandErrors.WithLabelValues(command).Inc()
+	}
+}
+
+// ObserveScan 记录一次扫描的耗时
+func (m *Metrics) ObserveScan(scanType string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.scanDuration.WithLabelValues(scanType).Observe(duration.Seconds())
+}
+
+// HTTPRequestStarted 记录开始处理的HTTP请求
+func (m *Metrics) HTTPRequestStarted() {
+	if m == nil {
+		return
+	}
+	m.httpInFlight.Inc()
+}
+
+// HTTPRequestFinished 记录处理完成的HTTP请求，route为路由模板
+func (m *Metrics) HTTPRequestFinished(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.httpInFlight.Dec()
+	m.httpRequests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+// fail2banCommandLabel 命令标签，set/get命令带上操作名（如 "set banip"），不包含jail和IP
+func fail2banCommandLabel(args []string) string {
+	if len(args) == 0 {
+		return "unknown"
+	}
+	if (args[0] == "set" || args[0] == "get") && len(args) >= 3 {
+		return args[0] + " " + args[2]
+	}
+	return args[0]
+}
+
+var (
+	bannedIPsDesc = prometheus.NewDesc(metricsNamespace+"_banned_ips",
+		"Number of IPs currently banned per jail.", []string{"jail"}, nil)
+	jailUpDesc = prometheus.NewDesc(metricsNamespace+"_jail_up",
+		"Whether a jail is running (1) or configured and enabled but not running (0).", []string{"jail"}, nil)
+	fail2banUpDesc = prometheus.NewDesc(metricsNamespace+"_fail2ban_up",
+		"Whether fail2ban-client could be queried.", nil, nil)
+	suspiciousIPsDesc = prometheus.NewDesc(metricsNamespace+"_suspicious_ips",
+		"Number of suspicious IPs seen in the last 24 hours by threat level.", []string{"level"}, nil)
+)
+
+// stateCollector 在抓取时查询fail2ban和威胁记录，结果缓存metricsStateTTL
+type stateCollector struct {
+	fail2banService    *Fail2BanService
+	jailService        *JailService
+	intelligentService *IntelligentScanService
+
+	mu        sync.Mutex
+	updatedAt time.Time
+	cached    []prometheus.Metric
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bannedIPsDesc
+	ch <- jailUpDesc
+	ch <- fail2banUpDesc
+	ch <- suspiciousIPsDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached == nil || time.Since(c.updatedAt) >= metricsStateTTL {
+		c.cached = c.collect()
+		c.updatedAt = time.Now()
+	}
+	for _, metric := range c.cached {
+		ch <- metric
+	}
+}
+
+func (c *stateCollector) collect() []prometheus.Metric {
+	var metrics []prometheus.Metric
+
+	running := make(map[string]bool)
+	up := 0.0
+	if jails, err := c.fail2banService.GetJails(); err != nil {
+		log.Printf("采集fail2ban指标失败: %v", err)
+	} else {
+		up = 1
+		for _, jail := range jails {
+			running[jail] = true
+			banned, err := c.fail2banService.GetBannedIPsForJail(jail)
+			if err != nil {
+				continue
+			}
+			metrics = append(metrics, prometheus.MustNewConstMetric(bannedIPsDesc, prometheus.GaugeValue, float64(len(banned)), jail))
+		}
+	}
+	metrics = append(metrics, prometheus.MustNewConstMetric(fail2banUpDesc, prometheus.GaugeValue, up))
+
+	for jail := range running {
+		metrics = append(metrics, prometheus.MustNewConstMetric(jailUpDesc, prometheus.GaugeValue, 1, jail))
+	}
+	if configured, err := c.jailService.GetEnabledJails(); err == nil {
+		for _, jail := range configured {
+			if !running[jail.Name] {
+				metrics = append(metrics, prometheus.MustNewConstMetric(jailUpDesc, prometheus.GaugeValue, 0, jail.Name))
+			}
+		}
+	}
+
+	levels := make(map[string]int, len(threatLevelLabels))
+	for _, label := range threatLevelLabels {
+		levels[label] = 0
+	}
+	for _, threat := range c.intelligentService.GetCurrentThreats() {
+		if label, exists := threatLevelLabels[threat.ThreatLevel]; exists {
+			levels[label]++
+		}
+	}
+	for level, count := range levels {
+		metrics = append(metrics, prometheus.MustNewConstMetric(suspiciousIPsDesc, prometheus.GaugeValue, float64(count), level))
+	}
+
+	return metrics
+}
@@ -16,8 +16,9 @@ import (
 )
 
 type NginxService struct {
-	config *config.Config
-	db     *gorm.DB
+	config  *config.Config
+	db      *gorm.DB
+	metrics *Metrics
 }
 
 type NginxStats struct {
@@ -47,10 +48,11 @@ type NginxLog struct {
 	IsBlocked   bool      `json:"is_blocked"`
 }
 
-func NewNginxService(cfg *config.Config, db *gorm.DB) *NginxService {
+func NewNginxService(cfg *config.Config, db *gorm.DB, metrics *Metrics) *NginxService {
 	return &NginxService{
-		config: cfg,
-		db:     db,
+		config:  cfg,
+		db:      db,
+		metrics: metrics,
 	}
 }
 
@@ -145,7 +147,7 @@ func (s *NginxService) analyzeNginxLogs() (*NginxStats, error) {
 		if matches := logRegex.FindStringSubmatch(line); matches != nil {
 			stats.TotalRequests++
 			
-			ip := matches[1]
+			ip := normalizeIP(matches[1])
 			method := matches[3]
 			url := matches[4]
 			statusCode := matches[5]
@@ -158,7 +160,9 @@ func (s *NginxService) analyzeNginxLogs() (*NginxStats, error) {
 			attackType := s.detectAttackType(method, url, userAgent, statusCode)
 			if attackType != "" {
 				stats.AttackRequests++
-				ipCount[ip]++
+				if ip != "" {
+					ipCount[ip]++
+				}
 				attackTypeCount[attackType]++
 				
 				// 尝试解析时间戳
@@ -385,6 +389,7 @@ func (s *NginxService) GetNginxLogs(limit int) ([]NginxLog, error) {
 	}
 	
 	// 记录解析结果
+	s.metrics.RecordLogLines(LogMetricSourceNginx, count, parsed-count)
 	fmt.Printf("Nginx日志解析完成: 读取%d行，解析成功%d条，文件: %s\n", parsed, count, accessLogPath)
 
 	return logs, nil
@@ -471,7 +476,7 @@ func (s *NginxService) BanNginxIP(ip string, jail string) error {
 	}
 	
 	// 使用fail2ban服务的统一命令执行
-	fail2banSvc := NewFail2BanService(nil)
+	fail2banSvc := NewFail2BanService(nil, nil)
 	return fail2banSvc.BanIP(jail, ip)
 }
 
@@ -482,8 +487,11 @@ func (s *NginxService) UnbanNginxIP(ip string, jail string) error {
 	}
 	
 	// 使用fail2ban服务的统一命令执行
-	fail2banSvc := NewFail2BanService(nil)
-	return fail2banSvc.UnbanIP(jail, ip)
+	fail2banSvc := NewFail2BanService(nil, nil)
+	if err := fail2banSvc.UnbanIP(jail, ip); err != nil {
+		return err
+	}
+	return deactivateBanRecords(s.db, ip, jail)
 }
 
 // parseNginxTimestamp 解析Nginx时间戳
@@ -492,23 +500,54 @@ func parseNginxTimestamp(timeStr string) (time.Time, error) {
 	return time.Parse("02/Jan/2006:15:04:05 -0700", timeStr)
 }
 
+// nginxLogFormats 支持的Nginx访问日志格式
+var nginxLogFormats = []*regexp.Regexp{
+	// 标准格式: IP - - [timestamp] "method url" status size "referer" "user-agent"
+	regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) ([^"]*) [^"]*" (\d+) (\d+) "([^"]*)" "([^"]*)"`),
+	// 简化格式: IP - - [timestamp] "method url" status size
+	regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) ([^"]*)" (\d+) (\d+)`),
+	// Combined格式变体
+	regexp.MustCompile(`^(\S+) - - \[([^\]]+)\] "([A-Z]+) ([^"]*) HTTP/[^"]*" (\d+) (\d+) "([^"]*)" "([^"]*)"`),
+}
+
+// nginxLeadingIPRegex 无法识别格式时用于提取行首的IPv4或IPv6地址
+var nginxLeadingIPRegex = regexp.MustCompile(`^\[?` + ipAddrPattern)
+
 // parseNginxLogLine 解析Nginx日志行
 func parseNginxLogLine(line string) *NginxLog {
-	// 支持多种Nginx日志格式
-	logFormats := []*regexp.Regexp{
-		// 标准格式: IP - - [timestamp] "method url" status size "referer" "user-agent"
-		regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) ([^"]*) [^"]*" (\d+) (\d+) "([^"]*)" "([^"]*)"`),
-		// 简化格式: IP - - [timestamp] "method url" status size
-		regexp.MustCompile(`^(\S+) \S+ \S+ \[([^\]]+)\] "(\S+) ([^"]*)" (\d+) (\d+)`),
-		// Combined格式变体
-		regexp.MustCompile(`^(\S+) - - \[([^\]]+)\] "([A-Z]+) ([^"]*) HTTP/[^"]*" (\d+) (\d+) "([^"]*)" "([^"]*)"`),
+	if log := parseNginxAccessLine(line); log != nil {
+		// 时间戳无法解析时使用当前时间
+		if log.Timestamp.IsZero() {
+			log.Timestamp = time.Now()
+		}
+		return log
+	}
+	
+	// 如果所有格式都匹配失败，尝试简单解析IP
+	if matches := nginxLeadingIPRegex.FindStringSubmatch(line); matches != nil && normalizeIP(matches[1]) != "" {
+		return &NginxLog{
+			IP:         normalizeIP(matches[1]),
+			Timestamp:  time.Now(),
+			StatusCode: 200,
+			Method:     "GET",
+			URL:        "/",
+		}
 	}
 	
-	for _, regex := range logFormats {
+	return nil
+}
+
+// parseNginxAccessLine 按已知格式严格解析访问日志行，不匹配时返回nil，时间戳无法解析时为零值
+func parseNginxAccessLine(line string) *NginxLog {
+	for _, regex := range nginxLogFormats {
 		if matches := regex.FindStringSubmatch(line); matches != nil {
 			log := &NginxLog{}
 			
-			log.IP = matches[1]
+			// 行首不是合法地址时尝试其他格式
+			log.IP = normalizeIP(matches[1])
+			if log.IP == "" {
+				continue
+			}
 			log.Method = matches[3]
 			log.URL = matches[4]
 			
@@ -527,8 +566,6 @@ func parseNginxLogLine(line string) *NginxLog {
 			// 解析时间戳
 			if timestamp, err := parseNginxTimestamp(matches[2]); err == nil {
 				log.Timestamp = timestamp
-			} else {
-				log.Timestamp = time.Now()
 			}
 			
 			// 检测攻击类型 (创建临时服务实例)
@@ -542,17 +579,5 @@ func parseNginxLogLine(line string) *NginxLog {
 		}
 	}
 	
-	// 如果所有格式都匹配失败，尝试简单解析IP
-	if ipRegex := regexp.MustCompile(`^(\d+\.\d+\.\d+\.\d+)`); ipRegex.MatchString(line) {
-		matches := ipRegex.FindStringSubmatch(line)
-		return &NginxLog{
-			IP:         matches[1],
-			Timestamp:  time.Now(),
-			StatusCode: 200,
-			Method:     "GET",
-			URL:        "/",
-		}
-	}
-	
 	return nil
-}
\ No newline at end of file
+}
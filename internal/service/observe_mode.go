@@ -0,0 +1,161 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"fail2ban-web/internal/model"
+)
+
+// 自动封禁策略名称
+const (
+	PolicyCriticalAttack = "critical_attack" // SQL注入/XSS/路径遍历等严重攻击
+	PolicyHighScore      = "high_score"      // 威胁评分达到80
+	PolicySSHBruteForce  = "ssh_bruteforce"  // SSH失败次数达到10
+	PolicyMultiAttack    = "multi_attack"    // 多种攻击类型且评分达到60
+	PolicyLogAnalysis    = "log_analysis"    // 日志文件分析判定为高危/严重
+	PolicySubnetEscalate = "subnet_escalate" // 同一网段的攻击来源数量或评分之和达到阈值
+)
+
+// BanPolicies 所有内置的自动封禁策略
+var BanPolicies = []string{
+	PolicyCriticalAttack,
+	PolicyHighScore,
+	PolicySSHBruteForce,
+	PolicyMultiAttack,
+	PolicyLogAnalysis,
+	PolicySubnetEscalate,
+}
+
+// ObserveConfig 观察模式配置
+type ObserveConfig struct {
+	Enabled  bool     `json:"enabled"`  // 全局观察模式
+	Policies []string `json:"policies"` // 单独处于观察模式的策略
+}
+
+// ObserveReport 观察模式报告
+type ObserveReport struct {
+	Since          time.Time            `json:"since"`
+	Until          time.Time            `json:"until"`
+	Config         ObserveConfig        `json:"config"`
+	TotalDecisions int                  `json:"total_decisions"`
+	UniqueIPs      int                  `json:"unique_ips"`
+	ByPolicy       map[string]int       `json:"by_policy"`
+	ByDay          map[string]int       `json:"by_day"`
+	Decisions      []model.ScanDecision `json:"decisions"`
+}
+
+// IsPolicyObserved 判断策略是否处于观察模式（全局观察模式对所有策略生效）
+func (s *IntelligentScanService) IsPolicyObserved(policy string) bool {
+	s.observeMutex.RLock()
+	defer s.observeMutex.RUnlock()
+
+	return s.observeMode || s.observePolicies[policy]
+}
+
+// GetObserveConfig 获取当前观察模式配置
+func (s *IntelligentScanService) GetObserveConfig() ObserveConfig {
+	s.observeMutex.RLock()
+	defer s.observeMutex.RUnlock()
+
+	cfg := ObserveConfig{
+		Enabled:  s.observeMode,
+		Policies: []string{},
+	}
+	for policy := range s.observePolicies {
+		cfg.Policies = append(cfg.Policies, policy)
+	}
+	sort.Strings(cfg.Policies)
+
+	return cfg
+}
+
+// SetObserveConfig 更新观察模式配置
+func (s *IntelligentScanService) SetObserveConfig(cfg ObserveConfig) error {
+	policies := make(map[string]bool)
+	for _, policy := range cfg.Policies {
+		if !contains(BanPolicies, policy) {
+			return fmt.Errorf("未知的封禁策略: %s", policy)
+		}
+		policies[policy] = true
+	}
+
+	s.observeMutex.Lock()
+	s.observeMode = cfg.Enabled
+	s.observePolicies = policies
+	s.observeMutex.Unlock()
+
+	log.Printf("观察模式配置已更新: 全局=%v, 策略=%v", cfg.Enabled, cfg.Policies)
+	return nil
+}
+
+// recordWouldBan 记录观察模式下本应执行的封禁决策
+func (s *IntelligentScanService) recordWouldBan(ip string, threat *IPThreatLevel, policy, source string) error {
+	return s.recordDecision(ip, threat, policy, source, "would_ban")
+}
+
+// recordDecision 记录未实际执行封禁的决策（观察模式/告警策略）
+func (s *IntelligentScanService) recordDecision(ip string, threat *IPThreatLevel, policy, source, action string) error {
+	// 在一个封禁周期内同一IP同一动作只记录一次，模拟已封禁的效果
+	var count int64
+	if err := s.db.Model(&model.ScanDecision{}).
+		Where("ip_address = ? AND action = ? AND created_at > ?", ip, action, time.Now().Add(-s.getBanDuration())).
+		Count(&count).Error; err != nil {
+		return fmt.Errorf("查询扫描决策失败: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	decision := &model.ScanDecision{
+		IPAddress:   ip,
+		Policy:      policy,
+		Source:      source,
+		Action:      action,
+		ThreatScore: threat.ThreatScore,
+		Reason:      s.generateBanReason(threat),
+	}
+
+	if action == "would_ban" {
+		log.Printf("[观察模式] 本应封禁IP %s (策略: %s, 威胁评分: %d)", ip, policy, threat.ThreatScore)
+	} else {
+		log.Printf("[告警] IP %s 命中策略 %s，不自动封禁 (威胁评分: %d)", ip, policy, threat.ThreatScore)
+	}
+	return s.db.Create(decision).Error
+}
+
+// GetObserveReport 获取指定时间段内观察模式的决策报告
+func (s *IntelligentScanService) GetObserveReport(since, until time.Time, limit int) (*ObserveReport, error) {
+	var decisions []model.ScanDecision
+	if err := s.db.Where("action = ? AND created_at >= ? AND created_at <= ?", "would_ban", since, until).
+		Order("created_at DESC").
+		Find(&decisions).Error; err != nil {
+		return nil, fmt.Errorf("查询观察模式决策失败: %w", err)
+	}
+
+	report := &ObserveReport{
+		Since:          since,
+		Until:          until,
+		Config:         s.GetObserveConfig(),
+		TotalDecisions: len(decisions),
+		ByPolicy:       make(map[string]int),
+		ByDay:          make(map[string]int),
+	}
+
+	ips := make(map[string]bool)
+	for _, decision := range decisions {
+		ips[decision.IPAddress] = true
+		report.ByPolicy[decision.Policy]++
+		report.ByDay[decision.CreatedAt.Format("2006-01-02")]++
+	}
+	report.UniqueIPs = len(ips)
+
+	if limit > 0 && len(decisions) > limit {
+		decisions = decisions[:limit]
+	}
+	report.Decisions = decisions
+
+	return report, nil
+}
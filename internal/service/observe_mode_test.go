@@ -0,0 +1,154 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// newTestScanService 创建只依赖数据库和配置的智能扫描服务，cfg为nil时使用默认配置
+func newTestScanService(t *testing.T, cfg *config.Config, db *gorm.DB) *IntelligentScanService {
+	t.Helper()
+	if cfg == nil {
+		cfg = config.Defaults()
+	}
+	s := NewIntelligentScanService(cfg, db, nil, nil, nil, nil, nil, nil, nil, nil, nil, nil, NewEventBus(), nil)
+	t.Cleanup(s.cancel)
+	return s
+}
+
+func TestIsPolicyObserved(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Scanner.ObservePolicies = []string{PolicySSHBruteForce}
+	s := newTestScanService(t, cfg, nil)
+
+	// 启动时使用配置文件中的单独策略
+	for _, policy := range BanPolicies {
+		if got := s.IsPolicyObserved(policy); got != (policy == PolicySSHBruteForce) {
+			t.Errorf("启动时 IsPolicyObserved(%s) = %v", policy, got)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		observe  ObserveConfig
+		observed []string // 处于观察模式的策略，nil表示全部
+	}{
+		{"关闭观察模式", ObserveConfig{}, []string{}},
+		{"单独策略", ObserveConfig{Policies: []string{PolicyHighScore, PolicySubnetEscalate}}, []string{PolicyHighScore, PolicySubnetEscalate}},
+		// 全局观察模式对GeoIP等非内置策略同样生效
+		{"全局观察模式", ObserveConfig{Enabled: true, Policies: []string{PolicyHighScore}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.SetObserveConfig(tt.observe); err != nil {
+				t.Fatal(err)
+			}
+			for _, policy := range append(BanPolicies, "geo:cn") {
+				want := tt.observed == nil || contains(tt.observed, policy)
+				if got := s.IsPolicyObserved(policy); got != want {
+					t.Errorf("IsPolicyObserved(%s) = %v, want %v", policy, got, want)
+				}
+			}
+		})
+	}
+
+	got := s.GetObserveConfig()
+	want := ObserveConfig{Enabled: true, Policies: []string{PolicyHighScore}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("GetObserveConfig() = %+v, want %+v", got, want)
+	}
+}
+
+func TestSetObserveConfigRejectsUnknownPolicy(t *testing.T) {
+	s := newTestScanService(t, nil, nil)
+	if err := s.SetObserveConfig(ObserveConfig{Policies: []string{PolicyHighScore}}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := s.SetObserveConfig(ObserveConfig{Enabled: true, Policies: []string{PolicySSHBruteForce, "no_such_policy"}})
+	if err == nil {
+		t.Fatal("SetObserveConfig 接受了未知策略")
+	}
+
+	// 配置无效时保留原配置
+	got := s.GetObserveConfig()
+	if got.Enabled || !reflect.DeepEqual(got.Policies, []string{PolicyHighScore}) {
+		t.Fatalf("拒绝无效配置后 GetObserveConfig() = %+v", got)
+	}
+}
+
+func TestGetObserveReport(t *testing.T) {
+	db := newTestDB(t, &model.ScanDecision{})
+	s := newTestScanService(t, nil, db)
+
+	now := time.Now()
+	for _, decision := range []model.ScanDecision{
+		{IPAddress: "192.0.2.1", Policy: PolicySSHBruteForce, Action: "would_ban", CreatedAt: now.Add(-time.Hour)},
+		{IPAddress: "192.0.2.1", Policy: PolicyHighScore, Action: "would_ban", CreatedAt: now.Add(-2 * time.Hour)},
+		{IPAddress: "198.51.100.7", Policy: PolicySSHBruteForce, Action: "would_ban", CreatedAt: now.Add(-3 * time.Hour)},
+		// 告警策略的决策不计入观察模式报告
+		{IPAddress: "203.0.113.5", Policy: "geo:cn", Action: GeoPolicyActionAlert, CreatedAt: now.Add(-time.Hour)},
+		// 统计时间段之外
+		{IPAddress: "203.0.113.9", Policy: PolicyHighScore, Action: "would_ban", CreatedAt: now.Add(-48 * time.Hour)},
+	} {
+		if err := db.Create(&decision).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report, err := s.GetObserveReport(now.Add(-24*time.Hour), now, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.TotalDecisions != 3 || report.UniqueIPs != 2 {
+		t.Fatalf("TotalDecisions = %d, UniqueIPs = %d, want 3, 2", report.TotalDecisions, report.UniqueIPs)
+	}
+	wantByPolicy := map[string]int{PolicySSHBruteForce: 2, PolicyHighScore: 1}
+	if !reflect.DeepEqual(report.ByPolicy, wantByPolicy) {
+		t.Errorf("ByPolicy = %v, want %v", report.ByPolicy, wantByPolicy)
+	}
+
+	// 统计包含全部决策，明细按时间倒序截断到limit
+	if len(report.Decisions) != 2 {
+		t.Fatalf("len(Decisions) = %d, want 2", len(report.Decisions))
+	}
+	if report.Decisions[0].Policy != PolicySSHBruteForce || report.Decisions[1].Policy != PolicyHighScore {
+		t.Errorf("Decisions = %+v", report.Decisions)
+	}
+	for _, decision := range report.Decisions {
+		if decision.Action != "would_ban" {
+			t.Errorf("报告包含 %s 决策", decision.Action)
+		}
+	}
+}
+
+func TestRecordWouldBanOncePerBanPeriod(t *testing.T) {
+	db := newTestDB(t, &model.ScanDecision{})
+	s := newTestScanService(t, nil, db)
+	threat := &IPThreatLevel{IP: "192.0.2.1", ThreatScore: 90, SSHAttempts: 12}
+
+	for i := 0; i < 3; i++ {
+		if err := s.recordWouldBan(threat.IP, threat, PolicySSHBruteForce, "scan"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 同一IP的告警决策单独计数
+	if err := s.recordDecision(threat.IP, threat, "geo:cn", "scan", GeoPolicyActionAlert); err != nil {
+		t.Fatal(err)
+	}
+
+	var decisions []model.ScanDecision
+	db.Order("id").Find(&decisions)
+	if len(decisions) != 2 || decisions[0].Action != "would_ban" || decisions[1].Action != GeoPolicyActionAlert {
+		t.Fatalf("decisions = %+v, want one would_ban and one alert", decisions)
+	}
+	if decisions[0].ThreatScore != 90 || decisions[0].Source != "scan" || decisions[0].Reason == "" {
+		t.Errorf("would_ban decision = %+v", decisions[0])
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/model"
+)
+
+const (
+	// defaultBanDuration 未配置封禁时长时使用的默认值
+	defaultBanDuration = 24 * time.Hour
+	// maxBanDuration 未配置上限时递增时长的上限，避免溢出
+	maxBanDuration = 100 * 365 * 24 * time.Hour
+)
+
+// banPlan 一次封禁的时长计划
+type banPlan struct {
+	Offense   int           // 回溯窗口内的第几次封禁（含本次）
+	Duration  time.Duration // 封禁时长，永久封禁时无意义
+	Permanent bool
+}
+
+// apply 将封禁计划写入封禁记录，需要先设置BanTime
+func (p banPlan) apply(bannedIP *model.BannedIP) {
+	bannedIP.Offense = p.Offense
+	bannedIP.Permanent = p.Permanent
+	if !p.Permanent {
+		bannedIP.UnbanTime = bannedIP.BanTime.Add(p.Duration)
+	}
+}
+
+// describe 封禁时长的描述，用于封禁原因
+func (p banPlan) describe() string {
+	if p.Permanent {
+		return fmt.Sprintf("第 %d 次封禁, 永久封禁", p.Offense)
+	}
+	return fmt.Sprintf("第 %d 次封禁, 封禁 %s", p.Offense, p.Duration)
+}
+
+// planBan 统计IP或网段及其所属聚合网段在回溯窗口内的历史封禁次数，计算本次的封禁时长
+func (s *IntelligentScanService) planBan(target string) banPlan {
+	cfg := s.banConfig()
+	query := s.db.Model(&model.BannedIP{}).Where("ip_address IN ?", s.banHistoryTargets(target))
+	if cfg.Lookback > 0 {
+		query = query.Where("ban_time >= ?", time.Now().Add(-cfg.Lookback))
+	}
+
+	// 一次封禁可能在多个jail中各有一条记录，按封禁时间去重
+	var prior int64
+	if err := query.Distinct("ban_time").Count(&prior).Error; err != nil {
+		// 统计失败时按首次封禁处理
+		log.Printf("统计 %s 的历史封禁次数失败: %v", target, err)
+		prior = 0
+	}
+	return calculateBanPlan(cfg, int(prior))
+}
+
+// banHistoryTargets 统计历史封禁次数时包含的目标：本身、IPv6聚合网段和所属的网段封禁
+func (s *IntelligentScanService) banHistoryTargets(target string) []string {
+	targets := []string{target}
+	key := s.threatKey(target)
+	if key != target {
+		targets = append(targets, key)
+	}
+	if subnet := s.subnetKey(key); subnet != "" {
+		targets = append(targets, subnet)
+	}
+	return targets
+}
+
+// ensureManagedJails 生成本服务使用的网段jail和长期封禁jail配置，需要在持有ipMutex之外调用。
+// 失败时记录日志，下次自动处理前重试
+func (s *IntelligentScanService) ensureManagedJails() {
+	if err := s.ensureSubnetJail(); err != nil {
+		log.Printf("生成网段封禁jail配置失败: %v", err)
+	}
+	if err := s.extendedBans.Ensure(); err != nil {
+		log.Printf("生成长期封禁jail配置失败: %v", err)
+	}
+}
+
+// holdForPlan 封禁时长超过jail的bantime时把封禁转移到长期jail，返回实际持有封禁的jail。
+// 转移失败时保留原jail，fail2ban提前解封后由封禁生命周期对账时重新封禁
+func (s *IntelligentScanService) holdForPlan(target, jail string, banTime time.Time, plan banPlan, source string) string {
+	if !s.extendedBans.Required(jail, banTime, banTime.Add(plan.Duration), plan.Permanent) {
+		return jail
+	}
+	if err := s.extendedBans.Hold(target, source); err != nil {
+		log.Printf("将 %s 的封禁转移到长期jail失败: %v", target, err)
+		return jail
+	}
+	return extendedBanJailName
+}
+
+// calculateBanPlan 按历史封禁次数计算封禁时长：首次时长 × 倍数^历史次数，不超过上限
+func calculateBanPlan(cfg config.BanConfig, prior int) banPlan {
+	base := cfg.Duration
+	if base <= 0 {
+		base = defaultBanDuration
+	}
+
+	plan := banPlan{Offense: prior + 1, Duration: base}
+	if cfg.PermanentAfter > 0 && prior >= cfg.PermanentAfter {
+		plan.Permanent = true
+		return plan
+	}
+
+	if cfg.IncrementFactor > 1 && prior > 0 {
+		duration := float64(base) * math.Pow(cfg.IncrementFactor, float64(prior))
+		if duration > float64(maxBanDuration) {
+			duration = float64(maxBanDuration)
+		}
+		plan.Duration = time.Duration(duration)
+	}
+	if cfg.MaxDuration > 0 && plan.Duration > cfg.MaxDuration {
+		plan.Duration = cfg.MaxDuration
+	}
+	return plan
+}
+
+// renderBanIncrement 将递增封禁配置渲染为fail2ban的bantime.increment设置，
+// 使fail2ban自己发现的重复攻击者与本服务使用相同的递增规则
+// fail2ban不支持按次数永久封禁，本服务的永久封禁通过长期封禁jail执行
+func renderBanIncrement(cfg config.BanConfig) string {
+	if cfg.IncrementFactor <= 1 {
+		return "bantime.increment = false\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("bantime.increment = true\n")
+	fmt.Fprintf(&b, "bantime.formula = ban.Time * math.pow(%s, ban.Count)\n",
+		strconv.FormatFloat(cfg.IncrementFactor, 'f', -1, 64))
+	if cfg.MaxDuration > 0 {
+		fmt.Fprintf(&b, "bantime.maxtime = %d\n", int64(cfg.MaxDuration.Seconds()))
+	}
+	b.WriteString("bantime.overalljails = true\n")
+	return b.String()
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+	"fail2ban-web/internal/model"
+)
+
+func TestCalculateBanPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		cfg       config.BanConfig
+		prior     int
+		duration  time.Duration
+		permanent bool
+	}{
+		{"首次封禁", config.BanConfig{Duration: time.Hour, IncrementFactor: 2}, 0, time.Hour, false},
+		{"第二次翻倍", config.BanConfig{Duration: time.Hour, IncrementFactor: 2}, 1, 2 * time.Hour, false},
+		{"第四次", config.BanConfig{Duration: time.Hour, IncrementFactor: 2}, 3, 8 * time.Hour, false},
+		{"小数倍数", config.BanConfig{Duration: time.Hour, IncrementFactor: 1.5}, 2, 135 * time.Minute, false},
+		{"未配置时长", config.BanConfig{IncrementFactor: 2}, 1, 2 * defaultBanDuration, false},
+		// 倍数不大于1时不递增
+		{"倍数为1", config.BanConfig{Duration: time.Hour, IncrementFactor: 1}, 5, time.Hour, false},
+		{"倍数小于1", config.BanConfig{Duration: time.Hour, IncrementFactor: 0.5}, 5, time.Hour, false},
+		{"未配置倍数", config.BanConfig{Duration: time.Hour}, 5, time.Hour, false},
+		// 上限
+		{"不超过上限", config.BanConfig{Duration: time.Hour, IncrementFactor: 2, MaxDuration: 24 * time.Hour}, 4, 16 * time.Hour, false},
+		{"达到上限", config.BanConfig{Duration: time.Hour, IncrementFactor: 2, MaxDuration: 24 * time.Hour}, 5, 24 * time.Hour, false},
+		{"首次时长超过上限", config.BanConfig{Duration: 48 * time.Hour, MaxDuration: 24 * time.Hour}, 0, 24 * time.Hour, false},
+		{"未配置上限时不溢出", config.BanConfig{Duration: time.Hour, IncrementFactor: 10}, 100, maxBanDuration, false},
+		// 永久封禁
+		{"未达到永久封禁次数", config.BanConfig{Duration: time.Hour, IncrementFactor: 2, PermanentAfter: 3}, 2, 4 * time.Hour, false},
+		{"达到永久封禁次数", config.BanConfig{Duration: time.Hour, IncrementFactor: 2, PermanentAfter: 3}, 3, time.Hour, true},
+		{"超过永久封禁次数", config.BanConfig{Duration: time.Hour, PermanentAfter: 3}, 7, time.Hour, true},
+		{"从不永久封禁", config.BanConfig{Duration: time.Hour, IncrementFactor: 2, MaxDuration: 24 * time.Hour}, 50, 24 * time.Hour, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := calculateBanPlan(tt.cfg, tt.prior)
+			if plan.Offense != tt.prior+1 {
+				t.Errorf("Offense = %d, want %d", plan.Offense, tt.prior+1)
+			}
+			if plan.Permanent != tt.permanent {
+				t.Fatalf("Permanent = %v, want %v", plan.Permanent, tt.permanent)
+			}
+			if !plan.Permanent && plan.Duration != tt.duration {
+				t.Errorf("Duration = %v, want %v", plan.Duration, tt.duration)
+			}
+		})
+	}
+}
+
+func TestBanPlanApply(t *testing.T) {
+	banTime := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+
+	record := model.BannedIP{BanTime: banTime}
+	banPlan{Offense: 2, Duration: 2 * time.Hour}.apply(&record)
+	if record.Offense != 2 || record.Permanent || !record.UnbanTime.Equal(banTime.Add(2*time.Hour)) {
+		t.Errorf("递增封禁记录 = %+v", record)
+	}
+
+	record = model.BannedIP{BanTime: banTime}
+	banPlan{Offense: 4, Duration: time.Hour, Permanent: true}.apply(&record)
+	if record.Offense != 4 || !record.Permanent || !record.UnbanTime.IsZero() {
+		t.Errorf("永久封禁记录 = %+v", record)
+	}
+}
+
+func TestRenderBanIncrement(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.BanConfig
+		want string
+	}{
+		{"未配置倍数", config.BanConfig{Duration: time.Hour}, "bantime.increment = false\n"},
+		{"倍数为1", config.BanConfig{IncrementFactor: 1, MaxDuration: time.Hour}, "bantime.increment = false\n"},
+		{"倍数小于1", config.BanConfig{IncrementFactor: 0.5}, "bantime.increment = false\n"},
+		{
+			"不限制最大时长",
+			config.BanConfig{Duration: time.Hour, IncrementFactor: 2},
+			"bantime.increment = true\n" +
+				"bantime.formula = ban.Time * math.pow(2, ban.Count)\n" +
+				"bantime.overalljails = true\n",
+		},
+		{
+			// 永久封禁由长期封禁jail执行，不写入fail2ban配置
+			"小数倍数和最大时长",
+			config.BanConfig{Duration: time.Hour, IncrementFactor: 1.5, MaxDuration: 7 * 24 * time.Hour, PermanentAfter: 5},
+			"bantime.increment = true\n" +
+				"bantime.formula = ban.Time * math.pow(1.5, ban.Count)\n" +
+				"bantime.maxtime = 604800\n" +
+				"bantime.overalljails = true\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := renderBanIncrement(tt.cfg); got != tt.want {
+				t.Errorf("renderBanIncrement() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
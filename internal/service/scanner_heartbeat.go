@@ -0,0 +1,63 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// 智能扫描后台循环名称
+const (
+	ScannerLoopLogScan        = "log_scan"
+	ScannerLoopThreatAnalysis = "threat_analysis"
+	ScannerLoopAutoProcessing = "auto_processing"
+	ScannerLoopLogAnalysis    = "log_analysis"
+)
+
+// scannerHeartbeatGrace 判断循环停滞时在两个周期之外额外允许的时间
+const scannerHeartbeatGrace = 30 * time.Second
+
+// LoopHeartbeat 后台循环最近一次心跳
+type LoopHeartbeat struct {
+	Name            string        `json:"name"`
+	Interval        time.Duration `json:"-"`
+	IntervalSeconds int64         `json:"interval_seconds"`
+	LastBeat        time.Time     `json:"last_beat"`
+	Stale           bool          `json:"stale"` // 超过两个周期没有心跳，循环可能已退出或卡住
+}
+
+// loopHeartbeats 记录各后台循环的心跳
+type loopHeartbeats struct {
+	mu    sync.Mutex
+	beats map[string]*LoopHeartbeat
+}
+
+// beat 记录循环的一次心跳，循环开始时和每个周期结束时调用
+func (h *loopHeartbeats) beat(name string, interval time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.beats == nil {
+		h.beats = make(map[string]*LoopHeartbeat)
+	}
+	h.beats[name] = &LoopHeartbeat{Name: name, Interval: interval, LastBeat: time.Now()}
+}
+
+// LoopHeartbeats 获取智能扫描各后台循环的心跳，服务未启动时为空
+func (s *IntelligentScanService) LoopHeartbeats() []LoopHeartbeat {
+	s.heartbeats.mu.Lock()
+	defer s.heartbeats.mu.Unlock()
+
+	now := time.Now()
+	result := make([]LoopHeartbeat, 0, len(s.heartbeats.beats))
+	for _, beat := range s.heartbeats.beats {
+		heartbeat := *beat
+		heartbeat.IntervalSeconds = int64(beat.Interval / time.Second)
+		heartbeat.Stale = now.Sub(beat.LastBeat) > 2*beat.Interval+scannerHeartbeatGrace
+		result = append(result, heartbeat)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// scannerSettings 智能扫描中可热加载的配置：扫描周期、封禁策略阈值、jail选择和封禁时长
+type scannerSettings struct {
+	mu      sync.RWMutex
+	scanner config.ScannerConfig
+	ban     config.BanConfig
+	changed chan struct{} // 配置更新时关闭并替换，通知后台循环重新读取周期
+}
+
+// newScannerSettings 使用启动时的配置创建
+func newScannerSettings(cfg *config.Config) scannerSettings {
+	return scannerSettings{
+		scanner: cfg.Scanner,
+		ban:     cfg.Ban,
+		changed: make(chan struct{}),
+	}
+}
+
+// scannerConfig 当前扫描配置
+func (s *IntelligentScanService) scannerConfig() config.ScannerConfig {
+	s.settings.mu.RLock()
+	defer s.settings.mu.RUnlock()
+
+	return s.settings.scanner
+}
+
+// banConfig 当前封禁时长配置
+func (s *IntelligentScanService) banConfig() config.BanConfig {
+	s.settings.mu.RLock()
+	defer s.settings.mu.RUnlock()
+
+	return s.settings.ban
+}
+
+// settingsChanged 下一次配置更新时关闭的channel
+func (s *IntelligentScanService) settingsChanged() <-chan struct{} {
+	s.settings.mu.RLock()
+	defer s.settings.mu.RUnlock()
+
+	return s.settings.changed
+}
+
+// ApplyConfig 热加载扫描和封禁配置。观察模式只在配置文件中的值变化时覆盖，
+// 避免重新加载时丢失通过API临时调整的观察模式
+func (s *IntelligentScanService) ApplyConfig(cfg *config.Config) error {
+	for _, policy := range cfg.Scanner.ObservePolicies {
+		if !contains(BanPolicies, policy) {
+			return fmt.Errorf("scanner.observe_policies 包含未知的封禁策略: %s", policy)
+		}
+	}
+
+	s.settings.mu.Lock()
+	previous := s.settings.scanner
+	s.settings.scanner = cfg.Scanner
+	s.settings.ban = cfg.Ban
+	close(s.settings.changed)
+	s.settings.changed = make(chan struct{})
+	s.settings.mu.Unlock()
+
+	if previous.ObserveMode != cfg.Scanner.ObserveMode || !reflect.DeepEqual(previous.ObservePolicies, cfg.Scanner.ObservePolicies) {
+		if err := s.SetObserveConfig(ObserveConfig{Enabled: cfg.Scanner.ObserveMode, Policies: cfg.Scanner.ObservePolicies}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runLoop 按配置的周期执行后台任务并记录心跳，配置更新后立即按新周期重置定时器
+func (s *IntelligentScanService) runLoop(name string, intervalOf func(config.ScannerConfig) time.Duration, run func()) {
+	defer s.wg.Done()
+
+	interval := intervalOf(s.scannerConfig())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	s.heartbeats.beat(name, interval)
+	for {
+		changed := s.settingsChanged()
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-changed:
+			if next := intervalOf(s.scannerConfig()); next != interval {
+				interval = next
+				ticker.Reset(interval)
+				log.Printf("后台循环 %s 的周期已调整为 %s", name, interval)
+			}
+			s.heartbeats.beat(name, interval)
+		case <-ticker.C:
+			run()
+			s.heartbeats.beat(name, interval)
+		}
+	}
+}
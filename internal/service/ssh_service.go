@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -16,8 +17,10 @@ import (
 )
 
 type SSHService struct {
-	config *config.Config
-	db     *gorm.DB
+	config     *config.Config
+	db         *gorm.DB
+	geoService *GeoService
+	metrics    *Metrics
 }
 
 type SSHStats struct {
@@ -43,10 +46,12 @@ type SSHLog struct {
 	Status    string    `json:"status"`
 }
 
-func NewSSHService(cfg *config.Config, db *gorm.DB) *SSHService {
+func NewSSHService(cfg *config.Config, db *gorm.DB, geoService *GeoService, metrics *Metrics) *SSHService {
 	return &SSHService{
-		config: cfg,
-		db:     db,
+		config:     cfg,
+		db:         db,
+		geoService: geoService,
+		metrics:    metrics,
 	}
 }
 
@@ -72,6 +77,7 @@ func (s *SSHService) GetSSHStats() (*SSHStats, error) {
 	stats.FailedAttempts = logStats.FailedAttempts
 	stats.LastAttack = logStats.LastAttack
 	stats.TopAttackerIPs = logStats.TopAttackerIPs
+	stats.AttacksByCountry = logStats.AttacksByCountry
 
 	return stats, nil
 }
@@ -114,16 +120,19 @@ func (s *SSHService) analyzeSSHLogs() (*SSHStats, error) {
 	scanner := bufio.NewScanner(file)
 	
 	// SSH失败登录的正则表达式
-	failedRegex := regexp.MustCompile(`Failed password for (?:invalid user )?(\S+) from (\d+\.\d+\.\d+\.\d+)`)
-	acceptedRegex := regexp.MustCompile(`Accepted password for (\S+) from (\d+\.\d+\.\d+\.\d+)`)
+	failedRegex := sshLogPatterns["failed_password"]
+	acceptedRegex := sshLogPatterns["accepted_password"]
 
 	for scanner.Scan() {
 		line := scanner.Text()
 		
 		// 匹配失败登录
 		if matches := failedRegex.FindStringSubmatch(line); matches != nil {
+			ip := normalizeIP(matches[2])
+			if ip == "" {
+				continue
+			}
 			stats.FailedAttempts++
-			ip := matches[2]
 			ipCount[ip]++
 			
 			// 尝试解析时间戳
@@ -144,6 +153,9 @@ func (s *SSHService) analyzeSSHLogs() (*SSHStats, error) {
 
 	// 获取攻击最多的IP
 	stats.TopAttackerIPs = getTopIPs(ipCount, 5)
+	
+	// 按国家统计攻击次数
+	stats.AttacksByCountry = s.countAttacksByCountry(ipCount)
 
 	return stats, nil
 }
@@ -214,7 +226,8 @@ func (s *SSHService) GetSSHLogs(limit int) ([]SSHLog, error) {
 		parsed++
 	}
 	
-	// 记录解析结果
+	// 记录解析结果，认证日志中包含其他服务的日志，未匹配的行不计为解析失败
+	s.metrics.RecordLogLines(LogMetricSourceSSH, count, 0)
 	fmt.Printf("SSH日志解析完成: 读取%d行，解析成功%d条，文件: %s\n", parsed, count, usedPath)
 
 	return logs, nil
@@ -305,7 +318,7 @@ func (s *SSHService) BanSSHIP(ip string, jail string) error {
 	}
 	
 	// 使用fail2ban服务的统一命令执行
-	fail2banSvc := NewFail2BanService(nil)
+	fail2banSvc := NewFail2BanService(nil, nil)
 	return fail2banSvc.BanIP(jail, ip)
 }
 
@@ -316,8 +329,11 @@ func (s *SSHService) UnbanSSHIP(ip string, jail string) error {
 	}
 	
 	// 使用fail2ban服务的统一命令执行
-	fail2banSvc := NewFail2BanService(nil)
-	return fail2banSvc.UnbanIP(jail, ip)
+	fail2banSvc := NewFail2BanService(nil, nil)
+	if err := fail2banSvc.UnbanIP(jail, ip); err != nil {
+		return err
+	}
+	return deactivateBanRecords(s.db, ip, jail)
 }
 
 // parseLogTimestamp 解析日志时间戳
@@ -333,20 +349,30 @@ func parseLogTimestamp(line string) (time.Time, error) {
 	currentYear := time.Now().Year()
 	fullTimeStr := fmt.Sprintf("%d %s", currentYear, timeStr)
 	
-	return time.Parse("2006 Jan 2 15:04:05", fullTimeStr)
+	timestamp, err := time.Parse("2006 Jan 2 15:04:05", fullTimeStr)
+	if err != nil {
+		return timestamp, err
+	}
+	
+	// syslog时间戳不带年份，跨年的旧日志会被解析到未来，回退一年
+	if timestamp.After(time.Now().Add(24 * time.Hour)) {
+		timestamp = timestamp.AddDate(-1, 0, 0)
+	}
+	
+	return timestamp, nil
+}
+
+// sshLogPatterns SSH登录相关的正则表达式，同时匹配IPv4和IPv6地址
+var sshLogPatterns = map[string]*regexp.Regexp{
+	"failed_password": regexp.MustCompile(`Failed password for (?:invalid user )?(\S+) from ` + ipAddrPattern),
+	"accepted_password": regexp.MustCompile(`Accepted password for (\S+) from ` + ipAddrPattern),
+	"invalid_user": regexp.MustCompile(`Invalid user (\S+) from ` + ipAddrPattern),
+	"disconnect": regexp.MustCompile(`Received disconnect from ` + ipAddrPattern),
 }
 
 // parseSSHLogLine 解析SSH日志行
 func parseSSHLogLine(line string) *SSHLog {
-	// SSH登录相关的正则表达式
-	patterns := map[string]*regexp.Regexp{
-		"failed_password": regexp.MustCompile(`Failed password for (?:invalid user )?(\S+) from (\d+\.\d+\.\d+\.\d+)`),
-		"accepted_password": regexp.MustCompile(`Accepted password for (\S+) from (\d+\.\d+\.\d+\.\d+)`),
-		"invalid_user": regexp.MustCompile(`Invalid user (\S+) from (\d+\.\d+\.\d+\.\d+)`),
-		"disconnect": regexp.MustCompile(`Received disconnect from (\d+\.\d+\.\d+\.\d+)`),
-	}
-
-	for event, regex := range patterns {
+	for event, regex := range sshLogPatterns {
 		if matches := regex.FindStringSubmatch(line); matches != nil {
 			log := &SSHLog{
 				Event: event,
@@ -361,13 +387,18 @@ func parseSSHLogLine(line string) *SSHLog {
 			case "failed_password", "accepted_password", "invalid_user":
 				if len(matches) > 2 {
 					log.User = matches[1]
-					log.IP = matches[2]
+					log.IP = normalizeIP(matches[2])
 				}
 			case "disconnect":
 				if len(matches) > 1 {
-					log.IP = matches[1]
+					log.IP = normalizeIP(matches[1])
 				}
 			}
+			
+			// 地址无法解析时尝试其他模式
+			if log.IP == "" {
+				continue
+			}
 
 			// 设置状态
 			if strings.Contains(event, "failed") || strings.Contains(event, "invalid") {
@@ -385,6 +416,35 @@ func parseSSHLogLine(line string) *SSHLog {
 	return nil
 }
 
+// countAttacksByCountry 使用离线GeoIP数据按国家汇总攻击次数，未加载GeoIP数据库时返回空列表
+func (s *SSHService) countAttacksByCountry(ipCount map[string]int) []CountryAttack {
+	attacks := []CountryAttack{}
+	if s.geoService == nil || !s.geoService.Available() {
+		return attacks
+	}
+	
+	countryCount := make(map[string]int)
+	for ip, count := range ipCount {
+		country := s.geoService.CountryOf(ip)
+		if country == "" {
+			country = "Unknown"
+		}
+		countryCount[country] += count
+	}
+	
+	for country, count := range countryCount {
+		attacks = append(attacks, CountryAttack{Country: country, Count: count})
+	}
+	sort.Slice(attacks, func(i, j int) bool {
+		if attacks[i].Count != attacks[j].Count {
+			return attacks[i].Count > attacks[j].Count
+		}
+		return attacks[i].Country < attacks[j].Country
+	})
+	
+	return attacks
+}
+
 // getTopIPs 获取攻击次数最多的IP
 func getTopIPs(ipCount map[string]int, limit int) []string {
 	type ipStat struct {
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// subnetJailName 封禁网段使用的jail，由fail2ban-web生成
+const subnetJailName = "fail2ban-web-subnet"
+
+// maxThreatAddresses 聚合威胁记录中最多保留的地址数量
+const maxThreatAddresses = 16
+
+// threatKey 威胁记录的聚合键，IPv6地址按配置的前缀长度聚合为网段
+func (s *IntelligentScanService) threatKey(ip string) string {
+	return ipv6ThreatKey(ip, s.scannerConfig().IPv6PrefixLen)
+}
+
+// addThreatAddress 记录聚合网段内出现过的地址
+func addThreatAddress(threat *IPThreatLevel, ip string) {
+	if threat.IP == ip || len(threat.Addresses) >= maxThreatAddresses || contains(threat.Addresses, ip) {
+		return
+	}
+	threat.Addresses = append(threat.Addresses, ip)
+}
+
+// banSubnet 在网段jail中封禁整个网段
+// 常见的banaction（iptables-ipset、nftables）使用单地址集合，无法直接封禁网段，
+// 因此使用基于hash:net的专用action，source为指标中记录的封禁来源。
+// 这里不生成jail配置（需要重新加载fail2ban），配置由ensureManagedJails预先生成
+func (s *IntelligentScanService) banSubnet(prefix, source string) (string, error) {
+	s.subnetJailMutex.Lock()
+	ready := s.subnetJailReady
+	s.subnetJailMutex.Unlock()
+	if !ready {
+		return "", fmt.Errorf("网段封禁jail %s 的配置尚未生成", subnetJailName)
+	}
+	if err := s.fail2banService.banIP(subnetJailName, prefix, source); err != nil {
+		return "", err
+	}
+	return subnetJailName, nil
+}
+
+// ensureSubnetJail 生成网段jail的配置文件，内容变化时重新加载fail2ban
+func (s *IntelligentScanService) ensureSubnetJail() error {
+	s.subnetJailMutex.Lock()
+	defer s.subnetJailMutex.Unlock()
+
+	if s.subnetJailReady {
+		return nil
+	}
+
+	root := s.config.Fail2Ban.ConfigPath
+	files := map[string]string{
+		filepath.Join(root, "action.d", subnetJailName+".conf"): subnetJailAction,
+		filepath.Join(root, "filter.d", subnetJailName+".conf"): subnetJailFilter,
+		filepath.Join(root, "jail.d", subnetJailName+".local"):  s.buildSubnetJail(),
+	}
+
+	changed := false
+	for path, content := range files {
+		if existing, err := os.ReadFile(path); err == nil && bytes.Equal(existing, []byte(content)) {
+			continue
+		}
+		if err := writeFileAtomic(path, []byte(content)); err != nil {
+			return err
+		}
+		changed = true
+	}
+
+	if changed {
+		log.Printf("已生成网段封禁jail %s 的配置", subnetJailName)
+		if err := s.fail2banService.Reload(); err != nil {
+			return fmt.Errorf("重新加载fail2ban失败: %w", err)
+		}
+	}
+
+	s.subnetJailReady = true
+	return nil
+}
+
+// buildSubnetJail 生成网段jail配置，封禁时长和递增规则与自动封禁一致
+func (s *IntelligentScanService) buildSubnetJail() string {
+	return fmt.Sprintf(`# Generated by fail2ban-web. Do not edit.
+[%s]
+enabled = true
+filter = %s
+logpath = %s
+backend = polling
+bantime = %d
+%saction = %s
+`, subnetJailName, subnetJailName, s.config.Fail2Ban.LogPath,
+		int(s.getBanDuration().Seconds()), renderBanIncrement(s.banConfig()), subnetJailName)
+}
+
+// subnetJailFilter 网段jail只接受手动封禁，使用一个不会命中的过滤器
+const subnetJailFilter = `# Generated by fail2ban-web. Do not edit.
+# Placeholder filter for the subnet jail, never matches any line.
+[Definition]
+failregex = ^fail2ban-web subnet placeholder <HOST>$
+ignoreregex =
+`
+
+// subnetJailAction 使用hash:net类型的ipset封禁IPv4和IPv6网段，
+// setprefix为ipset名称前缀，长期封禁jail使用不同的前缀
+const subnetJailAction = `# Generated by fail2ban-web. Do not edit.
+# Bans whole networks (CIDR) using hash:net ipsets.
+[Definition]
+actionstart = ipset -exist create <setprefix>-4 hash:net family inet
+              ipset -exist create <setprefix>-6 hash:net family inet6
+              iptables -I INPUT -m set --match-set <setprefix>-4 src -j DROP
+              ip6tables -I INPUT -m set --match-set <setprefix>-6 src -j DROP
+actionstop = iptables -D INPUT -m set --match-set <setprefix>-4 src -j DROP
+             ip6tables -D INPUT -m set --match-set <setprefix>-6 src -j DROP
+             ipset destroy <setprefix>-4
+             ipset destroy <setprefix>-6
+actioncheck =
+actionban = ipset -exist add <ipmset> <ip>
+actionunban = ipset -exist del <ipmset> <ip>
+
+[Init]
+setprefix = f2b-subnet
+ipmset = <setprefix>-4
+
+[Init?family=inet6]
+ipmset = <setprefix>-6
+`
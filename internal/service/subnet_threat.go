@@ -0,0 +1,331 @@
+package service
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"fail2ban-web/internal/ipset"
+)
+
+// SubnetHost 网段内的一个攻击来源
+type SubnetHost struct {
+	IP            string    `json:"ip"`
+	ThreatScore   int       `json:"threat_score"`
+	SSHAttempts   int       `json:"ssh_attempts"`
+	NginxAttempts int       `json:"nginx_attempts"`
+	LastSeen      time.Time `json:"last_seen"`
+}
+
+// SubnetThreat 网段级威胁记录，汇总同一网段内所有攻击来源
+// 僵尸网络常从同一网段的大量地址发起攻击，每个地址都低于单IP封禁阈值
+type SubnetThreat struct {
+	Subnet        string       `json:"subnet"`
+	HostCount     int          `json:"host_count"`  // 不同攻击来源数量
+	TotalScore    int          `json:"total_score"` // 各来源威胁评分之和
+	SSHAttempts   int          `json:"ssh_attempts"`
+	NginxAttempts int          `json:"nginx_attempts"`
+	FirstSeen     time.Time    `json:"first_seen"`
+	LastSeen      time.Time    `json:"last_seen"`
+	AttackTypes   []string     `json:"attack_types"`
+	Country       string       `json:"country"`
+	ISP           string       `json:"isp"`
+	Escalated     bool         `json:"escalated"`              // 是否已升级处理
+	Policy        string       `json:"policy,omitempty"`       // 升级时命中的策略
+	Action        string       `json:"action,omitempty"`       // ban / would_ban / alert / whitelisted
+	EscalatedAt   *time.Time   `json:"escalated_at,omitempty"` // 升级时间
+	Hosts         []SubnetHost `json:"hosts"`                  // 按威胁评分排序的攻击来源
+
+	hosts map[string]*SubnetHost
+}
+
+// SubnetEscalationConfig 网段升级阈值
+type SubnetEscalationConfig struct {
+	IPv4PrefixLen int `json:"ipv4_prefix_len"`
+	IPv6PrefixLen int `json:"ipv6_prefix_len"`
+	MinHosts      int `json:"min_hosts"`
+	MinScore      int `json:"min_score"`
+}
+
+// GetSubnetEscalationConfig 获取网段升级阈值
+func (s *IntelligentScanService) GetSubnetEscalationConfig() SubnetEscalationConfig {
+	cfg := s.scannerConfig()
+	return SubnetEscalationConfig{
+		IPv4PrefixLen: cfg.SubnetV4PrefixLen,
+		IPv6PrefixLen: cfg.SubnetV6PrefixLen,
+		MinHosts:      cfg.SubnetMinHosts,
+		MinScore:      cfg.SubnetMinScore,
+	}
+}
+
+// subnetKey 威胁记录所属的聚合网段，网段不大于威胁记录本身时返回空字符串
+func (s *IntelligentScanService) subnetKey(threatKey string) string {
+	prefix, err := ipset.ParsePrefix(threatKey)
+	if err != nil {
+		return ""
+	}
+
+	cfg := s.scannerConfig()
+	bits := cfg.SubnetV4PrefixLen
+	if prefix.Addr().Is6() {
+		bits = cfg.SubnetV6PrefixLen
+	}
+	if bits <= 0 || bits >= prefix.Bits() {
+		return ""
+	}
+
+	subnet, err := prefix.Addr().Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return subnet.String()
+}
+
+// trackSubnet 将威胁记录的最新状态汇总到所属网段，调用方需持有ipMutex写锁
+func (s *IntelligentScanService) trackSubnet(threat *IPThreatLevel) {
+	key := s.subnetKey(threat.IP)
+	if key == "" {
+		return
+	}
+
+	subnet, exists := s.subnetThreats[key]
+	if !exists {
+		subnet = &SubnetThreat{
+			Subnet:      key,
+			AttackTypes: []string{},
+			FirstSeen:   threat.FirstSeen,
+			LastSeen:    threat.LastSeen,
+			hosts:       make(map[string]*SubnetHost),
+		}
+		s.subnetThreats[key] = subnet
+	}
+
+	subnet.hosts[threat.IP] = &SubnetHost{
+		IP:            threat.IP,
+		ThreatScore:   threat.ThreatScore,
+		SSHAttempts:   threat.SSHAttempts,
+		NginxAttempts: threat.NginxAttempts,
+		LastSeen:      threat.LastSeen,
+	}
+
+	subnet.summarize()
+
+	if threat.FirstSeen.Before(subnet.FirstSeen) {
+		subnet.FirstSeen = threat.FirstSeen
+	}
+	if threat.LastSeen.After(subnet.LastSeen) {
+		subnet.LastSeen = threat.LastSeen
+	}
+	for _, attackType := range threat.AttackTypes {
+		if !contains(subnet.AttackTypes, attackType) {
+			subnet.AttackTypes = append(subnet.AttackTypes, attackType)
+		}
+	}
+	if subnet.Country == "" {
+		subnet.Country, subnet.ISP = threat.Country, threat.ISP
+	}
+}
+
+// summarize 重新汇总各攻击来源的计数，各来源的计数是累计值
+func (subnet *SubnetThreat) summarize() {
+	subnet.HostCount = len(subnet.hosts)
+	subnet.TotalScore, subnet.SSHAttempts, subnet.NginxAttempts = 0, 0, 0
+	for _, host := range subnet.hosts {
+		subnet.TotalScore += host.ThreatScore
+		subnet.SSHAttempts += host.SSHAttempts
+		subnet.NginxAttempts += host.NginxAttempts
+	}
+}
+
+// untrackSubnet 将威胁记录从所属网段中移除，网段内没有其他来源时删除网段记录，调用方需持有ipMutex写锁
+func (s *IntelligentScanService) untrackSubnet(threatKey string) {
+	key := s.subnetKey(threatKey)
+	subnet, exists := s.subnetThreats[key]
+	if key == "" || !exists {
+		return
+	}
+
+	delete(subnet.hosts, threatKey)
+	if len(subnet.hosts) == 0 {
+		delete(s.subnetThreats, key)
+		return
+	}
+	subnet.summarize()
+}
+
+// shouldEscalateSubnet 网段的攻击来源数量或评分之和是否达到升级阈值
+func (s *IntelligentScanService) shouldEscalateSubnet(subnet *SubnetThreat) bool {
+	cfg := s.scannerConfig()
+	if cfg.SubnetMinHosts > 0 && subnet.HostCount >= cfg.SubnetMinHosts {
+		return true
+	}
+	return cfg.SubnetMinScore > 0 && subnet.TotalScore >= cfg.SubnetMinScore
+}
+
+// subnetAsThreat 将网段记录转换为威胁记录，以便复用封禁策略、观察模式和封禁流程
+func (s *IntelligentScanService) subnetAsThreat(subnet *SubnetThreat) *IPThreatLevel {
+	score := subnet.TotalScore
+	if score > 100 {
+		score = 100
+	}
+
+	threat := &IPThreatLevel{
+		IP:            subnet.Subnet,
+		ThreatScore:   score,
+		SSHAttempts:   subnet.SSHAttempts,
+		NginxAttempts: subnet.NginxAttempts,
+		FirstSeen:     subnet.FirstSeen,
+		LastSeen:      subnet.LastSeen,
+		ThreatLevel:   s.getThreatLevelDescription(score),
+		AttackTypes:   append([]string(nil), subnet.AttackTypes...),
+		Country:       subnet.Country,
+		ISP:           subnet.ISP,
+	}
+	for ip := range subnet.hosts {
+		threat.Addresses = append(threat.Addresses, ip)
+	}
+	sort.Strings(threat.Addresses)
+	return threat
+}
+
+// subnetEscalation 加锁时选出的待升级网段，threat为网段记录转换的威胁记录副本
+type subnetEscalation struct {
+	key        string
+	threat     *IPThreatLevel
+	totalScore int
+}
+
+// escalateSubnets 将达到阈值的网段升级为网段封禁
+// 与autoProcessThreats相同，只在选出网段和标记结果时持有ipMutex
+func (s *IntelligentScanService) escalateSubnets() {
+	escalatedCount := 0
+	errorCount := 0
+
+	for _, candidate := range s.subnetEscalations() {
+		key, threat := candidate.key, candidate.threat
+		policy, action := s.resolveBanDecision(threat, PolicySubnetEscalate)
+		if policy == "" {
+			continue
+		}
+
+		// 网段中包含白名单地址时不封禁整个网段，只标记避免重复评估
+		if s.whitelistService.IsWhitelisted(key) {
+			log.Printf("[安全] 网段 %s 包含白名单地址，跳过网段封禁", key)
+			s.markSubnetEscalated(key, policy, "whitelisted")
+			continue
+		}
+
+		switch {
+		case action == GeoPolicyActionAlert:
+			if err := s.recordDecision(key, threat, policy, "subnet", GeoPolicyActionAlert); err != nil {
+				log.Printf("记录网段告警决策失败 %s: %v", key, err)
+				errorCount++
+				continue
+			}
+		case s.IsPolicyObserved(policy):
+			action = "would_ban"
+			if err := s.recordWouldBan(key, threat, policy, "subnet"); err != nil {
+				log.Printf("记录网段观察模式决策失败 %s: %v", key, err)
+				errorCount++
+				continue
+			}
+		default:
+			if err := s.autoBanIP(key, threat, policy); err != nil {
+				log.Printf("网段封禁 %s 失败: %v", key, err)
+				errorCount++
+				continue
+			}
+			log.Printf("网段 %s 升级为网段封禁: 攻击来源 %d 个, 评分之和 %d", key, len(threat.Addresses), candidate.totalScore)
+		}
+
+		s.markSubnetEscalated(key, policy, action)
+		escalatedCount++
+	}
+
+	if escalatedCount > 0 || errorCount > 0 {
+		log.Printf("网段升级处理完成: 升级 %d 个网段, 失败 %d 个", escalatedCount, errorCount)
+	}
+}
+
+// subnetEscalations 选出24小时内达到升级阈值且尚未升级的网段
+func (s *IntelligentScanService) subnetEscalations() []subnetEscalation {
+	s.ipMutex.RLock()
+	defer s.ipMutex.RUnlock()
+
+	var candidates []subnetEscalation
+	for key, subnet := range s.subnetThreats {
+		if subnet.Escalated || time.Since(subnet.LastSeen) > 24*time.Hour || !s.shouldEscalateSubnet(subnet) {
+			continue
+		}
+		candidates = append(candidates, subnetEscalation{
+			key:        key,
+			threat:     s.subnetAsThreat(subnet),
+			totalScore: subnet.TotalScore,
+		})
+	}
+	return candidates
+}
+
+// markSubnetEscalated 标记网段的升级结果，网段被封禁时其中的攻击来源同时标记为已封禁
+func (s *IntelligentScanService) markSubnetEscalated(key, policy, action string) {
+	s.ipMutex.Lock()
+	defer s.ipMutex.Unlock()
+
+	subnet, exists := s.subnetThreats[key]
+	if !exists {
+		return
+	}
+
+	now := time.Now()
+	subnet.Escalated = true
+	subnet.Policy = policy
+	subnet.Action = action
+	subnet.EscalatedAt = &now
+
+	if action != GeoPolicyActionBan {
+		return
+	}
+	// 网段内的来源已被整体封禁
+	for ip := range subnet.hosts {
+		if host, exists := s.suspiciousIPs[ip]; exists {
+			host.IsBanned = true
+			host.AutoBanned = true
+		}
+	}
+}
+
+// GetSubnetThreats 获取24小时内的网段威胁记录，按评分之和排序
+func (s *IntelligentScanService) GetSubnetThreats() []SubnetThreat {
+	s.ipMutex.RLock()
+	defer s.ipMutex.RUnlock()
+
+	subnets := make([]SubnetThreat, 0, len(s.subnetThreats))
+	for _, subnet := range s.subnetThreats {
+		if time.Since(subnet.LastSeen) > 24*time.Hour {
+			continue
+		}
+
+		clone := *subnet
+		clone.hosts = nil
+		clone.AttackTypes = append([]string(nil), subnet.AttackTypes...)
+		clone.Hosts = make([]SubnetHost, 0, len(subnet.hosts))
+		for _, host := range subnet.hosts {
+			clone.Hosts = append(clone.Hosts, *host)
+		}
+		sort.Slice(clone.Hosts, func(i, j int) bool {
+			if clone.Hosts[i].ThreatScore != clone.Hosts[j].ThreatScore {
+				return clone.Hosts[i].ThreatScore > clone.Hosts[j].ThreatScore
+			}
+			return clone.Hosts[i].IP < clone.Hosts[j].IP
+		})
+		subnets = append(subnets, clone)
+	}
+
+	sort.Slice(subnets, func(i, j int) bool {
+		if subnets[i].TotalScore != subnets[j].TotalScore {
+			return subnets[i].TotalScore > subnets[j].TotalScore
+		}
+		return subnets[i].Subnet < subnets[j].Subnet
+	})
+	return subnets
+}
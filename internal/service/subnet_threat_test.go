@@ -0,0 +1,202 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+func TestSubnetKey(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Scanner.SubnetV4PrefixLen = 24
+	cfg.Scanner.SubnetV6PrefixLen = 48
+	s := newTestScanService(t, cfg, nil)
+
+	tests := []struct {
+		threatKey string
+		want      string
+	}{
+		{"192.0.2.77", "192.0.2.0/24"},
+		{"198.51.100.1", "198.51.100.0/24"},
+		// IPv6威胁记录已按/64聚合
+		{"2001:db8:1:2::/64", "2001:db8:1::/48"},
+		{"2001:db8:1:2::1", "2001:db8:1::/48"},
+		{"192.0.2.0/28", "192.0.2.0/24"},
+		// 网段不大于威胁记录本身时不聚合
+		{"192.0.2.0/24", ""},
+		{"10.0.0.0/8", ""},
+		{"2001:db8::/32", ""},
+		{"not-an-ip", ""},
+	}
+	for _, tt := range tests {
+		if got := s.subnetKey(tt.threatKey); got != tt.want {
+			t.Errorf("subnetKey(%q) = %q, want %q", tt.threatKey, got, tt.want)
+		}
+	}
+
+	// 前缀长度为0时不聚合
+	cfg = config.Defaults()
+	cfg.Scanner.SubnetV4PrefixLen = 0
+	s = newTestScanService(t, cfg, nil)
+	if got := s.subnetKey("192.0.2.77"); got != "" {
+		t.Errorf("关闭网段聚合后 subnetKey = %q", got)
+	}
+}
+
+func TestTrackSubnet(t *testing.T) {
+	s := newTestScanService(t, nil, nil)
+	now := time.Now()
+
+	threats := []*IPThreatLevel{
+		{IP: "192.0.2.1", ThreatScore: 40, SSHAttempts: 4, FirstSeen: now.Add(-2 * time.Hour), LastSeen: now.Add(-time.Hour), AttackTypes: []string{"ssh_brute_force"}, Country: "NL"},
+		{IP: "192.0.2.2", ThreatScore: 30, NginxAttempts: 6, FirstSeen: now.Add(-3 * time.Hour), LastSeen: now, AttackTypes: []string{"sql_injection", "ssh_brute_force"}, Country: "DE"},
+		{IP: "198.51.100.1", ThreatScore: 10, SSHAttempts: 1, FirstSeen: now, LastSeen: now},
+	}
+	for _, threat := range threats {
+		s.trackSubnet(threat)
+	}
+
+	subnet := s.subnetThreats["192.0.2.0/24"]
+	if subnet == nil || len(s.subnetThreats) != 2 {
+		t.Fatalf("subnetThreats = %v", s.subnetThreats)
+	}
+	if subnet.HostCount != 2 || subnet.TotalScore != 70 || subnet.SSHAttempts != 4 || subnet.NginxAttempts != 6 {
+		t.Errorf("汇总 = {HostCount:%d TotalScore:%d SSH:%d Nginx:%d}", subnet.HostCount, subnet.TotalScore, subnet.SSHAttempts, subnet.NginxAttempts)
+	}
+	if !subnet.FirstSeen.Equal(now.Add(-3*time.Hour)) || !subnet.LastSeen.Equal(now) {
+		t.Errorf("FirstSeen = %v, LastSeen = %v", subnet.FirstSeen, subnet.LastSeen)
+	}
+	if !reflect.DeepEqual(subnet.AttackTypes, []string{"ssh_brute_force", "sql_injection"}) {
+		t.Errorf("AttackTypes = %v", subnet.AttackTypes)
+	}
+	// 网段的地理位置取第一个来源
+	if subnet.Country != "NL" {
+		t.Errorf("Country = %s, want NL", subnet.Country)
+	}
+
+	// 同一来源更新时用最新的累计值替换，不重复累加
+	updated := *threats[0]
+	updated.ThreatScore, updated.SSHAttempts = 60, 9
+	s.trackSubnet(&updated)
+	if subnet.HostCount != 2 || subnet.TotalScore != 90 || subnet.SSHAttempts != 9 {
+		t.Errorf("更新后 = {HostCount:%d TotalScore:%d SSH:%d}", subnet.HostCount, subnet.TotalScore, subnet.SSHAttempts)
+	}
+
+	// 网段威胁记录按评分之和排序，来源按评分排序
+	subnets := s.GetSubnetThreats()
+	if len(subnets) != 2 || subnets[0].Subnet != "192.0.2.0/24" || subnets[1].Subnet != "198.51.100.0/24" {
+		t.Fatalf("GetSubnetThreats() = %+v", subnets)
+	}
+	if hosts := subnets[0].Hosts; len(hosts) != 2 || hosts[0].IP != "192.0.2.1" || hosts[1].IP != "192.0.2.2" {
+		t.Errorf("Hosts = %+v", hosts)
+	}
+
+	// 移除来源后重新汇总，最后一个来源移除后删除网段
+	s.untrackSubnet("192.0.2.1")
+	if subnet.HostCount != 1 || subnet.TotalScore != 30 || subnet.SSHAttempts != 0 || subnet.NginxAttempts != 6 {
+		t.Errorf("移除后 = {HostCount:%d TotalScore:%d SSH:%d Nginx:%d}", subnet.HostCount, subnet.TotalScore, subnet.SSHAttempts, subnet.NginxAttempts)
+	}
+	s.untrackSubnet("192.0.2.2")
+	s.untrackSubnet("203.0.113.1")
+	if _, exists := s.subnetThreats["192.0.2.0/24"]; exists || len(s.subnetThreats) != 1 {
+		t.Errorf("subnetThreats = %v", s.subnetThreats)
+	}
+
+	// 不需要聚合的威胁记录不计入网段
+	s.trackSubnet(&IPThreatLevel{IP: "192.0.2.0/24", ThreatScore: 50, LastSeen: now})
+	if len(s.subnetThreats) != 1 {
+		t.Errorf("网段威胁记录被再次聚合: %v", s.subnetThreats)
+	}
+}
+
+func TestShouldEscalateSubnet(t *testing.T) {
+	tests := []struct {
+		name     string
+		minHosts int
+		minScore int
+		hosts    int
+		score    int
+		want     bool
+	}{
+		{"未达到阈值", 5, 300, 4, 299, false},
+		{"来源数量达到阈值", 5, 300, 5, 10, true},
+		{"评分之和达到阈值", 5, 300, 1, 300, true},
+		{"都达到阈值", 5, 300, 6, 400, true},
+		{"不按来源数量升级", 0, 300, 100, 299, false},
+		{"不按评分升级", 5, 0, 4, 10000, false},
+		{"关闭网段升级", 0, 0, 100, 10000, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Defaults()
+			cfg.Scanner.SubnetMinHosts = tt.minHosts
+			cfg.Scanner.SubnetMinScore = tt.minScore
+			s := newTestScanService(t, cfg, nil)
+			if got := s.shouldEscalateSubnet(&SubnetThreat{HostCount: tt.hosts, TotalScore: tt.score}); got != tt.want {
+				t.Errorf("shouldEscalateSubnet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubnetEscalations(t *testing.T) {
+	cfg := config.Defaults()
+	cfg.Scanner.SubnetMinHosts = 3
+	cfg.Scanner.SubnetMinScore = 0
+	s := newTestScanService(t, cfg, nil)
+	now := time.Now()
+
+	track := func(ip string, score int, lastSeen time.Time) {
+		threat := &IPThreatLevel{IP: ip, ThreatScore: score, FirstSeen: lastSeen, LastSeen: lastSeen}
+		s.suspiciousIPs[ip] = threat
+		s.trackSubnet(threat)
+	}
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		track(ip, 50, now)
+	}
+	// 来源不足
+	track("198.51.100.1", 90, now)
+	// 超过24小时没有活动
+	for _, ip := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.3"} {
+		track(ip, 50, now.Add(-25*time.Hour))
+	}
+
+	candidates := s.subnetEscalations()
+	if len(candidates) != 1 || candidates[0].key != "192.0.2.0/24" || candidates[0].totalScore != 150 {
+		t.Fatalf("subnetEscalations() = %+v", candidates)
+	}
+	threat := candidates[0].threat
+	if threat.IP != "192.0.2.0/24" || threat.ThreatScore != 100 ||
+		!reflect.DeepEqual(threat.Addresses, []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"}) {
+		t.Errorf("网段威胁记录 = %+v", threat)
+	}
+
+	// 观察模式只标记网段，不标记其中的来源
+	s.markSubnetEscalated("192.0.2.0/24", PolicySubnetEscalate, "would_ban")
+	subnet := s.subnetThreats["192.0.2.0/24"]
+	if !subnet.Escalated || subnet.Action != "would_ban" || subnet.Policy != PolicySubnetEscalate || subnet.EscalatedAt == nil {
+		t.Errorf("网段 = %+v", subnet)
+	}
+	if s.suspiciousIPs["192.0.2.1"].IsBanned {
+		t.Error("观察模式下来源被标记为已封禁")
+	}
+	// 已升级的网段不再参与升级
+	if candidates := s.subnetEscalations(); len(candidates) != 0 {
+		t.Errorf("已升级的网段再次成为候选: %+v", candidates)
+	}
+
+	// 网段封禁后其中的来源标记为已封禁
+	s.markSubnetEscalated("192.0.2.0/24", PolicySubnetEscalate, GeoPolicyActionBan)
+	for _, ip := range []string{"192.0.2.1", "192.0.2.2", "192.0.2.3"} {
+		if host := s.suspiciousIPs[ip]; !host.IsBanned || !host.AutoBanned {
+			t.Errorf("%s 没有标记为已封禁", ip)
+		}
+	}
+	if s.suspiciousIPs["198.51.100.1"].IsBanned {
+		t.Error("网段外的来源被标记为已封禁")
+	}
+	// 网段已不存在时忽略
+	s.markSubnetEscalated("10.0.0.0/24", PolicySubnetEscalate, GeoPolicyActionBan)
+}
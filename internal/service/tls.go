@@ -0,0 +1,247 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"fail2ban-web/config"
+)
+
+// tlsWatchInterval 检查证书文件是否变化的间隔
+const tlsWatchInterval = 10 * time.Second
+
+// TLSCertificateStatus 当前使用的服务器证书
+type TLSCertificateStatus struct {
+	Subject   string    `json:"subject"`
+	DNSNames  []string  `json:"dns_names"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	LoadedAt  time.Time `json:"loaded_at"`
+	LastError string    `json:"last_error,omitempty"` // 最近一次重新加载失败的原因，成功后清空
+}
+
+// tlsFileStamp 用于判断证书文件是否变化
+type tlsFileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// TLSService 管理HTTPS证书和客户端CA，证书文件变化时自动重新加载，
+// 加载失败时继续使用之前的证书
+type TLSService struct {
+	config config.TLSConfig
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu          sync.RWMutex
+	certificate *tls.Certificate
+	clientCAs   *x509.CertPool
+	stamps      map[string]tlsFileStamp
+	status      TLSCertificateStatus
+}
+
+// NewTLSService 创建证书管理服务，启用HTTPS时立即加载证书，证书无效时返回错误
+func NewTLSService(cfg *config.Config) (*TLSService, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &TLSService{
+		config: cfg.Server.TLS,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	if s.Enabled() {
+		if err := s.Reload(); err != nil {
+			cancel()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Enabled 是否启用HTTPS
+func (s *TLSService) Enabled() bool {
+	return s.config.Enabled()
+}
+
+// Start 定期检查证书文件，未启用HTTPS时不启动
+func (s *TLSService) Start() {
+	if !s.Enabled() {
+		return
+	}
+
+	s.wg.Add(1)
+	go s.watch()
+}
+
+// Stop 停止检查证书文件
+func (s *TLSService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// watch 证书、私钥或客户端CA文件变化时重新加载
+func (s *TLSService) watch() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(tlsWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			if !s.filesChanged() {
+				continue
+			}
+			if err := s.Reload(); err != nil {
+				log.Printf("重新加载TLS证书失败，继续使用当前证书: %v", err)
+			}
+		}
+	}
+}
+
+// files 需要监视的文件
+func (s *TLSService) files() []string {
+	files := []string{s.config.CertFile, s.config.KeyFile}
+	if s.config.ClientCAFile != "" {
+		files = append(files, s.config.ClientCAFile)
+	}
+	return files
+}
+
+// statFiles 获取各文件的修改时间和大小
+func (s *TLSService) statFiles() (map[string]tlsFileStamp, error) {
+	stamps := make(map[string]tlsFileStamp)
+	for _, path := range s.files() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		stamps[path] = tlsFileStamp{modTime: info.ModTime(), size: info.Size()}
+	}
+	return stamps, nil
+}
+
+// filesChanged 文件是否与上次加载时不同，无法访问时视为未变化（证书更新过程中文件可能暂时不存在）
+func (s *TLSService) filesChanged() bool {
+	stamps, err := s.statFiles()
+	if err != nil {
+		return false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for path, stamp := range stamps {
+		if s.stamps[path] != stamp {
+			return true
+		}
+	}
+	return false
+}
+
+// Reload 重新加载证书、私钥和客户端CA
+func (s *TLSService) Reload() error {
+	// 先记录文件状态，加载失败时不会反复尝试同一组文件
+	stamps, statErr := s.statFiles()
+
+	certificate, clientCAs, err := s.load()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if statErr == nil {
+		s.stamps = stamps
+	}
+	if err != nil {
+		s.status.LastError = err.Error()
+		return err
+	}
+
+	s.certificate = certificate
+	s.clientCAs = clientCAs
+	s.status = TLSCertificateStatus{
+		Subject:   certificate.Leaf.Subject.String(),
+		DNSNames:  certificate.Leaf.DNSNames,
+		NotBefore: certificate.Leaf.NotBefore,
+		NotAfter:  certificate.Leaf.NotAfter,
+		LoadedAt:  time.Now(),
+	}
+	log.Printf("已加载TLS证书: %s，有效期至 %s", s.status.Subject, s.status.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// load 读取并校验证书文件
+func (s *TLSService) load() (*tls.Certificate, *x509.CertPool, error) {
+	certificate, err := tls.LoadX509KeyPair(s.config.CertFile, s.config.KeyFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("加载证书 %s 失败: %w", s.config.CertFile, err)
+	}
+	if certificate.Leaf == nil {
+		leaf, err := x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return nil, nil, fmt.Errorf("解析证书 %s 失败: %w", s.config.CertFile, err)
+		}
+		certificate.Leaf = leaf
+	}
+
+	if s.config.ClientCAFile == "" {
+		return &certificate, nil, nil
+	}
+	data, err := os.ReadFile(s.config.ClientCAFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取客户端CA %s 失败: %w", s.config.ClientCAFile, err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(data) {
+		return nil, nil, fmt.Errorf("客户端CA %s 中没有有效的PEM证书", s.config.ClientCAFile)
+	}
+	return &certificate, clientCAs, nil
+}
+
+// Status 当前证书信息
+func (s *TLSService) Status() TLSCertificateStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.status
+}
+
+// ServerTLSConfig HTTPS服务器使用的TLS配置，每个连接都使用最新加载的证书和客户端CA
+func (s *TLSService) ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			s.mu.RLock()
+			defer s.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*s.certificate},
+				ClientCAs:    s.clientCAs,
+				ClientAuth:   s.clientAuthType(),
+				NextProtos:   []string{"h2", "http/1.1"},
+			}, nil
+		},
+	}
+}
+
+// clientAuthType 客户端证书校验方式
+func (s *TLSService) clientAuthType() tls.ClientAuthType {
+	switch s.config.ClientAuth {
+	case config.ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert
+	default:
+		return tls.NoClientCert
+	}
+}
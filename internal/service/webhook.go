@@ -0,0 +1,595 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// Webhook投递状态
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusFailed    = "failed"
+)
+
+// Webhook请求头
+const (
+	WebhookHeaderEvent     = "X-Fail2ban-Web-Event"
+	WebhookHeaderDelivery  = "X-Fail2ban-Web-Delivery"
+	WebhookHeaderTimestamp = "X-Fail2ban-Web-Timestamp"
+	// WebhookHeaderSignature sha256=hex(HMAC-SHA256(secret, timestamp + "." + body))
+	WebhookHeaderSignature = "X-Fail2ban-Web-Signature"
+)
+
+const (
+	webhookDispatchInterval   = 5 * time.Second
+	webhookBatchSize          = 50
+	webhookDefaultMaxAttempts = 8
+	webhookBaseBackoff        = 30 * time.Second
+	webhookMaxBackoff         = time.Hour
+	webhookTimeout            = 10 * time.Second
+	webhookDeliveryRetention  = 7 * 24 * time.Hour
+	webhookPurgeInterval      = time.Hour
+	// webhookTestTopic 测试投递使用的事件主题
+	webhookTestTopic = "test"
+)
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+// webhookTemplateFuncs 模板中可用的函数
+var webhookTemplateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// compiledWebhook 启用的Webhook及其编译后的模板
+type compiledWebhook struct {
+	endpoint model.WebhookEndpoint
+	tmpl     *template.Template
+}
+
+// WebhookService 出站Webhook通知：订阅事件总线，按模板生成请求体写入发件箱，
+// 后台投递并按指数退避重试，投递记录保留一段时间供查询
+type WebhookService struct {
+	db       *gorm.DB
+	eventBus *EventBus
+	client   *http.Client
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	wake     chan struct{}
+
+	mu        sync.RWMutex
+	endpoints map[uint]*compiledWebhook
+}
+
+// NewWebhookService 创建Webhook服务
+func NewWebhookService(db *gorm.DB, eventBus *EventBus) *WebhookService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &WebhookService{
+		db:        db,
+		eventBus:  eventBus,
+		client:    &http.Client{Timeout: webhookTimeout},
+		ctx:       ctx,
+		cancel:    cancel,
+		wake:      make(chan struct{}, 1),
+		endpoints: make(map[uint]*compiledWebhook),
+	}
+}
+
+// Start 加载Webhook配置并启动事件订阅和投递
+func (s *WebhookService) Start() error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	s.wg.Add(2)
+	go s.consume()
+	go s.dispatchLoop()
+	return nil
+}
+
+// Stop 停止事件订阅和投递，未完成的投递留在发件箱中下次启动继续
+func (s *WebhookService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// reload 重新加载并编译启用的Webhook
+func (s *WebhookService) reload() error {
+	var endpoints []model.WebhookEndpoint
+	if err := s.db.Where("enabled = ?", true).Find(&endpoints).Error; err != nil {
+		return fmt.Errorf("加载Webhook失败: %w", err)
+	}
+
+	compiled := make(map[uint]*compiledWebhook, len(endpoints))
+	for _, endpoint := range endpoints {
+		tmpl, err := parseWebhookTemplate(endpoint.Name, endpoint.Template)
+		if err != nil {
+			// 模板在保存时已校验，这里只可能是手工修改了数据库
+			log.Printf("Webhook %s 的模板无效，已跳过: %v", endpoint.Name, err)
+			continue
+		}
+		compiled[endpoint.ID] = &compiledWebhook{endpoint: endpoint, tmpl: tmpl}
+	}
+
+	s.mu.Lock()
+	s.endpoints = compiled
+	s.mu.Unlock()
+	return nil
+}
+
+// consume 订阅事件总线并将匹配的事件写入发件箱，处理过慢被断开时从最后的事件续传
+func (s *WebhookService) consume() {
+	defer s.wg.Done()
+
+	var lastID uint64
+	for {
+		sub, complete := s.eventBus.Subscribe(nil, lastID)
+		if !complete {
+			log.Printf("Webhook事件订阅续传时部分事件已丢失")
+		}
+
+		for open := true; open; {
+			select {
+			case <-s.ctx.Done():
+				sub.Close()
+				return
+			case event, ok := <-sub.Events:
+				if !ok {
+					open = false
+					break
+				}
+				lastID = event.ID
+				s.enqueue(event)
+			}
+		}
+	}
+}
+
+// enqueue 为每个匹配事件的Webhook生成请求体并写入发件箱
+func (s *WebhookService) enqueue(event Event) {
+	s.mu.RLock()
+	var matched []*compiledWebhook
+	for _, webhook := range s.endpoints {
+		if webhookMatches(webhook.endpoint.Events, event) {
+			matched = append(matched, webhook)
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, webhook := range matched {
+		delivery := newWebhookDelivery(webhook, event)
+		if err := s.db.Create(delivery).Error; err != nil {
+			log.Printf("写入Webhook %s 的发件箱失败: %v", webhook.endpoint.Name, err)
+		}
+	}
+
+	if len(matched) > 0 {
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// newWebhookDelivery 渲染请求体，模板执行失败的投递直接标记为失败
+func newWebhookDelivery(webhook *compiledWebhook, event Event) *model.WebhookDelivery {
+	delivery := &model.WebhookDelivery{
+		EndpointID:    webhook.endpoint.ID,
+		EventID:       event.ID,
+		Event:         event.Topic + "." + event.Type,
+		Status:        WebhookStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+
+	payload, err := renderWebhookPayload(webhook.tmpl, event)
+	if err != nil {
+		delivery.Status = WebhookStatusFailed
+		delivery.LastError = fmt.Sprintf("模板渲染失败: %v", err)
+		return delivery
+	}
+	delivery.Payload = payload
+	return delivery
+}
+
+// webhookMatches 事件是否匹配Webhook订阅的事件类型
+func webhookMatches(patterns []string, event Event) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == event.Topic || pattern == event.Topic+"."+event.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWebhookTemplate 编译请求体模板，模板为空时返回nil，表示发送事件JSON
+func parseWebhookTemplate(name, text string) (*template.Template, error) {
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	return template.New(name).Funcs(webhookTemplateFuncs).Option("missingkey=zero").Parse(text)
+}
+
+// renderWebhookPayload 使用模板渲染事件，模板中可以访问 .ID .Topic .Type .Time .Data
+func renderWebhookPayload(tmpl *template.Template, event Event) (string, error) {
+	if tmpl == nil {
+		data, err := json.Marshal(event)
+		return string(data), err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// dispatchLoop 定期投递到期的发件箱记录，有新事件时立即投递
+func (s *WebhookService) dispatchLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(webhookDispatchInterval)
+	defer ticker.Stop()
+
+	var lastPurge time.Time
+	for {
+		s.dispatchDue()
+
+		if time.Since(lastPurge) >= webhookPurgeInterval {
+			s.purgeDeliveries()
+			lastPurge = time.Now()
+		}
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		case <-s.wake:
+		}
+	}
+}
+
+// dispatchDue 投递到期的发件箱记录
+func (s *WebhookService) dispatchDue() {
+	for s.ctx.Err() == nil {
+		var deliveries []model.WebhookDelivery
+		if err := s.db.Where("status = ? AND next_attempt_at <= ?", WebhookStatusPending, time.Now()).
+			Order("id ASC").Limit(webhookBatchSize).Find(&deliveries).Error; err != nil {
+			log.Printf("查询Webhook发件箱失败: %v", err)
+			return
+		}
+
+		for i := range deliveries {
+			if s.ctx.Err() != nil {
+				return
+			}
+			s.mu.RLock()
+			webhook := s.endpoints[deliveries[i].EndpointID]
+			s.mu.RUnlock()
+
+			if webhook == nil {
+				// Webhook已删除或停用，不再投递
+				s.finishDelivery(&deliveries[i], 0, errors.New("webhook已删除或停用"), false)
+				continue
+			}
+			code, err := s.send(s.ctx, &webhook.endpoint, &deliveries[i])
+			s.finishDelivery(&deliveries[i], code, err, true)
+		}
+
+		if len(deliveries) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+// send 发送一次Webhook请求，返回响应状态码
+func (s *WebhookService) send(ctx context.Context, endpoint *model.WebhookEndpoint, delivery *model.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+
+	contentType := endpoint.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", "fail2ban-web-webhook")
+	for key, value := range endpoint.Headers {
+		req.Header.Set(key, value)
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(WebhookHeaderEvent, delivery.Event)
+	req.Header.Set(WebhookHeaderDelivery, strconv.FormatUint(uint64(delivery.ID), 10))
+	req.Header.Set(WebhookHeaderTimestamp, timestamp)
+	if endpoint.Secret != "" {
+		req.Header.Set(WebhookHeaderSignature, "sha256="+SignWebhookPayload(endpoint.Secret, timestamp, delivery.Payload))
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp.StatusCode, nil
+}
+
+// SignWebhookPayload 计算Webhook签名，接收方用同样的方式校验请求
+func SignWebhookPayload(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// finishDelivery 保存一次投递的结果，失败且未达到最大次数时按指数退避安排重试
+func (s *WebhookService) finishDelivery(delivery *model.WebhookDelivery, code int, err error, retry bool) {
+	delivery.Attempts++
+	delivery.ResponseCode = code
+
+	if err == nil {
+		now := time.Now()
+		delivery.Status = WebhookStatusDelivered
+		delivery.DeliveredAt = &now
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+		maxAttempts := webhookDefaultMaxAttempts
+		s.mu.RLock()
+		if webhook := s.endpoints[delivery.EndpointID]; webhook != nil && webhook.endpoint.MaxAttempts > 0 {
+			maxAttempts = webhook.endpoint.MaxAttempts
+		}
+		s.mu.RUnlock()
+
+		if retry && delivery.Attempts < maxAttempts {
+			delivery.NextAttemptAt = time.Now().Add(webhookBackoff(delivery.Attempts))
+		} else {
+			delivery.Status = WebhookStatusFailed
+			log.Printf("Webhook投递 #%d (%s) 失败: %v", delivery.ID, delivery.Event, err)
+		}
+	}
+
+	if err := s.db.Model(delivery).Select("attempts", "response_code", "status", "delivered_at", "last_error", "next_attempt_at").
+		Updates(delivery).Error; err != nil {
+		log.Printf("保存Webhook投递 #%d 结果失败: %v", delivery.ID, err)
+	}
+}
+
+// webhookBackoff 第n次失败后的重试间隔
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookBaseBackoff
+	for i := 1; i < attempts && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > webhookMaxBackoff {
+		backoff = webhookMaxBackoff
+	}
+	return backoff
+}
+
+// purgeDeliveries 删除超过保留期的已完成投递记录
+func (s *WebhookService) purgeDeliveries() {
+	if err := s.db.Where("status <> ? AND updated_at < ?", WebhookStatusPending, time.Now().Add(-webhookDeliveryRetention)).
+		Delete(&model.WebhookDelivery{}).Error; err != nil {
+		log.Printf("清理Webhook投递记录失败: %v", err)
+	}
+}
+
+// ListWebhooks 获取所有Webhook
+func (s *WebhookService) ListWebhooks() ([]model.WebhookEndpoint, error) {
+	var endpoints []model.WebhookEndpoint
+	if err := s.db.Order("id ASC").Find(&endpoints).Error; err != nil {
+		return nil, fmt.Errorf("查询Webhook失败: %w", err)
+	}
+	for i := range endpoints {
+		endpoints[i].HasSecret = endpoints[i].Secret != ""
+	}
+	return endpoints, nil
+}
+
+// GetWebhook 获取单个Webhook
+func (s *WebhookService) GetWebhook(id uint) (*model.WebhookEndpoint, error) {
+	var endpoint model.WebhookEndpoint
+	if err := s.db.First(&endpoint, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWebhookNotFound
+		}
+		return nil, fmt.Errorf("查询Webhook失败: %w", err)
+	}
+	endpoint.HasSecret = endpoint.Secret != ""
+	return &endpoint, nil
+}
+
+// CreateWebhook 创建Webhook
+func (s *WebhookService) CreateWebhook(endpoint *model.WebhookEndpoint) error {
+	if err := normalizeWebhook(endpoint); err != nil {
+		return err
+	}
+
+	endpoint.ID = 0
+	if err := s.db.Create(endpoint).Error; err != nil {
+		return fmt.Errorf("创建Webhook失败: %w", err)
+	}
+	endpoint.HasSecret = endpoint.Secret != ""
+
+	return s.reload()
+}
+
+// UpdateWebhook 更新Webhook，secret为nil时保留原有的签名密钥
+func (s *WebhookService) UpdateWebhook(id uint, endpoint *model.WebhookEndpoint, secret *string) (*model.WebhookEndpoint, error) {
+	existing, err := s.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint.Secret = existing.Secret
+	if secret != nil {
+		endpoint.Secret = *secret
+	}
+	if err := normalizeWebhook(endpoint); err != nil {
+		return nil, err
+	}
+
+	endpoint.ID = existing.ID
+	endpoint.CreatedAt = existing.CreatedAt
+	if err := s.db.Save(endpoint).Error; err != nil {
+		return nil, fmt.Errorf("更新Webhook失败: %w", err)
+	}
+	endpoint.HasSecret = endpoint.Secret != ""
+
+	return endpoint, s.reload()
+}
+
+// DeleteWebhook 删除Webhook及其投递记录
+func (s *WebhookService) DeleteWebhook(id uint) error {
+	if _, err := s.GetWebhook(id); err != nil {
+		return err
+	}
+
+	if err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("endpoint_id = ?", id).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.WebhookEndpoint{}, id).Error
+	}); err != nil {
+		return fmt.Errorf("删除Webhook失败: %w", err)
+	}
+
+	return s.reload()
+}
+
+// ListDeliveries 获取Webhook的投递记录，按时间倒序
+func (s *WebhookService) ListDeliveries(id uint, status string, limit int) ([]model.WebhookDelivery, error) {
+	if _, err := s.GetWebhook(id); err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	query := s.db.Where("endpoint_id = ?", id).Order("id DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var deliveries []model.WebhookDelivery
+	if err := query.Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("查询Webhook投递记录失败: %w", err)
+	}
+	return deliveries, nil
+}
+
+// SendTest 立即向Webhook发送一条测试事件（不论是否启用或订阅），返回投递记录
+func (s *WebhookService) SendTest(id uint) (*model.WebhookDelivery, error) {
+	endpoint, err := s.GetWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := parseWebhookTemplate(endpoint.Name, endpoint.Template)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 模板无效: %v", ErrInvalidWebhook, err)
+	}
+
+	event := Event{
+		Topic: webhookTestTopic,
+		Type:  "ping",
+		Time:  time.Now(),
+		Data: map[string]string{
+			"message": "fail2ban-web webhook test",
+			"webhook": endpoint.Name,
+		},
+	}
+	delivery := newWebhookDelivery(&compiledWebhook{endpoint: *endpoint, tmpl: tmpl}, event)
+	// 测试投递同步发送且不重试，避免后台投递再次发送
+	delivery.NextAttemptAt = time.Now().Add(webhookMaxBackoff)
+	if err := s.db.Create(delivery).Error; err != nil {
+		return nil, fmt.Errorf("保存Webhook投递记录失败: %w", err)
+	}
+	if delivery.Status == WebhookStatusFailed {
+		return delivery, nil
+	}
+
+	ctx, cancel := context.WithTimeout(s.ctx, webhookTimeout)
+	defer cancel()
+	code, sendErr := s.send(ctx, endpoint, delivery)
+	s.finishDelivery(delivery, code, sendErr, false)
+	return delivery, nil
+}
+
+// normalizeWebhook 校验并规范化Webhook字段
+func normalizeWebhook(endpoint *model.WebhookEndpoint) error {
+	endpoint.Name = strings.TrimSpace(endpoint.Name)
+	if endpoint.Name == "" {
+		return fmt.Errorf("%w: 名称不能为空", ErrInvalidWebhook)
+	}
+
+	endpoint.URL = strings.TrimSpace(endpoint.URL)
+	target, err := url.Parse(endpoint.URL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("%w: URL必须是http或https地址", ErrInvalidWebhook)
+	}
+
+	events := make([]string, 0, len(endpoint.Events))
+	seen := make(map[string]bool)
+	for _, pattern := range endpoint.Events {
+		pattern = strings.TrimSpace(pattern)
+		topic, _, _ := strings.Cut(pattern, ".")
+		if pattern != "*" && !IsEventTopic(topic) {
+			return fmt.Errorf("%w: 未知的事件类型 %s，可用的主题: %s", ErrInvalidWebhook, pattern, strings.Join(EventTopics, ", "))
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			events = append(events, pattern)
+		}
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("%w: 至少需要订阅一个事件类型", ErrInvalidWebhook)
+	}
+	endpoint.Events = events
+
+	if _, err := parseWebhookTemplate(endpoint.Name, endpoint.Template); err != nil {
+		return fmt.Errorf("%w: 模板无效: %v", ErrInvalidWebhook, err)
+	}
+	if endpoint.MaxAttempts < 0 {
+		return fmt.Errorf("%w: max_attempts不能为负数", ErrInvalidWebhook)
+	}
+	if endpoint.MaxAttempts == 0 {
+		endpoint.MaxAttempts = webhookDefaultMaxAttempts
+	}
+	return nil
+}
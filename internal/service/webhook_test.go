@@ -0,0 +1,286 @@
+package service
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fail2ban-web/internal/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB 创建内存数据库并迁移给定的模型
+func newTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("打开内存数据库失败: %v", err)
+	}
+	// 内存数据库每个连接相互独立，只使用一个连接
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := db.AutoMigrate(models...); err != nil {
+		t.Fatalf("迁移数据库失败: %v", err)
+	}
+	return db
+}
+
+func newTestWebhookService(t *testing.T) *WebhookService {
+	t.Helper()
+	s := NewWebhookService(newTestDB(t, &model.WebhookEndpoint{}, &model.WebhookDelivery{}), NewEventBus())
+	t.Cleanup(s.Stop)
+	return s
+}
+
+func TestWebhookSignatureVerifiesOnReceiver(t *testing.T) {
+	const secret = "s3cret"
+	var received atomic.Bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp := r.Header.Get(WebhookHeaderTimestamp)
+		if _, err := strconv.ParseInt(timestamp, 10, 64); err != nil {
+			t.Errorf("时间戳请求头无效: %q", timestamp)
+		}
+
+		// 接收方按文档重新计算签名
+		expected := "sha256=" + SignWebhookPayload(secret, timestamp, string(body))
+		if !hmac.Equal([]byte(expected), []byte(r.Header.Get(WebhookHeaderSignature))) {
+			t.Errorf("签名不匹配: got %q, want %q", r.Header.Get(WebhookHeaderSignature), expected)
+		}
+		if got := r.Header.Get(WebhookHeaderEvent); got != "ban.banned" {
+			t.Errorf("事件请求头 = %q, want ban.banned", got)
+		}
+		if got := r.Header.Get("X-Custom"); got != "yes" {
+			t.Errorf("附加请求头 = %q, want yes", got)
+		}
+		if got := r.Header.Get("Content-Type"); got != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", got)
+		}
+		received.Store(true)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	s := newTestWebhookService(t)
+	endpoint := &model.WebhookEndpoint{
+		Name:    "signed",
+		URL:     server.URL,
+		Secret:  secret,
+		Events:  []string{"*"},
+		Headers: map[string]string{"X-Custom": "yes"},
+		Enabled: true,
+	}
+	if err := s.CreateWebhook(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery := &model.WebhookDelivery{ID: 1, Event: "ban.banned", Payload: `{"ip":"192.0.2.1"}`}
+	code, err := s.send(s.ctx, endpoint, delivery)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("send() = %d, %v", code, err)
+	}
+	if !received.Load() {
+		t.Fatal("接收方没有收到请求")
+	}
+
+	// 篡改请求体后签名不再匹配
+	timestamp := "1700000000"
+	signature := SignWebhookPayload(secret, timestamp, delivery.Payload)
+	if signature == SignWebhookPayload(secret, timestamp, delivery.Payload+" ") {
+		t.Fatal("不同请求体的签名相同")
+	}
+	if signature == SignWebhookPayload("other", timestamp, delivery.Payload) {
+		t.Fatal("不同密钥的签名相同")
+	}
+}
+
+func TestRenderWebhookPayload(t *testing.T) {
+	event := Event{
+		ID:    42,
+		Topic: EventTopicBan,
+		Type:  "banned",
+		Time:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Data:  map[string]string{"ip": `192.0.2.1"quoted`, "jail": "sshd"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "json函数转义字符串",
+			template: `{"text":{{json .Data.ip}}}`,
+			want:     `{"text":"192.0.2.1\"quoted"}`,
+		},
+		{
+			name:     "缺失的键渲染为零值",
+			template: `[{{.Data.missing}}]`,
+			want:     `[]`,
+		},
+		{
+			name:     "字符串函数",
+			template: `{{upper .Topic}}.{{lower "BANNED"}} #{{.ID}} {{.Data.jail}}`,
+			want:     `BAN.banned #42 sshd`,
+		},
+		{
+			name:     "整个事件编码为JSON",
+			template: `{{json .}}`,
+			want:     `{"id":42,"topic":"ban","type":"banned","time":"2024-01-02T03:04:05Z","data":{"ip":"192.0.2.1\"quoted","jail":"sshd"}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseWebhookTemplate("test", tt.template)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := renderWebhookPayload(tmpl, event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("render = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// 空模板发送事件JSON
+	tmpl, err := parseWebhookTemplate("empty", "  \n")
+	if err != nil || tmpl != nil {
+		t.Fatalf("parseWebhookTemplate(空) = %v, %v", tmpl, err)
+	}
+	got, err := renderWebhookPayload(nil, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Event
+	if err := json.Unmarshal([]byte(got), &decoded); err != nil || decoded.ID != 42 || decoded.Type != "banned" {
+		t.Fatalf("默认请求体 = %s, %v", got, err)
+	}
+
+	// 访问事件上不存在的字段时渲染失败，投递直接标记为失败
+	tmpl, err = parseWebhookTemplate("broken", `{{.Missing}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery := newWebhookDelivery(&compiledWebhook{tmpl: tmpl}, event)
+	if delivery.Status != WebhookStatusFailed || !strings.Contains(delivery.LastError, "模板渲染失败") {
+		t.Fatalf("渲染失败的投递 = %s, %q", delivery.Status, delivery.LastError)
+	}
+
+	if _, err := parseWebhookTemplate("invalid", `{{.Data`); err == nil {
+		t.Fatal("语法错误的模板应该无法编译")
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{6, 16 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{20, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := webhookBackoff(tt.attempts); got != tt.want {
+			t.Errorf("webhookBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestWebhookRetriesUntilMaxAttempts(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	s := newTestWebhookService(t)
+	endpoint := &model.WebhookEndpoint{
+		Name:        "flaky",
+		URL:         server.URL,
+		Events:      []string{EventTopicBan},
+		MaxAttempts: 3,
+		Enabled:     true,
+	}
+	if err := s.CreateWebhook(endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	s.enqueue(Event{ID: 1, Topic: EventTopicBan, Type: "banned", Time: time.Now()})
+	// 未订阅的事件不写入发件箱
+	s.enqueue(Event{ID: 2, Topic: EventTopicJob, Type: "completed", Time: time.Now()})
+
+	var count int64
+	s.db.Model(&model.WebhookDelivery{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("发件箱记录数 = %d, want 1", count)
+	}
+
+	var delivery model.WebhookDelivery
+	for attempt := 1; attempt <= endpoint.MaxAttempts; attempt++ {
+		before := time.Now()
+		s.dispatchDue()
+
+		if err := s.db.First(&delivery).Error; err != nil {
+			t.Fatal(err)
+		}
+		if delivery.Attempts != attempt {
+			t.Fatalf("第%d次投递后 Attempts = %d", attempt, delivery.Attempts)
+		}
+		if delivery.ResponseCode != http.StatusServiceUnavailable || !strings.Contains(delivery.LastError, "HTTP 503") {
+			t.Fatalf("第%d次投递结果 = %d, %q", attempt, delivery.ResponseCode, delivery.LastError)
+		}
+
+		if attempt < endpoint.MaxAttempts {
+			if delivery.Status != WebhookStatusPending {
+				t.Fatalf("第%d次投递后状态 = %s, want pending", attempt, delivery.Status)
+			}
+			wait := delivery.NextAttemptAt.Sub(before)
+			if backoff := webhookBackoff(attempt); wait < backoff || wait > backoff+5*time.Second {
+				t.Fatalf("第%d次投递后的重试间隔 = %v, want %v", attempt, wait, backoff)
+			}
+
+			// 未到重试时间时不会再次投递
+			s.dispatchDue()
+			if got := requests.Load(); got != int32(attempt) {
+				t.Fatalf("未到重试时间时发送了请求: %d", got)
+			}
+			s.db.Model(&delivery).Update("next_attempt_at", time.Now().Add(-time.Second))
+			continue
+		}
+
+		if delivery.Status != WebhookStatusFailed {
+			t.Fatalf("达到最大次数后状态 = %s, want failed", delivery.Status)
+		}
+	}
+
+	// 失败的投递不再重试
+	s.dispatchDue()
+	if got := requests.Load(); got != int32(endpoint.MaxAttempts) {
+		t.Fatalf("请求次数 = %d, want %d", got, endpoint.MaxAttempts)
+	}
+}
@@ -1,124 +1,563 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"net"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"fail2ban-web/internal/ipset"
+	"fail2ban-web/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 白名单条目类型
+const (
+	WhitelistTypeIP       = "ip"
+	WhitelistTypeCIDR     = "cidr"
+	WhitelistTypeHostname = "hostname"
+	WhitelistTypeBuiltin  = "builtin" // 内置的本地和内网地址，不可删除
+	WhitelistTypeList     = "list"    // 导入的允许列表
+
+	whitelistRefreshInterval = 5 * time.Minute
+	whitelistResolveTimeout  = 5 * time.Second
 )
 
+var (
+	ErrWhitelistEntryNotFound = errors.New("whitelist entry not found")
+	ErrInvalidWhitelistEntry  = errors.New("invalid whitelist entry")
+	ErrIPWhitelisted          = errors.New("ip is whitelisted")
+
+	hostnamePattern = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?\.)*[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+)
+
+// builtinWhitelist 内置白名单，本地和内网地址永远不会被封禁
+var builtinWhitelist = []string{
+	"127.0.0.0/8",
+	"10.0.0.0/8",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"169.254.0.0/16", // 链路本地地址
+	"::1/128",        // IPv6 localhost
+	"fc00::/7",       // IPv6 ULA
+	"fe80::/10",      // IPv6 链路本地
+}
+
 // WhitelistService IP白名单服务
+// 条目保存在数据库中，内存中编译为前缀树；主机名定期解析，
+// 所有条目同步到每个jail的ignoreip，导入的允许列表只在本系统中生效
 type WhitelistService struct {
-	whitelistIPs   []string
-	whitelistCIDRs []*net.IPNet
+	db              *gorm.DB
+	fail2banService *Fail2BanService
+	ipListService   *IPListService
+
+	mu    sync.RWMutex
+	table *ipset.Table[*model.WhitelistEntry]
+
+	syncMu sync.Mutex
+	synced map[string]map[string]bool // 每个jail中由本服务添加到ignoreip的地址，持久化在数据库中
+
+	syncCh chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 // NewWhitelistService 创建白名单服务
-func NewWhitelistService() *WhitelistService {
-	service := &WhitelistService{
-		whitelistIPs: []string{
-			"127.0.0.1",
-			"::1",
-		},
-	}
-	
-	// 添加常见的内网CIDR
-	privateCIDRs := []string{
-		"10.0.0.0/8",
-		"172.16.0.0/12", 
-		"192.168.0.0/16",
-		"169.254.0.0/16", // 链路本地地址
-		"::1/128",        // IPv6 localhost
-		"fc00::/7",       // IPv6 ULA
-		"fe80::/10",      // IPv6 链路本地
-	}
-	
-	for _, cidr := range privateCIDRs {
-		_, network, err := net.ParseCIDR(cidr)
-		if err == nil {
-			service.whitelistCIDRs = append(service.whitelistCIDRs, network)
-		}
-	}
-	
-	return service
+func NewWhitelistService(db *gorm.DB, fail2banService *Fail2BanService, ipListService *IPListService) *WhitelistService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &WhitelistService{
+		db:              db,
+		fail2banService: fail2banService,
+		ipListService:   ipListService,
+		synced:          make(map[string]map[string]bool),
+		syncCh:          make(chan struct{}, 1),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+	s.compile(nil)
+
+	return s
 }
 
-// IsWhitelisted 检查IP是否在白名单中
-func (w *WhitelistService) IsWhitelisted(ipStr string) bool {
-	// 检查精确匹配
-	for _, whiteIP := range w.whitelistIPs {
-		if ipStr == whiteIP {
-			return true
+// Start 加载白名单并启动定期刷新，需要在数据库迁移完成后调用
+func (s *WhitelistService) Start() error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+	if err := s.loadSynced(); err != nil {
+		return err
+	}
+
+	s.wg.Add(1)
+	go s.run()
+	return nil
+}
+
+// Stop 停止定期刷新
+func (s *WhitelistService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// run 定期清理过期条目、解析主机名并同步ignoreip，条目变化时立即同步
+func (s *WhitelistService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(whitelistRefreshInterval)
+	defer ticker.Stop()
+
+	s.refresh()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.refresh()
+		case <-s.syncCh:
+			s.syncIgnoreIPs()
 		}
 	}
-	
-	// 检查CIDR匹配
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false
+}
+
+// refresh 执行一次完整的刷新
+func (s *WhitelistService) refresh() {
+	if err := s.purgeExpired(); err != nil {
+		log.Printf("清理过期白名单失败: %v", err)
+	}
+	if err := s.resolveHostnames(); err != nil {
+		log.Printf("解析白名单主机名失败: %v", err)
+	}
+	if err := s.reload(); err != nil {
+		log.Printf("加载白名单失败: %v", err)
+	}
+	s.syncIgnoreIPs()
+}
+
+// requestSync 请求后台同步ignoreip
+func (s *WhitelistService) requestSync() {
+	select {
+	case s.syncCh <- struct{}{}:
+	default:
+	}
+}
+
+// reload 从数据库重新加载未过期的条目
+func (s *WhitelistService) reload() error {
+	var entries []model.WhitelistEntry
+	if err := s.db.Where("expires_at IS NULL OR expires_at > ?", time.Now()).Find(&entries).Error; err != nil {
+		return fmt.Errorf("加载白名单失败: %w", err)
+	}
+
+	s.compile(entries)
+	return nil
+}
+
+// compile 生成内存中的前缀树
+func (s *WhitelistService) compile(entries []model.WhitelistEntry) {
+	table := &ipset.Table[*model.WhitelistEntry]{}
+
+	for _, cidr := range builtinWhitelist {
+		table.Insert(netip.MustParsePrefix(cidr), &model.WhitelistEntry{Type: WhitelistTypeBuiltin, Value: cidr})
 	}
-	
-	for _, network := range w.whitelistCIDRs {
-		if network.Contains(ip) {
-			return true
+
+	for i := range entries {
+		entry := &entries[i]
+		var values []string
+		switch entry.Type {
+		case WhitelistTypeIP, WhitelistTypeCIDR:
+			values = []string{entry.Value}
+		case WhitelistTypeHostname:
+			values = entry.ResolvedIPs
+		}
+		for _, value := range values {
+			if prefixes, err := ipset.ParseEntry(value); err == nil {
+				table.Insert(prefixes[0], entry)
+			}
 		}
 	}
-	
-	return false
+
+	s.mu.Lock()
+	s.table = table
+	s.mu.Unlock()
 }
 
-// AddIP 添加IP到白名单
-func (w *WhitelistService) AddIP(ipStr string) error {
-	if net.ParseIP(ipStr) == nil {
-		return fmt.Errorf("invalid IP address: %s", ipStr)
+// Match 返回命中IP的白名单条目，未命中返回nil
+// 参数为网段时，只要与白名单条目有重叠即视为命中，避免封禁网段时误伤白名单地址
+// 命中导入的允许列表时返回类型为list的条目
+func (s *WhitelistService) Match(ipStr string) *model.WhitelistEntry {
+	prefix, err := ipset.ParsePrefix(ipStr)
+	if err != nil {
+		return nil
+	}
+
+	s.mu.RLock()
+	_, entry, ok := s.table.Overlaps(prefix)
+	s.mu.RUnlock()
+
+	if ok && !whitelistEntryExpired(entry, time.Now()) {
+		return entry
 	}
-	
-	// 检查是否已存在
-	for _, existingIP := range w.whitelistIPs {
-		if existingIP == ipStr {
-			return nil // 已存在
+
+	if s.ipListService != nil {
+		if match := s.ipListService.MatchAllow(ipStr); match != nil {
+			return &model.WhitelistEntry{
+				Type:    WhitelistTypeList,
+				Value:   match.Prefix,
+				Comment: "IP列表 " + match.List,
+			}
 		}
 	}
-	
-	w.whitelistIPs = append(w.whitelistIPs, ipStr)
+
 	return nil
 }
 
-// AddCIDR 添加CIDR到白名单
-func (w *WhitelistService) AddCIDR(cidrStr string) error {
-	_, network, err := net.ParseCIDR(cidrStr)
+// IsWhitelisted 检查IP是否在白名单中
+func (s *WhitelistService) IsWhitelisted(ipStr string) bool {
+	return s.Match(ipStr) != nil
+}
+
+func whitelistEntryExpired(entry *model.WhitelistEntry, now time.Time) bool {
+	return entry.ExpiresAt != nil && !entry.ExpiresAt.After(now)
+}
+
+// ListEntries 获取所有白名单条目，includeBuiltin为true时包含内置网段
+func (s *WhitelistService) ListEntries(includeBuiltin bool) ([]model.WhitelistEntry, error) {
+	var entries []model.WhitelistEntry
+	if err := s.db.Order("id ASC").Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("查询白名单失败: %w", err)
+	}
+
+	if includeBuiltin {
+		builtin := make([]model.WhitelistEntry, 0, len(builtinWhitelist))
+		for _, cidr := range builtinWhitelist {
+			builtin = append(builtin, model.WhitelistEntry{
+				Type:    WhitelistTypeBuiltin,
+				Value:   cidr,
+				Comment: "内置本地/内网地址",
+			})
+		}
+		entries = append(builtin, entries...)
+	}
+
+	return entries, nil
+}
+
+// GetEntry 获取单个白名单条目
+func (s *WhitelistService) GetEntry(id uint) (*model.WhitelistEntry, error) {
+	var entry model.WhitelistEntry
+	if err := s.db.First(&entry, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrWhitelistEntryNotFound
+		}
+		return nil, fmt.Errorf("查询白名单失败: %w", err)
+	}
+	return &entry, nil
+}
+
+// CreateEntry 添加白名单条目，主机名会立即解析一次
+func (s *WhitelistService) CreateEntry(entry *model.WhitelistEntry) error {
+	if err := normalizeWhitelistEntry(entry); err != nil {
+		return err
+	}
+	if entry.ExpiresAt != nil && !entry.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("%w: 过期时间必须晚于当前时间", ErrInvalidWhitelistEntry)
+	}
+
+	var count int64
+	if err := s.db.Model(&model.WhitelistEntry{}).Where("value = ?", entry.Value).Count(&count).Error; err != nil {
+		return fmt.Errorf("查询白名单失败: %w", err)
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s 已在白名单中", ErrInvalidWhitelistEntry, entry.Value)
+	}
+
+	if entry.Type == WhitelistTypeHostname {
+		s.resolveEntry(entry)
+	}
+
+	entry.ID = 0
+	if err := s.db.Create(entry).Error; err != nil {
+		return fmt.Errorf("添加白名单失败: %w", err)
+	}
+
+	log.Printf("已添加白名单 %s (%s), 操作人: %s", entry.Value, entry.Type, entry.CreatedBy)
+	return s.reloadAndSync()
+}
+
+// UpdateEntry 更新白名单条目的备注和过期时间
+func (s *WhitelistService) UpdateEntry(id uint, comment string, expiresAt *time.Time) (*model.WhitelistEntry, error) {
+	entry, err := s.GetEntry(id)
+	if err != nil {
+		return nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, fmt.Errorf("%w: 过期时间必须晚于当前时间", ErrInvalidWhitelistEntry)
+	}
+
+	entry.Comment = comment
+	entry.ExpiresAt = expiresAt
+	if err := s.db.Model(entry).Select("comment", "expires_at").Updates(entry).Error; err != nil {
+		return nil, fmt.Errorf("更新白名单失败: %w", err)
+	}
+
+	return entry, s.reloadAndSync()
+}
+
+// DeleteEntry 删除白名单条目
+func (s *WhitelistService) DeleteEntry(id uint) error {
+	entry, err := s.GetEntry(id)
 	if err != nil {
-		return fmt.Errorf("invalid CIDR: %s", cidrStr)
+		return err
 	}
-	
-	// 检查是否已存在
-	for _, existingNetwork := range w.whitelistCIDRs {
-		if existingNetwork.String() == network.String() {
-			return nil // 已存在
+
+	if err := s.db.Delete(&model.WhitelistEntry{}, id).Error; err != nil {
+		return fmt.Errorf("删除白名单失败: %w", err)
+	}
+
+	log.Printf("已删除白名单 %s (%s)", entry.Value, entry.Type)
+	return s.reloadAndSync()
+}
+
+// reloadAndSync 重新加载匹配表并在后台同步ignoreip
+func (s *WhitelistService) reloadAndSync() error {
+	if err := s.reload(); err != nil {
+		return err
+	}
+	s.requestSync()
+	return nil
+}
+
+// normalizeWhitelistEntry 识别条目类型并规范化值
+func normalizeWhitelistEntry(entry *model.WhitelistEntry) error {
+	value := strings.TrimSpace(entry.Value)
+	entryType := strings.ToLower(strings.TrimSpace(entry.Type))
+
+	var detected string
+	if ip := net.ParseIP(value); ip != nil {
+		detected = WhitelistTypeIP
+		value = ip.String()
+	} else if _, network, err := net.ParseCIDR(value); err == nil {
+		detected = WhitelistTypeCIDR
+		value = network.String()
+	} else if hostnamePattern.MatchString(value) && len(value) <= 253 {
+		detected = WhitelistTypeHostname
+		value = strings.ToLower(value)
+	} else {
+		return fmt.Errorf("%w: %s 不是有效的IP、CIDR或主机名", ErrInvalidWhitelistEntry, entry.Value)
+	}
+
+	if entryType != "" && entryType != detected {
+		return fmt.Errorf("%w: %s 的类型应为 %s", ErrInvalidWhitelistEntry, value, detected)
+	}
+
+	entry.Type = detected
+	entry.Value = value
+	entry.Comment = strings.TrimSpace(entry.Comment)
+	return nil
+}
+
+// purgeExpired 删除已过期的条目
+func (s *WhitelistService) purgeExpired() error {
+	result := s.db.Where("expires_at IS NOT NULL AND expires_at <= ?", time.Now()).Delete(&model.WhitelistEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("已清理 %d 条过期白名单", result.RowsAffected)
+	}
+	return nil
+}
+
+// resolveHostnames 重新解析所有主机名条目
+func (s *WhitelistService) resolveHostnames() error {
+	var entries []model.WhitelistEntry
+	if err := s.db.Where("type = ?", WhitelistTypeHostname).Find(&entries).Error; err != nil {
+		return err
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		s.resolveEntry(entry)
+		if err := s.db.Model(entry).Select("resolved_ips", "resolved_at", "resolve_error").Updates(entry).Error; err != nil {
+			return err
 		}
 	}
-	
-	w.whitelistCIDRs = append(w.whitelistCIDRs, network)
 	return nil
 }
 
-// RemoveIP 从白名单移除IP
-func (w *WhitelistService) RemoveIP(ipStr string) {
-	for i, ip := range w.whitelistIPs {
-		if ip == ipStr {
-			w.whitelistIPs = append(w.whitelistIPs[:i], w.whitelistIPs[i+1:]...)
-			break
+// resolveEntry 解析主机名，失败时保留上一次的解析结果
+func (s *WhitelistService) resolveEntry(entry *model.WhitelistEntry) {
+	ctx, cancel := context.WithTimeout(s.ctx, whitelistResolveTimeout)
+	defer cancel()
+
+	now := time.Now()
+	entry.ResolvedAt = &now
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, entry.Value)
+	if err != nil {
+		entry.ResolveError = err.Error()
+		log.Printf("解析白名单主机名 %s 失败: %v", entry.Value, err)
+		return
+	}
+
+	ips := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP.String())
+	}
+	sort.Strings(ips)
+
+	entry.ResolvedIPs = ips
+	entry.ResolveError = ""
+}
+
+// ignoreIPValues 需要同步到ignoreip的地址，不包含内置网段
+func (s *WhitelistService) ignoreIPValues() map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	values := make(map[string]bool)
+	s.table.Walk(func(prefix netip.Prefix, entry *model.WhitelistEntry) bool {
+		if entry.Type != WhitelistTypeBuiltin && !whitelistEntryExpired(entry, now) {
+			if prefix.IsSingleIP() {
+				values[prefix.Addr().String()] = true
+			} else {
+				values[prefix.String()] = true
+			}
+		}
+		return true
+	})
+	return values
+}
+
+// loadSynced 加载之前添加到ignoreip的地址，重启后仍能移除已删除的白名单
+func (s *WhitelistService) loadSynced() error {
+	var records []model.WhitelistIgnoreIP
+	if err := s.db.Find(&records).Error; err != nil {
+		return fmt.Errorf("加载ignoreip同步记录失败: %w", err)
+	}
+
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	s.synced = make(map[string]map[string]bool)
+	for _, record := range records {
+		if s.synced[record.Jail] == nil {
+			s.synced[record.Jail] = make(map[string]bool)
+		}
+		s.synced[record.Jail][record.Value] = true
+	}
+	return nil
+}
+
+// setSynced 记录或取消jail中某个ignoreip地址由本服务添加，需要持有syncMu
+func (s *WhitelistService) setSynced(jail, value string, owned bool) {
+	record := model.WhitelistIgnoreIP{Jail: jail, Value: value}
+	var err error
+	if owned {
+		err = s.db.Where(&record).FirstOrCreate(&record).Error
+	} else {
+		err = s.db.Where(&record).Delete(&model.WhitelistIgnoreIP{}).Error
+	}
+	if err != nil {
+		log.Printf("保存jail %s 的ignoreip同步记录 %s 失败: %v", jail, value, err)
+	}
+
+	if owned {
+		if s.synced[jail] == nil {
+			s.synced[jail] = make(map[string]bool)
 		}
+		s.synced[jail][value] = true
+		return
+	}
+	delete(s.synced[jail], value)
+	if len(s.synced[jail]) == 0 {
+		delete(s.synced, jail)
 	}
 }
 
-// GetWhitelist 获取白名单列表
-func (w *WhitelistService) GetWhitelist() map[string]interface{} {
-	cidrs := make([]string, len(w.whitelistCIDRs))
-	for i, network := range w.whitelistCIDRs {
-		cidrs[i] = network.String()
+// syncIgnoreIPs 将白名单同步到每个jail的ignoreip
+// 只移除由本服务添加的地址，jail配置中原有的ignoreip保持不变
+func (s *WhitelistService) syncIgnoreIPs() {
+	if s.fail2banService == nil {
+		return
 	}
-	
-	return map[string]interface{}{
-		"ips":   w.whitelistIPs,
-		"cidrs": cidrs,
+
+	s.syncMu.Lock()
+	defer s.syncMu.Unlock()
+
+	jails, err := s.fail2banService.GetJails()
+	if err != nil {
+		log.Printf("同步白名单到ignoreip失败: %v", err)
+		return
 	}
-}
\ No newline at end of file
+
+	desired := s.ignoreIPValues()
+	running := make(map[string]bool, len(jails))
+	added, removed := 0, 0
+	for _, jail := range jails {
+		running[jail] = true
+		current, err := s.fail2banService.GetIgnoreIPs(jail)
+		if err != nil {
+			log.Printf("获取jail %s 的ignoreip失败: %v", jail, err)
+			continue
+		}
+		existing := make(map[string]bool, len(current))
+		for _, ip := range current {
+			existing[ip] = true
+		}
+
+		owned := s.synced[jail]
+		for value := range desired {
+			if existing[value] {
+				// jail配置中原有的地址不记为本服务添加
+				continue
+			}
+			if err := s.fail2banService.AddIgnoreIP(jail, value); err != nil {
+				log.Printf("添加 %s 到jail %s 的ignoreip失败: %v", value, jail, err)
+				continue
+			}
+			added++
+			if !owned[value] {
+				s.setSynced(jail, value, true)
+			}
+		}
+		for value := range owned {
+			if desired[value] {
+				continue
+			}
+			if existing[value] {
+				if err := s.fail2banService.DelIgnoreIP(jail, value); err != nil {
+					log.Printf("从jail %s 的ignoreip移除 %s 失败: %v", jail, value, err)
+					continue
+				}
+				removed++
+			}
+			s.setSynced(jail, value, false)
+		}
+	}
+
+	// 未运行的jail重新启动时ignoreip恢复为配置中的值，不再需要移除
+	for jail, owned := range s.synced {
+		if running[jail] {
+			continue
+		}
+		for value := range owned {
+			s.setSynced(jail, value, false)
+		}
+	}
+
+	if added > 0 || removed > 0 {
+		log.Printf("白名单已同步到 %d 个jail的ignoreip: 添加 %d, 移除 %d", len(jails), added, removed)
+	}
+}
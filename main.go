@@ -2,15 +2,46 @@ package main
 
 import (
 	"embed"
+	"flag"
+	"fmt"
+	"os"
 
 	"fail2ban-web/app"
+	"fail2ban-web/config"
 )
 
 //go:embed web
 var staticFiles embed.FS
 
 func main() {
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML配置文件路径，环境变量优先于配置文件")
+	printConfig := flag.Bool("print-config", false, "校验并打印生效的配置（隐藏密码和密钥）后退出")
+	flag.Parse()
+
+	if *printConfig {
+		if err := printEffectiveConfig(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 创建并启动 fx 应用
-	fxApp := app.NewApp(staticFiles)
+	fxApp := app.NewApp(staticFiles, *configPath)
 	fxApp.Run()
 }
+
+// printEffectiveConfig 加载并校验配置，以YAML格式输出到标准输出
+func printEffectiveConfig(path string) error {
+	cfg, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := cfg.Redacted().YAML()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}